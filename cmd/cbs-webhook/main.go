@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/driver/cbs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	listen      = flag.String("listen", ":8443", "webhook listen address")
+	tlsCertFile = flag.String("tls_cert_file", "/etc/webhook/certs/tls.crt", "webhook tls certificate")
+	tlsKeyFile  = flag.String("tls_key_file", "/etc/webhook/certs/tls.key", "webhook tls private key")
+
+	// must match the flags of the controller, parameters are validated the way it parses them
+	defaultDiskType        = flag.String("default_disk_type", cbs.DiskTypeDefault, "disk type used when storage class does not specify one")
+	defaultDiskChargeType  = flag.String("default_disk_charge_type", cbs.DiskChargeTypeDefault, "disk charge type used when storage class does not specify one")
+	pvcAnnotationOverrides = flag.Bool("pvc_annotation_overrides", false, "allow pvc annotations to override diskType and tags")
+)
+
+func main() {
+	flag.Parse()
+	defer logging.Flush()
+
+	kubeClient, err := kube.NewInClusterClient()
+	if err != nil {
+		logging.Warningf("kubernetes client not available, pvcs will not be validated: %v", err)
+		kubeClient = nil
+	}
+
+	config := cbs.DefaultConfig()
+	config.DiskType = *defaultDiskType
+	config.DiskChargeType = *defaultDiskChargeType
+	config.PVCAnnotationOverrides = *pvcAnnotationOverrides
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", cbs.NewWebhookHandler(kubeClient, config))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	logging.Infof("webhook listening on %s", *listen)
+
+	if err := http.ListenAndServeTLS(*listen, *tlsCertFile, *tlsKeyFile, mux); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -6,15 +6,19 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 
 	"github.com/dbdd4us/qcloudapi-sdk-go/metadata"
-	"github.com/golang/glog"
 	"github.com/tencentcloud/kubernetes-csi-tencentcloud/driver/cbs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
 )
 
 const (
 	TENCENTCLOUD_CBS_API_SECRET_ID  = "TENCENTCLOUD_CBS_API_SECRET_ID"
 	TENCENTCLOUD_CBS_API_SECRET_KEY = "TENCENTCLOUD_CBS_API_SECRET_KEY"
+
+	TENCENTCLOUD_CBS_API_SECONDARY_SECRET_ID  = "TENCENTCLOUD_CBS_API_SECONDARY_SECRET_ID"
+	TENCENTCLOUD_CBS_API_SECONDARY_SECRET_KEY = "TENCENTCLOUD_CBS_API_SECONDARY_SECRET_KEY"
 )
 
 var (
@@ -23,25 +27,78 @@ var (
 	secretKey = flag.String("secret_key", "", "tencent cloud api secret key")
 	region    = flag.String("region", "", "tencent cloud api region")
 	zone      = flag.String("zone", "", "cvm instance region")
+	config    = flag.String("config", "", "path of the driver config file, reloaded on change")
+
+	secondarySecretId  = flag.String("secondary_secret_id", "", "tencent cloud api secret id used when the primary one is rejected")
+	secondarySecretKey = flag.String("secondary_secret_key", "", "tencent cloud api secret key used when the primary one is rejected")
+
+	defaultDiskType       = flag.String("default_disk_type", cbs.DiskTypeDefault, "disk type used when storage class does not specify one")
+	defaultDiskChargeType = flag.String("default_disk_charge_type", cbs.DiskChargeTypeDefault, "disk charge type used when storage class does not specify one")
+	defaultFsType         = flag.String("default_fs_type", cbs.FsTypeDefault, "filesystem used when volume does not specify one")
+
+	deviceWaitTimeout  = flag.Duration("device_wait_timeout", cbs.DefaultConfig().DeviceWaitTimeout, "how long the node waits for the device of an attached disk to appear")
+	deviceWaitInterval = flag.Duration("device_wait_interval", cbs.DefaultConfig().DeviceWaitInterval, "first interval between two device checks, doubled after every check")
+
+	volumeHealthCheckInterval = flag.Duration("volume_health_check_interval", cbs.DefaultConfig().VolumeHealthCheckInterval, "interval between two checks of staged volumes for read only remounts")
+	fstrimInterval            = flag.Duration("fstrim_interval", cbs.DefaultConfig().FstrimInterval, "interval between two fstrim runs of volumes with discard set to fstrim")
+
+	stateFile          = flag.String("state_file", "", "file the node plugin keeps its staged volumes in, restored after a restart")
+	probeCloudInterval = flag.Duration("probe_cloud_interval", 0, "interval between two cloud api reachability and credential checks made by Probe, 0 disables the check")
+	socketMode         = flag.String("socket_mode", "", "octal mode of the endpoint socket, e.g. 0660, empty keeps the umask default")
+	socketOwner        = flag.String("socket_owner", "", "numeric uid:gid of the endpoint socket, either may be empty to keep it")
+	tlsCertFile        = flag.String("tls_cert_file", "", "server certificate of a tcp:// endpoint")
+	tlsKeyFile         = flag.String("tls_key_file", "", "server private key of a tcp:// endpoint")
+	tlsClientCAFile    = flag.String("tls_client_ca_file", "", "ca certificates of a tcp:// endpoint that clients must present a certificate signed by, required unless the endpoint listens on loopback")
+	shutdownTimeout    = flag.Duration("shutdown_timeout", cbs.DefaultConfig().ShutdownTimeout, "how long rpcs in flight, e.g. creating or attaching a disk, may take to finish after SIGTERM")
+	leaderElection     = flag.Bool("leader_election", false, "only let the controller replica holding the lease in POD_NAMESPACE change disks, required for more than one controller replica")
+	diskInfo           = flag.Bool("disk_info", false, "keep a DiskInfo resource with the cloud state of the disk of every bound persistent volume, requires the DiskInfo crd")
+	snapshotSchedules  = flag.Bool("snapshot_schedules", false, "take the snapshots of the VolumeSnapshotSchedule resources when they are due, requires the VolumeSnapshotSchedule crd")
+	volumeRollbacks    = flag.Bool("volume_rollbacks", false, "roll the disks of the VolumeRollback resources back to their snapshots, requires the VolumeRollback crd")
+	volumeMigrations   = flag.Bool("volume_migrations", false, "migrate the volumes of pods which can not be scheduled because their disks are in another zone through a snapshot, enable on the controller only")
+	volumeFreeze       = flag.Bool("volume_freeze", false, "freeze the filesystems of staged volumes as asked by the VolumeFreeze resources of the instance, enable on the nodes, requires the VolumeFreeze crd")
+	quotaMetrics       = flag.Duration("quota_metrics_interval", 0, "interval between two updates of the disk usage metrics of the zones of the region, 0 disables them, enable on the controller only")
+	snapshotMetrics    = flag.Duration("snapshot_metrics_interval", 0, "interval between two updates of the size and cost metrics of the snapshots of the region, 0 disables them, enable on the controller only")
+	snapshotVerify     = flag.Duration("snapshot_verify_interval", 0, "interval between two test restores of a sampled recent snapshot onto a disk which is deleted again, 0 disables them, enable on the controller only")
+	rpcTimeouts        = flag.String("rpc_timeouts", "", "server side deadlines of csi rpcs, e.g. CreateVolume=5m,ControllerPublishVolume=3m,DeleteVolume=1m")
+	maxInflight        = flag.Int("max_inflight_requests", 0, "maximum number of controller and node rpcs in flight, further rpcs fail with RESOURCE_EXHAUSTED, 0 means no limit")
+	maxVolumesPerNode  = flag.Int64("max_volumes_per_node", 0, "maximum number of volumes attached to a node, reported in NodeGetInfo, 0 means no limit")
+
+	version         = flag.Bool("version", false, "print the driver version and build information and exit")
+	logFormat       = flag.String("log_format", "text", "format of the log entries written to stderr, text or json")
+	grpcReflection  = flag.Bool("grpc_reflection", false, "serve the grpc reflection service so grpcurl can call the csi services")
+	grpcLogLevel    = flag.Int("grpc_log_level", 0, "log verbosity at which csi rpcs are logged, failed rpcs are always logged")
+	healthAddress   = flag.String("health_address", "", "address to serve /healthz and /readyz at for kubernetes probes, e.g. :9808, disabled if empty")
+	pprofAddress    = flag.String("pprof_address", "", "address to serve pprof at, e.g. localhost:6060, disabled if empty")
+	tracingEndpoint = flag.String("tracing_endpoint", "", "opentelemetry collector otlp http endpoint, e.g. http://otel-collector:4318, tracing is disabled if empty")
+	auditLogFile    = flag.String("audit_log_file", "", "file a json line is appended to for every cloud api call which changes disks, disabled if empty")
+	metricsAddress  = flag.String("metrics_address", "", "address to serve prometheus metrics at, e.g. :9199, disabled if empty")
+
+	pvcAnnotationOverrides = flag.Bool("pvc_annotation_overrides", false, "allow pvc annotations to override diskType and tags, requires external-provisioner with --extra-create-metadata")
 )
 
 func main() {
 	flag.Parse()
-	defer glog.Flush()
+	defer logging.Flush()
+
+	if *version {
+		info := cbs.VersionInfo()
+		fmt.Printf("%s %s, git commit %s, built %s with %s\n", cbs.DriverName, info["version"], info["gitCommit"], info["buildDate"], info["goVersion"])
+		return
+	}
 
 	metadataClient := metadata.NewMetaData(http.DefaultClient)
 
 	if *region == "" {
 		r, err := metadataClient.Region()
 		if err != nil {
-			glog.Fatal(err)
+			logging.Fatal(err)
 		}
 		region = &r
 	}
 	if *zone == "" {
 		z, err := metadataClient.Zone()
 		if err != nil {
-			glog.Fatal(err)
+			logging.Fatal(err)
 		}
 		zone = &z
 	}
@@ -58,25 +115,115 @@ func main() {
 	}
 
 	if *secretId == "" || *secretKey == "" {
-		glog.Fatal("tencent cloud credential must be specified")
+		logging.Fatal("tencent cloud credential must be specified")
+	}
+
+	credentials := []cbs.Credential{{SecretId: *secretId, SecretKey: *secretKey}}
+
+	if *secondarySecretId == "" {
+		*secondarySecretId = os.Getenv(TENCENTCLOUD_CBS_API_SECONDARY_SECRET_ID)
+	}
+	if *secondarySecretKey == "" {
+		*secondarySecretKey = os.Getenv(TENCENTCLOUD_CBS_API_SECONDARY_SECRET_KEY)
+	}
+
+	if *secondarySecretId != "" && *secondarySecretKey != "" {
+		credentials = append(credentials, cbs.Credential{SecretId: *secondarySecretId, SecretKey: *secondarySecretKey})
+	} else if *secondarySecretId != "" || *secondarySecretKey != "" {
+		logging.Fatal("both secondary secret id and secondary secret key must be specified")
 	}
 
 	u, err := url.Parse(*endpoint)
 	if err != nil {
-		glog.Fatalf("parse endpoint err: %s", err.Error())
+		logging.Fatalf("parse endpoint err: %s", err.Error())
+	}
+
+	if u.Scheme != "unix" && u.Scheme != "tcp" {
+		logging.Fatal("only unix and tcp endpoints are supported")
 	}
 
-	if u.Scheme != "unix" {
-		glog.Fatal("only unix socket is supported currently")
+	driverConfig := cbs.DefaultConfig()
+	driverConfig.DiskType = *defaultDiskType
+	driverConfig.DiskChargeType = *defaultDiskChargeType
+	driverConfig.FsType = *defaultFsType
+	driverConfig.PVCAnnotationOverrides = *pvcAnnotationOverrides
+	driverConfig.DeviceWaitTimeout = *deviceWaitTimeout
+	driverConfig.DeviceWaitInterval = *deviceWaitInterval
+	driverConfig.VolumeHealthCheckInterval = *volumeHealthCheckInterval
+	driverConfig.FstrimInterval = *fstrimInterval
+	driverConfig.MaxVolumesPerNode = *maxVolumesPerNode
+	driverConfig.MaxInflightRequests = *maxInflight
+	driverConfig.RPCTimeouts, err = cbs.ParseRPCTimeouts(*rpcTimeouts)
+	if err != nil {
+		logging.Fatal(err)
 	}
+	driverConfig.ProbeCloudInterval = *probeCloudInterval
+	driverConfig.LeaderElection = *leaderElection
+	driverConfig.DiskInfo = *diskInfo
+	driverConfig.SnapshotSchedules = *snapshotSchedules
+	driverConfig.VolumeFreeze = *volumeFreeze
+	driverConfig.VolumeRollbacks = *volumeRollbacks
+	driverConfig.VolumeMigrations = *volumeMigrations
+	driverConfig.QuotaMetricsInterval = *quotaMetrics
+	driverConfig.SnapshotMetricsInterval = *snapshotMetrics
+	driverConfig.SnapshotVerifyInterval = *snapshotVerify
+	driverConfig.ShutdownTimeout = *shutdownTimeout
+	driverConfig.SocketMode = *socketMode
+	driverConfig.SocketOwner = *socketOwner
+	driverConfig.TLSCertFile = *tlsCertFile
+	driverConfig.TLSKeyFile = *tlsKeyFile
+	driverConfig.TLSClientCAFile = *tlsClientCAFile
+	driverConfig.StateFile = *stateFile
+	driverConfig.MetricsAddress = *metricsAddress
+	driverConfig.AuditLogFile = *auditLogFile
+	driverConfig.GRPCLogLevel = *grpcLogLevel
+	driverConfig.GRPCReflection = *grpcReflection
+	driverConfig.LogLevel, err = strconv.Atoi(flag.Lookup("v").Value.String())
+	if err != nil {
+		logging.Fatal(err)
+	}
+	driverConfig.TracingEndpoint = *tracingEndpoint
+	driverConfig.PprofAddress = *pprofAddress
+	driverConfig.HealthAddress = *healthAddress
 
-	drv, err := cbs.NewDriver(*region, *zone, *secretId, *secretKey)
+	drv, err := cbs.NewDriver(*region, *zone, credentials, *config, driverConfig)
 	if err != nil {
-		glog.Fatal(err)
+		logging.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "check":
+		if !drv.Check(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	case "orphans":
+		if flag.Arg(1) != "" && flag.Arg(1) != "delete" {
+			logging.Fatalf("unknown argument %s of orphans, only delete is supported", flag.Arg(1))
+		}
+		if err := drv.Orphans(os.Stdout, flag.Arg(1) == "delete"); err != nil {
+			logging.Fatal(err)
+		}
+		return
+	case "detach":
+		if flag.Arg(1) == "" {
+			logging.Fatal("disk id of detach is empty")
+		}
+		if err := drv.ForceDetach(os.Stdout, flag.Arg(1)); err != nil {
+			logging.Fatal(err)
+		}
+		return
+	default:
+		logging.Fatalf("unknown command %s, use check, orphans or detach", flag.Arg(0))
+	}
+
+	if err := logging.SetFormat(*logFormat); err != nil {
+		logging.Fatal(err)
 	}
 
 	if err := drv.Run(u); err != nil {
-		glog.Fatal(err)
+		logging.Fatal(err)
 	}
 
 	return
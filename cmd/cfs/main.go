@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/dbdd4us/qcloudapi-sdk-go/metadata"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/driver/cfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+const (
+	TENCENTCLOUD_CFS_API_SECRET_ID  = "TENCENTCLOUD_CFS_API_SECRET_ID"
+	TENCENTCLOUD_CFS_API_SECRET_KEY = "TENCENTCLOUD_CFS_API_SECRET_KEY"
+)
+
+var (
+	endpoint  = flag.String("endpoint", fmt.Sprintf("unix:///var/lib/kubelet/plugins/%s/csi.sock", cfs.DriverName), "CSI endpoint")
+	secretId  = flag.String("secret_id", "", "tencent cloud api secret id")
+	secretKey = flag.String("secret_key", "", "tencent cloud api secret key")
+	region    = flag.String("region", "", "tencent cloud api region")
+	zone      = flag.String("zone", "", "zone new file systems are created in")
+
+	vpcId          = flag.String("vpc_id", "", "vpc the mount targets of new file systems are created in, by default that of the controller's node")
+	subnetId       = flag.String("subnet_id", "", "subnet the mount targets of new file systems are created in, by default that of the controller's node")
+	pgroupId       = flag.String("pgroup_id", "", "permission group of new file systems, by default each file system gets one allowing its vpc")
+	tags           = flag.String("tags", "", "tags of new file systems, e.g. team=storage,env=prod")
+	createTimeout  = flag.Duration("create_timeout", cfs.DefaultConfig().CreateTimeout, "how long to wait for a new file system to become available")
+	reclaim        = flag.String("reclaim", cfs.DefaultConfig().Reclaim, "what deleting a volume does to its file system, delete or retain, unless the storage class sets it")
+	subdirReclaim  = flag.String("subdir_reclaim", cfs.DefaultConfig().SubdirReclaim, "what deleting a volume does to its subdirectory, archive, delete or retain, unless the storage class sets it")
+	quotaGidMin    = flag.Int("quota_gid_min", cfs.DefaultConfig().QuotaGidMin, "first group whose quota limits a subdirectory volume")
+	quotaGidMax    = flag.Int("quota_gid_max", cfs.DefaultConfig().QuotaGidMax, "last group whose quota limits a subdirectory volume")
+	metricsAddress = flag.String("metrics_address", "", "address to serve prometheus metrics at, e.g. :9199, disabled if empty")
+	workDir        = flag.String("work_dir", cfs.DefaultConfig().WorkDir, "directory the controller mounts the file systems volumes are subdirectories of in")
+)
+
+// metadataNetwork returns the vpc and subnet of the primary network interface of the node.
+func metadataNetwork(metadataClient *metadata.MetaData) (string, string, error) {
+	mac, err := metadataClient.Mac()
+	if err != nil {
+		return "", "", err
+	}
+	if mac == "" {
+		return "", "", fmt.Errorf("mac of the node not found")
+	}
+	vpcId, err := metadataValue(fmt.Sprintf("network/interfaces/macs/%s/vpc-id", mac))
+	if err != nil {
+		return "", "", err
+	}
+	subnetId, err := metadataValue(fmt.Sprintf("network/interfaces/macs/%s/subnet-id", mac))
+	if err != nil {
+		return "", "", err
+	}
+	return vpcId, subnetId, nil
+}
+
+// metadataValue returns the metadata resource, which the metadata client has no method for.
+func metadataValue(resource string) (string, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/%s", metadata.ENDPOINT, resource))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get metadata %s: %s", resource, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("metadata %s is empty", resource)
+	}
+	return value, nil
+}
+
+func main() {
+	flag.Parse()
+	defer logging.Flush()
+
+	metadataClient := metadata.NewMetaData(http.DefaultClient)
+
+	if *region == "" {
+		r, err := metadataClient.Region()
+		if err != nil {
+			logging.Fatal(err)
+		}
+		region = &r
+	}
+	if *zone == "" {
+		z, err := metadataClient.Zone()
+		if err != nil {
+			logging.Fatal(err)
+		}
+		zone = &z
+	}
+	if *vpcId == "" && *subnetId == "" {
+		v, s, err := metadataNetwork(metadataClient)
+		if err != nil {
+			logging.Warningf("get vpc and subnet of the node err: %v, storage classes must set them", err)
+		} else {
+			vpcId, subnetId = &v, &s
+		}
+	}
+
+	if *secretId == "" {
+		*secretId = os.Getenv(TENCENTCLOUD_CFS_API_SECRET_ID)
+	}
+	if *secretKey == "" {
+		*secretKey = os.Getenv(TENCENTCLOUD_CFS_API_SECRET_KEY)
+	}
+
+	if *secretId == "" || *secretKey == "" {
+		logging.Fatal("tencent cloud credential must be specified")
+	}
+
+	u, err := url.Parse(*endpoint)
+	if err != nil {
+		logging.Fatalf("parse endpoint err: %s", err.Error())
+	}
+
+	if u.Scheme != "unix" {
+		logging.Fatal("only unix socket is supported currently")
+	}
+
+	driverConfig := cfs.DefaultConfig()
+	driverConfig.VpcId = *vpcId
+	driverConfig.SubnetId = *subnetId
+	driverConfig.PGroupId = *pgroupId
+	driverConfig.CreateTimeout = *createTimeout
+	driverConfig.WorkDir = *workDir
+	driverConfig.Reclaim = *reclaim
+	driverConfig.SubdirReclaim = *subdirReclaim
+	driverConfig.QuotaGidMin = *quotaGidMin
+	driverConfig.QuotaGidMax = *quotaGidMax
+	driverConfig.MetricsAddress = *metricsAddress
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag == "" {
+			continue
+		}
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			logging.Fatalf("invalid tag %s, expected key=value", tag)
+		}
+		driverConfig.Tags[kv[0]] = kv[1]
+	}
+
+	drv, err := cfs.NewDriver(*region, *zone, cfs.Credential{SecretId: *secretId, SecretKey: *secretKey}, driverConfig)
+	if err != nil {
+		logging.Fatal(err)
+	}
+
+	if err := drv.Run(u); err != nil {
+		logging.Fatal(err)
+	}
+}
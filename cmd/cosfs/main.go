@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/driver/cosfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	endpoint     = flag.String("endpoint", fmt.Sprintf("unix:///var/lib/kubelet/plugins/%s/csi.sock", cosfs.DriverName), "CSI endpoint")
+	cosfsPath    = flag.String("cosfs_path", cosfs.DefaultConfig().CosfsPath, "path of the cosfs binary")
+	workDir      = flag.String("work_dir", cosfs.DefaultConfig().WorkDir, "directory the password files of mounted buckets are written to")
+	mountTimeout = flag.Duration("mount_timeout", cosfs.DefaultConfig().MountTimeout, "how long to wait for cosfs to mount a bucket")
+)
+
+func main() {
+	flag.Parse()
+	defer logging.Flush()
+
+	u, err := url.Parse(*endpoint)
+	if err != nil {
+		logging.Fatalf("parse endpoint err: %s", err.Error())
+	}
+
+	if u.Scheme != "unix" {
+		logging.Fatal("only unix socket is supported currently")
+	}
+
+	driverConfig := cosfs.DefaultConfig()
+	driverConfig.CosfsPath = *cosfsPath
+	driverConfig.WorkDir = *workDir
+	driverConfig.MountTimeout = *mountTimeout
+
+	drv, err := cosfs.NewDriver(driverConfig)
+	if err != nil {
+		logging.Fatal(err)
+	}
+
+	if err := drv.Run(u); err != nil {
+		logging.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+)
+
+var (
+	// parameters added by external-provisioner when it runs with --extra-create-metadata
+	PVCNameKey      = "csi.storage.k8s.io/pvc/name"
+	PVCNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+	PVNameKey       = "csi.storage.k8s.io/pv/name"
+
+	// storage class parameters which can be overridden by pvc annotations, e.g.
+	//   com.tencent.cloud.csi.cbs/diskType: CLOUD_SSD
+	PVCAnnotationPrefix          = DriverName + "/"
+	PVCOverridableParameterNames = []string{DiskTypeAttr, TagsAttr}
+)
+
+// applyPVCOverrides returns a copy of parameters with the whitelisted parameters replaced by
+// the annotations of the pvc being provisioned.
+func (ctrl *cbsController) applyPVCOverrides(ctx context.Context, parameters map[string]string) (map[string]string, error) {
+	if !ctrl.config.Get().PVCAnnotationOverrides {
+		return parameters, nil
+	}
+
+	pvcName, pvcNamespace := parameters[PVCNameKey], parameters[PVCNamespaceKey]
+	if pvcName == "" || pvcNamespace == "" {
+		logging.V(4).Infof("pvc name or namespace not found in parameters, is external-provisioner running with --extra-create-metadata?")
+		return parameters, nil
+	}
+
+	if ctrl.kubeClient == nil {
+		return nil, fmt.Errorf("pvc annotation overrides enabled but kubernetes client is not available")
+	}
+
+	pvc := &kube.PersistentVolumeClaim{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumeClaimPath(pvcNamespace, pvcName), pvc); err != nil {
+		return nil, fmt.Errorf("get pvc %s/%s err: %v", pvcNamespace, pvcName, err)
+	}
+
+	merged := make(map[string]string, len(parameters))
+	for k, v := range parameters {
+		merged[k] = v
+	}
+
+	for _, name := range PVCOverridableParameterNames {
+		if v, ok := pvc.Metadata.Annotations[PVCAnnotationPrefix+name]; ok {
+			logging.Infof("pvc %s/%s overrides parameter %s: %s", pvcNamespace, pvcName, name, v)
+			merged[name] = v
+		}
+	}
+
+	return merged, nil
+}
+
+// parseTags parses tags in the form of "key1:value1,key2:value2".
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid tag %q, should be key:value", kv)
+		}
+		tags[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
@@ -0,0 +1,7 @@
+package cbs
+
+var (
+	// number of cbs data disks a cvm instance can attach, cbs documents the same limit for all
+	// instance types
+	DefaultMaxDataDisksPerInstance int64 = 20
+)
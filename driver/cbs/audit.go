@@ -0,0 +1,135 @@
+package cbs
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var (
+	// actions with these prefixes only read, they are not audited
+	ReadOnlyActionPrefixes = []string{"Describe", "Inquiry", "Get"}
+)
+
+// auditEntry is one mutating cloud api call in the audit log.
+type auditEntry struct {
+	Time           string          `json:"time"`
+	RequestId      string          `json:"requestId,omitempty"`
+	RPC            string          `json:"rpc,omitempty"`
+	Action         string          `json:"action"`
+	Credential     string          `json:"credential"`
+	Volumes        []string        `json:"volumes,omitempty"`
+	Instances      []string        `json:"instances,omitempty"`
+	Request        json.RawMessage `json:"request,omitempty"`
+	Code           string          `json:"code"`
+	Error          string          `json:"error,omitempty"`
+	CloudRequestId string          `json:"cloudRequestId,omitempty"`
+	DurationMs     int64           `json:"durationMs"`
+}
+
+// auditLog appends a json line for every cloud api call which changes disks to a file.
+type auditLog struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: file}, nil
+}
+
+func isReadOnlyAction(action string) bool {
+	for _, prefix := range ReadOnlyActionPrefixes {
+		if strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditedFields are the request and response fields naming the disks and instances of a call.
+type auditedFields struct {
+	DiskId      *string   `json:"DiskId"`
+	DiskIds     []*string `json:"DiskIds"`
+	InstanceId  *string   `json:"InstanceId"`
+	InstanceIds []*string `json:"InstanceIds"`
+	Response    struct {
+		DiskIdSet []*string `json:"DiskIdSet"`
+		RequestId *string   `json:"RequestId"`
+	} `json:"Response"`
+}
+
+func appendIds(ids []string, id *string, more []*string) []string {
+	for _, p := range append([]*string{id}, more...) {
+		if p != nil && *p != "" {
+			ids = append(ids, *p)
+		}
+	}
+	return ids
+}
+
+// record appends the call of request made with credential which started at start and returned err,
+// a nil log or a read only action records nothing.
+func (l *auditLog) record(ctx context.Context, credential string, request tchttp.Request, response tchttp.Response, start time.Time, err error) {
+	if l == nil || isReadOnlyAction(request.GetAction()) {
+		return
+	}
+
+	entry := auditEntry{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		RequestId:  requestIdFromContext(ctx),
+		Action:     request.GetAction(),
+		Credential: credential,
+		Code:       cloudAPICode(err),
+		DurationMs: time.Since(start).Nanoseconds() / int64(time.Millisecond),
+	}
+	if method, ok := grpc.Method(ctx); ok {
+		entry.RPC = method
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		if e, ok := err.(*errors.TencentCloudSDKError); ok {
+			entry.CloudRequestId = e.RequestId
+		}
+	}
+
+	var fields auditedFields
+	if data, err := json.Marshal(request); err == nil {
+		entry.Request = data
+		json.Unmarshal(data, &fields)
+	}
+	if err == nil {
+		if data, err := json.Marshal(response); err == nil {
+			json.Unmarshal(data, &fields)
+		}
+		if fields.Response.RequestId != nil {
+			entry.CloudRequestId = *fields.Response.RequestId
+		}
+	}
+	entry.Volumes = appendIds(appendIds(nil, fields.DiskId, fields.DiskIds), nil, fields.Response.DiskIdSet)
+	entry.Instances = appendIds(nil, fields.InstanceId, fields.InstanceIds)
+
+	data, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		logging.Errorf("marshal audit entry of %s err: %v", entry.Action, marshalErr)
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		logging.Errorf("write audit log %s err: %v", l.file.Name(), err)
+	}
+}
@@ -0,0 +1,218 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cbsext"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// VolumeSnapshotClass parameter choosing between cbs snapshots and disk backups
+	SnapshotTypeParameter = "type"
+	SnapshotTypeSnapshot  = "snapshot"
+	SnapshotTypeBackup    = "backup"
+
+	// ids of disk backups start with the prefix, it tells them apart from snapshot ids
+	DiskBackupIdPrefix = "dbp-"
+
+	diskBackupQuotaHint = "delete old backups of the disk or raise its backup quota in the console"
+)
+
+// snapshotType returns the type of the snapshots parameters ask for, snapshot by default.
+func snapshotType(parameters map[string]string) (string, error) {
+	typ, ok := parameters[SnapshotTypeParameter]
+	if !ok {
+		return SnapshotTypeSnapshot, nil
+	}
+	if typ != SnapshotTypeSnapshot && typ != SnapshotTypeBackup {
+		return "", fmt.Errorf("%s must be %s or %s", SnapshotTypeParameter, SnapshotTypeSnapshot, SnapshotTypeBackup)
+	}
+	return typ, nil
+}
+
+func isDiskBackupId(id string) bool {
+	return strings.HasPrefix(id, DiskBackupIdPrefix)
+}
+
+// csiDiskBackup returns the csi snapshot of a disk backup, its states are those of snapshots.
+func csiDiskBackup(b *cbsext.DiskBackup) *csi.Snapshot {
+	return csiSnapshot(&cbs.Snapshot{
+		SnapshotId:    b.DiskBackupId,
+		DiskId:        b.DiskId,
+		DiskSize:      b.DiskSize,
+		SnapshotState: b.DiskBackupState,
+		Percent:       b.Percent,
+		CreateTime:    b.CreateTime,
+	})
+}
+
+// describeDiskBackup returns the disk backup backupId, a NotFound error if it does not exist.
+func (ctrl *cbsController) describeDiskBackup(ctx context.Context, backupId string) (*cbsext.DiskBackup, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	request := cbsext.NewDescribeDiskBackupsRequest()
+	request.DiskBackupIds = []*string{&backupId}
+	response, err := ctrl.cbsClient.DescribeDiskBackups(ctx, request)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	for _, backup := range response.Response.DiskBackupSet {
+		if backup.DiskBackupId != nil && *backup.DiskBackupId == backupId {
+			return backup, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "disk backup %s not found, DescribeDiskBackups request id %s", backupId, requestIdOf(response.Response.RequestId))
+}
+
+// diskBackupByName returns the backup of diskId named name, nil if there is none. Backups can not
+// be filtered by name, but a disk only has a few of them.
+func (ctrl *cbsController) diskBackupByName(ctx context.Context, diskId, name string) (*cbsext.DiskBackup, error) {
+	filterName := "disk-id"
+	request := cbsext.NewDescribeDiskBackupsRequest()
+	request.Filters = []*cbsext.Filter{{Name: &filterName, Values: []*string{&diskId}}}
+	request.Limit = &DescribeDisksPageSize
+
+	for offset := uint64(0); ; offset += DescribeDisksPageSize {
+		o := offset
+		request.Offset = &o
+
+		if err := ctrl.waitRateLimit(ctx); err != nil {
+			return nil, err
+		}
+		response, err := ctrl.cbsClient.DescribeDiskBackups(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range response.Response.DiskBackupSet {
+			if backup.DiskBackupName != nil && *backup.DiskBackupName == name {
+				return backup, nil
+			}
+		}
+
+		if len(response.Response.DiskBackupSet) < int(DescribeDisksPageSize) {
+			return nil, nil
+		}
+	}
+}
+
+// createDiskBackup backs diskId up as name and returns the id of the backup. With freeze the
+// filesystem of the disk is frozen on its node until cbs took the point in time of the backup.
+func (ctrl *cbsController) createDiskBackup(ctx context.Context, diskId, name string, freeze bool) (string, error) {
+	if freeze {
+		thaw, err := ctrl.freezeVolume(ctx, diskId)
+		if err != nil {
+			return "", err
+		}
+		defer thaw()
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+
+	request := cbsext.NewCreateDiskBackupRequest()
+	request.DiskId = &diskId
+	request.DiskBackupName = &name
+	response, err := ctrl.cbsClient.CreateDiskBackup(ctx, request)
+	if err != nil {
+		if e, ok := err.(*errors.TencentCloudSDKError); ok && strings.HasPrefix(e.Code, CloudAPILimitExceeded) {
+			p := status.Convert(cloudError(codes.ResourceExhausted, err)).Proto()
+			p.Message += ": " + diskBackupQuotaHint
+			return "", status.ErrorProto(p)
+		}
+		return "", err
+	}
+	if response.Response.DiskBackupId == nil {
+		return "", fmt.Errorf("no disk backup id in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	return *response.Response.DiskBackupId, nil
+}
+
+// createDiskBackupSnapshot is CreateSnapshot for snapshot classes with type backup, the name of the
+// backup makes repeated calls return the same backup.
+func (ctrl *cbsController) createDiskBackupSnapshot(ctx context.Context, diskId, name string, freeze bool) (*csi.CreateSnapshotResponse, error) {
+	existing, err := ctrl.diskBackupByName(ctx, diskId, name)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	if existing != nil {
+		return &csi.CreateSnapshotResponse{Snapshot: csiDiskBackup(existing)}, nil
+	}
+
+	backupId, err := ctrl.createDiskBackup(ctx, diskId, name, freeze)
+	ctrl.observeSnapshotCreated(diskId, backupId, SnapshotTypeBackup, SnapshotTriggerVolumeSnapshot, nil, err)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	logging.Infof("%screated disk backup %s of %s", logPrefix(ctx), backupId, diskId)
+
+	backup, err := ctrl.describeDiskBackup(ctx, backupId)
+	if err != nil {
+		logging.Warningf("%sdescribe disk backup %s err: %v", logPrefix(ctx), backupId, err)
+		return &csi.CreateSnapshotResponse{Snapshot: &csi.Snapshot{
+			Id:             backupId,
+			SourceVolumeId: diskId,
+			SizeBytes:      ctrl.diskSizeBytes(ctx, diskId),
+			CreatedAt:      time.Now().UnixNano(),
+			Status:         &csi.SnapshotStatus{Type: csi.SnapshotStatus_UPLOADING},
+		}}, nil
+	}
+	return &csi.CreateSnapshotResponse{Snapshot: csiDiskBackup(backup)}, nil
+}
+
+// deleteDiskBackup deletes the disk backup backupId, a backup which does not exist is deleted.
+func (ctrl *cbsController) deleteDiskBackup(ctx context.Context, backupId string) error {
+	backup, err := ctrl.describeDiskBackup(ctx, backupId)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			logging.Infof("%sdisk backup %s not found, assuming it is deleted", logPrefix(ctx), backupId)
+			return nil
+		}
+		return err
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	request := cbsext.NewDeleteDiskBackupsRequest()
+	request.DiskBackupIds = []*string{&backupId}
+	_, err = ctrl.cbsClient.DeleteDiskBackups(ctx, request)
+	ctrl.observeSnapshotDeleted(stringValue(backup.DiskId), backupId, SnapshotTypeBackup, SnapshotTriggerVolumeSnapshot, err)
+	if err != nil {
+		return cloudError(codes.Internal, err)
+	}
+	logging.Infof("%sdeleted disk backup %s", logPrefix(ctx), backupId)
+	return nil
+}
+
+// listDiskBackups returns up to limit disk backups of the region, of diskId unless it is empty,
+// from offset on.
+func (ctrl *cbsController) listDiskBackups(ctx context.Context, diskId string, offset, limit uint64) ([]*cbsext.DiskBackup, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	request := cbsext.NewDescribeDiskBackupsRequest()
+	request.Offset = &offset
+	request.Limit = &limit
+	if diskId != "" {
+		filterName := "disk-id"
+		request.Filters = []*cbsext.Filter{{Name: &filterName, Values: []*string{&diskId}}}
+	}
+	response, err := ctrl.cbsClient.DescribeDiskBackups(ctx, request)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	return response.Response.DiskBackupSet, nil
+}
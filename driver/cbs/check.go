@@ -0,0 +1,174 @@
+package cbs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cvm"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	DiskUsageDataDisk = "DATA_DISK"
+
+	// how long a single check may take
+	CheckTimeout = time.Second * 15
+)
+
+// checkReport prints the results of the checks made by Check.
+type checkReport struct {
+	w      io.Writer
+	failed bool
+}
+
+func (r *checkReport) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[ OK ] "+format+"\n", args...)
+}
+
+func (r *checkReport) warn(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[WARN] "+format+"\n", args...)
+}
+
+func (r *checkReport) fail(format string, args ...interface{}) {
+	r.failed = true
+	fmt.Fprintf(r.w, "[FAIL] "+format+"\n", args...)
+}
+
+// Check verifies the config, every credential, the region and zone, the disk types available in the
+// zone and the access to the cvm and kubernetes apis, and writes a report to w. It returns false if
+// the driver would not be able to provision volumes.
+func (drv *Driver) Check(w io.Writer) bool {
+	r := &checkReport{w: w}
+
+	fmt.Fprintf(w, "checking %s %s in region %s, zone %s\n", DriverName, DriverVerision, drv.region, drv.zone)
+
+	config, err := newConfigStore(drv.configPath, drv.config)
+	if err != nil {
+		r.fail("config: %v", err)
+		return false
+	}
+	cfg := config.Get()
+	if drv.configPath != "" {
+		r.ok("config: %s is valid", drv.configPath)
+	} else {
+		r.ok("config: no config file, using flags")
+	}
+
+	var client *cloudClient
+	for i, cred := range drv.credentials {
+		c, err := newCloudClient(drv.region, []Credential{cred})
+		if err != nil {
+			r.fail("%s credential: %v", credentialName(i), err)
+			continue
+		}
+
+		var limit uint64 = 1
+		request := cbs.NewDescribeDisksRequest()
+		request.Limit = &limit
+
+		ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+		response, err := c.DescribeDisks(ctx, request)
+		cancel()
+		if err != nil {
+			if isAuthError(err) {
+				r.fail("%s credential: rejected, check secret id and secret key: %v", credentialName(i), err)
+			} else {
+				r.fail("%s credential: describe disks in region %s failed, check that the region exists and the api is reachable: %v", credentialName(i), drv.region, err)
+			}
+			continue
+		}
+
+		total := uint64(0)
+		if response.Response.TotalCount != nil {
+			total = *response.Response.TotalCount
+		}
+		r.ok("%s credential: cbs api reachable, %d disks in region %s", credentialName(i), total, drv.region)
+		if client == nil {
+			client = c
+		}
+	}
+	if client == nil {
+		return false
+	}
+
+	drv.checkZone(r, client, cfg)
+
+	var limit int64 = 1
+	instancesRequest := cvm.NewDescribeInstancesRequest()
+	instancesRequest.Limit = &limit
+
+	ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+	_, err = client.DescribeInstances(ctx, instancesRequest)
+	cancel()
+	if err != nil {
+		r.warn("cvm api: %v, node names which are not instance ids can not be resolved", err)
+	} else {
+		r.ok("cvm api: reachable")
+	}
+
+	if _, err := kube.NewInClusterClient(); err != nil {
+		r.warn("kubernetes api: %v, events and pvc annotations are not available", err)
+	} else {
+		r.ok("kubernetes api: in cluster client available")
+	}
+
+	if r.failed {
+		fmt.Fprintln(w, "check failed")
+	} else {
+		fmt.Fprintln(w, "check passed")
+	}
+	return !r.failed
+}
+
+// checkZone reports the data disk types which can be created in the zone of the driver.
+func (drv *Driver) checkZone(r *checkReport, client *cloudClient, cfg *Config) {
+	request := cbs.NewDescribeDiskConfigQuotaRequest()
+	request.InquiryType = &InquiryTypeCbsConfig
+	request.Zones = []*string{&drv.zone}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+	defer cancel()
+
+	response, err := client.DescribeDiskConfigQuota(ctx, request)
+	if err != nil {
+		r.fail("zone %s: describe disk config failed, check that the zone exists in region %s: %v", drv.zone, drv.region, err)
+		return
+	}
+
+	// disk type to the size range of available data disks with the default charge type
+	available := map[string]string{}
+	for _, c := range response.Response.DiskConfigSet {
+		if c.Available == nil || !*c.Available || c.DiskType == nil || c.DiskUsage == nil || *c.DiskUsage != DiskUsageDataDisk {
+			continue
+		}
+		if c.DiskChargeType != nil && *c.DiskChargeType != cfg.DiskChargeType {
+			continue
+		}
+		sizes := ""
+		if c.MinDiskSize != nil && c.MaxDiskSize != nil {
+			sizes = fmt.Sprintf(" %d-%dGB", *c.MinDiskSize, *c.MaxDiskSize)
+		}
+		available[*c.DiskType] = *c.DiskType + sizes
+	}
+
+	if len(available) == 0 {
+		r.fail("zone %s: no %s data disk can be created", drv.zone, cfg.DiskChargeType)
+		return
+	}
+
+	var types []string
+	for _, t := range available {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	r.ok("zone %s: %s data disks available: %s", drv.zone, cfg.DiskChargeType, strings.Join(types, ", "))
+
+	if _, ok := available[cfg.DiskType]; !ok {
+		r.fail("zone %s: default disk type %s is not available", drv.zone, cfg.DiskType)
+	}
+}
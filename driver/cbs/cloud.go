@@ -0,0 +1,409 @@
+package cbs
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cbsext"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cos"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cvm"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/trace"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	credentialFailoverTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbs_credential_failover_total",
+		Help: "Number of times the driver switched to another credential after an authentication failure.",
+	}, []string{"from", "to"})
+
+	cloudAPICallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbs_cloud_api_calls_total",
+		Help: "Number of tencent cloud api calls, by action and result code.",
+	}, []string{"action", "code"})
+
+	cloudAPICallSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cbs_cloud_api_call_seconds",
+		Help:    "Duration in seconds of tencent cloud api calls, by action.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"action"})
+
+	cloudAPIThrottledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbs_cloud_api_throttled_total",
+		Help: "Number of tencent cloud api calls rejected because the request limit was exceeded, by action.",
+	}, []string{"action"})
+
+	cloudAPIRateLimitWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cbs_cloud_api_rate_limit_wait_seconds",
+		Help:    "Time in seconds cloud api calls waited for the client side rate limit.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30},
+	})
+
+	// result codes of calls which did not return a cloud api error
+	CloudAPICodeSuccess     = "Success"
+	CloudAPICodeClientError = "ClientError"
+
+	// error code prefix of throttled calls
+	CloudAPIRequestLimitExceeded = "RequestLimitExceeded"
+)
+
+func init() {
+	prometheus.MustRegister(credentialFailoverTotal)
+	prometheus.MustRegister(cloudAPICallsTotal)
+	prometheus.MustRegister(cloudAPICallSeconds)
+	prometheus.MustRegister(cloudAPIThrottledTotal)
+	prometheus.MustRegister(cloudAPIRateLimitWaitSeconds)
+}
+
+// Credential is a tencent cloud api secret id and key pair, at most a primary and a secondary one are used.
+type Credential struct {
+	SecretId  string
+	SecretKey string
+}
+
+// cloudClient sends cbs api requests. It holds one client per credential and fails over to
+// the next credential when the current one is rejected, e.g. during key rotation.
+type cloudClient struct {
+	region  string
+	clients []*cbs.Client
+	// the clients of other regions are created with the same credentials
+	credentials []Credential
+	regions     map[string]*cloudClient
+
+	mutex   sync.RWMutex
+	current int
+
+	// nil unless an audit log is configured
+	audit *auditLog
+	// calls slower than its SlowCallThreshold are logged, nil disables the warnings
+	config *configStore
+}
+
+func newCloudClient(region string, credentials []Credential) (*cloudClient, error) {
+	c := &cloudClient{region: region, credentials: credentials, regions: map[string]*cloudClient{}}
+	for _, cred := range credentials {
+		client, err := cbs.NewClient(common.NewCredential(cred.SecretId, cred.SecretKey), region, profile.NewClientProfile())
+		if err != nil {
+			return nil, err
+		}
+		c.clients = append(c.clients, client)
+	}
+	return c, nil
+}
+
+// inRegion returns a client of region sharing the credentials, audit log and config of c, e.g. to
+// delete the copies of snapshots in other regions.
+func (c *cloudClient) inRegion(region string) (*cloudClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if client, ok := c.regions[region]; ok {
+		return client, nil
+	}
+	client, err := newCloudClient(region, c.credentials)
+	if err != nil {
+		return nil, err
+	}
+	client.audit, client.config = c.audit, c.config
+	c.regions[region] = client
+	return client, nil
+}
+
+// cosClient returns a client of bucket in the region of c signing with the current credential.
+func (c *cloudClient) cosClient(bucket string) *cos.Client {
+	c.mutex.RLock()
+	cred := c.credentials[c.current]
+	c.mutex.RUnlock()
+	return cos.NewClient(bucket, c.region, cred.SecretId, cred.SecretKey)
+}
+
+func credentialName(i int) string {
+	if i == 0 {
+		return "primary"
+	}
+	return "secondary"
+}
+
+func isAuthError(err error) bool {
+	e, ok := err.(*errors.TencentCloudSDKError)
+	return ok && strings.HasPrefix(e.Code, "AuthFailure")
+}
+
+// cloudAPICode returns the result code of a cloud api call for metrics.
+func cloudAPICode(err error) string {
+	if err == nil {
+		return CloudAPICodeSuccess
+	}
+	if e, ok := err.(*errors.TencentCloudSDKError); ok {
+		return e.Code
+	}
+	return CloudAPICodeClientError
+}
+
+// cloudError returns a status error with code for err of a cloud api call. Errors returned by the api
+// carry a RequestInfo detail with their request id and their error code as serving data, so clients
+// can tell the causes apart without parsing the message. Errors which already are status errors, e.g.
+// of the rate limit, are returned unchanged.
+func cloudError(code codes.Code, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	s := status.New(code, err.Error())
+	e, ok := err.(*errors.TencentCloudSDKError)
+	if !ok {
+		return s.Err()
+	}
+
+	detailed, detailsErr := s.WithDetails(&errdetails.RequestInfo{
+		RequestId:   e.RequestId,
+		ServingData: e.Code,
+	})
+	if detailsErr != nil {
+		logging.Errorf("add details to error %v err: %v", err, detailsErr)
+		return s.Err()
+	}
+	return detailed.Err()
+}
+
+// requestIdOf returns the request id of a cloud api response, so errors can name the call for
+// support, or unknown if the response has none.
+func requestIdOf(requestId *string) string {
+	if requestId == nil || *requestId == "" {
+		return "unknown"
+	}
+	return *requestId
+}
+
+// sendWith sends request with client and records the call in the cloud api metrics and a span.
+func sendWith(ctx context.Context, client *cbs.Client, request tchttp.Request, response tchttp.Response) error {
+	action := request.GetAction()
+	start := time.Now()
+
+	_, span := trace.Start(ctx, request.GetService()+"."+action, trace.KindClient)
+	err := client.Send(request, response)
+	span.End(err)
+
+	code := cloudAPICode(err)
+	cloudAPICallSeconds.WithLabelValues(action).Observe(time.Since(start).Seconds())
+	cloudAPICallsTotal.WithLabelValues(action, code).Inc()
+	if strings.HasPrefix(code, CloudAPIRequestLimitExceeded) {
+		cloudAPIThrottledTotal.WithLabelValues(action).Inc()
+	}
+
+	return err
+}
+
+func (c *cloudClient) send(ctx context.Context, request tchttp.Request, response tchttp.Response) error {
+	c.mutex.RLock()
+	current := c.current
+	c.mutex.RUnlock()
+
+	threshold := time.Duration(0)
+	if c.config != nil {
+		threshold = c.config.Get().SlowCallThreshold
+	}
+
+	start := time.Now()
+	err := sendWith(ctx, c.clients[current], request, response)
+	c.audit.record(ctx, credentialName(current), request, response, start, err)
+	warnSlowCall(ctx, threshold, request, start, err)
+	if err == nil || !isAuthError(err) || len(c.clients) <= 1 {
+		return err
+	}
+
+	next := (current + 1) % len(c.clients)
+
+	c.mutex.Lock()
+	if c.current == current {
+		c.current = next
+		credentialFailoverTotal.WithLabelValues(credentialName(current), credentialName(next)).Inc()
+		logging.Warningf("%s credential rejected by %s: %v, failing over to %s credential", credentialName(current), request.GetAction(), err, credentialName(next))
+	}
+	next = c.current
+	c.mutex.Unlock()
+
+	start = time.Now()
+	err = sendWith(ctx, c.clients[next], request, response)
+	c.audit.record(ctx, credentialName(next), request, response, start, err)
+	warnSlowCall(ctx, threshold, request, start, err)
+	return err
+}
+
+func (c *cloudClient) CreateDisks(ctx context.Context, request *cbs.CreateDisksRequest) (*cbs.CreateDisksResponse, error) {
+	response := cbs.NewCreateDisksResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeDisks(ctx context.Context, request *cbs.DescribeDisksRequest) (*cbs.DescribeDisksResponse, error) {
+	response := cbs.NewDescribeDisksResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) TerminateDisks(ctx context.Context, request *cbs.TerminateDisksRequest) (*cbs.TerminateDisksResponse, error) {
+	response := cbs.NewTerminateDisksResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) AttachDisks(ctx context.Context, request *cbs.AttachDisksRequest) (*cbs.AttachDisksResponse, error) {
+	response := cbs.NewAttachDisksResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DetachDisks(ctx context.Context, request *cbs.DetachDisksRequest) (*cbs.DetachDisksResponse, error) {
+	response := cbs.NewDetachDisksResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) CreateSnapshot(ctx context.Context, request *cbsext.CreateSnapshotRequest) (*cbsext.CreateSnapshotResponse, error) {
+	response := cbsext.NewCreateSnapshotResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeSnapshots(ctx context.Context, request *cbs.DescribeSnapshotsRequest) (*cbs.DescribeSnapshotsResponse, error) {
+	response := cbs.NewDescribeSnapshotsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteSnapshots(ctx context.Context, request *cbs.DeleteSnapshotsRequest) (*cbs.DeleteSnapshotsResponse, error) {
+	response := cbs.NewDeleteSnapshotsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) ApplySnapshot(ctx context.Context, request *cbs.ApplySnapshotRequest) (*cbs.ApplySnapshotResponse, error) {
+	response := cbs.NewApplySnapshotResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeSnapshotOverview(ctx context.Context, request *cbsext.DescribeSnapshotOverviewRequest) (*cbsext.DescribeSnapshotOverviewResponse, error) {
+	response := cbsext.NewDescribeSnapshotOverviewResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) CopySnapshotCrossRegions(ctx context.Context, request *cbsext.CopySnapshotCrossRegionsRequest) (*cbsext.CopySnapshotCrossRegionsResponse, error) {
+	response := cbsext.NewCopySnapshotCrossRegionsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeDiskConfigQuota(ctx context.Context, request *cbs.DescribeDiskConfigQuotaRequest) (*cbs.DescribeDiskConfigQuotaResponse, error) {
+	response := cbs.NewDescribeDiskConfigQuotaResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeInstances(ctx context.Context, request *cvm.DescribeInstancesRequest) (*cvm.DescribeInstancesResponse, error) {
+	response := cvm.NewDescribeInstancesResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) CreateDiskBackup(ctx context.Context, request *cbsext.CreateDiskBackupRequest) (*cbsext.CreateDiskBackupResponse, error) {
+	response := cbsext.NewCreateDiskBackupResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeDiskBackups(ctx context.Context, request *cbsext.DescribeDiskBackupsRequest) (*cbsext.DescribeDiskBackupsResponse, error) {
+	response := cbsext.NewDescribeDiskBackupsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteDiskBackups(ctx context.Context, request *cbsext.DeleteDiskBackupsRequest) (*cbsext.DeleteDiskBackupsResponse, error) {
+	response := cbsext.NewDeleteDiskBackupsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeZones(ctx context.Context, request *cvm.DescribeZonesRequest) (*cvm.DescribeZonesResponse, error) {
+	response := cvm.NewDescribeZonesResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) CreateImage(ctx context.Context, request *cvm.CreateImageRequest) (*cvm.CreateImageResponse, error) {
+	response := cvm.NewCreateImageResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeImages(ctx context.Context, request *cvm.DescribeImagesRequest) (*cvm.DescribeImagesResponse, error) {
+	response := cvm.NewDescribeImagesResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) ExportImages(ctx context.Context, request *cvm.ExportImagesRequest) (*cvm.ExportImagesResponse, error) {
+	response := cvm.NewExportImagesResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteImages(ctx context.Context, request *cvm.DeleteImagesRequest) (*cvm.DeleteImagesResponse, error) {
+	response := cvm.NewDeleteImagesResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,487 @@
+package cbs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds driver settings which can be tuned at runtime through the config file.
+type Config struct {
+	// default disk type and charge type when storage class does not specify one
+	DiskType       string `yaml:"diskType"`
+	DiskChargeType string `yaml:"diskChargeType"`
+
+	// default filesystem when volume capability does not specify one
+	FsType string `yaml:"fsType"`
+
+	// tags attached to every disk created by the driver
+	Tags map[string]string `yaml:"tags"`
+
+	// allow pvc annotations to override some storage class parameters, requires
+	// external-provisioner running with --extra-create-metadata
+	PVCAnnotationOverrides bool `yaml:"pvcAnnotationOverrides"`
+
+	// how long to wait for a disk to become ready after create, attach or detach
+	CreateTimeout time.Duration `yaml:"createTimeout"`
+	AttachTimeout time.Duration `yaml:"attachTimeout"`
+	DetachTimeout time.Duration `yaml:"detachTimeout"`
+	// interval between two disk state checks while waiting
+	PollInterval time.Duration `yaml:"pollInterval"`
+
+	// how long the node waits for the device of an attached disk to appear, and the first
+	// interval between two checks which doubles after every check
+	DeviceWaitTimeout  time.Duration `yaml:"deviceWaitTimeout"`
+	DeviceWaitInterval time.Duration `yaml:"deviceWaitInterval"`
+
+	// interval between two checks of staged volumes for read only remounts
+	VolumeHealthCheckInterval time.Duration `yaml:"volumeHealthCheckInterval"`
+
+	// fraction of the bytes or inodes of a staged volume in use at which a VolumeNearlyFull event is
+	// recorded on its claim, zero disables the events
+	VolumeFullThreshold float64 `yaml:"volumeFullThreshold"`
+
+	// maximum number of volumes attached to a node reported to the scheduler, zero means no limit
+	MaxVolumesPerNode int64 `yaml:"maxVolumesPerNode"`
+
+	// interval between two fstrim runs of volumes with discard set to fstrim
+	FstrimInterval time.Duration `yaml:"fstrimInterval"`
+
+	// file the node keeps its staged volumes in to restore them after a restart, only read at
+	// startup, empty means the volumes are reconstructed from the mount table
+	StateFile string `yaml:"stateFile"`
+
+	// file a json line is appended to for every cloud api call which changes disks, only read at
+	// startup, empty disables the audit log
+	AuditLogFile string `yaml:"auditLogFile"`
+
+	// address the prometheus metrics are served at, e.g. :9199, only read at startup, empty
+	// disables the listener
+	MetricsAddress string `yaml:"metricsAddress"`
+
+	// address the pprof endpoints are served at, e.g. localhost:6060, only read at startup, empty
+	// disables the listener
+	PprofAddress string `yaml:"pprofAddress"`
+
+	// address /healthz and /readyz are served at, e.g. :9808, only read at startup, empty disables
+	// the listener
+	HealthAddress string `yaml:"healthAddress"`
+
+	// otlp http endpoint spans are exported to, e.g. http://otel-collector:4318, only read at
+	// startup, empty disables tracing
+	TracingEndpoint string `yaml:"tracingEndpoint"`
+
+	// serve the grpc reflection service for debugging with grpcurl, only read at startup
+	GRPCReflection bool `yaml:"grpcReflection"`
+
+	// glog verbosity of the driver, the -v flag is changed when the config file is reloaded
+	LogLevel int `yaml:"logLevel"`
+
+	// glog verbosity at which csi rpcs and their responses are logged, failed rpcs are always logged
+	GRPCLogLevel int `yaml:"grpcLogLevel"`
+
+	// octal mode, e.g. 0660, and numeric uid:gid of the unix socket the driver listens on, only read
+	// at startup, empty keeps the umask default and the user and group of the driver
+	SocketMode  string `yaml:"socketMode"`
+	SocketOwner string `yaml:"socketOwner"`
+
+	// server certificate and key of a tcp endpoint, and the ca client certificates must be signed
+	// by, only read at startup, an empty client ca accepts clients without certificates
+	TLSCertFile     string `yaml:"tlsCertFile"`
+	TLSKeyFile      string `yaml:"tlsKeyFile"`
+	TLSClientCAFile string `yaml:"tlsClientCAFile"`
+
+	// how long rpcs in flight may take to finish after SIGTERM before the driver exits anyway, only
+	// read at startup
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	// only let the replica holding the controller lease create, delete, attach and detach disks, so
+	// the controller can run with several replicas, only read at startup
+	LeaderElection bool `yaml:"leaderElection"`
+
+	// keep a DiskInfo resource with the cloud state of the disk of every bound persistent volume in
+	// the namespace of its claim, only read at startup
+	DiskInfo bool `yaml:"diskInfo"`
+
+	// take the snapshots of the VolumeSnapshotSchedule resources when they are due, only read at
+	// startup
+	SnapshotSchedules bool `yaml:"snapshotSchedules"`
+
+	// freeze and thaw the filesystems of staged volumes as asked by the VolumeFreeze resources of the
+	// instance, enable it on the nodes, only read at startup
+	VolumeFreeze bool `yaml:"volumeFreeze"`
+
+	// roll the disks of the VolumeRollback resources back to their snapshots, only read at startup
+	VolumeRollbacks bool `yaml:"volumeRollbacks"`
+
+	// migrate the volumes of pods which can not be scheduled because their disks are in another zone
+	// through a snapshot, enable it on the controller only, only read at startup
+	VolumeMigrations bool `yaml:"volumeMigrations"`
+
+	// interval between two updates of the disk usage metrics of the zones of the region, zero
+	// disables them, enable them on the controller only, only read at startup
+	QuotaMetricsInterval time.Duration `yaml:"quotaMetricsInterval"`
+
+	// snapshot of a system disk the snapshots exported to cos are combined with, cvm only creates
+	// images of snapshots including a system disk, exports wait until it is set
+	ExportSystemDiskSnapshotId string `yaml:"exportSystemDiskSnapshotId"`
+
+	// interval between two updates of the size and cost metrics of the snapshots of the region, zero
+	// disables them, enable them on the controller only, only read at startup
+	SnapshotMetricsInterval time.Duration `yaml:"snapshotMetricsInterval"`
+
+	// interval between two test restores of a sampled recent snapshot, zero disables them, enable
+	// them on the controller only, only read at startup
+	SnapshotVerifyInterval time.Duration `yaml:"snapshotVerifyInterval"`
+
+	// price of a GB of snapshots a month, the cost metrics of snapshots are only exported when it is
+	// set
+	SnapshotPricePerGB float64 `yaml:"snapshotPricePerGB"`
+
+	// data disk quota of the account in GB by zone and disk type, as granted in the console, the
+	// api does not return it
+	DiskQuotas map[string]map[string]uint64 `yaml:"diskQuotas"`
+
+	// interval between two cloud api checks made by Probe, zero disables the check
+	ProbeCloudInterval time.Duration `yaml:"probeCloudInterval"`
+
+	// reject new CreateVolume calls with UNAVAILABLE, e.g. during maintenance, deleting, attaching
+	// and detaching disks keeps working
+	Drain bool `yaml:"drain"`
+
+	// server side deadlines of rpcs by method, e.g. CreateVolume, waiting for a disk after create,
+	// attach or detach also stops at the deadline
+	RPCTimeouts map[string]time.Duration `yaml:"rpcTimeouts"`
+
+	// maximum number of controller and node rpcs in flight, further rpcs fail with
+	// RESOURCE_EXHAUSTED, zero means no limit
+	MaxInflightRequests int `yaml:"maxInflightRequests"`
+
+	// cloud api calls taking longer are logged as warnings, zero disables the warnings
+	SlowCallThreshold time.Duration `yaml:"slowCallThreshold"`
+
+	// waits for a disk to become available, attached or unattached taking longer are logged as
+	// warnings with the current state of the disk, zero disables the warnings
+	SlowWaitThreshold time.Duration `yaml:"slowWaitThreshold"`
+
+	// snapshots taken by a schedule which sets no maxAge, or by a deleted schedule if tags are set,
+	// older than this are deleted, zero keeps them
+	SnapshotMaxAge time.Duration `yaml:"snapshotMaxAge"`
+
+	// snapshots a disk can have as limited by cbs, and snapshots of the account in the region as
+	// granted in the console, which the api does not return. Snapshots beyond them are rejected before
+	// the cloud api is called, zero disables the checks
+	SnapshotsPerDisk int `yaml:"snapshotsPerDisk"`
+	SnapshotQuota    int `yaml:"snapshotQuota"`
+
+	// delete the oldest snapshots taken by schedules of a disk with snapshotsPerDisk snapshots to
+	// make room for a new one, instead of failing
+	RotateSnapshots bool `yaml:"rotateSnapshots"`
+
+	// daily time ranges in UTC, e.g. "22:00-04:00", scheduled snapshots are taken in, and the
+	// duration the snapshots of a run are spread over, for schedules which set neither
+	SnapshotWindows []string      `yaml:"snapshotWindows"`
+	SnapshotStagger time.Duration `yaml:"snapshotStagger"`
+
+	// how long the controller waits for the node to freeze the filesystem of a volume snapshotted
+	// with fsFreeze
+	FreezeTimeout time.Duration `yaml:"freezeTimeout"`
+
+	// cloud api calls per second and burst, zero means no limit
+	APIRateLimit float64 `yaml:"apiRateLimit"`
+	APIRateBurst int     `yaml:"apiRateBurst"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		DiskType:       DiskTypeDefault,
+		DiskChargeType: DiskChargeTypeDefault,
+		FsType:         FsTypeDefault,
+		CreateTimeout:  time.Second * 120,
+		AttachTimeout:  time.Second * 120,
+		DetachTimeout:  time.Second * 120,
+		PollInterval:   time.Second * 5,
+
+		DeviceWaitTimeout:  time.Second * 30,
+		DeviceWaitInterval: time.Second,
+
+		SlowCallThreshold: time.Second * 5,
+		SlowWaitThreshold: time.Minute,
+
+		VolumeHealthCheckInterval: time.Minute,
+		FstrimInterval:            time.Hour * 24,
+
+		ShutdownTimeout: time.Minute * 2,
+
+		SnapshotsPerDisk: 64,
+		FreezeTimeout:    time.Second * 30,
+
+		APIRateBurst: 10,
+	}
+}
+
+// LoadConfig reads the config file at path, fields not set in the file keep the value of base.
+func LoadConfig(path string, base *Config) (*Config, error) {
+	cfg := *base
+	cfg.Tags = nil
+	cfg.RPCTimeouts = nil
+	cfg.DiskQuotas = nil
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config file %s err: %v", path, err)
+	}
+	if cfg.Tags == nil {
+		cfg.Tags = base.Tags
+	}
+	if cfg.RPCTimeouts == nil {
+		cfg.RPCTimeouts = base.RPCTimeouts
+	}
+	if cfg.DiskQuotas == nil {
+		cfg.DiskQuotas = base.DiskQuotas
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	if !isValidDiskType(cfg.DiskType) {
+		return fmt.Errorf("diskType %s not supported", cfg.DiskType)
+	}
+	if cfg.DiskChargeType != DiskChargeTypePrePaid && cfg.DiskChargeType != DiskChargeTypePostPaidByHour {
+		return fmt.Errorf("diskChargeType %s not supported", cfg.DiskChargeType)
+	}
+	if !isValidFsType(cfg.FsType) {
+		return fmt.Errorf("fsType %s not supported", cfg.FsType)
+	}
+	if cfg.CreateTimeout <= 0 || cfg.AttachTimeout <= 0 || cfg.DetachTimeout <= 0 {
+		return fmt.Errorf("timeouts must be positive")
+	}
+	if cfg.PollInterval <= 0 {
+		return fmt.Errorf("pollInterval must be positive")
+	}
+	if cfg.DeviceWaitTimeout <= 0 || cfg.DeviceWaitInterval <= 0 {
+		return fmt.Errorf("deviceWaitTimeout and deviceWaitInterval must be positive")
+	}
+	if cfg.VolumeHealthCheckInterval <= 0 {
+		return fmt.Errorf("volumeHealthCheckInterval must be positive")
+	}
+	if cfg.VolumeFullThreshold < 0 || cfg.VolumeFullThreshold > 1 {
+		return fmt.Errorf("volumeFullThreshold must be between 0 and 1")
+	}
+	if cfg.MaxVolumesPerNode < 0 {
+		return fmt.Errorf("maxVolumesPerNode must not be negative")
+	}
+	if cfg.FstrimInterval <= 0 {
+		return fmt.Errorf("fstrimInterval must be positive")
+	}
+	if cfg.SlowCallThreshold < 0 || cfg.SlowWaitThreshold < 0 {
+		return fmt.Errorf("slowCallThreshold and slowWaitThreshold must not be negative")
+	}
+	if cfg.SnapshotMaxAge < 0 {
+		return fmt.Errorf("snapshotMaxAge must not be negative")
+	}
+	if cfg.SnapshotsPerDisk < 0 || cfg.SnapshotQuota < 0 {
+		return fmt.Errorf("snapshotsPerDisk and snapshotQuota must not be negative")
+	}
+	if _, err := parseSnapshotWindows(cfg.SnapshotWindows); err != nil {
+		return err
+	}
+	if cfg.SnapshotStagger < 0 {
+		return fmt.Errorf("snapshotStagger must not be negative")
+	}
+	if cfg.FreezeTimeout <= 0 {
+		return fmt.Errorf("freezeTimeout must be positive")
+	}
+	if cfg.QuotaMetricsInterval < 0 {
+		return fmt.Errorf("quotaMetricsInterval must not be negative")
+	}
+	if cfg.SnapshotVerifyInterval < 0 {
+		return fmt.Errorf("snapshotVerifyInterval must not be negative")
+	}
+	if cfg.SnapshotMetricsInterval < 0 || cfg.SnapshotPricePerGB < 0 {
+		return fmt.Errorf("snapshotMetricsInterval and snapshotPricePerGB must not be negative")
+	}
+	if cfg.ProbeCloudInterval < 0 {
+		return fmt.Errorf("probeCloudInterval must not be negative")
+	}
+	if _, err := parseSocketMode(cfg.SocketMode); err != nil {
+		return err
+	}
+	if _, _, err := parseSocketOwner(cfg.SocketOwner); err != nil {
+		return err
+	}
+	if cfg.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdownTimeout must not be negative")
+	}
+	if cfg.LogLevel < 0 {
+		return fmt.Errorf("logLevel must not be negative")
+	}
+	if cfg.GRPCLogLevel < 0 {
+		return fmt.Errorf("grpcLogLevel must not be negative")
+	}
+	for method, timeout := range cfg.RPCTimeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("rpcTimeouts of %s must be positive", method)
+		}
+	}
+	if cfg.MaxInflightRequests < 0 {
+		return fmt.Errorf("maxInflightRequests must not be negative")
+	}
+	if cfg.APIRateLimit < 0 {
+		return fmt.Errorf("apiRateLimit must not be negative")
+	}
+	if cfg.APIRateLimit > 0 && cfg.APIRateBurst < 1 {
+		return fmt.Errorf("apiRateBurst must be at least 1 when apiRateLimit is set")
+	}
+	return nil
+}
+
+// configStore keeps the current config and reloads it when the config file changes.
+type configStore struct {
+	path string
+	base *Config
+
+	mutex    sync.RWMutex
+	config   *Config
+	onReload []func(*Config)
+}
+
+func newConfigStore(path string, base *Config) (*configStore, error) {
+	if err := base.validate(); err != nil {
+		return nil, err
+	}
+
+	store := &configStore{
+		path:   path,
+		base:   base,
+		config: base,
+	}
+
+	if path == "" {
+		return store, nil
+	}
+
+	cfg, err := LoadConfig(path, base)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		logging.Infof("config file %s not found, using default config", path)
+		return store, nil
+	}
+	store.config = cfg
+
+	return store, nil
+}
+
+func (store *configStore) Get() *Config {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.config
+}
+
+// OnReload registers f to be called with the new config after every successful reload.
+func (store *configStore) OnReload(f func(*Config)) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.onReload = append(store.onReload, f)
+}
+
+func (store *configStore) reload() {
+	cfg, err := LoadConfig(store.path, store.base)
+	if err != nil {
+		logging.Errorf("reload config failed, keep using the previous one: %v", err)
+		return
+	}
+
+	store.mutex.Lock()
+	store.config = cfg
+	callbacks := store.onReload
+	store.mutex.Unlock()
+
+	for _, f := range callbacks {
+		f(cfg)
+	}
+
+	logging.Infof("config reloaded from %s: %+v", store.path, *cfg)
+}
+
+// Watch reloads the config whenever the config file changes until stopCh is closed.
+// The parent directory is watched instead of the file itself, because configmap
+// volumes are updated by atomically swapping a symlink.
+func (store *configStore) Watch(stopCh <-chan struct{}) error {
+	if store.path == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(filepath.Dir(store.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case event := <-watcher.Events:
+				if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+					continue
+				}
+				logging.V(4).Infof("config directory changed: %s", event)
+				store.reload()
+			case err := <-watcher.Errors:
+				logging.Errorf("watch config file %s err: %v", store.path, err)
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// ParseRPCTimeouts parses comma separated method=duration pairs, e.g. CreateVolume=5m,DeleteVolume=1m.
+func ParseRPCTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	if s == "" {
+		return timeouts, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid rpc timeout %s, expected method=duration", pair)
+		}
+		timeout, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rpc timeout %s: %v", pair, err)
+		}
+		timeouts[parts[0]] = timeout
+	}
+	return timeouts, nil
+}
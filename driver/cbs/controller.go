@@ -1,14 +1,18 @@
 package cbs
 
 import (
-	"strconv"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
 	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
 	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -46,177 +50,324 @@ var (
 
 	DiskChargePrepaidRenewFlagDefault = DiskChargePrepaidRenewFlagNotifyAndManualRenewd
 
+	// filesystem of the volume, passed to the node in volume attributes
+	FsTypeAttr    = "fsType"
+	FsTypeCSIAttr = "csi.storage.k8s.io/fstype"
+
+	// extra mkfs arguments used when the node formats a blank disk, passed to the node in volume attributes
+	MkfsOptionsAttr = "mkfsOptions"
+
+	// cbs disk tags, merged with the tags in config
+	TagsAttr = "tags"
+
 	// cbs disk encrypt
 	EncryptAttr   = "encrypt"
 	EncryptEnable = "ENCRYPT"
 
+	// attach information returned in publish info of ControllerPublishVolume
+	PublishInfoDiskSerial = "diskSerial"
+	PublishInfoDevicePath = "devicePath"
+
 	// cbs status
 	StatusUnattached = "UNATTACHED"
 	StatusAttached   = "ATTACHED"
 )
 
 type cbsController struct {
-	cbsClient *cbs.Client
+	cbsClient *cloudClient
 	zone      string
+	config    *configStore
+	// optional, nil when the driver does not run in a kubernetes cluster
+	kubeClient *kube.Client
+
+	limiterMutex sync.RWMutex
+	limiter      *rate.Limiter
+
+	instances *instanceIdCache
+
+	// snapshots created by the controller which are not ready yet
+	snapshots *snapshotTracker
+
+	// nil unless leader election is enabled
+	leader *leaderElector
 }
 
-func newCbsController(secretId, secretKey, region, zone string) (*cbsController, error) {
-	client, err := cbs.NewClient(common.NewCredential(secretId, secretKey), region, profile.NewClientProfile())
-	if err != nil {
-		return nil, err
+func newCbsController(client *cloudClient, zone string, config *configStore, kubeClient *kube.Client) (*cbsController, error) {
+	ctrl := &cbsController{
+		cbsClient:  client,
+		zone:       zone,
+		config:     config,
+		kubeClient: kubeClient,
+		instances:  newInstanceIdCache(),
+		snapshots:  newSnapshotTracker(),
 	}
 
-	return &cbsController{
-		cbsClient: client,
-		zone:      zone,
-	}, nil
-}
+	ctrl.setRateLimit(config.Get())
+	config.OnReload(ctrl.setRateLimit)
 
-func (ctrl *cbsController) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
-	if req.Name == "" {
-		return nil, status.Error(codes.InvalidArgument, "volume name is empty")
+	if config.Get().LeaderElection {
+		if kubeClient == nil {
+			return nil, fmt.Errorf("leader election requires a kubernetes client")
+		}
+		leader, err := newLeaderElector(kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		ctrl.leader = leader
+		go leader.run(make(chan struct{}))
 	}
 
-	volumeIdempotencyName := req.Name
-	volumeCapacity := req.CapacityRange.RequiredBytes
+	go ctrl.runSnapshotTracking(make(chan struct{}))
 
-	if len(req.VolumeCapabilities) <= 0 {
-		return nil, status.Error(codes.InvalidArgument, "volume has no capabilities")
+	if config.Get().DiskInfo {
+		if kubeClient == nil {
+			return nil, fmt.Errorf("disk info requires a kubernetes client")
+		}
+		go ctrl.runDiskInfoSync(make(chan struct{}))
 	}
 
-	for _, c := range req.VolumeCapabilities {
-		if c.GetBlock() != nil {
-			return nil, status.Error(codes.InvalidArgument, "block volume is not supported")
+	if config.Get().SnapshotSchedules {
+		if kubeClient == nil {
+			return nil, fmt.Errorf("snapshot schedules require a kubernetes client")
 		}
-		if c.AccessMode.Mode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
-			return nil, status.Error(codes.InvalidArgument, "block access mode only support singer node writer")
+		go ctrl.runSnapshotSchedules(make(chan struct{}))
+		go ctrl.runSnapshotReaper(make(chan struct{}))
+	}
+
+	if config.Get().VolumeRollbacks {
+		if kubeClient == nil {
+			return nil, fmt.Errorf("volume rollbacks require a kubernetes client")
 		}
+		go ctrl.runVolumeRollbacks(make(chan struct{}))
 	}
 
-	volumeType, ok := req.Parameters[DiskTypeAttr]
-	if !ok {
-		volumeType = DiskTypeDefault
+	if config.Get().VolumeMigrations {
+		if kubeClient == nil {
+			return nil, fmt.Errorf("volume migrations require a kubernetes client")
+		}
+		go ctrl.runVolumeMigrations(make(chan struct{}))
 	}
 
-	if volumeType != DiskTypeCloudBasic && volumeType != DiskTypeCloudPremium && volumeType != DiskTypeCloudSsd {
-		return nil, status.Error(codes.InvalidArgument, "cbs type not supported")
+	if interval := config.Get().QuotaMetricsInterval; interval > 0 {
+		go ctrl.runQuotaMetrics(interval, make(chan struct{}))
 	}
 
-	volumeChargeType, ok := req.Parameters[DiskChargeTypeAttr]
-	if !ok {
-		volumeChargeType = DiskChargeTypeDefault
+	if interval := config.Get().SnapshotMetricsInterval; interval > 0 {
+		go ctrl.runSnapshotMetrics(interval, make(chan struct{}))
 	}
 
-	var volumeChargePrepaidPeriod int
-	var volumeChargePrepaidRenewFlag string
+	if interval := config.Get().SnapshotVerifyInterval; interval > 0 {
+		go ctrl.runSnapshotVerification(interval, make(chan struct{}))
+	}
 
-	if volumeChargeType == DiskChargeTypePrePaid {
-		var err error
-		var ok bool
-		volumeChargePrepaidPeriodStr, ok := req.Parameters[DiskChargePrepaidPeriodAttr]
-		if !ok {
-			volumeChargePrepaidPeriodStr = strconv.Itoa(DiskChargePrepaidPeriodDefault)
-		}
+	return ctrl, nil
+}
 
-		volumeChargePrepaidPeriod, err = strconv.Atoi(volumeChargePrepaidPeriodStr)
-		if err != nil {
-			return nil, status.Error(codes.InvalidArgument, "prepaid period not valid")
-		}
+func (ctrl *cbsController) setRateLimit(cfg *Config) {
+	limit := rate.Inf
+	if cfg.APIRateLimit > 0 {
+		limit = rate.Limit(cfg.APIRateLimit)
+	}
 
-		found := false
+	ctrl.limiterMutex.Lock()
+	defer ctrl.limiterMutex.Unlock()
 
-		for _, p := range DiskChargePrepaidPeriodValidValues {
-			if p == volumeChargePrepaidPeriod {
-				found = true
-			}
-		}
+	ctrl.limiter = rate.NewLimiter(limit, cfg.APIRateBurst)
+}
 
-		if !found {
-			return nil, status.Error(codes.InvalidArgument, "can not found valid prepaid period")
-		}
+// waitRateLimit blocks until the next cloud api call is allowed by the configured rate limit.
+func (ctrl *cbsController) waitRateLimit(ctx context.Context) error {
+	ctrl.limiterMutex.RLock()
+	limiter := ctrl.limiter
+	ctrl.limiterMutex.RUnlock()
+
+	start := time.Now()
+	if err := limiter.Wait(ctx); err != nil {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	cloudAPIRateLimitWaitSeconds.Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (ctrl *cbsController) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume name is empty")
+	}
+
+	ctx, cancelTerm, err := ctrl.leaderContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelTerm()
 
-		volumeChargePrepaidRenewFlag, ok = req.Parameters[DiskChargePrepaidRenewFlagAttr]
-		if !ok {
-			volumeChargePrepaidRenewFlag = DiskChargePrepaidRenewFlagDefault
+	cfg := ctrl.config.Get()
+
+	if cfg.Drain {
+		return nil, status.Error(codes.Unavailable, "provisioning is drained, set drain to false in the config file to resume")
+	}
+
+	volumeIdempotencyName := req.Name
+
+	if len(req.VolumeCapabilities) <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume has no capabilities")
+	}
+
+	for _, c := range req.VolumeCapabilities {
+		if c.GetBlock() != nil {
+			return nil, status.Error(codes.InvalidArgument, "block volume is not supported")
+		}
+		if c.AccessMode.Mode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
+			return nil, status.Error(codes.InvalidArgument, "block access mode only support singer node writer")
 		}
-		if volumeChargePrepaidRenewFlag != DiskChargePrepaidRenewFlagDisableNotifyAndManualRenew && volumeChargePrepaidRenewFlag != DiskChargePrepaidRenewFlagNotifyAndAutoRenew && volumeChargePrepaidRenewFlag != DiskChargePrepaidRenewFlagNotifyAndManualRenewd {
-			return nil, status.Error(codes.InvalidArgument, "invalid renew flag")
+		if c.GetMount() != nil {
+			if _, err := normalizeMountOptions(c.GetMount().MountFlags); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
 		}
+	}
 
+	parameters, err := ctrl.applyPVCOverrides(ctx, req.Parameters)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	volumeEncrypt, ok := req.Parameters[EncryptAttr]
-	if !ok {
-		volumeEncrypt = ""
+	p, err := parseCreateParameters(parameters, cfg)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	if volumeEncrypt != "" && volumeEncrypt != EncryptEnable {
-		return nil, status.Error(codes.InvalidArgument, "volume encrypt not valid")
+	snapshot, err := ctrl.restoreSnapshot(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	createCbsReq := cbs.NewCreateDisksRequest()
 
 	createCbsReq.ClientToken = &volumeIdempotencyName
-	createCbsReq.DiskType = &volumeType
-	createCbsReq.DiskChargeType = &volumeChargeType
+	createCbsReq.DiskType = &p.diskType
+	createCbsReq.DiskChargeType = &p.chargeType
 
-	if volumeChargeType == DiskChargeTypePrePaid {
-		period := uint64(volumeChargePrepaidPeriod)
+	if p.chargeType == DiskChargeTypePrePaid {
+		period := uint64(p.prepaidPeriod)
 		createCbsReq.DiskChargePrepaid = &cbs.DiskChargePrepaid{
 			Period:    &period,
-			RenewFlag: &volumeChargePrepaidRenewFlag,
+			RenewFlag: &p.prepaidRenewFlag,
 		}
 	}
 
-	gb := uint64(volumeCapacity / int64(GB))
+	gb := uint64(req.GetCapacityRange().GetRequiredBytes() / int64(GB))
+	if gb == 0 {
+		// no capacity requested, create the smallest disk of the disk type
+		gb = uint64(DiskSizeLimits[p.diskType][0])
+	}
 
 	createCbsReq.DiskSize = &gb
 
-	if volumeEncrypt == EncryptEnable {
+	if snapshot != nil {
+		if gb, err = restoreSizeGB(snapshot, req.CapacityRange); err != nil {
+			return nil, err
+		}
+		if err := checkRestoreDiskType(snapshot, p.diskType, gb); err != nil {
+			return nil, err
+		}
+		logging.Infof("restoring snapshot %s onto a %dGB %s disk", *snapshot.SnapshotId, gb, p.diskType)
+		createCbsReq.SnapshotId = snapshot.SnapshotId
+		// a disk restored from an encrypted snapshot is encrypted
+		if snapshot.Encrypt != nil && *snapshot.Encrypt {
+			p.encrypt = EncryptEnable
+		}
+	}
+
+	if p.encrypt == EncryptEnable {
 		createCbsReq.Encrypt = &EncryptEnable
 	}
 
+	zone := volumeZone(req.AccessibilityRequirements, ctrl.zone)
 	createCbsReq.Placement = &cbs.Placement{
-		Zone: &ctrl.zone,
+		Zone: &zone,
 	}
 
-	createCbsResponse, err := ctrl.cbsClient.CreateDisks(createCbsReq)
+	createCbsReq.Tags = diskTags(p.tags)
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	createCbsResponse, err := ctrl.cbsClient.CreateDisks(ctx, createCbsReq)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		ctrl.recordProvisioningEvent(req.Parameters, err)
+		return nil, cloudError(codes.Internal, err)
 	}
 
 	if len(createCbsResponse.Response.DiskIdSet) <= 0 {
-		return nil, status.Errorf(codes.Internal, "create disk failed, no disk id found in create disk response, request id %s", *createCbsResponse.Response.RequestId)
+		return nil, status.Errorf(codes.Internal, "create disk failed, no disk id found in create disk response, request id %s", requestIdOf(createCbsResponse.Response.RequestId))
 	}
 
 	diskId := *createCbsResponse.Response.DiskIdSet[0]
 
+	volumeAttributes := map[string]string{
+		FsLabelAttr: req.Name,
+	}
+	if p.fsType != "" {
+		volumeAttributes[FsTypeAttr] = p.fsType
+	}
+	if p.mkfsOptions != "" {
+		volumeAttributes[MkfsOptionsAttr] = p.mkfsOptions
+	}
+	if p.reservedBlocks != "" {
+		volumeAttributes[ReservedBlocksPercentageAttr] = p.reservedBlocks
+	}
+	if p.luksEncrypt {
+		volumeAttributes[LuksEncryptAttr] = LuksEncryptTrue
+	}
+	if p.discard != "" {
+		volumeAttributes[DiscardAttr] = p.discard
+	}
+	for attr, value := range p.tuning {
+		volumeAttributes[attr] = value
+	}
+	if snapshot != nil {
+		volumeAttributes[SnapshotIdAttr] = *snapshot.SnapshotId
+	}
+
 	disk := new(cbs.Disk)
 
-	ticker := time.NewTicker(time.Second * 5)
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*120)
+	ctx, cancel := pollContext(ctx, cfg.CreateTimeout)
 	defer cancel()
 
+	wait := newSlowWait("create", diskId)
+
 	for {
 		select {
 		case <-ticker.C:
+			if err := ctrl.waitRateLimit(ctx); err != nil {
+				continue
+			}
+
 			listCbsRequest := cbs.NewDescribeDisksRequest()
 			listCbsRequest.DiskIds = []*string{&diskId}
 
-			listCbsResponse, err := ctrl.cbsClient.DescribeDisks(listCbsRequest)
+			listCbsResponse, err := ctrl.cbsClient.DescribeDisks(ctx, listCbsRequest)
 			if err != nil {
 				continue
 			}
 			if len(listCbsResponse.Response.DiskSet) >= 1 {
 				for _, d := range listCbsResponse.Response.DiskSet {
 					if *d.DiskId == diskId && d.DiskState != nil {
+						operations.observeDiskState(ctx, diskId, *d.DiskState)
+						wait.observe(ctx, cfg.SlowWaitThreshold, *d.DiskState)
 						if *d.DiskState == StatusAttached || *d.DiskState == StatusUnattached {
 							disk = d
 							return &csi.CreateVolumeResponse{
 								Volume: &csi.Volume{
-									Id:            *disk.DiskId,
-									CapacityBytes: int64(int(*disk.DiskSize) * GB),
+									Id:                 *disk.DiskId,
+									CapacityBytes:      int64(int(*disk.DiskSize) * GB),
+									Attributes:         volumeAttributes,
+									ContentSource:      req.VolumeContentSource,
+									AccessibleTopology: zoneTopology(zone),
 								},
 							}, nil
 						}
@@ -224,7 +375,7 @@ func (ctrl *cbsController) CreateVolume(ctx context.Context, req *csi.CreateVolu
 				}
 			}
 		case <-ctx.Done():
-			return nil, status.Error(codes.DeadlineExceeded, "cbs disk is not ready before deadline exceeded")
+			return nil, status.Errorf(codes.DeadlineExceeded, "cbs disk %s is not ready before deadline exceeded, CreateDisks request id %s", diskId, requestIdOf(createCbsResponse.Response.RequestId))
 		}
 	}
 }
@@ -233,24 +384,46 @@ func (ctrl *cbsController) DeleteVolume(ctx context.Context, req *csi.DeleteVolu
 	if req.VolumeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
+
+	ctx, cancelTerm, err := ctrl.leaderContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelTerm()
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
 
 	describeDiskRequest := cbs.NewDescribeDisksRequest()
 	describeDiskRequest.DiskIds = []*string{&req.VolumeId}
-	describeDiskResponse, err := ctrl.cbsClient.DescribeDisks(describeDiskRequest)
+	describeDiskResponse, err := ctrl.cbsClient.DescribeDisks(ctx, describeDiskRequest)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, cloudError(codes.Internal, err)
 	}
 
 	if len(describeDiskResponse.Response.DiskSet) <= 0 {
 		return &csi.DeleteVolumeResponse{}, nil
 	}
 
+	for _, disk := range describeDiskResponse.Response.DiskSet {
+		if *disk.DiskId == req.VolumeId && isRetained(disk) {
+			logging.Infof("disk %s has tag %s=%s, not terminating it", req.VolumeId, RetainTagKey, RetainTagValue)
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
 	terminateCbsRequest := cbs.NewTerminateDisksRequest()
 	terminateCbsRequest.DiskIds = []*string{&req.VolumeId}
 
-	_, err = ctrl.cbsClient.TerminateDisks(terminateCbsRequest)
+	_, err = ctrl.cbsClient.TerminateDisks(ctx, terminateCbsRequest)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, cloudError(codes.Internal, err)
 	}
 
 	return &csi.DeleteVolumeResponse{}, nil
@@ -260,6 +433,7 @@ func (ctrl *cbsController) ControllerPublishVolume(ctx context.Context, req *csi
 	if req.VolumeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
 	if req.NodeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "node id is empty")
 	}
@@ -268,67 +442,106 @@ func (ctrl *cbsController) ControllerPublishVolume(ctx context.Context, req *csi
 		return nil, status.Error(codes.InvalidArgument, "volume has no capabilities")
 	}
 
+	ctx, cancelTerm, err := ctrl.leaderContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelTerm()
+
+	cfg := ctrl.config.Get()
+
 	diskId := req.VolumeId
-	instanceId := req.NodeId
+
+	instanceId, err := ctrl.resolveInstanceId(ctx, req.NodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
 
 	listCbsRequest := cbs.NewDescribeDisksRequest()
 	listCbsRequest.DiskIds = []*string{&diskId}
 
-	listCbsResponse, err := ctrl.cbsClient.DescribeDisks(listCbsRequest)
+	listCbsResponse, err := ctrl.cbsClient.DescribeDisks(ctx, listCbsRequest)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, cloudError(codes.Internal, err)
 	}
 
 	if len(listCbsResponse.Response.DiskSet) <= 0 {
-		return nil, status.Error(codes.NotFound, "disk not found")
+		return nil, status.Errorf(codes.NotFound, "disk not found, DescribeDisks request id %s", requestIdOf(listCbsResponse.Response.RequestId))
 	}
 
+	var attachedDisk *cbs.Disk
 	for _, disk := range listCbsResponse.Response.DiskSet {
 		if *disk.DiskId == diskId {
+			attachedDisk = disk
 			if *disk.DiskState == StatusAttached && *disk.InstanceId == instanceId {
-				return &csi.ControllerPublishVolumeResponse{}, nil
+				return &csi.ControllerPublishVolumeResponse{PublishInfo: publishInfo(diskId)}, nil
 			}
 			if *disk.DiskState == StatusAttached && *disk.InstanceId != instanceId {
 				return nil, status.Error(codes.FailedPrecondition, "disk is attach to another instance already")
 			}
+			if err := ctrl.checkZone(ctx, disk, instanceId); err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
 	attachDiskRequest := cbs.NewAttachDisksRequest()
 	attachDiskRequest.DiskIds = []*string{&diskId}
 	attachDiskRequest.InstanceId = &instanceId
 
-	_, err = ctrl.cbsClient.AttachDisks(attachDiskRequest)
+	attachStart := time.Now()
+	attachDiskResponse, err := ctrl.cbsClient.AttachDisks(ctx, attachDiskRequest)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		observeAttachment(AttachmentOperationAttach, attachedDisk, attachStart, AttachmentResultError)
+		ctrl.recordAttachEvent(diskId, instanceId, err)
+		return nil, cloudError(codes.Internal, err)
 	}
 
-	ticker := time.NewTicker(time.Second * 5)
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*120)
+	ctx, cancel := pollContext(ctx, cfg.AttachTimeout)
 	defer cancel()
 
+	wait := newSlowWait(AttachmentOperationAttach, diskId)
+
 	for {
 		select {
 		case <-ticker.C:
+			if err := ctrl.waitRateLimit(ctx); err != nil {
+				continue
+			}
+
 			listCbsRequest := cbs.NewDescribeDisksRequest()
 			listCbsRequest.DiskIds = []*string{&diskId}
 
-			listCbsResponse, err := ctrl.cbsClient.DescribeDisks(listCbsRequest)
+			listCbsResponse, err := ctrl.cbsClient.DescribeDisks(ctx, listCbsRequest)
 			if err != nil {
 				continue
 			}
 			if len(listCbsResponse.Response.DiskSet) >= 1 {
 				for _, d := range listCbsResponse.Response.DiskSet {
 					if *d.DiskId == diskId && d.DiskState != nil {
+						operations.observeDiskState(ctx, diskId, *d.DiskState)
+						wait.observe(ctx, cfg.SlowWaitThreshold, *d.DiskState)
 						if *d.DiskState == StatusAttached {
-							return &csi.ControllerPublishVolumeResponse{}, nil
+							observeAttachment(AttachmentOperationAttach, attachedDisk, attachStart, AttachmentResultSuccess)
+							return &csi.ControllerPublishVolumeResponse{PublishInfo: publishInfo(diskId)}, nil
 						}
 					}
 				}
 			}
 		case <-ctx.Done():
-			return nil, status.Error(codes.Internal, "cbs disk is not attached before deadline exceeded")
+			observeAttachment(AttachmentOperationAttach, attachedDisk, attachStart, AttachmentResultTimeout)
+			return nil, status.Errorf(codes.Internal, "cbs disk is not attached before deadline exceeded, AttachDisks request id %s", requestIdOf(attachDiskResponse.Response.RequestId))
 		}
 	}
 }
@@ -337,70 +550,121 @@ func (ctrl *cbsController) ControllerUnpublishVolume(ctx context.Context, req *c
 	if req.VolumeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
 	if req.NodeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "node id is empty")
 	}
 
+	ctx, cancelTerm, err := ctrl.leaderContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelTerm()
+
+	cfg := ctrl.config.Get()
+
 	diskId := req.VolumeId
 
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
 	listCbsRequest := cbs.NewDescribeDisksRequest()
 	listCbsRequest.DiskIds = []*string{&diskId}
 
-	listCbsResponse, err := ctrl.cbsClient.DescribeDisks(listCbsRequest)
+	listCbsResponse, err := ctrl.cbsClient.DescribeDisks(ctx, listCbsRequest)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, cloudError(codes.Internal, err)
 	}
 
 	if len(listCbsResponse.Response.DiskSet) <= 0 {
-		return nil, status.Error(codes.NotFound, "disk not found")
+		return nil, status.Errorf(codes.NotFound, "disk not found, DescribeDisks request id %s", requestIdOf(listCbsResponse.Response.RequestId))
 	}
 
+	var detachedDisk *cbs.Disk
 	for _, disk := range listCbsResponse.Response.DiskSet {
 		if *disk.DiskId == diskId {
+			detachedDisk = disk
 			if *disk.DiskState == StatusUnattached {
 				return &csi.ControllerUnpublishVolumeResponse{}, nil
 			}
 		}
 	}
 
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
 	detachDiskRequest := cbs.NewDetachDisksRequest()
 	detachDiskRequest.DiskIds = []*string{&diskId}
 
-	_, err = ctrl.cbsClient.DetachDisks(detachDiskRequest)
+	detachStart := time.Now()
+	detachDiskResponse, err := ctrl.cbsClient.DetachDisks(ctx, detachDiskRequest)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		observeAttachment(AttachmentOperationDetach, detachedDisk, detachStart, AttachmentResultError)
+		return nil, cloudError(codes.Internal, err)
 	}
 
-	ticker := time.NewTicker(time.Second * 5)
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*120)
+	ctx, cancel := pollContext(ctx, cfg.DetachTimeout)
 	defer cancel()
 
+	wait := newSlowWait(AttachmentOperationDetach, diskId)
+
 	for {
 		select {
 		case <-ticker.C:
+			if err := ctrl.waitRateLimit(ctx); err != nil {
+				continue
+			}
+
 			listCbsRequest := cbs.NewDescribeDisksRequest()
 			listCbsRequest.DiskIds = []*string{&diskId}
 
-			listCbsResponse, err := ctrl.cbsClient.DescribeDisks(listCbsRequest)
+			listCbsResponse, err := ctrl.cbsClient.DescribeDisks(ctx, listCbsRequest)
 			if err != nil {
 				continue
 			}
 			if len(listCbsResponse.Response.DiskSet) >= 1 {
 				for _, d := range listCbsResponse.Response.DiskSet {
 					if *d.DiskId == diskId && d.DiskState != nil {
+						operations.observeDiskState(ctx, diskId, *d.DiskState)
+						wait.observe(ctx, cfg.SlowWaitThreshold, *d.DiskState)
 						if *d.DiskState == StatusUnattached {
+							observeAttachment(AttachmentOperationDetach, detachedDisk, detachStart, AttachmentResultSuccess)
 							return &csi.ControllerUnpublishVolumeResponse{}, nil
 						}
 					}
 				}
 			}
 		case <-ctx.Done():
-			return nil, status.Error(codes.Internal, "cbs disk is not unattached before deadline exceeded")
+			observeAttachment(AttachmentOperationDetach, detachedDisk, detachStart, AttachmentResultTimeout)
+			return nil, status.Errorf(codes.Internal, "cbs disk is not unattached before deadline exceeded, DetachDisks request id %s", requestIdOf(detachDiskResponse.Response.RequestId))
 		}
 	}
 }
 
+func isValidDiskType(diskType string) bool {
+	return diskType == DiskTypeCloudBasic || diskType == DiskTypeCloudPremium || diskType == DiskTypeCloudSsd
+}
+
+func diskTags(tags map[string]string) []*cbs.Tag {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cbsTags := make([]*cbs.Tag, 0, len(keys))
+	for _, k := range keys {
+		key, value := k, tags[k]
+		cbsTags = append(cbsTags, &cbs.Tag{Key: &key, Value: &value})
+	}
+	return cbsTags
+}
+
 func (ctrl *cbsController) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
 	return &csi.ControllerGetCapabilitiesResponse{
 		Capabilities: []*csi.ControllerServiceCapability{
@@ -418,30 +682,74 @@ func (ctrl *cbsController) ControllerGetCapabilities(ctx context.Context, req *c
 					},
 				},
 			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+					},
+				},
+			},
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+					},
+				},
+			},
 		},
 	}, nil
 }
 
-func (ctrl *cbsController) ValidateVolumeCapabilities(context.Context, *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
+func (ctrl *cbsController) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
+	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
 
-func (ctrl *cbsController) ListVolumes(context.Context, *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
-}
+	if len(req.VolumeCapabilities) <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume has no capabilities")
+	}
 
-func (ctrl *cbsController) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	describeDiskRequest := cbs.NewDescribeDisksRequest()
+	describeDiskRequest.DiskIds = []*string{&req.VolumeId}
+	describeDiskResponse, err := ctrl.cbsClient.DescribeDisks(ctx, describeDiskRequest)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+
+	if len(describeDiskResponse.Response.DiskSet) <= 0 {
+		return nil, status.Errorf(codes.NotFound, "disk not found, DescribeDisks request id %s", requestIdOf(describeDiskResponse.Response.RequestId))
+	}
+
+	for _, c := range req.VolumeCapabilities {
+		if c.GetBlock() != nil {
+			return &csi.ValidateVolumeCapabilitiesResponse{Supported: false, Message: "block volume is not supported"}, nil
+		}
+		if c.AccessMode == nil || c.AccessMode.Mode != csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER {
+			return &csi.ValidateVolumeCapabilitiesResponse{Supported: false, Message: "only single node writer is supported"}, nil
+		}
+	}
+
+	return &csi.ValidateVolumeCapabilitiesResponse{Supported: true}, nil
 }
 
-func (ctrl *cbsController) CreateSnapshot(context.Context, *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+func (ctrl *cbsController) ListVolumes(context.Context, *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-func (ctrl *cbsController) DeleteSnapshot(context.Context, *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+func (ctrl *cbsController) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
-func (ctrl *cbsController) ListSnapshots(context.Context, *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+// publishInfo tells the node how to find the attached disk without calling the cloud api: the disk
+// id is the serial number of the device and the by-id path is the expected device of virtio disks.
+func publishInfo(diskId string) map[string]string {
+	return map[string]string{
+		PublishInfoDiskSerial: diskId,
+		PublishInfoDevicePath: path.Join(DiskByIdDevicePath, DiskByIdDeviceNamePrefix+diskId),
+	}
 }
@@ -0,0 +1,96 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"golang.org/x/net/context"
+)
+
+var (
+	// explanations of common cloud api error code prefixes, shown in events to users without
+	// access to the driver logs
+	CloudErrorExplanations = []struct {
+		codePrefix  string
+		explanation string
+	}{
+		{"ResourceInsufficient", "the disk type is sold out in the zone, try another disk type or zone"},
+		{"ResourceUnavailable", "the disk type is not available in the zone, try another disk type or zone"},
+		{"LimitExceeded.InstanceAttachedDisk", "the instance has reached its data disk limit"},
+		{"LimitExceeded", "the disk quota of the account is exceeded"},
+		{"InvalidAccount.InsufficientBalance", "the account balance is insufficient"},
+		{"InvalidAccount", "the account can not create disks, check its balance and verification status"},
+		{"AuthFailure", "the driver credentials were rejected"},
+		{"UnauthorizedOperation", "the driver credentials lack permission for this operation"},
+		{"RequestLimitExceeded", "the cloud api rate limit is exceeded, the operation is retried"},
+		{"InvalidDisk.Busy", "the disk is busy with another operation, the operation is retried"},
+		{"InvalidInstance.NotSupported", "the instance does not support attaching this disk"},
+	}
+)
+
+// explainCloudError returns err with an explanation of its cloud api error code, if known.
+func explainCloudError(err error) string {
+	e, ok := err.(*errors.TencentCloudSDKError)
+	if !ok {
+		return err.Error()
+	}
+	for _, c := range CloudErrorExplanations {
+		if strings.HasPrefix(e.Code, c.codePrefix) {
+			return fmt.Sprintf("%s: %s", c.explanation, e.Error())
+		}
+	}
+	return e.Error()
+}
+
+// recordProvisioningEvent records a warning event on the pvc a disk was created for. The pvc is
+// only known when external-provisioner runs with --extra-create-metadata.
+func (ctrl *cbsController) recordProvisioningEvent(parameters map[string]string, err error) {
+	name, namespace := parameters[PVCNameKey], parameters[PVCNamespaceKey]
+	if ctrl.kubeClient == nil || name == "" || namespace == "" {
+		return
+	}
+
+	message := explainCloudError(err)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		involved := []kube.ObjectReference{{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: namespace, Name: name}}
+		recordWarningEvents(ctx, ctrl.kubeClient, ControllerEventComponent, involved, EventReasonProvisioningFailed, message)
+	}()
+}
+
+// recordAttachEvent records a warning event on the pv of diskId and its claim.
+func (ctrl *cbsController) recordAttachEvent(diskId, instanceId string, err error) {
+	if ctrl.kubeClient == nil {
+		return
+	}
+
+	message := fmt.Sprintf("attach disk %s to instance %s failed, %s", diskId, instanceId, explainCloudError(err))
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		pvs := &kube.PersistentVolumeList{}
+		if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumesPath(), pvs); err != nil {
+			logging.Warningf("list pvs err: %v", err)
+			return
+		}
+
+		for _, pv := range pvs.Items {
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName || legacyVolumeId(pv.Spec.CSI.VolumeHandle) != diskId {
+				continue
+			}
+			involved := []kube.ObjectReference{{APIVersion: "v1", Kind: "PersistentVolume", Name: pv.Metadata.Name, UID: pv.Metadata.UID}}
+			if claim := pv.Spec.ClaimRef; claim != nil {
+				involved = append(involved, kube.ObjectReference{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: claim.Namespace, Name: claim.Name, UID: claim.UID})
+			}
+			recordWarningEvents(ctx, ctrl.kubeClient, ControllerEventComponent, involved, EventReasonAttachFailed, message)
+			return
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package cbs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	SysBlockPath = "/sys/block"
+	DevPath      = "/dev"
+
+	// nvme disks are linked as nvme-<model>_<serial>
+	DiskByIdNvmeDeviceNamePrefix = "nvme-"
+)
+
+// findDevicePath returns the device of an attached disk. The device path hint from the publish
+// info is tried first, then the disk serial is matched against the by-id symlinks created by udev
+// and against the serial of every block device, device names like /dev/vdb are not stable when
+// several disks are attached at the same time. Both virtio disks and nvme namespaces are supported.
+func findDevicePath(diskId string, publishInfo map[string]string) (string, error) {
+	if hint := publishInfo[PublishInfoDevicePath]; hint != "" {
+		if _, err := os.Stat(hint); err == nil {
+			return hint, nil
+		}
+	}
+	if serial := publishInfo[PublishInfoDiskSerial]; serial != "" {
+		diskId = serial
+	}
+
+	byIdPath := path.Join(DiskByIdDevicePath, DiskByIdDeviceNamePrefix+diskId)
+	if _, err := os.Stat(byIdPath); err == nil {
+		return byIdPath, nil
+	}
+
+	if links, err := ioutil.ReadDir(DiskByIdDevicePath); err == nil {
+		for _, link := range links {
+			if strings.HasPrefix(link.Name(), DiskByIdNvmeDeviceNamePrefix) && strings.HasSuffix(link.Name(), "_"+diskId) {
+				return path.Join(DiskByIdDevicePath, link.Name()), nil
+			}
+		}
+	}
+
+	devices, err := ioutil.ReadDir(SysBlockPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, device := range devices {
+		// virtio disks have the serial on the block device, nvme namespaces on the controller
+		for _, serialPath := range []string{"serial", "device/serial"} {
+			serial, err := ioutil.ReadFile(path.Join(SysBlockPath, device.Name(), serialPath))
+			if err != nil {
+				continue
+			}
+			if strings.TrimSpace(string(serial)) == diskId {
+				return path.Join(DevPath, device.Name()), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("device of disk %s not found", diskId)
+}
+
+// waitForDevice waits until the device of diskId appears after attach. udev is settled before
+// every check, the interval between checks starts at cfg.DeviceWaitInterval and doubles until
+// cfg.DeviceWaitTimeout is reached.
+func (node *cbsNode) waitForDevice(diskId string, publishInfo map[string]string, cfg *Config) (string, error) {
+	deadline := time.Now().Add(cfg.DeviceWaitTimeout)
+	interval := cfg.DeviceWaitInterval
+
+	for {
+		remaining := deadline.Sub(time.Now())
+		if remaining > 0 {
+			timeout := int(remaining.Seconds())
+			if timeout < 1 {
+				timeout = 1
+			}
+			if output, err := node.mounter.Exec.Run("udevadm", "settle", fmt.Sprintf("--timeout=%d", timeout)); err != nil {
+				logging.V(4).Infof("udevadm settle err: %v, output: %s", err, string(output))
+			}
+		}
+
+		devicePath, err := findDevicePath(diskId, publishInfo)
+		if err == nil {
+			return devicePath, nil
+		}
+
+		remaining = deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return "", fmt.Errorf("%v after waiting %s", err, cfg.DeviceWaitTimeout)
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+
+		logging.V(4).Infof("device of disk %s not found yet, checking again in %s", diskId, interval)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
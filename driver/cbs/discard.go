@@ -0,0 +1,48 @@
+package cbs
+
+import (
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	// reclaim deleted blocks of thin provisioned disks, either by mounting with -o discard or by
+	// running fstrim periodically
+	DiscardAttr   = "discard"
+	DiscardMount  = "mount"
+	DiscardFstrim = "fstrim"
+)
+
+// trimVolumes runs fstrim on every staged volume with discard set to fstrim.
+func (node *cbsNode) trimVolumes() {
+	node.volumes.mutex.Lock()
+	var paths []string
+	for _, v := range node.volumes.volumes {
+		if v.fstrim && !v.readOnly {
+			paths = append(paths, v.stagingPath)
+		}
+	}
+	node.volumes.mutex.Unlock()
+
+	for _, p := range paths {
+		output, err := node.mounter.Exec.Run("fstrim", p)
+		if err != nil {
+			logging.Errorf("fstrim %s err: %v, output: %s", p, err, string(output))
+			continue
+		}
+		logging.V(4).Infof("fstrim %s: %s", p, string(output))
+	}
+}
+
+// runFstrim trims volumes every cfg.FstrimInterval until stopCh is closed.
+func (node *cbsNode) runFstrim(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(node.config.Get().FstrimInterval):
+			node.trimVolumes()
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package cbs
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// interval between two syncs of the disk infos with the cloud state of the disks
+	DiskInfoSyncPeriod = time.Minute * 5
+
+	DiskInfoKind = "DiskInfo"
+
+	// label of the disk infos maintained by the driver, others are left alone
+	DiskInfoManagedByLabel = "app.kubernetes.io/managed-by"
+)
+
+// runDiskInfoSync keeps a DiskInfo resource for every bound persistent volume of the driver until
+// stopCh is closed. Only the leader syncs when leader election is enabled.
+func (ctrl *cbsController) runDiskInfoSync(stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), DiskInfoSyncPeriod); ok {
+			if err := ctrl.syncDiskInfos(ctx); err != nil {
+				logging.Errorf("sync disk infos err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(DiskInfoSyncPeriod):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) syncDiskInfos(ctx context.Context) error {
+	pvs := &kube.PersistentVolumeList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumesPath(), pvs); err != nil {
+		return err
+	}
+
+	var diskIds []string
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName && pv.Spec.ClaimRef != nil {
+			diskIds = append(diskIds, legacyVolumeId(pv.Spec.CSI.VolumeHandle))
+		}
+	}
+
+	disks := map[string]*cbs.Disk{}
+	for start := 0; start < len(diskIds); start += int(DescribeDisksPageSize) {
+		end := start + int(DescribeDisksPageSize)
+		if end > len(diskIds) {
+			end = len(diskIds)
+		}
+
+		request := cbs.NewDescribeDisksRequest()
+		request.Limit = &DescribeDisksPageSize
+		for i := start; i < end; i++ {
+			request.DiskIds = append(request.DiskIds, &diskIds[i])
+		}
+
+		if err := ctrl.waitRateLimit(ctx); err != nil {
+			return err
+		}
+		response, err := ctrl.cbsClient.DescribeDisks(ctx, request)
+		if err != nil {
+			return err
+		}
+		for _, disk := range response.Response.DiskSet {
+			if disk.DiskId != nil {
+				disks[*disk.DiskId] = disk
+			}
+		}
+	}
+
+	// namespace/name of the disk infos which should exist
+	wanted := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName || pv.Spec.ClaimRef == nil {
+			continue
+		}
+		namespace := pv.Spec.ClaimRef.Namespace
+		wanted[namespace+"/"+pv.Metadata.Name] = true
+
+		diskId := legacyVolumeId(pv.Spec.CSI.VolumeHandle)
+		status := diskInfoStatus(diskId, disks[diskId])
+		status.PersistentVolumeClaim = pv.Spec.ClaimRef.Name
+
+		if err := ctrl.applyDiskInfo(ctx, namespace, pv.Metadata.Name, status); err != nil {
+			logging.Errorf("update disk info %s/%s err: %v", namespace, pv.Metadata.Name, err)
+		}
+	}
+
+	infos := &kube.DiskInfoList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.AllDiskInfosPath(), infos); err != nil {
+		return err
+	}
+	for _, info := range infos.Items {
+		if info.Metadata.Labels[DiskInfoManagedByLabel] != DriverName || wanted[info.Metadata.Namespace+"/"+info.Metadata.Name] {
+			continue
+		}
+		if err := ctrl.kubeClient.Delete(ctx, kube.DiskInfoPath(info.Metadata.Namespace, info.Metadata.Name)); err != nil && !kube.IsNotFound(err) {
+			logging.Errorf("delete disk info %s/%s err: %v", info.Metadata.Namespace, info.Metadata.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyDiskInfo creates the disk info namespace/name or updates it if its status changed.
+func (ctrl *cbsController) applyDiskInfo(ctx context.Context, namespace, name string, status kube.DiskInfoStatus) error {
+	info := &kube.DiskInfo{}
+	err := ctrl.kubeClient.Get(ctx, kube.DiskInfoPath(namespace, name), info)
+	if kube.IsNotFound(err) {
+		info = &kube.DiskInfo{
+			APIVersion: kube.CustomResourceAPIVersion,
+			Kind:       DiskInfoKind,
+			Metadata: kube.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{DiskInfoManagedByLabel: DriverName},
+			},
+			Status: status,
+		}
+		return ctrl.kubeClient.Create(ctx, kube.DiskInfosPath(namespace), info, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(info.Status, status) {
+		return nil
+	}
+	info.Status = status
+	return ctrl.kubeClient.Update(ctx, kube.DiskInfoPath(namespace, name), info, nil)
+}
+
+// diskInfoStatus returns the status of the disk info of diskId, disk is nil if the disk does not
+// exist anymore.
+func diskInfoStatus(diskId string, disk *cbs.Disk) kube.DiskInfoStatus {
+	status := kube.DiskInfoStatus{VolumeId: diskId}
+	if disk == nil {
+		status.Error = "disk not found"
+		return status
+	}
+
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	status.DiskName = value(disk.DiskName)
+	status.DiskType = value(disk.DiskType)
+	status.ChargeType = value(disk.DiskChargeType)
+	status.ExpireTime = value(disk.DeadlineTime)
+	status.RenewFlag = value(disk.RenewFlag)
+	status.State = value(disk.DiskState)
+	status.InstanceId = value(disk.InstanceId)
+	if disk.DiskSize != nil {
+		status.DiskSizeGB = *disk.DiskSize
+	}
+	if disk.Placement != nil {
+		status.Zone = value(disk.Placement.Zone)
+	}
+	if disk.Attached != nil {
+		status.Attached = *disk.Attached
+	}
+	if disk.Encrypt != nil {
+		status.Encrypted = *disk.Encrypt
+	}
+	for _, tag := range disk.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			if status.Tags == nil {
+				status.Tags = map[string]string{}
+			}
+			status.Tags[*tag.Key] = *tag.Value
+		}
+	}
+	return status
+}
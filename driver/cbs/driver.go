@@ -1,69 +1,201 @@
 package cbs
 
 import (
-	"context"
+	"flag"
+	"fmt"
+	"log"
 	"net"
 	"net/url"
-	"os"
 	"path"
+	"runtime"
+	"strconv"
 
 	"github.com/container-storage-interface/spec/lib/go/csi/v0"
-	"github.com/golang/glog"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/redact"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
 )
 
 var (
 	DriverName     = "com.tencent.cloud.csi.cbs"
 	DriverVerision = "0.1.0"
+
+	// set at build time with -ldflags "-X github.com/tencentcloud/kubernetes-csi-tencentcloud/driver/cbs.GitCommit=..."
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+
+	// service.name of the spans exported by the driver
+	TracingServiceName = "cbs-csi"
 )
 
 type Driver struct {
-	region    string
-	zone      string
-	secretId  string
-	secretKey string
+	region      string
+	zone        string
+	credentials []Credential
+	configPath  string
+	config      *Config
 }
 
-func NewDriver(region string, zone string, secretId string, secretKey string) (*Driver, error) {
+// NewDriver creates the cbs driver. credentials are tried in order when api calls are rejected,
+// config holds the defaults used when the config file does not override them.
+func NewDriver(region string, zone string, credentials []Credential, configPath string, config *Config) (*Driver, error) {
+	if len(credentials) == 0 {
+		return nil, fmt.Errorf("no tencent cloud credential specified")
+	}
+
 	driver := Driver{
-		zone:      zone,
-		region:    region,
-		secretId:  secretId,
-		secretKey: secretKey,
+		zone:        zone,
+		region:      region,
+		credentials: credentials,
+		configPath:  configPath,
+		config:      config,
 	}
 
 	return &driver, nil
 }
 
+// VersionInfo returns the version, git commit, build date and go version of the driver build.
+func VersionInfo() map[string]string {
+	return map[string]string{
+		"version":   DriverVerision,
+		"gitCommit": GitCommit,
+		"buildDate": BuildDate,
+		"goVersion": runtime.Version(),
+	}
+}
+
+// setLogLevel sets the glog verbosity to cfg.LogLevel.
+func setLogLevel(cfg *Config) {
+	level := strconv.Itoa(cfg.LogLevel)
+	if current := flag.Lookup("v"); current == nil || current.Value.String() == level {
+		return
+	}
+	if err := flag.Set("v", level); err != nil {
+		logging.Errorf("set log level %s err: %v", level, err)
+		return
+	}
+	logging.Infof("log level set to %s", level)
+}
+
 func (drv *Driver) Run(endpoint *url.URL) error {
-	controller, err := newCbsController(drv.secretId, drv.secretKey, drv.region, drv.zone)
+	logging.Infof("starting %s %s, git commit %s, built %s", DriverName, DriverVerision, GitCommit, BuildDate)
+
+	for _, cred := range drv.credentials {
+		redact.AddSecret(cred.SecretId)
+		redact.AddSecret(cred.SecretKey)
+	}
+
+	// tencent cloud sdk dumps every http request and response to the standard logger
+	log.SetFlags(0)
+	log.SetOutput(redact.LogWriter{V: 5})
+
+	config, err := newConfigStore(drv.configPath, drv.config)
 	if err != nil {
 		return err
 	}
 
-	identity, err := newCbsIdentity()
+	// before any goroutine starting spans, e.g. the cloud calls of the background loops, is started
+	if endpoint := config.Get().TracingEndpoint; endpoint != "" {
+		trace.Init(endpoint, TracingServiceName)
+	}
+
+	if err := config.Watch(make(chan struct{})); err != nil {
+		return err
+	}
+
+	setLogLevel(config.Get())
+	config.OnReload(setLogLevel)
+
+	kubeClient, err := kube.NewInClusterClient()
+	if err != nil {
+		logging.Warningf("kubernetes client not available, features depending on it are disabled: %v", err)
+		kubeClient = nil
+	}
+
+	cloud, err := newCloudClient(drv.region, drv.credentials)
 	if err != nil {
 		return err
 	}
 
-	node, err := newCbsNode(drv.secretId, drv.secretKey, drv.region)
+	cloud.config = config
+
+	if err := checkCloudAccess(cloud, drv.region, drv.zone); err != nil {
+		return err
+	}
+
+	if auditLogFile := config.Get().AuditLogFile; auditLogFile != "" {
+		if cloud.audit, err = openAuditLog(auditLogFile); err != nil {
+			return err
+		}
+	}
+
+	controller, err := newCbsController(cloud, drv.zone, config, kubeClient)
 	if err != nil {
 		return err
 	}
 
-	logGRPC := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		glog.Infof("GRPC call: %s, request: %+v", info.FullMethod, req)
-		resp, err := handler(ctx, req)
-		if err != nil {
-			glog.Errorf("GRPC error: %v", err)
-		} else {
-			glog.Infof("GRPC error: %v, response: %+v", err, resp)
+	hostBinariesErr := checkHostBinaries(config.Get().FsType)
+	if hostBinariesErr != nil {
+		logging.Errorf("node host check failed: %v", hostBinariesErr)
+	}
+
+	healthChecks := []func() error{func() error { return hostBinariesErr }, newCloudProbe(cloud, config).check}
+	identity, err := newCbsIdentity(healthChecks...)
+	if err != nil {
+		return err
+	}
+
+	node, err := newCbsNode(config, controller, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	if err := node.cleanupOrphanedMounts(); err != nil {
+		logging.Errorf("clean up orphaned mounts err: %v", err)
+	}
+
+	if err := node.restoreVolumes(); err != nil {
+		logging.Errorf("restore staged volumes err: %v", err)
+	}
+
+	registerVolumeStats(node)
+
+	go node.runVolumeHealthCheck(make(chan struct{}))
+	go node.runFstrim(make(chan struct{}))
+
+	if config.Get().VolumeFreeze {
+		if kubeClient == nil {
+			return fmt.Errorf("volume freezes require a kubernetes client")
 		}
-		return resp, err
+		go node.runVolumeFreezes(make(chan struct{}))
+	}
+
+	if address := config.Get().MetricsAddress; address != "" {
+		go serveMetrics(address)
+	}
+
+	if address := config.Get().PprofAddress; address != "" {
+		go servePprof(address)
+	}
+
+	if address := config.Get().HealthAddress; address != "" {
+		serverHealth.checks = healthChecks
+		go serveHealth(address, serverHealth)
 	}
 
 	opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(logGRPC),
+		grpc.UnaryInterceptor(chainUnaryInterceptors(newLogInterceptor(config), newConcurrencyLimitInterceptor(config), newTimeoutInterceptor(config))),
+	}
+
+	if endpoint.Scheme == "tcp" {
+		creds, err := serverTLSCredentials(config.Get(), endpoint.Host)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
 	}
 
 	srv := grpc.NewServer(opts...)
@@ -72,23 +204,22 @@ func (drv *Driver) Run(endpoint *url.URL) error {
 	csi.RegisterIdentityServer(srv, identity)
 	csi.RegisterNodeServer(srv, node)
 
-	if endpoint.Scheme == "unix" {
-		sockPath := path.Join(endpoint.Host, endpoint.Path)
-		if _, err := os.Stat(sockPath); err != nil {
-			if !os.IsNotExist(err) {
-				return err
-			}
-		} else {
-			if err := os.Remove(sockPath); err != nil {
-				return err
-			}
-		}
+	if config.Get().GRPCReflection {
+		reflection.Register(srv)
 	}
 
-	listener, err := net.Listen(endpoint.Scheme, path.Join(endpoint.Host, endpoint.Path))
+	var listener net.Listener
+	if endpoint.Scheme == "tcp" {
+		listener, err = net.Listen("tcp", endpoint.Host)
+	} else {
+		listener, err = listenUnix(path.Join(endpoint.Host, endpoint.Path), config.Get())
+	}
 	if err != nil {
 		return err
 	}
 
+	go stopOnSignal(srv, config.Get().ShutdownTimeout)
+
+	serverHealth.setServing(true)
 	return srv.Serve(listener)
 }
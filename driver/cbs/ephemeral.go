@@ -0,0 +1,182 @@
+package cbs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// set by kubelet in the volume context of inline ephemeral volumes
+	EphemeralAttr = "csi.storage.k8s.io/ephemeral"
+	// size of an inline ephemeral volume, e.g. 20Gi
+	EphemeralSizeAttr = "size"
+
+	// volume context keys added by kubelet, they are not storage class parameters
+	KubeletAttrPrefix = "csi.storage.k8s.io/"
+
+	// storage class parameters pods may set on their ephemeral volumes, anything else, like the
+	// charge type, tags, encryption or queue tuning, is left to the driver defaults since any pod
+	// author can set the attributes
+	EphemeralParameterNames = []string{DiskTypeAttr, FsTypeAttr}
+
+	// stored next to the target path, holds the id of the disk created for an ephemeral volume
+	EphemeralDiskIdFile = "cbs-ephemeral-disk-id"
+)
+
+func isEphemeral(attributes map[string]string) bool {
+	return attributes[EphemeralAttr] == "true"
+}
+
+func ephemeralDiskIdFile(targetPath string) string {
+	return filepath.Join(filepath.Dir(targetPath), EphemeralDiskIdFile)
+}
+
+// ephemeralParameters returns the storage class parameters of an ephemeral volume, rejecting the
+// attributes pods are not allowed to set.
+func ephemeralParameters(attributes map[string]string) (map[string]string, error) {
+	parameters := map[string]string{}
+	for k, v := range attributes {
+		if strings.HasPrefix(k, KubeletAttrPrefix) || k == EphemeralSizeAttr {
+			continue
+		}
+		allowed := false
+		for _, name := range EphemeralParameterNames {
+			if k == name {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("volume attribute %s is not allowed on ephemeral volumes, only %s and %s are", k, strings.Join(EphemeralParameterNames, ", "), EphemeralSizeAttr)
+		}
+		parameters[k] = v
+	}
+	return parameters, nil
+}
+
+// publishEphemeralVolume creates a disk for an inline ephemeral volume, attaches it to this node
+// and mounts it at the target path. The disk lives as long as the pod, it is deleted on unpublish.
+func (node *cbsNode) publishEphemeralVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	parameters, err := ephemeralParameters(req.VolumeAttributes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sizeStr, ok := req.VolumeAttributes[EphemeralSizeAttr]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "size of ephemeral volume is empty")
+	}
+	quantity, err := resource.ParseQuantity(sizeStr)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "size of ephemeral volume not valid: %v", err)
+	}
+	size := (quantity.Value() + int64(GB) - 1) / int64(GB) * int64(GB)
+
+	if err := ValidateDiskSize(parameters, size, node.config.Get()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	instanceId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	createResp, err := node.controller.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               req.VolumeId,
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: size},
+		VolumeCapabilities: []*csi.VolumeCapability{req.VolumeCapability},
+		Parameters:         parameters,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diskId := createResp.Volume.Id
+	logging.Infof("disk %s created for ephemeral volume %s", diskId, req.VolumeId)
+
+	if err := os.MkdirAll(filepath.Dir(req.TargetPath), 0750); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := ioutil.WriteFile(ephemeralDiskIdFile(req.TargetPath), []byte(diskId), 0640); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	publishResp, err := node.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         diskId,
+		NodeId:           instanceId,
+		VolumeCapability: req.VolumeCapability,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = node.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          diskId,
+		PublishInfo:       publishResp.PublishInfo,
+		StagingTargetPath: req.TargetPath,
+		VolumeCapability:  req.VolumeCapability,
+		NodeStageSecrets:  req.NodePublishSecrets,
+		VolumeAttributes:  createResp.Volume.Attributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// unpublishEphemeralVolume unmounts, detaches and deletes the disk of an ephemeral volume.
+// It returns false if the target path does not belong to an ephemeral volume.
+func (node *cbsNode) unpublishEphemeralVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (bool, error) {
+	idFile := ephemeralDiskIdFile(req.TargetPath)
+
+	data, err := ioutil.ReadFile(idFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return true, status.Error(codes.Internal, err.Error())
+	}
+	diskId := strings.TrimSpace(string(data))
+
+	if _, err := node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{
+		VolumeId:          diskId,
+		StagingTargetPath: req.TargetPath,
+	}); err != nil {
+		return true, err
+	}
+
+	instanceId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return true, status.Error(codes.Internal, err.Error())
+	}
+
+	if _, err := node.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: diskId,
+		NodeId:   instanceId,
+	}); err != nil && status.Code(err) != codes.NotFound {
+		return true, err
+	}
+
+	if _, err := node.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: diskId}); err != nil {
+		return true, err
+	}
+
+	if err := os.Remove(idFile); err != nil && !os.IsNotExist(err) {
+		return true, status.Error(codes.Internal, err.Error())
+	}
+
+	logging.Infof("disk %s of ephemeral volume %s deleted", diskId, req.VolumeId)
+
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package cbs
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+)
+
+var (
+	// set by kubelet in the volume context when the csi driver object has podInfoOnMount enabled
+	PodNameAttr      = "csi.storage.k8s.io/pod.name"
+	PodNamespaceAttr = "csi.storage.k8s.io/pod.namespace"
+
+	// kubelet publishes csi volumes at /var/lib/kubelet/pods/<pod uid>/volumes/kubernetes.io~csi/<pv name>/mount
+	KubeletTargetPathBase = "mount"
+
+	EventComponent           = "cbs-csi-node"
+	ControllerEventComponent = "cbs-csi-controller"
+
+	// reasons of events recorded by the controller
+	EventReasonProvisioningFailed = "ProvisioningFailed"
+	EventReasonAttachFailed       = "AttachFailed"
+
+	// reasons of events recorded by the node plugin
+	EventReasonDeviceNotFound       = "DeviceNotFound"
+	EventReasonLuksSetupFailed      = "LuksSetupFailed"
+	EventReasonFormatAndMountFailed = "FormatAndMountFailed"
+	EventReasonMountFailed          = "MountFailed"
+	EventReasonVolumeNearlyFull     = "VolumeNearlyFull"
+
+	// the api server rejects longer event messages
+	EventMessageMaxLength = 1024
+)
+
+// pvNameOfPath returns the name of the pv staged or published at path by kubelet, or an empty string.
+func pvNameOfPath(path string) string {
+	switch filepath.Base(path) {
+	case KubeletStagingPathBase, KubeletTargetPathBase:
+		return filepath.Base(filepath.Dir(path))
+	}
+	return ""
+}
+
+// recordVolumeEvent records a warning event on the claim of the volume at path, and on the pod if
+// kubelet passed the pod in attributes, so that users see volume failures, including the output of
+// the failed command, without access to the node. Events are sent in the background.
+func (node *cbsNode) recordVolumeEvent(path string, attributes map[string]string, reason string, err error) {
+	if node.kubeClient == nil {
+		return
+	}
+
+	message := err.Error()
+
+	var involved []kube.ObjectReference
+	if name, namespace := attributes[PodNameAttr], attributes[PodNamespaceAttr]; name != "" && namespace != "" {
+		involved = append(involved, kube.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name})
+	}
+
+	pvName := pvNameOfPath(path)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		if pvName != "" {
+			pv := &kube.PersistentVolume{}
+			if err := node.kubeClient.Get(ctx, kube.PersistentVolumePath(pvName), pv); err != nil {
+				logging.Warningf("get pv %s err: %v", pvName, err)
+			} else if pv.Spec.ClaimRef != nil {
+				claim := *pv.Spec.ClaimRef
+				claim.APIVersion = "v1"
+				claim.Kind = "PersistentVolumeClaim"
+				involved = append(involved, claim)
+			}
+		}
+
+		recordWarningEvents(ctx, node.kubeClient, EventComponent, involved, reason, message)
+	}()
+}
+
+// recordWarningEvents creates a warning event on every object in involved.
+func recordWarningEvents(ctx context.Context, client *kube.Client, component string, involved []kube.ObjectReference, reason, message string) {
+	recordEvents(ctx, client, component, involved, kube.EventTypeWarning, reason, message)
+}
+
+// recordEvents creates an event of eventType on every object in involved.
+func recordEvents(ctx context.Context, client *kube.Client, component string, involved []kube.ObjectReference, eventType, reason, message string) {
+	if len(message) > EventMessageMaxLength {
+		message = message[:EventMessageMaxLength]
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, object := range involved {
+		namespace := object.Namespace
+		if namespace == "" {
+			// events of cluster scoped objects such as pvs
+			namespace = "default"
+		}
+		event := &kube.Event{
+			Metadata: kube.ObjectMeta{
+				GenerateName: fmt.Sprintf("%s.", object.Name),
+				Namespace:    namespace,
+			},
+			InvolvedObject: object,
+			Reason:         reason,
+			Message:        message,
+			Type:           eventType,
+			Source:         kube.EventSource{Component: component},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if err := client.Create(ctx, kube.EventsPath(namespace), event, nil); err != nil {
+			logging.Warningf("record event %s on %s %s/%s err: %v", reason, object.Kind, object.Namespace, object.Name, err)
+		}
+	}
+}
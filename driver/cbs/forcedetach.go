@@ -0,0 +1,152 @@
+package cbs
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+// ForceDetach detaches the disk diskId from the instance it is attached to, whatever node that is,
+// and deletes the volume attachments of its persistent volume, so the volume can be attached to
+// another node after the node holding it died. Progress is written to w.
+func (drv *Driver) ForceDetach(w io.Writer, diskId string) error {
+	diskId = legacyVolumeId(diskId)
+
+	config, err := newConfigStore(drv.configPath, drv.config)
+	if err != nil {
+		return err
+	}
+	cfg := config.Get()
+
+	client, err := newCloudClient(drv.region, drv.credentials)
+	if err != nil {
+		return err
+	}
+	if cfg.AuditLogFile != "" {
+		if client.audit, err = openAuditLog(cfg.AuditLogFile); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DetachTimeout+time.Minute)
+	defer cancel()
+
+	disk, err := describeDisk(ctx, client, diskId)
+	if err != nil {
+		return err
+	}
+
+	if disk.DiskState != nil && *disk.DiskState == StatusUnattached {
+		fmt.Fprintf(w, "%s is not attached\n", diskId)
+	} else {
+		instance := ""
+		if disk.InstanceId != nil {
+			instance = *disk.InstanceId
+		}
+		fmt.Fprintf(w, "detaching %s from %s\n", diskId, instance)
+
+		request := cbs.NewDetachDisksRequest()
+		request.DiskIds = []*string{&diskId}
+		if _, err := client.DetachDisks(ctx, request); err != nil {
+			return fmt.Errorf("detach %s err: %v", diskId, err)
+		}
+		if err := waitUnattached(ctx, client, diskId, cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s detached\n", diskId)
+	}
+
+	kubeClient, err := kube.NewInClusterClient()
+	if err != nil {
+		fmt.Fprintf(w, "kubernetes client not available, volume attachments are not deleted: %v\n", err)
+		return nil
+	}
+	return deleteVolumeAttachments(ctx, w, kubeClient, diskId)
+}
+
+func describeDisk(ctx context.Context, client *cloudClient, diskId string) (*cbs.Disk, error) {
+	request := cbs.NewDescribeDisksRequest()
+	request.DiskIds = []*string{&diskId}
+
+	response, err := client.DescribeDisks(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("describe %s err: %v", diskId, err)
+	}
+	for _, disk := range response.Response.DiskSet {
+		if disk.DiskId != nil && *disk.DiskId == diskId {
+			return disk, nil
+		}
+	}
+	return nil, fmt.Errorf("disk %s not found", diskId)
+}
+
+// waitUnattached polls the disk until it is unattached or ctx is done.
+func waitUnattached(ctx context.Context, client *cloudClient, diskId string, cfg *Config) error {
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.DetachTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ticker.C:
+			disk, err := describeDisk(ctx, client, diskId)
+			if err != nil {
+				continue
+			}
+			if disk.DiskState != nil && *disk.DiskState == StatusUnattached {
+				return nil
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("%s is not unattached after %v", diskId, cfg.DetachTimeout)
+		}
+	}
+}
+
+// deleteVolumeAttachments deletes the volume attachments of the persistent volumes of diskId. The
+// disk is detached already, so their finalizers are removed too, the attacher of a dead node may
+// never remove them.
+func deleteVolumeAttachments(ctx context.Context, w io.Writer, kubeClient *kube.Client, diskId string) error {
+	pvs := &kube.PersistentVolumeList{}
+	if err := kubeClient.Get(ctx, kube.PersistentVolumesPath(), pvs); err != nil {
+		return fmt.Errorf("list persistent volumes err: %v", err)
+	}
+	volumes := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName && legacyVolumeId(pv.Spec.CSI.VolumeHandle) == diskId {
+			volumes[pv.Metadata.Name] = true
+		}
+	}
+	if len(volumes) == 0 {
+		fmt.Fprintf(w, "no persistent volume of %s found\n", diskId)
+		return nil
+	}
+
+	attachments := &kube.VolumeAttachmentList{}
+	if err := kubeClient.Get(ctx, kube.VolumeAttachmentsPath(), attachments); err != nil {
+		return fmt.Errorf("list volume attachments err: %v", err)
+	}
+
+	clearFinalizers := map[string]interface{}{"metadata": map[string]interface{}{"finalizers": nil}}
+	for _, va := range attachments.Items {
+		source := va.Spec.Source.PersistentVolumeName
+		if va.Spec.Attacher != DriverName || source == nil || !volumes[*source] {
+			continue
+		}
+
+		path := kube.VolumeAttachmentPath(va.Metadata.Name)
+		if err := kubeClient.Delete(ctx, path); err != nil && !kube.IsNotFound(err) {
+			return fmt.Errorf("delete volume attachment %s err: %v", va.Metadata.Name, err)
+		}
+		if err := kubeClient.Patch(ctx, path, kube.PatchTypeMerge, clearFinalizers, nil); err != nil && !kube.IsNotFound(err) {
+			return fmt.Errorf("remove finalizers of volume attachment %s err: %v", va.Metadata.Name, err)
+		}
+		fmt.Fprintf(w, "deleted volume attachment %s of %s on node %s\n", va.Metadata.Name, *source, va.Spec.NodeName)
+	}
+	return nil
+}
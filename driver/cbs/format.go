@@ -0,0 +1,94 @@
+package cbs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// percentage of ext4 blocks reserved for root, 0 when not set
+	ReservedBlocksPercentageAttr = "reservedBlocksPercentage"
+
+	// filesystem label set at format time, the controller sets it to the pv name
+	FsLabelAttr = "fsLabel"
+
+	// maximum filesystem label length
+	FsLabelMaxLength = map[string]int{
+		FsTypeExt4: 16,
+		FsTypeXfs:  12,
+	}
+)
+
+// formatOptions are applied when a blank disk is formatted, they are passed from storage class
+// parameters to the node in volume attributes.
+type formatOptions struct {
+	mkfsOptions              string
+	reservedBlocksPercentage string
+	label                    string
+	// snapshot the disk was restored from, a restored disk is never formatted
+	snapshotId string
+}
+
+func formatOptionsFromAttributes(attributes map[string]string) formatOptions {
+	return formatOptions{
+		mkfsOptions:              attributes[MkfsOptionsAttr],
+		reservedBlocksPercentage: attributes[ReservedBlocksPercentageAttr],
+		label:                    attributes[FsLabelAttr],
+		snapshotId:               attributes[SnapshotIdAttr],
+	}
+}
+
+// parseMkfsOptions splits the mkfsOptions parameter into mkfs arguments, e.g. "-I 512 -E lazy_itable_init=0".
+func parseMkfsOptions(options string) ([]string, error) {
+	args := strings.Fields(options)
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return nil, fmt.Errorf("mkfsOptions %q not valid, must start with an option", options)
+	}
+	return args, nil
+}
+
+func validateReservedBlocksPercentage(percentage string) error {
+	if percentage == "" {
+		return nil
+	}
+	p, err := strconv.Atoi(percentage)
+	if err != nil || p < 0 || p > 50 {
+		return fmt.Errorf("reservedBlocksPercentage %q not valid, must be between 0 and 50", percentage)
+	}
+	return nil
+}
+
+// mkfsArgs returns the arguments of mkfs.<fsType> for device, extra options go before the device.
+func mkfsArgs(fsType, device string, opts formatOptions) ([]string, error) {
+	extra, err := parseMkfsOptions(opts.mkfsOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateReservedBlocksPercentage(opts.reservedBlocksPercentage); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if fsType == FsTypeExt4 {
+		reserved := opts.reservedBlocksPercentage
+		if reserved == "" {
+			reserved = "0"
+		}
+		args = append(args, "-F", "-m", reserved)
+	}
+	if label := fsLabel(fsType, opts.label); label != "" {
+		args = append(args, "-L", label)
+	}
+	args = append(args, extra...)
+	return append(args, device), nil
+}
+
+// fsLabel truncates label to the maximum length of fsType, pv names like pvc-1234abcd-... keep
+// enough of the uid to identify the volume.
+func fsLabel(fsType, label string) string {
+	if max, ok := FsLabelMaxLength[fsType]; ok && len(label) > max {
+		return label[:max]
+	}
+	return label
+}
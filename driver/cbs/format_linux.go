@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package cbs
+
+import (
+	"fmt"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	utilexec "k8s.io/utils/exec"
+)
+
+var (
+	// e2fsck exit codes, 1 and 2 mean errors were found and corrected
+	E2fsckErrorsCorrected       = 1
+	E2fsckErrorsCorrectedReboot = 2
+
+	// xfs_repair -n exit codes
+	XfsRepairCorruptionDetected = 1
+	XfsRepairDirtyLog           = 2
+)
+
+// formatAndMount formats device with opts if it is blank, otherwise checks the existing
+// filesystem, then mounts it at target and grows the filesystem to the disk size. A disk which
+// already has a filesystem or partition table is never formatted again.
+func (node *cbsNode) formatAndMount(device, target, fsType string, mountFlags []string, opts formatOptions) error {
+	readOnly := false
+	for _, flag := range mountFlags {
+		if flag == "ro" {
+			readOnly = true
+		}
+	}
+
+	existingFormat, err := node.mounter.GetDiskFormat(device)
+	if err != nil {
+		return err
+	}
+
+	// the filesystem of a restored disk comes from the snapshot, whatever fsType the storage class sets
+	if opts.snapshotId != "" && existingFormat != "" && existingFormat != fsType {
+		logging.Infof("disk %s restored from snapshot %s contains %s, mounting it as %s instead of %s", device, opts.snapshotId, existingFormat, existingFormat, fsType)
+		fsType = existingFormat
+	}
+
+	if existingFormat == "" {
+		// the data of a restored disk is loaded from the snapshot in the background, a filesystem not
+		// found yet must not be overwritten
+		if opts.snapshotId != "" {
+			return fmt.Errorf("disk %s restored from snapshot %s has no filesystem yet, refusing to format it", device, opts.snapshotId)
+		}
+		if readOnly {
+			return fmt.Errorf("disk %s is not formatted, can not mount it read only", device)
+		}
+
+		args, err := mkfsArgs(fsType, device, opts)
+		if err != nil {
+			return err
+		}
+		logging.Infof("disk %s is not formatted, formatting as %s with args %v", device, fsType, args)
+
+		output, err := node.mounter.Exec.Run("mkfs."+fsType, args...)
+		if err != nil {
+			return fmt.Errorf("format disk %s as %s err: %v, output: %s", device, fsType, err, string(output))
+		}
+	} else {
+		// never format a disk with existing data, e.g. a statically provisioned disk
+		if existingFormat != fsType {
+			return fmt.Errorf("disk %s already contains %s but fsType %s is requested, refusing to format it, set fsType to the existing filesystem or clean the disk", device, existingFormat, fsType)
+		}
+		if err := node.checkFilesystem(device, existingFormat, readOnly); err != nil {
+			return err
+		}
+	}
+
+	options := append([]string{}, mountFlags...)
+	options = append(options, "defaults")
+
+	// disks restored from a snapshot or cloned share the uuid of their source, xfs refuses to mount a
+	// second filesystem with the uuid of a mounted one
+	if existingFormat == FsTypeXfs && !hasMountOption(options, XfsNoUUIDMountOption) {
+		options = append(options, XfsNoUUIDMountOption)
+	}
+
+	logging.V(4).Infof("mounting disk %s at %s as %s with options %v", device, target, fsType, options)
+	if err := node.mounter.Interface.Mount(device, target, fsType, options); err != nil {
+		return err
+	}
+
+	if existingFormat != "" && !readOnly {
+		if err := node.growFilesystem(device, target, fsType); err != nil {
+			if unmountErr := node.mounter.Unmount(target); unmountErr != nil {
+				logging.Errorf("unmount %s after failed filesystem grow err: %v", target, unmountErr)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkFilesystem runs fsck on an existing filesystem before it is mounted, so that a filesystem
+// corrupted by an unclean node shutdown is repaired or reported instead of silently mounted.
+func (node *cbsNode) checkFilesystem(device, format string, readOnly bool) error {
+	var cmd string
+	var args []string
+
+	switch format {
+	case FsTypeExt4:
+		cmd = "e2fsck"
+		if readOnly {
+			args = []string{"-n", device}
+		} else {
+			args = []string{"-p", device}
+		}
+	case FsTypeXfs:
+		cmd = "xfs_repair"
+		args = []string{"-n", device}
+	default:
+		logging.V(4).Infof("skip filesystem check of disk %s with format %s", device, format)
+		return nil
+	}
+
+	logging.V(4).Infof("checking filesystem of disk %s: %s %v", device, cmd, args)
+
+	output, err := node.mounter.Exec.Run(cmd, args...)
+	if err == nil {
+		return nil
+	}
+	if err == utilexec.ErrExecutableNotFound {
+		logging.Warningf("%s not found, mounting disk %s without filesystem check", cmd, device)
+		return nil
+	}
+
+	exitErr, ok := err.(utilexec.ExitError)
+	if !ok {
+		return fmt.Errorf("check filesystem of disk %s err: %v", device, err)
+	}
+
+	switch {
+	case format == FsTypeExt4 && (exitErr.ExitStatus() == E2fsckErrorsCorrected || exitErr.ExitStatus() == E2fsckErrorsCorrectedReboot):
+		logging.Warningf("filesystem errors on disk %s were corrected by e2fsck: %s", device, string(output))
+		return nil
+	case format == FsTypeXfs && exitErr.ExitStatus() == XfsRepairDirtyLog:
+		// the log is replayed by mount
+		logging.Infof("disk %s has a dirty xfs log, it will be replayed on mount", device)
+		return nil
+	case format == FsTypeXfs && exitErr.ExitStatus() == XfsRepairCorruptionDetected:
+		return fmt.Errorf("xfs filesystem on disk %s is corrupted, repair it with xfs_repair before using the volume: %s", device, string(output))
+	default:
+		return fmt.Errorf("%s filesystem on disk %s has errors that could not be corrected automatically (%s exit status %d), repair it manually before using the volume: %s", format, device, cmd, exitErr.ExitStatus(), string(output))
+	}
+}
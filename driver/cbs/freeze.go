@@ -0,0 +1,353 @@
+package cbs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// VolumeSnapshotClass parameter freezing the filesystem of the volume while it is snapshotted
+	FsFreezeParameter = "fsFreeze"
+
+	// interval between two checks of a freeze by the controller waiting for it
+	VolumeFreezePollInterval = time.Second
+
+	// nodes watch the volume freezes of their instance, and list them again after this to thaw the
+	// volumes frozen for too long
+	VolumeFreezeResyncPeriod = time.Second * 30
+
+	// nodes failing to list or watch the volume freezes retry after a backoff doubling up to this
+	VolumeFreezeMaxBackoff = time.Minute * 5
+
+	// nodes thaw filesystems frozen longer than this even if their freeze was not deleted, e.g.
+	// because the controller crashed while snapshotting
+	VolumeFreezeMaxDuration = time.Minute * 2
+
+	// volume freezes are named after the disk
+	VolumeFreezeNamePrefix = "freeze-"
+)
+
+// fsFreezeRequested returns whether parameters ask to freeze the filesystem while snapshotting.
+func fsFreezeRequested(parameters map[string]string) (bool, error) {
+	value, ok := parameters[FsFreezeParameter]
+	if !ok {
+		return false, nil
+	}
+	freeze, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", FsFreezeParameter)
+	}
+	return freeze, nil
+}
+
+// freezeVolume asks the node plugin of the instance diskId is attached to to freeze the filesystem
+// of the disk and waits until it is frozen. The returned function thaws it. Nothing writes to an
+// unattached disk, it is not frozen.
+func (ctrl *cbsController) freezeVolume(ctx context.Context, diskId string) (func(), error) {
+	if ctrl.kubeClient == nil {
+		return nil, status.Error(codes.FailedPrecondition, "freezing volumes requires a kubernetes client")
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	disk, err := describeDisk(ctx, ctrl.cbsClient, diskId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if disk.Attached == nil || !*disk.Attached || stringValue(disk.InstanceId) == "" {
+		return func() {}, nil
+	}
+	instanceId := *disk.InstanceId
+
+	namespace := podNamespace()
+	name := VolumeFreezeNamePrefix + diskId
+	path := kube.VolumeFreezePath(namespace, name)
+	freeze := &kube.VolumeFreeze{
+		APIVersion: kube.CustomResourceAPIVersion,
+		Kind:       "VolumeFreeze",
+		Metadata: kube.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{kube.VolumeFreezeInstanceLabel: instanceId},
+		},
+		Spec: kube.VolumeFreezeSpec{VolumeId: diskId, InstanceId: instanceId},
+	}
+	if err := ctrl.createVolumeFreeze(ctx, freeze, time.Now()); err != nil {
+		return nil, err
+	}
+
+	thaw := func() {
+		// thaw even if the rpc was cancelled
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := ctrl.kubeClient.Delete(ctx, path); err != nil && !kube.IsNotFound(err) {
+			logging.Errorf("delete volume freeze %s err: %v, the node thaws %s after %v", name, err, diskId, VolumeFreezeMaxDuration)
+		}
+	}
+
+	if err := ctrl.waitFrozen(ctx, path, diskId, instanceId, ctrl.config.Get().FreezeTimeout); err != nil {
+		thaw()
+		return nil, err
+	}
+	logging.Infof("froze %s on %s", diskId, instanceId)
+	return thaw, nil
+}
+
+// createVolumeFreeze creates freeze. A freeze of the disk older than VolumeFreezeMaxDuration was
+// left behind and is replaced, a newer one belongs to another snapshot in progress.
+func (ctrl *cbsController) createVolumeFreeze(ctx context.Context, freeze *kube.VolumeFreeze, now time.Time) error {
+	namespace, name := freeze.Metadata.Namespace, freeze.Metadata.Name
+
+	err := ctrl.kubeClient.Create(ctx, kube.VolumeFreezesPath(namespace), freeze, nil)
+	if err == nil {
+		return nil
+	}
+	if !kube.IsAlreadyExists(err) {
+		return status.Errorf(codes.Internal, "create volume freeze %s err: %v", name, err)
+	}
+
+	existing := &kube.VolumeFreeze{}
+	if err := ctrl.kubeClient.Get(ctx, kube.VolumeFreezePath(namespace, name), existing); err != nil {
+		return status.Errorf(codes.Internal, "get volume freeze %s err: %v", name, err)
+	}
+	created, err := time.Parse(time.RFC3339, existing.Metadata.CreationTimestamp)
+	if err == nil && now.Sub(created) < VolumeFreezeMaxDuration {
+		return status.Errorf(codes.Aborted, "%s is frozen for another snapshot", freeze.Spec.VolumeId)
+	}
+
+	logging.Warningf("replacing volume freeze %s created at %s", name, existing.Metadata.CreationTimestamp)
+	if err := ctrl.kubeClient.Delete(ctx, kube.VolumeFreezePath(namespace, name)); err != nil && !kube.IsNotFound(err) {
+		return status.Errorf(codes.Internal, "delete volume freeze %s err: %v", name, err)
+	}
+	if err := ctrl.kubeClient.Create(ctx, kube.VolumeFreezesPath(namespace), freeze, nil); err != nil {
+		return status.Errorf(codes.Internal, "create volume freeze %s err: %v", name, err)
+	}
+	return nil
+}
+
+// waitFrozen polls the volume freeze at path until the node froze the filesystem or timeout passed.
+func (ctrl *cbsController) waitFrozen(ctx context.Context, path, diskId, instanceId string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		freeze := &kube.VolumeFreeze{}
+		if err := ctrl.kubeClient.Get(ctx, path, freeze); err != nil {
+			logging.V(4).Infof("get volume freeze of %s err: %v", diskId, err)
+		} else {
+			switch freeze.Status.Phase {
+			case kube.VolumeFreezeFrozen:
+				return nil
+			case kube.VolumeFreezeFailed:
+				return status.Errorf(codes.FailedPrecondition, "freeze %s on %s err: %s", diskId, instanceId, freeze.Status.Message)
+			case kube.VolumeFreezeThawed:
+				return status.Errorf(codes.Aborted, "%s was thawed on %s before it was snapshotted: %s", diskId, instanceId, freeze.Status.Message)
+			}
+		}
+
+		select {
+		case <-time.After(VolumeFreezePollInterval):
+		case <-ctx.Done():
+			return status.Errorf(codes.DeadlineExceeded, "%s was not frozen on %s within %v, check that its node plugin runs with --volume_freeze", diskId, instanceId, timeout)
+		}
+	}
+}
+
+// runVolumeFreezes freezes and thaws the filesystems of the volumes staged on this node as asked
+// by the VolumeFreeze resources of its instance until stopCh is closed. The freezes are listed
+// again whenever one changes and every VolumeFreezeResyncPeriod.
+func (node *cbsNode) runVolumeFreezes(stopCh <-chan struct{}) {
+	// the volumes frozen before a restart are not known anymore
+	node.thawAllVolumes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	var instanceId string
+	backoff := time.Second
+	for {
+		var err error
+		if instanceId == "" {
+			instanceId, err = node.metadataClient.InstanceID()
+			if err != nil {
+				err = fmt.Errorf("get instance id err: %v", err)
+			}
+		}
+		if err == nil {
+			err = node.syncVolumeFreezes(ctx, instanceId)
+		}
+
+		wait := time.Duration(0)
+		if err == nil {
+			backoff = time.Second
+		} else {
+			logging.Errorf("sync volume freezes err: %v, retrying in %v", err, backoff)
+			wait = backoff
+			if backoff *= 2; backoff > VolumeFreezeMaxBackoff {
+				backoff = VolumeFreezeMaxBackoff
+			}
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// syncVolumeFreezes checks the volume freezes of instanceId, then watches them until one changes
+// or VolumeFreezeResyncPeriod passed.
+func (node *cbsNode) syncVolumeFreezes(ctx context.Context, instanceId string) error {
+	path := kube.InstanceVolumeFreezesPath(podNamespace(), instanceId)
+
+	listCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	freezes := &kube.VolumeFreezeList{}
+	err := node.kubeClient.Get(listCtx, path, freezes)
+	if err == nil {
+		node.checkVolumeFreezes(listCtx, freezes, time.Now())
+	}
+	cancel()
+	if err != nil {
+		return fmt.Errorf("list volume freezes err: %v", err)
+	}
+
+	err = node.kubeClient.Watch(ctx, path, freezes.Metadata.ResourceVersion, VolumeFreezeResyncPeriod, func(event *kube.WatchEvent) bool {
+		logging.V(4).Infof("volume freeze %s", strings.ToLower(event.Type))
+		return false
+	})
+	if err != nil && ctx.Err() == nil {
+		if kube.IsGone(err) {
+			// listed again right away
+			return nil
+		}
+		return fmt.Errorf("watch volume freezes err: %v", err)
+	}
+	return nil
+}
+
+func (node *cbsNode) checkVolumeFreezes(ctx context.Context, freezes *kube.VolumeFreezeList, now time.Time) {
+
+	requested := map[string]*kube.VolumeFreeze{}
+	for i := range freezes.Items {
+		freeze := &freezes.Items[i]
+		requested[freeze.Spec.VolumeId] = freeze
+		if freeze.Status.Phase != "" {
+			continue
+		}
+
+		freeze.Status = node.freezeVolume(freeze.Spec.VolumeId, now)
+		node.updateVolumeFreeze(ctx, freeze)
+	}
+
+	for volumeId, frozen := range node.frozenVolumes() {
+		freeze, ok := requested[volumeId]
+		if ok && now.Sub(frozen) < VolumeFreezeMaxDuration {
+			continue
+		}
+
+		node.thawVolume(volumeId)
+		if ok {
+			freeze.Status.Phase = kube.VolumeFreezeThawed
+			freeze.Status.Message = fmt.Sprintf("thawed after %v", VolumeFreezeMaxDuration)
+			node.updateVolumeFreeze(ctx, freeze)
+		}
+	}
+}
+
+func (node *cbsNode) updateVolumeFreeze(ctx context.Context, freeze *kube.VolumeFreeze) {
+	path := kube.VolumeFreezePath(freeze.Metadata.Namespace, freeze.Metadata.Name)
+	if err := node.kubeClient.Update(ctx, path, freeze, nil); err != nil && !kube.IsNotFound(err) {
+		logging.Errorf("update volume freeze %s err: %v", freeze.Metadata.Name, err)
+	}
+}
+
+// freezeVolume freezes the filesystem of the staged volume volumeId and returns the status of its
+// freeze. The volume tracker stays locked, so the volume is not unstaged meanwhile.
+func (node *cbsNode) freezeVolume(volumeId string, now time.Time) kube.VolumeFreezeStatus {
+	node.volumes.mutex.Lock()
+	defer node.volumes.mutex.Unlock()
+
+	v, ok := node.volumes.volumes[volumeId]
+	if !ok {
+		return kube.VolumeFreezeStatus{Phase: kube.VolumeFreezeFailed, Message: fmt.Sprintf("%s is not staged on this node", volumeId)}
+	}
+	if v.readOnly {
+		return kube.VolumeFreezeStatus{Phase: kube.VolumeFreezeFrozen, Message: "staged read only"}
+	}
+	// the status of an earlier freeze may not have been saved
+	if !v.frozen.IsZero() {
+		return kube.VolumeFreezeStatus{Phase: kube.VolumeFreezeFrozen, FrozenTime: v.frozen.UTC().Format(time.RFC3339)}
+	}
+
+	output, err := node.mounter.Exec.Run("fsfreeze", "--freeze", v.stagingPath)
+	if err != nil {
+		logging.Errorf("fsfreeze --freeze %s err: %v, output: %s", v.stagingPath, err, string(output))
+		return kube.VolumeFreezeStatus{Phase: kube.VolumeFreezeFailed, Message: fmt.Sprintf("fsfreeze err: %v, output: %s", err, string(output))}
+	}
+	v.frozen = now
+	logging.Infof("froze %s at %s", volumeId, v.stagingPath)
+	return kube.VolumeFreezeStatus{Phase: kube.VolumeFreezeFrozen, FrozenTime: now.UTC().Format(time.RFC3339)}
+}
+
+// thawVolume thaws the filesystem of volumeId if it was frozen by freezeVolume.
+func (node *cbsNode) thawVolume(volumeId string) {
+	node.volumes.mutex.Lock()
+	defer node.volumes.mutex.Unlock()
+
+	v, ok := node.volumes.volumes[volumeId]
+	if !ok || v.frozen.IsZero() {
+		return
+	}
+
+	output, err := node.mounter.Exec.Run("fsfreeze", "--unfreeze", v.stagingPath)
+	if err != nil {
+		logging.Errorf("fsfreeze --unfreeze %s err: %v, output: %s", v.stagingPath, err, string(output))
+	} else {
+		logging.Infof("thawed %s at %s after %v", volumeId, v.stagingPath, time.Since(v.frozen))
+	}
+	v.frozen = time.Time{}
+}
+
+// thawAllVolumes thaws the filesystems of all staged volumes, unfreezing a filesystem which is not
+// frozen fails and is ignored.
+func (node *cbsNode) thawAllVolumes() {
+	node.volumes.mutex.Lock()
+	defer node.volumes.mutex.Unlock()
+
+	for volumeId, v := range node.volumes.volumes {
+		if v.readOnly {
+			continue
+		}
+		if _, err := node.mounter.Exec.Run("fsfreeze", "--unfreeze", v.stagingPath); err == nil {
+			logging.Infof("thawed %s at %s frozen before the restart", volumeId, v.stagingPath)
+		}
+	}
+}
+
+// frozenVolumes returns when the volumes frozen by freezeVolume were frozen by volume id.
+func (node *cbsNode) frozenVolumes() map[string]time.Time {
+	node.volumes.mutex.Lock()
+	defer node.volumes.mutex.Unlock()
+
+	frozen := map[string]time.Time{}
+	for volumeId, v := range node.volumes.volumes {
+		if !v.frozen.IsZero() {
+			frozen[volumeId] = v.frozen
+		}
+	}
+	return frozen
+}
@@ -0,0 +1,282 @@
+package cbs
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+)
+
+var (
+	volumeAbnormal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_volume_abnormal",
+		Help: "Whether a staged volume is abnormal, e.g. its filesystem was remounted read only after io errors.",
+	}, []string{"volume_id", "reason"})
+
+	VolumeConditionReadOnlyRemount = "read_only_remount"
+
+	// staging paths created by kubelet for csi volumes contain this
+	KubeletCSIStagingPathSegment = "/plugins/kubernetes.io/csi/"
+	// kubelet stages csi volumes at <plugins dir>/kubernetes.io/csi/pv/<pv name>/globalmount
+	KubeletStagingPathBase = "globalmount"
+
+	DiskIdPrefix = "disk-"
+)
+
+func init() {
+	prometheus.MustRegister(volumeAbnormal)
+}
+
+// stagedVolume is a volume staged on this node.
+type stagedVolume struct {
+	stagingPath string
+	readOnly    bool
+	// trim the filesystem periodically
+	fstrim bool
+	// reason of the abnormal condition, empty if the volume is healthy
+	abnormal string
+	// target paths the volume is bind mounted at, one per pod using the volume on this node
+	targets map[string]bool
+	// the VolumeNearlyFull event was recorded and the volume did not drop below the threshold since
+	nearlyFull bool
+	// claim of the pv of the volume for the volume metrics, looked up once, nil if the pv has none
+	claim      *kube.ObjectReference
+	claimKnown bool
+	// when the filesystem was frozen for a snapshot, zero if it is not frozen
+	frozen time.Time
+}
+
+// volumeTracker keeps the volumes staged on this node.
+type volumeTracker struct {
+	mutex   sync.Mutex
+	volumes map[string]*stagedVolume
+	// the volumes are saved to this file on every change if it is set
+	stateFile string
+}
+
+func newVolumeTracker(stateFile string) *volumeTracker {
+	return &volumeTracker{volumes: map[string]*stagedVolume{}, stateFile: stateFile}
+}
+
+func (t *volumeTracker) has(volumeId string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	_, ok := t.volumes[volumeId]
+	return ok
+}
+
+func (t *volumeTracker) add(volumeId string, v *stagedVolume) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if v.targets == nil {
+		v.targets = map[string]bool{}
+	}
+	// a volume staged again keeps its targets
+	if old, ok := t.volumes[volumeId]; ok {
+		for target := range old.targets {
+			v.targets[target] = true
+		}
+	}
+	t.volumes[volumeId] = v
+	t.saveLocked()
+}
+
+func (t *volumeTracker) addTarget(volumeId, target string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if v, ok := t.volumes[volumeId]; ok && !v.targets[target] {
+		v.targets[target] = true
+		t.saveLocked()
+	}
+}
+
+func (t *volumeTracker) removeTarget(volumeId, target string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if v, ok := t.volumes[volumeId]; ok && v.targets[target] {
+		delete(v.targets, target)
+		t.saveLocked()
+	}
+}
+
+// targets returns the target paths volumeId is published at.
+func (t *volumeTracker) targets(volumeId string) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var targets []string
+	if v, ok := t.volumes[volumeId]; ok {
+		for target := range v.targets {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func (t *volumeTracker) remove(volumeId string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if v, ok := t.volumes[volumeId]; ok && v.abnormal != "" {
+		volumeAbnormal.DeleteLabelValues(volumeId, v.abnormal)
+	}
+	if _, ok := t.volumes[volumeId]; ok {
+		delete(t.volumes, volumeId)
+		t.saveLocked()
+	}
+}
+
+// diskIdOfDevice returns the id of the cbs disk behind device, or an empty string if device is
+// not a cbs disk.
+func diskIdOfDevice(device string) string {
+	if strings.HasPrefix(device, path.Join(LuksMapperPath, LuksMapperPrefix)) {
+		return strings.TrimPrefix(device, path.Join(LuksMapperPath, LuksMapperPrefix))
+	}
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	name := filepath.Base(device)
+	for _, serialPath := range []string{"serial", "device/serial"} {
+		serial, err := ioutil.ReadFile(path.Join(SysBlockPath, name, serialPath))
+		if err != nil {
+			continue
+		}
+		if id := strings.TrimSpace(string(serial)); strings.HasPrefix(id, DiskIdPrefix) {
+			return id
+		}
+	}
+	return ""
+}
+
+// recoverStagedVolumes adds the untracked cbs disks mounted at kubelet staging paths and their
+// target paths to the tracker, so that volumes staged before the node plugin restarted are checked too.
+func (node *cbsNode) recoverStagedVolumes() error {
+	mountPoints, err := node.mounter.List()
+	if err != nil {
+		return err
+	}
+
+	for _, mp := range mountPoints {
+		if !strings.Contains(mp.Path, KubeletCSIStagingPathSegment) {
+			continue
+		}
+		diskId := diskIdOfDevice(mp.Device)
+		if diskId == "" || node.volumes.has(diskId) {
+			continue
+		}
+		logging.Infof("found staged volume %s at %s", diskId, mp.Path)
+		// whether the volume was requested read only is unknown, take the current mount options
+		node.volumes.add(diskId, &stagedVolume{
+			stagingPath: mp.Path,
+			readOnly:    hasMountOption(mp.Opts, "ro"),
+			fstrim:      node.stagedVolumeFstrim(mp.Path),
+		})
+	}
+
+	// bind mounts list the device of their source
+	for _, mp := range mountPoints {
+		if !strings.Contains(mp.Path, KubeletCSITargetPathSegment) {
+			continue
+		}
+		if diskId := diskIdOfDevice(mp.Device); diskId != "" {
+			node.volumes.addTarget(diskId, mp.Path)
+		}
+	}
+
+	return nil
+}
+
+// stagedVolumeFstrim returns whether the volume staged at stagingPath is trimmed periodically, as
+// set by the discard attribute of its pv. The mount options do not tell, fstrim volumes are mounted
+// without discard.
+func (node *cbsNode) stagedVolumeFstrim(stagingPath string) bool {
+	pvName := pvNameOfPath(stagingPath)
+	if pvName == "" || node.kubeClient == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	pv := &kube.PersistentVolume{}
+	if err := node.kubeClient.Get(ctx, kube.PersistentVolumePath(pvName), pv); err != nil {
+		logging.Warningf("get pv %s err: %v, volume staged at %s is not trimmed until it is staged again", pvName, err, stagingPath)
+		return false
+	}
+	return pv.Spec.CSI != nil && pv.Spec.CSI.VolumeAttributes[DiscardAttr] == DiscardFstrim
+}
+
+func hasMountOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// checkVolumes detects staged volumes whose filesystem was remounted read only, which typically
+// happens after io errors, and reports them through the cbs_volume_abnormal metric.
+func (node *cbsNode) checkVolumes() {
+	mountPoints, err := node.mounter.List()
+	if err != nil {
+		logging.Errorf("list mount points err: %v", err)
+		return
+	}
+
+	options := map[string][]string{}
+	for _, mp := range mountPoints {
+		options[mp.Path] = mp.Opts
+	}
+
+	node.volumes.mutex.Lock()
+	defer node.volumes.mutex.Unlock()
+
+	for volumeId, v := range node.volumes.volumes {
+		opts, ok := options[v.stagingPath]
+		if !ok {
+			continue
+		}
+
+		abnormal := ""
+		if !v.readOnly && hasMountOption(opts, "ro") {
+			abnormal = VolumeConditionReadOnlyRemount
+		}
+
+		if abnormal == v.abnormal {
+			continue
+		}
+		if abnormal != "" {
+			logging.Warningf("volume %s staged at %s is abnormal: %s", volumeId, v.stagingPath, abnormal)
+			volumeAbnormal.WithLabelValues(volumeId, abnormal).Set(1)
+		} else {
+			logging.Infof("volume %s staged at %s is healthy again", volumeId, v.stagingPath)
+			volumeAbnormal.DeleteLabelValues(volumeId, v.abnormal)
+		}
+		v.abnormal = abnormal
+	}
+}
+
+// runVolumeHealthCheck checks staged volumes every cfg.VolumeHealthCheckInterval until stopCh is closed.
+func (node *cbsNode) runVolumeHealthCheck(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(node.config.Get().VolumeHealthCheckInterval):
+			node.checkVolumes()
+			node.checkVolumeUsage()
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package cbs
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	// HealthzPath is ok while the grpc server serves, for liveness probes
+	HealthzPath = "/healthz"
+	// ReadyzPath is ok while the grpc server serves and the checks of Probe pass, e.g. the cloud
+	// api accepts the credentials, for readiness probes
+	ReadyzPath = "/readyz"
+
+	serverHealth = &healthServer{}
+)
+
+// healthServer answers http liveness and readiness probes, so kubernetes probes can be used
+// without the livenessprobe sidecar.
+type healthServer struct {
+	// 1 while the grpc server serves
+	serving int32
+	checks  []func() error
+}
+
+func (h *healthServer) setServing(serving bool) {
+	var v int32
+	if serving {
+		v = 1
+	}
+	atomic.StoreInt32(&h.serving, v)
+}
+
+func (h *healthServer) healthz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.serving) == 0 {
+		http.Error(w, "grpc server not serving", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (h *healthServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.serving) == 0 {
+		http.Error(w, "grpc server not serving", http.StatusServiceUnavailable)
+		return
+	}
+	for _, check := range h.checks {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveHealth serves HealthzPath and ReadyzPath at address until the process exits.
+func serveHealth(address string, h *healthServer) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(HealthzPath, h.healthz)
+	mux.HandleFunc(ReadyzPath, h.readyz)
+
+	logging.Infof("serving health checks at %s%s and %s", address, HealthzPath, ReadyzPath)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logging.Errorf("serve health checks err: %v", err)
+	}
+}
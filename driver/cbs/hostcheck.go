@@ -0,0 +1,74 @@
+package cbs
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	// binaries the node plugin can not stage volumes of any filesystem without
+	RequiredHostBinaries = []string{"mount", "umount", "blkid", "blockdev"}
+	// binaries to format, check and resize each filesystem, required for the default filesystem
+	// and for volumes staged with the filesystem
+	FsTypeHostBinaries = map[string][]string{
+		FsTypeExt4: {"mkfs.ext4", "e2fsck", "dumpe2fs", "resize2fs"},
+		FsTypeXfs:  {"mkfs.xfs", "xfs_repair", "xfs_info", "xfs_growfs"},
+	}
+	// binaries only some features need
+	OptionalHostBinaries = []string{"udevadm", "cryptsetup", "fstrim", "fsfreeze"}
+)
+
+// missingHostBinaries returns the binaries not found in PATH.
+func missingHostBinaries(binaries []string) []string {
+	var missing []string
+	for _, binary := range binaries {
+		if _, err := exec.LookPath(binary); err != nil {
+			missing = append(missing, binary)
+		}
+	}
+	return missing
+}
+
+// checkFsTypeBinaries verifies that the binaries of the filesystem fsType are available.
+func checkFsTypeBinaries(fsType string) error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	if missing := missingHostBinaries(FsTypeHostBinaries[fsType]); len(missing) > 0 {
+		return fmt.Errorf("binaries of %s not found in PATH: %s", fsType, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkHostBinaries verifies that the binaries used to mount volumes and to format, check and
+// resize the default filesystem fsType are available, so a broken image is reported at startup
+// instead of on the first NodeStageVolume. Images may leave out the tools of other filesystems,
+// volumes of those fail to stage.
+func checkHostBinaries(fsType string) error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	missing := missingHostBinaries(RequiredHostBinaries)
+	missing = append(missing, missingHostBinaries(FsTypeHostBinaries[fsType])...)
+	for other := range FsTypeHostBinaries {
+		if other == fsType {
+			continue
+		}
+		if err := checkFsTypeBinaries(other); err != nil {
+			logging.Warningf("%v, volumes with fsType %s can not be staged", err, other)
+		}
+	}
+	for _, binary := range missingHostBinaries(OptionalHostBinaries) {
+		logging.Warningf("%s not found, features depending on it will not work", binary)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("required binaries not found in PATH: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -3,18 +3,24 @@ package cbs
 import (
 	"github.com/container-storage-interface/spec/lib/go/csi/v0"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type cbsIdentity struct{}
+type cbsIdentity struct {
+	// errors which make the plugin unhealthy, checked by Probe
+	healthChecks []func() error
+}
 
-func newCbsIdentity() (*cbsIdentity, error) {
-	return &cbsIdentity{}, nil
+func newCbsIdentity(healthChecks ...func() error) (*cbsIdentity, error) {
+	return &cbsIdentity{healthChecks: healthChecks}, nil
 }
 
 func (identity *cbsIdentity) GetPluginInfo(context.Context, *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
 	return &csi.GetPluginInfoResponse{
 		Name:          DriverName,
 		VendorVersion: DriverVerision,
+		Manifest:      VersionInfo(),
 	}, nil
 }
 
@@ -28,10 +34,22 @@ func (identity *cbsIdentity) GetPluginCapabilities(context.Context, *csi.GetPlug
 					},
 				},
 			},
+			{
+				Type: &csi.PluginCapability_Service_{
+					Service: &csi.PluginCapability_Service{
+						Type: csi.PluginCapability_Service_ACCESSIBILITY_CONSTRAINTS,
+					},
+				},
+			},
 		},
 	}, nil
 }
 
 func (identity *cbsIdentity) Probe(context.Context, *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	for _, check := range identity.healthChecks {
+		if err := check(); err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
 	return &csi.ProbeResponse{}, nil
 }
@@ -0,0 +1,160 @@
+package cbs
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cvm"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	InstanceIdPrefix = "ins-"
+
+	// how long a resolved node id is cached, nodes may be replaced by instances with the same name
+	InstanceIdCacheTTL = time.Minute * 10
+
+	NodeInternalIP = "InternalIP"
+
+	// cvm DescribeInstances filters
+	InstanceFilterPrivateIpAddress = "private-ip-address"
+	InstanceFilterInstanceName     = "instance-name"
+)
+
+type cachedInstanceId struct {
+	instanceId string
+	expires    time.Time
+}
+
+// instanceIdCache maps node ids which are not instance ids, e.g. hostnames or private ips, to instance ids.
+type instanceIdCache struct {
+	mutex     sync.Mutex
+	instances map[string]cachedInstanceId
+	// instance id to zone
+	zones map[string]string
+}
+
+func newInstanceIdCache() *instanceIdCache {
+	return &instanceIdCache{instances: map[string]cachedInstanceId{}, zones: map[string]string{}}
+}
+
+func (c *instanceIdCache) get(nodeId string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cached, ok := c.instances[nodeId]
+	if !ok || time.Now().After(cached.expires) {
+		return "", false
+	}
+	return cached.instanceId, true
+}
+
+func (c *instanceIdCache) set(nodeId, instanceId string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.instances[nodeId] = cachedInstanceId{instanceId: instanceId, expires: time.Now().Add(InstanceIdCacheTTL)}
+}
+
+func (c *instanceIdCache) zone(instanceId string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	zone, ok := c.zones[instanceId]
+	return zone, ok
+}
+
+func (c *instanceIdCache) setZone(instanceId, zone string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.zones[instanceId] = zone
+}
+
+// resolveInstanceId returns the instance id of the node with id nodeId. Node ids are instance ids
+// when reported by NodeGetId, but kubelets registered with hostnames may pass the node name or
+// private ip instead. Those are resolved through the kubernetes node object and the cvm api.
+func (ctrl *cbsController) resolveInstanceId(ctx context.Context, nodeId string) (string, error) {
+	if strings.HasPrefix(nodeId, InstanceIdPrefix) {
+		return nodeId, nil
+	}
+
+	if instanceId, ok := ctrl.instances.get(nodeId); ok {
+		return instanceId, nil
+	}
+
+	privateIp := ""
+	if net.ParseIP(nodeId) != nil {
+		privateIp = nodeId
+	} else if ctrl.kubeClient != nil {
+		node := &kube.Node{}
+		if err := ctrl.kubeClient.Get(ctx, kube.NodePath(nodeId), node); err != nil {
+			logging.Warningf("get node %s err: %v", nodeId, err)
+		} else {
+			// provider id is qcloud:///<zone id>/<instance id> on tke
+			if instanceId := node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, "/")+1:]; strings.HasPrefix(instanceId, InstanceIdPrefix) {
+				logging.Infof("node %s resolved to instance %s by provider id", nodeId, instanceId)
+				ctrl.instances.set(nodeId, instanceId)
+				return instanceId, nil
+			}
+			for _, address := range node.Status.Addresses {
+				if address.Type == NodeInternalIP {
+					privateIp = address.Address
+					break
+				}
+			}
+		}
+	}
+
+	filter := &cvm.Filter{Name: &InstanceFilterInstanceName, Values: []*string{&nodeId}}
+	if privateIp != "" {
+		filter = &cvm.Filter{Name: &InstanceFilterPrivateIpAddress, Values: []*string{&privateIp}}
+	}
+
+	instanceId, err := ctrl.describeInstanceId(ctx, filter)
+	if err != nil {
+		return "", err
+	}
+
+	logging.Infof("node %s resolved to instance %s by %s", nodeId, instanceId, *filter.Name)
+	ctrl.instances.set(nodeId, instanceId)
+
+	return instanceId, nil
+}
+
+func (ctrl *cbsController) describeInstanceId(ctx context.Context, filter *cvm.Filter) (string, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+
+	request := cvm.NewDescribeInstancesRequest()
+	request.Filters = []*cvm.Filter{filter}
+
+	response, err := ctrl.cbsClient.DescribeInstances(ctx, request)
+	if err != nil {
+		return "", cloudError(codes.Internal, err)
+	}
+
+	var instanceIds []string
+	for _, instance := range response.Response.InstanceSet {
+		if instance.InstanceId != nil {
+			instanceIds = append(instanceIds, *instance.InstanceId)
+		}
+	}
+
+	switch len(instanceIds) {
+	case 0:
+		return "", status.Error(codes.NotFound, fmt.Sprintf("no instance found with %s %s", *filter.Name, *filter.Values[0]))
+	case 1:
+		return instanceIds[0], nil
+	default:
+		return "", status.Error(codes.FailedPrecondition, fmt.Sprintf("instances %s found with %s %s", strings.Join(instanceIds, ", "), *filter.Name, *filter.Values[0]))
+	}
+}
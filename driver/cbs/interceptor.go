@@ -0,0 +1,162 @@
+package cbs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/redact"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// grpc metadata key of a request id set by the caller, a new id is generated if it is missing
+	RequestIdMetadataKey = "x-request-id"
+
+	// prefix of the rpcs which are not limited by MaxInflightRequests, so Probe keeps working
+	IdentityServicePrefix = "/csi.v0.Identity/"
+)
+
+type requestIdKey struct{}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIdFromContext returns the id of the csi rpc handled with ctx, or an empty string.
+func requestIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// newLogInterceptor returns a grpc interceptor which tags every rpc with a request id and logs its
+// sanitized request and response at the verbosity of cfg.GRPCLogLevel, along with the duration.
+// Failed rpcs are always logged.
+func newLogInterceptor(config *configStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requestId := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[RequestIdMetadataKey]) > 0 {
+			requestId = md[RequestIdMetadataKey][0]
+		}
+		if requestId == "" {
+			requestId = newRequestId()
+		}
+		ctx = context.WithValue(ctx, requestIdKey{}, requestId)
+
+		ctx, span := trace.Start(ctx, info.FullMethod, trace.KindServer)
+		span.SetAttribute("request_id", requestId)
+
+		level := logging.Level(config.Get().GRPCLogLevel)
+
+		logging.V(level).Infof("[%s] GRPC call: %s, request: %+v", requestId, info.FullMethod, redact.Message(req))
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		span.End(err)
+		observeOperation(info.FullMethod, start, err)
+		duration := time.Since(start)
+
+		if err != nil {
+			if s, ok := status.FromError(err); ok {
+				// keep the details, only the message may contain secrets
+				p := s.Proto()
+				p.Message = redact.String(p.Message)
+				err = status.ErrorProto(p)
+			}
+			logging.Errorf("[%s] GRPC error: %s failed after %v: %v", requestId, info.FullMethod, duration, err)
+		} else {
+			logging.V(level).Infof("[%s] GRPC response: %s succeeded after %v, response: %+v", requestId, info.FullMethod, duration, redact.Message(resp))
+		}
+		return resp, err
+	}
+}
+
+// newConcurrencyLimitInterceptor returns a grpc interceptor which fails rpcs with ResourceExhausted
+// while cfg.MaxInflightRequests rpcs are in flight, so sidecars retrying timed out calls can not pile
+// up goroutines polling the cloud api. Identity rpcs are not limited, the other rpcs are listed at
+// OperationsPath while they run.
+func newConcurrencyLimitInterceptor(config *configStore) grpc.UnaryServerInterceptor {
+	var inflight int64
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, IdentityServicePrefix) {
+			return handler(ctx, req)
+		}
+
+		n := atomic.AddInt64(&inflight, 1)
+		defer atomic.AddInt64(&inflight, -1)
+
+		if max := config.Get().MaxInflightRequests; max > 0 && n > int64(max) {
+			return nil, status.Errorf(codes.ResourceExhausted, "%d rpcs in flight, limit is %d", n-1, max)
+		}
+
+		inflightOperations.Inc()
+		defer inflightOperations.Dec()
+
+		ctx, done := operations.start(ctx, info.FullMethod, req)
+		defer done()
+
+		return handler(ctx, req)
+	}
+}
+
+// newTimeoutInterceptor returns a grpc interceptor which bounds rpcs by the server side deadline
+// configured for their method in cfg.RPCTimeouts, e.g. CreateVolume.
+func newTimeoutInterceptor(config *configStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		timeout, ok := config.Get().RPCTimeouts[path.Base(info.FullMethod)]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return handler(context.WithValue(ctx, serverDeadlineKey{}, time.Now().Add(timeout)), req)
+	}
+}
+
+type serverDeadlineKey struct{}
+
+// pollContext returns the context to wait for a disk with after the rpc handled with ctx changed
+// it. Waiting goes on when the caller gives up, e.g. when a sidecar times out, so the change is not
+// left half done, but stops after timeout or the server side deadline of the rpc, whichever is earlier,
+// or when this replica loses the lease it held when the rpc started.
+func pollContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Value(serverDeadlineKey{}).(time.Time); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	pollCtx := trace.ContextWithSpan(context.Background(), trace.FromContext(ctx))
+	if op := ctx.Value(operationKey{}); op != nil {
+		pollCtx = context.WithValue(pollCtx, operationKey{}, op)
+	}
+	if term := ctx.Value(leaderTermKey{}); term != nil {
+		pollCtx = context.WithValue(pollCtx, leaderTermKey{}, term)
+	}
+	pollCtx, cancel := context.WithTimeout(pollCtx, timeout)
+	return withLeaderTerm(pollCtx, cancel), cancel
+}
+
+// chainUnaryInterceptors combines interceptors into one, the first one is the outermost.
+func chainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,271 @@
+package cbs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	LeaseName = "com-tencent-cloud-csi-cbs"
+
+	// namespace of the lease and volume freezes when POD_NAMESPACE is not set
+	DefaultLeaseNamespace = "kube-system"
+
+	LeaseDuration    = time.Second * 15
+	LeaseRenewPeriod = time.Second * 5
+)
+
+// leaderElector holds a coordination.k8s.io lease so that only one controller replica makes cloud
+// api calls which change disks.
+type leaderElector struct {
+	client    *kube.Client
+	namespace string
+	identity  string
+
+	// holder and renew time of the lease when it last changed, and the local time this replica saw
+	// the change at. Replicas only compare their own clock against observedTime, never against the
+	// renew time written by another replica, so clock skew between nodes does not shorten leases.
+	observedHolder string
+	observedRenew  string
+	observedTime   time.Time
+
+	mutex sync.RWMutex
+	// time until which this replica holds the lease, zero if it is not the leader
+	leaseExpires time.Time
+	// closed when this replica loses the lease, nil if it is not the leader
+	term chan struct{}
+	// ends the term when the lease expires without being renewed
+	expiryTimer *time.Timer
+}
+
+// leaderTermKey is the context key of the term of the leader a context was derived in.
+type leaderTermKey struct{}
+
+func newLeaderElector(client *kube.Client) (*leaderElector, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &leaderElector{client: client, namespace: podNamespace(), identity: identity}, nil
+}
+
+// podNamespace returns the namespace the driver runs in, which holds its lease and volume freezes.
+func podNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return DefaultLeaseNamespace
+}
+
+// isLeader reports whether this replica holds an unexpired lease. A nil elector is always the leader.
+func (e *leaderElector) isLeader() bool {
+	if e == nil {
+		return true
+	}
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return time.Now().Before(e.leaseExpires)
+}
+
+// termContext returns a context derived from parent which is canceled when this replica loses the
+// lease, or after timeout if it is positive. ok is false if this replica is not the leader. A nil
+// elector is always the leader and never cancels the context.
+func (e *leaderElector) termContext(parent context.Context, timeout time.Duration) (ctx context.Context, cancel context.CancelFunc, ok bool) {
+	ctx = parent
+	if e != nil {
+		e.mutex.RLock()
+		term, leader := e.term, time.Now().Before(e.leaseExpires)
+		e.mutex.RUnlock()
+		if !leader || term == nil {
+			return nil, nil, false
+		}
+		ctx = context.WithValue(ctx, leaderTermKey{}, term)
+	}
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return withLeaderTerm(ctx, cancel), cancel, true
+}
+
+// withLeaderTerm calls cancel when the term ctx was derived in ends, so that work started by a leader
+// does not go on after another replica may have taken over.
+func withLeaderTerm(ctx context.Context, cancel context.CancelFunc) context.Context {
+	term, ok := ctx.Value(leaderTermKey{}).(chan struct{})
+	if !ok {
+		return ctx
+	}
+	go func() {
+		select {
+		case <-term:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx
+}
+
+// tryAcquire creates, renews or takes over the lease, it returns whether this replica holds it.
+func (e *leaderElector) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	renewTime := kube.NewMicroTime(now)
+	durationSeconds := int32(LeaseDuration / time.Second)
+
+	lease := &kube.Lease{}
+	err := e.client.Get(ctx, kube.LeasePath(e.namespace, LeaseName), lease)
+	if kube.IsNotFound(err) {
+		lease = &kube.Lease{
+			Metadata: kube.ObjectMeta{Name: LeaseName, Namespace: e.namespace},
+			Spec: kube.LeaseSpec{
+				HolderIdentity:       &e.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}
+		if err := e.client.Create(ctx, kube.LeasesPath(e.namespace), lease, nil); err != nil {
+			if kube.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder, renew := "", ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if lease.Spec.RenewTime != nil {
+		renew = lease.Spec.RenewTime.UTC().String()
+	}
+	if holder != e.observedHolder || renew != e.observedRenew || e.observedTime.IsZero() {
+		e.observedHolder, e.observedRenew, e.observedTime = holder, renew, now
+	}
+
+	if holder != e.identity {
+		if holder != "" {
+			duration := LeaseDuration
+			if lease.Spec.LeaseDurationSeconds != nil {
+				duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+			}
+			// the holder renewed the lease within its duration as seen on the local clock
+			if now.Before(e.observedTime.Add(duration)) {
+				return false, nil
+			}
+		}
+		logging.Infof("lease %s/%s of %s expired, taking it over", e.namespace, LeaseName, holder)
+		lease.Spec.HolderIdentity = &e.identity
+		lease.Spec.AcquireTime = &renewTime
+	}
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &renewTime
+
+	// the update carries the resource version, it fails if another replica changed the lease meanwhile
+	if err := e.client.Update(ctx, kube.LeasePath(e.namespace, LeaseName), lease, nil); err != nil {
+		if kube.IsConflict(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	e.observedHolder, e.observedRenew, e.observedTime = e.identity, renewTime.UTC().String(), now
+	return true, nil
+}
+
+// run acquires and renews the lease every LeaseRenewPeriod until stopCh is closed.
+func (e *leaderElector) run(stopCh <-chan struct{}) {
+	for {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), LeaseRenewPeriod)
+		acquired, err := e.tryAcquire(ctx)
+		cancel()
+		if err != nil {
+			logging.Errorf("acquire lease %s/%s err: %v", e.namespace, LeaseName, err)
+		}
+
+		if acquired {
+			// leave a margin so the lease is given up before another replica may take it over
+			e.renewed(start.Add(LeaseDuration - LeaseRenewPeriod))
+		} else if err == nil {
+			// another replica holds the lease
+			e.endTerm(e.currentTerm(), true)
+		}
+
+		select {
+		case <-time.After(LeaseRenewPeriod):
+		case <-stopCh:
+			e.endTerm(e.currentTerm(), true)
+			return
+		}
+	}
+}
+
+// renewed records that this replica holds the lease until expires, starting a new term if it was
+// not the leader.
+func (e *leaderElector) renewed(expires time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.term == nil || !time.Now().Before(e.leaseExpires) {
+		if e.term != nil {
+			close(e.term)
+		}
+		e.term = make(chan struct{})
+		logging.Infof("%s became leader of lease %s/%s", e.identity, e.namespace, LeaseName)
+	}
+	e.leaseExpires = expires
+
+	if e.expiryTimer != nil {
+		e.expiryTimer.Stop()
+	}
+	term := e.term
+	e.expiryTimer = time.AfterFunc(time.Until(expires), func() { e.endTerm(term, false) })
+}
+
+func (e *leaderElector) currentTerm() chan struct{} {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.term
+}
+
+// endTerm cancels the work started in term, when the lease expired or, if lost is set, when another
+// replica holds it.
+func (e *leaderElector) endTerm(term chan struct{}, lost bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if term == nil || e.term != term || (!lost && time.Now().Before(e.leaseExpires)) {
+		return
+	}
+	close(e.term)
+	e.term = nil
+	e.leaseExpires = time.Time{}
+	logging.Infof("%s is no longer leader of lease %s/%s, canceling its operations", e.identity, e.namespace, LeaseName)
+}
+
+// leaderContext returns a context derived from ctx which is canceled when this replica loses the
+// lease, or a grpc error if this replica must not change disks because it is not the leader.
+func (ctrl *cbsController) leaderContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	ctx, cancel, ok := ctrl.leader.termContext(ctx, 0)
+	if !ok {
+		return nil, nil, status.Error(codes.Unavailable, fmt.Sprintf("not the leader of lease %s, retry on the leader", LeaseName))
+	}
+	return ctx, cancel, nil
+}
@@ -0,0 +1,84 @@
+package cbs
+
+import (
+	"strings"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	// storage class parameters of the in-tree and flexvolume qcloud-cbs provisioner
+	LegacyDiskTypeAttr  = "type"
+	LegacyPayModeAttr   = "paymode"
+	LegacyRenewFlagAttr = "renewflag"
+
+	// paymode values of the qcloud-cbs provisioner
+	LegacyPayModePrePaid  = "PREPAID"
+	LegacyPayModePostPaid = "POSTPAID"
+
+	// disk type names used by the qcloud-cbs provisioner besides the api names
+	LegacyDiskTypes = map[string]string{
+		"cloudBasic":   DiskTypeCloudBasic,
+		"cloudPremium": DiskTypeCloudPremium,
+		"cloudSsd":     DiskTypeCloudSsd,
+	}
+
+	// qcloud-cbs parameters without an equivalent, they are ignored
+	LegacyIgnoredAttrs = []string{"zone", "aspid"}
+)
+
+// convertLegacyParameters maps storage class parameters of the qcloud-cbs provisioner to the ones
+// of this driver, so storage classes can switch provisioner without being rewritten. Parameters of
+// this driver take precedence over legacy ones.
+func convertLegacyParameters(parameters map[string]string) map[string]string {
+	result := make(map[string]string, len(parameters))
+	for k, v := range parameters {
+		result[k] = v
+	}
+
+	convert := func(legacyAttr, attr string, value func(string) string) {
+		legacyValue, ok := result[legacyAttr]
+		if !ok {
+			return
+		}
+		delete(result, legacyAttr)
+		if _, ok := result[attr]; !ok {
+			result[attr] = value(legacyValue)
+		}
+	}
+
+	convert(LegacyDiskTypeAttr, DiskTypeAttr, func(v string) string {
+		if diskType, ok := LegacyDiskTypes[v]; ok {
+			return diskType
+		}
+		return v
+	})
+	convert(LegacyPayModeAttr, DiskChargeTypeAttr, func(v string) string {
+		if v == LegacyPayModePostPaid {
+			return DiskChargeTypePostPaidByHour
+		}
+		return v
+	})
+	convert(LegacyRenewFlagAttr, DiskChargePrepaidRenewFlagAttr, func(v string) string {
+		return v
+	})
+
+	for _, attr := range LegacyIgnoredAttrs {
+		if _, ok := result[attr]; ok {
+			logging.Warningf("storage class parameter %s of qcloud-cbs is not supported, ignoring it", attr)
+			delete(result, attr)
+		}
+	}
+
+	return result
+}
+
+// legacyVolumeId returns the disk id of a volume handle written by the qcloud-cbs provisioner or by
+// hand for a migrated pv, e.g. qcloud-cbs://disk-xxx or <zone>/disk-xxx. Other handles are returned
+// unchanged.
+func legacyVolumeId(volumeId string) string {
+	if i := strings.LastIndex(volumeId, "/"); i >= 0 && strings.HasPrefix(volumeId[i+1:], DiskIdPrefix) {
+		return volumeId[i+1:]
+	}
+	return volumeId
+}
@@ -0,0 +1,13 @@
+package cbs
+
+var (
+	// set up dm-crypt/luks on the node before formatting, the key is read from the node stage secret
+	LuksEncryptAttr  = "luksEncrypt"
+	LuksEncryptTrue  = "true"
+	LuksKeySecretKey = "luksKey"
+
+	LuksDiskFormat    = "crypto_LUKS"
+	LuksMapperPath    = "/dev/mapper"
+	LuksMapperPrefix  = "luks-"
+	LuksCryptsetupCmd = "cryptsetup"
+)
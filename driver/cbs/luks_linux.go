@@ -0,0 +1,90 @@
+//go:build linux
+// +build linux
+
+package cbs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+func luksMapperName(diskId string) string {
+	return LuksMapperPrefix + diskId
+}
+
+// openLuks opens the luks device on top of device and returns the path of the decrypted device.
+// A blank disk is luks formatted first, a disk with any other content is refused so that existing
+// data is never overwritten.
+func (node *cbsNode) openLuks(diskId, device string, secrets map[string]string) (string, error) {
+	mapperName := luksMapperName(diskId)
+	mapperPath := path.Join(LuksMapperPath, mapperName)
+
+	if _, err := os.Stat(mapperPath); err == nil {
+		return mapperPath, nil
+	}
+
+	key := secrets[LuksKeySecretKey]
+	if key == "" {
+		return "", fmt.Errorf("node stage secret %s is required for luks encrypted volumes", LuksKeySecretKey)
+	}
+
+	keyFile, err := ioutil.TempFile("", "luks-key-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(keyFile.Name())
+
+	_, err = keyFile.WriteString(key)
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	format, err := node.mounter.GetDiskFormat(device)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case LuksDiskFormat:
+	case "":
+		logging.Infof("disk %s is blank, setting up luks", device)
+		if output, err := node.mounter.Exec.Run(LuksCryptsetupCmd, "luksFormat", "--batch-mode", "--key-file", keyFile.Name(), device); err != nil {
+			return "", fmt.Errorf("luks format disk %s err: %v, output: %s", device, err, string(output))
+		}
+	default:
+		return "", fmt.Errorf("disk %s already contains %s, refusing to set up luks on it", device, format)
+	}
+
+	if output, err := node.mounter.Exec.Run(LuksCryptsetupCmd, "luksOpen", "--key-file", keyFile.Name(), device, mapperName); err != nil {
+		return "", fmt.Errorf("luks open disk %s err: %v, output: %s", device, err, string(output))
+	}
+
+	// the disk may have been expanded since the luks device was created
+	if output, err := node.mounter.Exec.Run(LuksCryptsetupCmd, "resize", "--key-file", keyFile.Name(), mapperName); err != nil {
+		logging.Warningf("resize luks device %s err: %v, output: %s", mapperName, err, string(output))
+	}
+
+	return mapperPath, nil
+}
+
+// closeLuks closes the luks device of diskId if it is open.
+func (node *cbsNode) closeLuks(diskId string) error {
+	mapperName := luksMapperName(diskId)
+
+	if _, err := os.Stat(path.Join(LuksMapperPath, mapperName)); os.IsNotExist(err) {
+		return nil
+	}
+
+	if output, err := node.mounter.Exec.Run(LuksCryptsetupCmd, "luksClose", mapperName); err != nil {
+		return fmt.Errorf("luks close %s err: %v, output: %s", mapperName, err, string(output))
+	}
+
+	return nil
+}
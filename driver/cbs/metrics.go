@@ -0,0 +1,90 @@
+package cbs
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	operationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbs_csi_operations_total",
+		Help: "Number of csi rpcs handled by the driver, by method and grpc status code.",
+	}, []string{"method", "grpc_status_code"})
+
+	operationsSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cbs_csi_operations_seconds",
+		Help: "Duration in seconds of csi rpcs handled by the driver, by method and grpc status code.",
+		// attach and create wait for the disk for up to minutes
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 15, 30, 60, 120, 300},
+	}, []string{"method", "grpc_status_code"})
+
+	inflightOperations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cbs_csi_inflight_operations",
+		Help: "Number of controller and node csi rpcs in flight.",
+	})
+
+	diskAttachmentSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cbs_disk_attachment_seconds",
+		Help:    "Seconds from AttachDisks or DetachDisks until the disk reached its terminal state, by operation, zone, disk type and result.",
+		Buckets: []float64{1, 2.5, 5, 10, 15, 20, 30, 45, 60, 90, 120, 180, 300},
+	}, []string{"operation", "zone", "disk_type", "result"})
+
+	AttachmentOperationAttach = "attach"
+	AttachmentOperationDetach = "detach"
+
+	// results of attachments, error if the call failed and timeout if the disk did not reach its
+	// terminal state in time
+	AttachmentResultSuccess = "success"
+	AttachmentResultError   = "error"
+	AttachmentResultTimeout = "timeout"
+
+	MetricsPath = "/metrics"
+)
+
+func init() {
+	prometheus.MustRegister(operationsTotal)
+	prometheus.MustRegister(operationsSeconds)
+	prometheus.MustRegister(inflightOperations)
+	prometheus.MustRegister(diskAttachmentSeconds)
+}
+
+// observeOperation records a csi rpc of fullMethod, e.g. /csi.v0.Controller/CreateVolume, which
+// started at start and returned err.
+func observeOperation(fullMethod string, start time.Time, err error) {
+	method := path.Base(fullMethod)
+	code := status.Code(err).String()
+
+	operationsTotal.WithLabelValues(method, code).Inc()
+	operationsSeconds.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
+
+// observeAttachment records an attach or detach of disk which started at start.
+func observeAttachment(operation string, disk *cbs.Disk, start time.Time, result string) {
+	zone, diskType := "", ""
+	if disk != nil {
+		if disk.Placement != nil && disk.Placement.Zone != nil {
+			zone = *disk.Placement.Zone
+		}
+		if disk.DiskType != nil {
+			diskType = *disk.DiskType
+		}
+	}
+	diskAttachmentSeconds.WithLabelValues(operation, zone, diskType, result).Observe(time.Since(start).Seconds())
+}
+
+// serveMetrics serves the prometheus metrics of the driver at address until the process exits.
+func serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, prometheus.UninstrumentedHandler())
+
+	logging.Infof("serving metrics at %s%s", address, MetricsPath)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logging.Errorf("serve metrics err: %v", err)
+	}
+}
@@ -0,0 +1,472 @@
+package cbs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cvm"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// interval between two checks for pods waiting for a volume in another zone
+	VolumeMigrationCheckPeriod = time.Second * 30
+
+	// annotations of a claim whose volume is being migrated to another zone, they keep the state of
+	// the migration while the persistent volume is replaced
+	MigrationZoneAnnotation          = "cbs.csi.cloud.tencent.com/migration-zone"
+	MigrationSourceAnnotation        = "cbs.csi.cloud.tencent.com/migration-source"
+	MigrationReclaimPolicyAnnotation = "cbs.csi.cloud.tencent.com/migration-reclaim-policy"
+	MigrationSnapshotAnnotation      = "cbs.csi.cloud.tencent.com/migration-snapshot"
+	MigrationDiskAnnotation          = "cbs.csi.cloud.tencent.com/migration-disk"
+	MigrationVolumeAnnotation        = "cbs.csi.cloud.tencent.com/migration-volume"
+
+	// annotation of a migrated persistent volume with the disk it was migrated from
+	MigratedFromAnnotation = "cbs.csi.cloud.tencent.com/migrated-from"
+
+	MigrationSnapshotNamePrefix = "csi-migrate-"
+
+	// zone label of nodes without the topology of the driver, tke sets it to the zone id, e.g. 100003
+	LegacyZoneLabel = "failure-domain.beta.kubernetes.io/zone"
+
+	// part of the message of the scheduler for pods whose volumes are in another zone
+	VolumeNodeAffinityConflict = "volume node affinity conflict"
+
+	EventReasonVolumeMigrating = "VolumeMigrating"
+
+	ReclaimPolicyRetain = "Retain"
+	ReclaimPolicyDelete = "Delete"
+)
+
+// runVolumeMigrations migrates the volumes of pods which can not be scheduled because their disks
+// are in another zone until stopCh is closed. Only the leader migrates them when leader election
+// is enabled.
+func (ctrl *cbsController) runVolumeMigrations(stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), VolumeMigrationCheckPeriod*4); ok {
+			if err := ctrl.checkVolumeMigrations(ctx); err != nil {
+				logging.Errorf("check volume migrations err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(VolumeMigrationCheckPeriod):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// checkVolumeMigrations takes the next step of the migrations in progress, and starts one for
+// every claim of an unschedulable pod whose disk is in another zone than the nodes the pod can run
+// on.
+func (ctrl *cbsController) checkVolumeMigrations(ctx context.Context) error {
+	claims := &kube.PersistentVolumeClaimList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.AllPersistentVolumeClaimsPath(), claims); err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if claim.Metadata.Annotations[MigrationZoneAnnotation] == "" {
+			continue
+		}
+		if err := ctrl.migrateVolume(ctx, claim); err != nil {
+			logging.Errorf("migrate volume of claim %s/%s err: %v", claim.Metadata.Namespace, claim.Metadata.Name, err)
+		}
+	}
+
+	pods := &kube.PodList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PendingPodsPath(), pods); err != nil {
+		return err
+	}
+	var nodes *kube.NodeList
+	var zones map[string]string
+	for _, pod := range pods.Items {
+		if !hasVolumeZoneConflict(&pod) {
+			continue
+		}
+		if nodes == nil {
+			nodes = &kube.NodeList{}
+			if err := ctrl.kubeClient.Get(ctx, kube.NodesPath(), nodes); err != nil {
+				return err
+			}
+			var err error
+			if zones, err = ctrl.zonesById(ctx); err != nil {
+				return err
+			}
+		}
+
+		zone := podZone(&pod, nodes.Items, zones)
+		if zone == "" {
+			logging.V(4).Infof("pod %s/%s can run in more than one zone or none, not migrating its volumes", pod.Metadata.Namespace, pod.Metadata.Name)
+			continue
+		}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			if err := ctrl.startVolumeMigration(ctx, pod.Metadata.Namespace, volume.PersistentVolumeClaim.ClaimName, zone); err != nil {
+				logging.Errorf("migrate volume of claim %s/%s to %s err: %v", pod.Metadata.Namespace, volume.PersistentVolumeClaim.ClaimName, zone, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasVolumeZoneConflict reports whether the scheduler found no node for pod because of the node
+// affinity of its volumes.
+func hasVolumeZoneConflict(pod *kube.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == kube.PodScheduled && c.Status == kube.ConditionStatusFalse && c.Reason == kube.PodReasonUnschedulable {
+			return strings.Contains(c.Message, VolumeNodeAffinityConflict)
+		}
+	}
+	return false
+}
+
+// podZone returns the zone of the schedulable nodes matching the node selector of pod, an empty
+// string unless they are all in one zone. Nodes without the topology label of the driver are in
+// the zone of their LegacyZoneLabel, translated with zones by zone id.
+func podZone(pod *kube.Pod, nodes []kube.Node, zones map[string]string) string {
+	zone := ""
+	for _, node := range nodes {
+		if node.Spec.Unschedulable || !hasLabels(node.Metadata.Labels, pod.Spec.NodeSelector) {
+			continue
+		}
+		z := node.Metadata.Labels[TopologyZoneKey]
+		if z == "" {
+			z = node.Metadata.Labels[LegacyZoneLabel]
+			if name, ok := zones[z]; ok {
+				z = name
+			}
+		}
+		if z == "" || (zone != "" && z != zone) {
+			return ""
+		}
+		zone = z
+	}
+	return zone
+}
+
+// startVolumeMigration starts to migrate the volume of a claim to zone, unless its disk is in zone
+// already or still attached.
+func (ctrl *cbsController) startVolumeMigration(ctx context.Context, namespace, name, zone string) error {
+	claim := &kube.PersistentVolumeClaim{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumeClaimPath(namespace, name), claim); err != nil {
+		return err
+	}
+	if claim.Spec.VolumeName == "" || claim.Metadata.Annotations[MigrationZoneAnnotation] != "" {
+		return nil
+	}
+	pv := &kube.PersistentVolume{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumePath(claim.Spec.VolumeName), pv); err != nil {
+		return err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName {
+		return nil
+	}
+	if pv.Spec.NodeAffinity == nil {
+		// provisioned without topology, e.g. by csi-provisioner 0.3.0, the volume is not the
+		// conflict and its pods can run in any zone
+		logging.V(4).Infof("pv %s of claim %s/%s has no node affinity, not migrating it", pv.Metadata.Name, namespace, name)
+		return nil
+	}
+	diskId := legacyVolumeId(pv.Spec.CSI.VolumeHandle)
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	disk, err := describeDisk(ctx, ctrl.cbsClient, diskId)
+	if err != nil {
+		return err
+	}
+	if disk.Placement != nil && stringValue(disk.Placement.Zone) == zone {
+		return nil
+	}
+	if state := stringValue(disk.DiskState); state != StatusUnattached {
+		logging.V(4).Infof("%s of claim %s/%s is %s, waiting for it to be detached before migrating it", diskId, namespace, name, state)
+		return nil
+	}
+
+	policy := pv.Spec.PersistentVolumeReclaimPolicy
+	if policy == "" {
+		policy = ReclaimPolicyDelete
+	}
+	if err := ctrl.annotateClaim(ctx, claim, map[string]interface{}{
+		MigrationZoneAnnotation:          zone,
+		MigrationSourceAnnotation:        diskId,
+		MigrationReclaimPolicyAnnotation: policy,
+	}); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("migrating %s to zone %s through a snapshot, the pod is scheduled once the volume is replaced", diskId, zone)
+	logging.Infof("claim %s/%s: %s", namespace, name, message)
+	involved := []kube.ObjectReference{{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: namespace, Name: name, UID: claim.Metadata.UID}}
+	recordWarningEvents(ctx, ctrl.kubeClient, ControllerEventComponent, involved, EventReasonVolumeMigrating, message)
+	return nil
+}
+
+// migrateVolume takes the next step of the migration of the volume of claim: it snapshots the
+// disk, creates a disk from the snapshot in the target zone and replaces the persistent volume.
+func (ctrl *cbsController) migrateVolume(ctx context.Context, claim *kube.PersistentVolumeClaim) error {
+	a := claim.Metadata.Annotations
+	sourceId, zone := a[MigrationSourceAnnotation], a[MigrationZoneAnnotation]
+
+	if a[MigrationSnapshotAnnotation] == "" {
+		name := MigrationSnapshotNamePrefix + claim.Spec.VolumeName
+		existing, err := ctrl.snapshotByName(ctx, name)
+		if err != nil {
+			return err
+		}
+		snapshotId := ""
+		if existing != nil {
+			snapshotId = stringValue(existing.SnapshotId)
+		} else if snapshotId, err = ctrl.createSnapshot(ctx, sourceId, name, &snapshotParameters{tags: ctrl.config.Get().Tags}); err != nil {
+			return err
+		}
+		logging.Infof("claim %s/%s: took snapshot %s of %s to migrate it", claim.Metadata.Namespace, claim.Metadata.Name, snapshotId, sourceId)
+		return ctrl.annotateClaim(ctx, claim, map[string]interface{}{MigrationSnapshotAnnotation: snapshotId})
+	}
+
+	if a[MigrationDiskAnnotation] == "" {
+		snapshot, err := ctrl.describeSnapshot(ctx, a[MigrationSnapshotAnnotation])
+		if err != nil {
+			return err
+		}
+		if stringValue(snapshot.SnapshotState) != SnapshotStateNormal {
+			return nil
+		}
+		diskId, err := ctrl.createMigrationDisk(ctx, sourceId, snapshot, zone, claim.Spec.VolumeName)
+		if err != nil {
+			return fmt.Errorf("create disk in %s err: %v", zone, explainCloudError(err))
+		}
+		logging.Infof("claim %s/%s: creating %s in %s from snapshot %s", claim.Metadata.Namespace, claim.Metadata.Name, diskId, zone, a[MigrationSnapshotAnnotation])
+		return ctrl.annotateClaim(ctx, claim, map[string]interface{}{MigrationDiskAnnotation: diskId})
+	}
+
+	return ctrl.replaceVolume(ctx, claim)
+}
+
+// createMigrationDisk creates a disk like sourceId in zone from snapshot and returns its id. The
+// client token makes repeated calls return the same disk. Disks are created postpaid by hour, a
+// prepaid disk can be converted in the console.
+func (ctrl *cbsController) createMigrationDisk(ctx context.Context, sourceId string, snapshot *cbs.Snapshot, zone, pvName string) (string, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+	source, err := describeDisk(ctx, ctrl.cbsClient, sourceId)
+	if err != nil {
+		return "", err
+	}
+
+	token := "migrate-" + pvName + "-" + zone
+	request := cbs.NewCreateDisksRequest()
+	request.ClientToken = &token
+	request.DiskType = source.DiskType
+	request.DiskChargeType = &DiskChargeTypePostPaidByHour
+	request.DiskSize = source.DiskSize
+	request.SnapshotId = snapshot.SnapshotId
+	request.Placement = &cbs.Placement{Zone: &zone}
+	request.Tags = source.Tags
+	if snapshot.Encrypt != nil && *snapshot.Encrypt {
+		request.Encrypt = &EncryptEnable
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+	response, err := ctrl.cbsClient.CreateDisks(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Response.DiskIdSet) == 0 {
+		return "", fmt.Errorf("no disk id in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	return *response.Response.DiskIdSet[0], nil
+}
+
+// replaceVolume replaces the persistent volume of claim by one of the migrated disk with the same
+// name once the disk is created. The new volume is saved on the claim before the old one is
+// deleted, the claim is lost until the new one is created and binds to it again. The migration is
+// finished when the volume of the claim is the migrated disk.
+func (ctrl *cbsController) replaceVolume(ctx context.Context, claim *kube.PersistentVolumeClaim) error {
+	a := claim.Metadata.Annotations
+	pvName, diskId := claim.Spec.VolumeName, a[MigrationDiskAnnotation]
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	disk, err := describeDisk(ctx, ctrl.cbsClient, diskId)
+	if err != nil {
+		return err
+	}
+	if stringValue(disk.DiskState) != StatusUnattached {
+		return nil
+	}
+
+	raw := map[string]interface{}{}
+	err = ctrl.kubeClient.Get(ctx, kube.PersistentVolumePath(pvName), &raw)
+	if kube.IsNotFound(err) {
+		saved := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(a[MigrationVolumeAnnotation]), &saved); err != nil {
+			return fmt.Errorf("pv %s is deleted, but the migrated pv saved on the claim is invalid: %v", pvName, err)
+		}
+		if err := ctrl.kubeClient.Create(ctx, kube.PersistentVolumesPath(), saved, nil); err != nil && !kube.IsAlreadyExists(err) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pv := &kube.PersistentVolume{}
+	b, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(b, pv)
+	}
+	if err != nil {
+		return err
+	}
+	if pv.Spec.CSI != nil && legacyVolumeId(pv.Spec.CSI.VolumeHandle) == diskId {
+		if snapshotId := a[MigrationSnapshotAnnotation]; snapshotId != "" {
+			if err := ctrl.deleteSnapshots(ctx, []*string{&snapshotId}); err != nil {
+				logging.Errorf("delete migration snapshot %s err: %v", snapshotId, err)
+			}
+		}
+		logging.Infof("claim %s/%s: migrated from %s to %s in %s, %s is kept", claim.Metadata.Namespace, claim.Metadata.Name, a[MigrationSourceAnnotation], diskId, a[MigrationZoneAnnotation], a[MigrationSourceAnnotation])
+		done := map[string]interface{}{}
+		for _, key := range []string{MigrationZoneAnnotation, MigrationSourceAnnotation, MigrationReclaimPolicyAnnotation, MigrationSnapshotAnnotation, MigrationDiskAnnotation, MigrationVolumeAnnotation} {
+			done[key] = nil
+		}
+		return ctrl.annotateClaim(ctx, claim, done)
+	}
+
+	zones, err := ctrl.zonesById(ctx)
+	if err != nil {
+		return err
+	}
+	zoneId := ""
+	for id, name := range zones {
+		if name == a[MigrationZoneAnnotation] {
+			zoneId = id
+		}
+	}
+	migrated, err := migratedVolume(raw, diskId, a[MigrationZoneAnnotation], zoneId, a[MigrationReclaimPolicyAnnotation], a[MigrationSourceAnnotation])
+	if err != nil {
+		return err
+	}
+	b, err = json.Marshal(migrated)
+	if err != nil {
+		return err
+	}
+	if err := ctrl.annotateClaim(ctx, claim, map[string]interface{}{MigrationVolumeAnnotation: string(b)}); err != nil {
+		return err
+	}
+
+	// the old disk is kept, whatever the reclaim policy of the old volume was
+	path := kube.PersistentVolumePath(pvName)
+	retain := map[string]interface{}{"spec": map[string]interface{}{"persistentVolumeReclaimPolicy": ReclaimPolicyRetain}}
+	if err := ctrl.kubeClient.Patch(ctx, path, kube.PatchTypeMerge, retain, nil); err != nil {
+		return err
+	}
+	if err := ctrl.kubeClient.Delete(ctx, path); err != nil && !kube.IsNotFound(err) {
+		return err
+	}
+	clearFinalizers := map[string]interface{}{"metadata": map[string]interface{}{"finalizers": nil}}
+	if err := ctrl.kubeClient.Patch(ctx, path, kube.PatchTypeMerge, clearFinalizers, nil); err != nil && !kube.IsNotFound(err) {
+		return err
+	}
+	logging.Infof("claim %s/%s: deleted pv %s of %s, recreating it with %s", claim.Metadata.Namespace, claim.Metadata.Name, pvName, a[MigrationSourceAnnotation], diskId)
+	return nil
+}
+
+// migratedVolume returns a copy of the persistent volume raw for diskId in zone, bound to the same
+// claim, without the fields set by the api server.
+func migratedVolume(raw map[string]interface{}, diskId, zone, zoneId, reclaimPolicy, sourceId string) (map[string]interface{}, error) {
+	metadata, _ := raw["metadata"].(map[string]interface{})
+	spec, _ := raw["spec"].(map[string]interface{})
+	if metadata == nil || spec == nil {
+		return nil, fmt.Errorf("pv has no metadata or spec")
+	}
+	source, _ := spec["csi"].(map[string]interface{})
+	if source == nil {
+		return nil, fmt.Errorf("pv %v is not a csi volume", metadata["name"])
+	}
+
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+	}
+	annotations[MigratedFromAnnotation] = sourceId
+
+	source["volumeHandle"] = diskId
+	spec["persistentVolumeReclaimPolicy"] = reclaimPolicy
+	// nodes match either term, those without the topology of the driver by their legacy zone label
+	legacyZones := []interface{}{zone}
+	if zoneId != "" {
+		legacyZones = append(legacyZones, zoneId)
+	}
+	spec["nodeAffinity"] = map[string]interface{}{
+		"required": map[string]interface{}{
+			"nodeSelectorTerms": []interface{}{
+				map[string]interface{}{
+					"matchExpressions": []interface{}{map[string]interface{}{
+						"key":      TopologyZoneKey,
+						"operator": "In",
+						"values":   []interface{}{zone},
+					}},
+				},
+				map[string]interface{}{
+					"matchExpressions": []interface{}{map[string]interface{}{
+						"key":      LegacyZoneLabel,
+						"operator": "In",
+						"values":   legacyZones,
+					}},
+				},
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolume",
+		"metadata": map[string]interface{}{
+			"name":        metadata["name"],
+			"labels":      metadata["labels"],
+			"annotations": annotations,
+		},
+		"spec": spec,
+	}, nil
+}
+
+// zonesById returns the names of the zones of the region by zone id.
+func (ctrl *cbsController) zonesById(ctx context.Context) (map[string]string, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	response, err := ctrl.cbsClient.DescribeZones(ctx, cvm.NewDescribeZonesRequest())
+	if err != nil {
+		return nil, fmt.Errorf("describe zones err: %v", err)
+	}
+	zones := map[string]string{}
+	for _, zone := range response.Response.ZoneSet {
+		if zone.ZoneId != nil && zone.Zone != nil {
+			zones[*zone.ZoneId] = *zone.Zone
+		}
+	}
+	return zones, nil
+}
+
+// annotateClaim merges annotations into the annotations of claim, nil values remove them.
+func (ctrl *cbsController) annotateClaim(ctx context.Context, claim *kube.PersistentVolumeClaim, annotations map[string]interface{}) error {
+	patch := map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}}
+	return ctrl.kubeClient.Patch(ctx, kube.PersistentVolumeClaimPath(claim.Metadata.Namespace, claim.Metadata.Name), kube.PatchTypeMerge, patch, nil)
+}
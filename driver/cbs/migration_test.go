@@ -0,0 +1,79 @@
+package cbs
+
+import (
+	"testing"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+)
+
+func TestPodZone(t *testing.T) {
+	node := func(labels map[string]string, unschedulable bool) kube.Node {
+		n := kube.Node{}
+		n.Metadata.Labels = labels
+		n.Spec.Unschedulable = unschedulable
+		return n
+	}
+	zones := map[string]string{"100003": "ap-guangzhou-3", "100004": "ap-guangzhou-4"}
+
+	tests := []struct {
+		name         string
+		nodeSelector map[string]string
+		nodes        []kube.Node
+		want         string
+	}{
+		{
+			name: "topology label",
+			nodes: []kube.Node{
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-3"}, false),
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-3"}, false),
+			},
+			want: "ap-guangzhou-3",
+		},
+		{
+			name: "legacy zone id",
+			nodes: []kube.Node{
+				node(map[string]string{LegacyZoneLabel: "100004"}, false),
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-4", LegacyZoneLabel: "100004"}, false),
+			},
+			want: "ap-guangzhou-4",
+		},
+		{
+			name:  "legacy zone name",
+			nodes: []kube.Node{node(map[string]string{LegacyZoneLabel: "ap-guangzhou-3"}, false)},
+			want:  "ap-guangzhou-3",
+		},
+		{
+			name: "more than one zone",
+			nodes: []kube.Node{
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-3"}, false),
+				node(map[string]string{LegacyZoneLabel: "100004"}, false),
+			},
+			want: "",
+		},
+		{
+			name:         "selected and schedulable nodes only",
+			nodeSelector: map[string]string{"pool": "db"},
+			nodes: []kube.Node{
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-3", "pool": "db"}, false),
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-4", "pool": "db"}, true),
+				node(map[string]string{TopologyZoneKey: "ap-guangzhou-4"}, false),
+			},
+			want: "ap-guangzhou-3",
+		},
+		{
+			name:  "no zone label",
+			nodes: []kube.Node{node(map[string]string{"pool": "db"}, false)},
+			want:  "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &kube.Pod{}
+			pod.Spec.NodeSelector = test.nodeSelector
+			if got := podZone(pod, test.nodes, zones); got != test.want {
+				t.Errorf("podZone = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package cbs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+var (
+	// target paths created by kubelet for csi volumes contain this
+	KubeletCSITargetPathSegment = "/volumes/kubernetes.io~csi/"
+)
+
+// isCorruptedMountErr reports errors returned when accessing a mount whose device or connection is gone.
+func isCorruptedMountErr(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	return err == syscall.ENOTCONN || err == syscall.ESTALE || err == syscall.EIO
+}
+
+// checkMountPoint reports whether path is a mount point and whether the mount is stale, i.e. the
+// path can not be accessed any more or the device it was mounted from has vanished.
+func (node *cbsNode) checkMountPoint(path string) (mounted bool, stale bool, err error) {
+	if _, err := os.Stat(path); err != nil {
+		if isCorruptedMountErr(err) {
+			return true, true, nil
+		}
+		if os.IsNotExist(err) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	mountPoints, err := node.mounter.List()
+	if err != nil {
+		return false, false, err
+	}
+
+	for _, mp := range mountPoints {
+		if mp.Path != path {
+			continue
+		}
+		mounted = true
+		stale = isStaleMount(mp)
+	}
+
+	return mounted, stale, nil
+}
+
+// mountedDevice returns the device mounted at path, or an empty string if path is not a mount point.
+func (node *cbsNode) mountedDevice(path string) (string, error) {
+	mountPoints, err := node.mounter.List()
+	if err != nil {
+		return "", err
+	}
+
+	device := ""
+	for _, mp := range mountPoints {
+		// the last mount at path is the visible one
+		if mp.Path == path {
+			device = mp.Device
+		}
+	}
+	return device, nil
+}
+
+// isSameDevice reports whether a and b are the same device once symlinks are resolved.
+func isSameDevice(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return a == b
+}
+
+// prepareStagingPath makes stagingPath ready to mount device at. It returns true if device is already
+// mounted there, e.g. when NodeStageVolume is retried, and a grpc error if another device is mounted.
+// Stale mounts and leftovers of an interrupted stage, such as a file instead of a directory, are
+// cleaned up.
+func (node *cbsNode) prepareStagingPath(stagingPath, device string) (bool, error) {
+	mounted, stale, err := node.checkMountPoint(stagingPath)
+	if err != nil {
+		return false, status.Error(codes.Internal, err.Error())
+	}
+
+	if mounted && stale {
+		logging.Warningf("staging path %s is stale, unmounting it", stagingPath)
+		if err := node.mounter.Unmount(stagingPath); err != nil {
+			return false, status.Error(codes.Internal, err.Error())
+		}
+		mounted = false
+	}
+
+	if mounted {
+		mountedDevice, err := node.mountedDevice(stagingPath)
+		if err != nil {
+			return false, status.Error(codes.Internal, err.Error())
+		}
+		if !isSameDevice(mountedDevice, device) {
+			return false, status.Errorf(codes.AlreadyExists, "staging path %s is mounted from %s instead of %s", stagingPath, mountedDevice, device)
+		}
+		return true, nil
+	}
+
+	info, err := os.Stat(stagingPath)
+	if err == nil && !info.IsDir() {
+		logging.Warningf("staging path %s is not a directory, removing it", stagingPath)
+		if err := os.Remove(stagingPath); err != nil {
+			return false, status.Error(codes.Internal, err.Error())
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return false, status.Error(codes.Internal, err.Error())
+	}
+
+	if err := os.MkdirAll(stagingPath, 0750); err != nil {
+		return false, status.Error(codes.Internal, err.Error())
+	}
+
+	return false, nil
+}
+
+// checkNotPublished returns a grpc error if volumeId is still mounted at one of its target paths,
+// unstaging it would pull the filesystem from under the pods using it.
+func (node *cbsNode) checkNotPublished(volumeId string) error {
+	for _, target := range node.volumes.targets(volumeId) {
+		mounted, stale, err := node.checkMountPoint(target)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if mounted && !stale {
+			return status.Errorf(codes.FailedPrecondition, "volume %s is still published at %s", volumeId, target)
+		}
+		node.volumes.removeTarget(volumeId, target)
+	}
+	return nil
+}
+
+// healStagingPath unmounts a stale staging path and stages the volume again, so that the target path
+// is not bind mounted over a broken mount.
+func (node *cbsNode) healStagingPath(ctx context.Context, req *csi.NodePublishVolumeRequest) error {
+	mounted, stale, err := node.checkMountPoint(req.StagingTargetPath)
+	if err != nil {
+		return err
+	}
+	if !mounted || !stale {
+		return nil
+	}
+
+	logging.Warningf("staging path %s of volume %s is stale, staging it again", req.StagingTargetPath, req.VolumeId)
+
+	if _, err := node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{
+		VolumeId:          req.VolumeId,
+		StagingTargetPath: req.StagingTargetPath,
+	}); err != nil {
+		return err
+	}
+
+	_, err = node.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+		VolumeId:          req.VolumeId,
+		PublishInfo:       req.PublishInfo,
+		StagingTargetPath: req.StagingTargetPath,
+		VolumeCapability:  req.VolumeCapability,
+		NodeStageSecrets:  req.NodePublishSecrets,
+		VolumeAttributes:  req.VolumeAttributes,
+	})
+	return err
+}
+
+// healTargetPath unmounts a stale target path, it returns true if the target path is already
+// mounted and healthy.
+func (node *cbsNode) healTargetPath(targetPath string) (bool, error) {
+	mounted, stale, err := node.checkMountPoint(targetPath)
+	if err != nil {
+		return false, err
+	}
+	if !mounted {
+		return false, nil
+	}
+	if !stale {
+		return true, nil
+	}
+
+	logging.Warningf("target path %s is stale, unmounting it", targetPath)
+
+	return false, node.mounter.Unmount(targetPath)
+}
+
+// isStaleMount reports whether the mount at mp can not be accessed any more or its device vanished.
+func isStaleMount(mp mount.MountPoint) bool {
+	if _, err := os.Stat(mp.Path); err != nil && isCorruptedMountErr(err) {
+		return true
+	}
+	if strings.HasPrefix(mp.Device, DevPath+"/") {
+		if _, err := os.Stat(mp.Device); os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupOrphanedMounts unmounts csi target and staging paths whose disk is no longer attached,
+// e.g. after a node reboot or kubelet crash, so they do not block staging the volumes again.
+// Target paths are unmounted before staging paths.
+func (node *cbsNode) cleanupOrphanedMounts() error {
+	mountPoints, err := node.mounter.List()
+	if err != nil {
+		return err
+	}
+
+	var targets, stagings []string
+	for _, mp := range mountPoints {
+		switch {
+		case strings.Contains(mp.Path, KubeletCSITargetPathSegment):
+			if isStaleMount(mp) {
+				targets = append(targets, mp.Path)
+			}
+		case strings.Contains(mp.Path, KubeletCSIStagingPathSegment):
+			if isStaleMount(mp) {
+				stagings = append(stagings, mp.Path)
+			}
+		}
+	}
+
+	for _, p := range append(targets, stagings...) {
+		logging.Warningf("unmounting orphaned mount %s", p)
+		if err := node.mounter.Unmount(p); err != nil {
+			logging.Errorf("unmount orphaned mount %s err: %v", p, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// mount options which contradict each other, at most one of each group may be set
+	ConflictingMountOptions = [][]string{
+		{"ro", "rw"},
+		{"atime", "noatime", "relatime", "strictatime"},
+		{"diratime", "nodiratime"},
+		{"discard", "nodiscard"},
+		{"barrier", "nobarrier"},
+		{"sync", "async"},
+		{"exec", "noexec"},
+		{"suid", "nosuid"},
+		{"dev", "nodev"},
+	}
+
+	// skips the duplicate uuid check of xfs, added when mounting an existing xfs filesystem
+	XfsNoUUIDMountOption = "nouuid"
+
+	// mount options only understood by xfs
+	XfsMountOptions = []string{"pquota", "pqnoenforce", "uqnoenforce", "gqnoenforce", "qnoenforce", XfsNoUUIDMountOption}
+
+	// quota mount options, they must be set when the filesystem is mounted at the staging path and
+	// are dropped from the bind mount at the target path
+	QuotaMountOptions = []string{"pquota", "prjquota", "pqnoenforce", "uquota", "usrquota", "uqnoenforce", "gquota", "grpquota", "gqnoenforce", "quota", "qnoenforce"}
+)
+
+// normalizeMountOptions validates mount options from pv.spec.mountOptions and removes duplicates,
+// keeping the order in which options first appear.
+func normalizeMountOptions(options []string) ([]string, error) {
+	var result []string
+	seen := map[string]bool{}
+
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		if strings.ContainsAny(option, " \t\n") {
+			return nil, fmt.Errorf("mount option %q not valid", option)
+		}
+		if seen[option] {
+			continue
+		}
+		seen[option] = true
+		result = append(result, option)
+	}
+
+	for _, group := range ConflictingMountOptions {
+		var found []string
+		for _, option := range group {
+			if seen[option] {
+				found = append(found, option)
+			}
+		}
+		if len(found) > 1 {
+			return nil, fmt.Errorf("mount options %s conflict with each other", strings.Join(found, ", "))
+		}
+	}
+
+	return result, nil
+}
+
+// readOnlyMountOptions returns options with rw replaced by ro.
+func readOnlyMountOptions(options []string) []string {
+	result := []string{"ro"}
+	for _, option := range options {
+		if option != "ro" && option != "rw" {
+			result = append(result, option)
+		}
+	}
+	return result
+}
+
+// validateFsMountOptions checks that filesystem specific mount options match fsType.
+func validateFsMountOptions(fsType string, options []string) error {
+	if fsType == FsTypeXfs {
+		return nil
+	}
+	for _, option := range options {
+		for _, xfsOption := range XfsMountOptions {
+			if option == xfsOption {
+				return fmt.Errorf("mount option %s requires fsType %s", option, FsTypeXfs)
+			}
+		}
+	}
+	return nil
+}
+
+// bindMountOptions returns options without the quota options, which only apply to the mount of
+// the filesystem itself.
+func bindMountOptions(options []string) []string {
+	var result []string
+	for _, option := range options {
+		quota := false
+		for _, quotaOption := range QuotaMountOptions {
+			if option == quotaOption {
+				quota = true
+			}
+		}
+		if !quota {
+			result = append(result, option)
+		}
+	}
+	return result
+}
@@ -3,13 +3,11 @@ package cbs
 import (
 	"net/http"
 	"os"
-	"path"
 
 	"github.com/container-storage-interface/spec/lib/go/csi/v0"
 	"github.com/dbdd4us/qcloudapi-sdk-go/metadata"
-	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -19,27 +17,37 @@ import (
 var (
 	DiskByIdDevicePath       = "/dev/disk/by-id"
 	DiskByIdDeviceNamePrefix = "virtio-"
+
+	FsTypeExt4 = "ext4"
+	FsTypeXfs  = "xfs"
+
+	FsTypeDefault = FsTypeExt4
 )
 
 type cbsNode struct {
 	metadataClient *metadata.MetaData
-	cbsClient      *cbs.Client
 	mounter        mount.SafeFormatAndMount
+	config         *configStore
+	// creates and deletes the disks of inline ephemeral volumes
+	controller *cbsController
+	volumes    *volumeTracker
+	// optional, nil when the driver does not run in a kubernetes cluster
+	kubeClient *kube.Client
 }
 
-func newCbsNode(secretId, secretKey, region string) (*cbsNode, error) {
-	client, err := cbs.NewClient(common.NewCredential(secretId, secretKey), region, profile.NewClientProfile())
-	if err != nil {
-		return nil, err
-	}
-
+// newCbsNode creates the node service, it only calls the cloud api through controller for inline
+// ephemeral volumes, everything it needs about other attached disks is passed in the publish info.
+func newCbsNode(config *configStore, controller *cbsController, kubeClient *kube.Client) (*cbsNode, error) {
 	node := cbsNode{
 		metadataClient: metadata.NewMetaData(http.DefaultClient),
-		cbsClient:      client,
 		mounter: mount.SafeFormatAndMount{
 			Interface: mount.New(""),
 			Exec:      mount.NewOsExec(),
 		},
+		config:     config,
+		controller: controller,
+		volumes:    newVolumeTracker(config.Get().StateFile),
+		kubeClient: kubeClient,
 	}
 	return &node, nil
 }
@@ -48,6 +56,7 @@ func (node *cbsNode) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolu
 	if req.VolumeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
 	if req.StagingTargetPath == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume staging target path is empty")
 	}
@@ -62,26 +71,78 @@ func (node *cbsNode) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolu
 
 	stagingTargetPath := req.StagingTargetPath
 
-	mountFlags := req.VolumeCapability.GetMount().MountFlags
+	mountFlags, err := normalizeMountOptions(req.VolumeCapability.GetMount().MountFlags)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	mountFsType := req.VolumeCapability.GetMount().FsType
 
-	diskDevicePath := path.Join(DiskByIdDevicePath, DiskByIdDeviceNamePrefix+diskId)
+	if mountFsType == "" {
+		mountFsType = req.VolumeAttributes[FsTypeAttr]
+	}
+	if mountFsType == "" {
+		mountFsType = node.config.Get().FsType
+	}
+
+	if !isValidFsType(mountFsType) {
+		return nil, status.Errorf(codes.InvalidArgument, "fsType %s not supported", mountFsType)
+	}
+	if err := checkFsTypeBinaries(mountFsType); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
 
-	if _, err := os.Stat(stagingTargetPath); err != nil {
-		if os.IsNotExist(err) {
-			err := os.MkdirAll(stagingTargetPath, 0750)
-			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
-			}
-		} else {
+	if err := validateFsMountOptions(mountFsType, mountFlags); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if req.VolumeAttributes[DiscardAttr] == DiscardMount {
+		mountFlags, err = normalizeMountOptions(append(mountFlags, "discard"))
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	diskDevicePath, err := node.waitForDevice(diskId, req.PublishInfo, node.config.Get())
+	if err != nil {
+		node.recordVolumeEvent(stagingTargetPath, req.VolumeAttributes, EventReasonDeviceNotFound, err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if err := tuneBlockDevice(diskDevicePath, req.VolumeAttributes); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if req.VolumeAttributes[LuksEncryptAttr] == LuksEncryptTrue {
+		diskDevicePath, err = node.openLuks(diskId, diskDevicePath, req.NodeStageSecrets)
+		if err != nil {
+			node.recordVolumeEvent(stagingTargetPath, req.VolumeAttributes, EventReasonLuksSetupFailed, err)
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 	}
 
-	if err := node.mounter.FormatAndMount(diskDevicePath, stagingTargetPath, mountFsType, mountFlags); err != nil {
+	staged := &stagedVolume{
+		stagingPath: stagingTargetPath,
+		readOnly:    hasMountOption(mountFlags, "ro"),
+		fstrim:      req.VolumeAttributes[DiscardAttr] == DiscardFstrim,
+	}
+
+	alreadyStaged, err := node.prepareStagingPath(stagingTargetPath, diskDevicePath)
+	if err != nil {
+		return nil, err
+	}
+	if alreadyStaged {
+		logging.Infof("volume %s is already staged at %s", diskId, stagingTargetPath)
+		node.volumes.add(diskId, staged)
+		return &csi.NodeStageVolumeResponse{}, nil
+	}
+
+	if err := node.formatAndMount(diskDevicePath, stagingTargetPath, mountFsType, mountFlags, formatOptionsFromAttributes(req.VolumeAttributes)); err != nil {
+		node.recordVolumeEvent(stagingTargetPath, req.VolumeAttributes, EventReasonFormatAndMountFailed, err)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	node.volumes.add(diskId, staged)
+
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
@@ -89,12 +150,37 @@ func (node *cbsNode) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstage
 	if req.StagingTargetPath == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume staging target path is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
 
 	stagingTargetPath := req.StagingTargetPath
 
-	if err := node.mounter.Unmount(stagingTargetPath); err != nil {
+	if req.VolumeId != "" {
+		if err := node.checkNotPublished(req.VolumeId); err != nil {
+			return nil, err
+		}
+		// a frozen filesystem can not be unmounted
+		node.thawVolume(req.VolumeId)
+	}
+
+	// unstage may be retried after the unmount succeeded, only unmount actual mount points
+	mounted, _, err := node.checkMountPoint(stagingTargetPath)
+	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	if mounted {
+		if err := node.mounter.Unmount(stagingTargetPath); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else {
+		logging.Infof("staging path %s is not a mount point, skipping unmount", stagingTargetPath)
+	}
+
+	if req.VolumeId != "" {
+		if err := node.closeLuks(req.VolumeId); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		node.volumes.remove(req.VolumeId)
+	}
 
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
@@ -103,6 +189,16 @@ func (node *cbsNode) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	if req.VolumeId == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
+	if isEphemeral(req.VolumeAttributes) {
+		if req.TargetPath == "" {
+			return nil, status.Error(codes.InvalidArgument, "volume target path is empty")
+		}
+		if req.VolumeCapability == nil || req.VolumeCapability.GetMount() == nil {
+			return nil, status.Error(codes.InvalidArgument, "volume access type is not mount")
+		}
+		return node.publishEphemeralVolume(ctx, req)
+	}
 	if req.StagingTargetPath == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume staging target path is empty")
 	}
@@ -120,17 +216,35 @@ func (node *cbsNode) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	source := req.StagingTargetPath
 	target := req.TargetPath
 
-	mountFlags := req.VolumeCapability.GetMount().MountFlags
-	mountFlags = append(mountFlags, "bind")
+	mountFlags, err := normalizeMountOptions(req.VolumeCapability.GetMount().MountFlags)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	mountFlags = bindMountOptions(mountFlags)
 
 	if req.Readonly {
-		mountFlags = append(mountFlags, "ro")
+		mountFlags = readOnlyMountOptions(mountFlags)
 	}
+	mountFlags = append(mountFlags, "bind")
 
 	mountFsType := req.VolumeCapability.GetMount().FsType
 
 	if mountFsType == "" {
-		mountFsType = "ext4"
+		mountFsType = node.config.Get().FsType
+	}
+
+	if err := node.healStagingPath(ctx, req); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	mounted, err := node.healTargetPath(target)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if mounted {
+		node.volumes.addTarget(req.VolumeId, target)
+		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
 	if _, err := os.Stat(target); err != nil {
@@ -145,9 +259,12 @@ func (node *cbsNode) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 	}
 
 	if err := node.mounter.Mount(source, target, mountFsType, mountFlags); err != nil {
+		node.recordVolumeEvent(target, req.VolumeAttributes, EventReasonMountFailed, err)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	node.volumes.addTarget(req.VolumeId, target)
+
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
@@ -155,16 +272,31 @@ func (node *cbsNode) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpub
 	if req.TargetPath == "" {
 		return nil, status.Error(codes.InvalidArgument, "volume target path is empty")
 	}
+	req.VolumeId = legacyVolumeId(req.VolumeId)
+
+	if ephemeral, err := node.unpublishEphemeralVolume(ctx, req); ephemeral {
+		if err != nil {
+			return nil, err
+		}
+		return &csi.NodeUnpublishVolumeResponse{}, nil
+	}
 
 	targetPath := req.TargetPath
 
+	// only the bind mount of this pod is removed, other pods keep using the staging mount
 	if err := node.mounter.Unmount(targetPath); err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
+	node.volumes.removeTarget(req.VolumeId, targetPath)
+
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
+func isValidFsType(fsType string) bool {
+	return fsType == FsTypeExt4 || fsType == FsTypeXfs
+}
+
 func (node *cbsNode) NodeGetId(context.Context, *csi.NodeGetIdRequest) (*csi.NodeGetIdResponse, error) {
 	nodeId, err := node.metadataClient.InstanceID()
 	if err != nil {
@@ -186,5 +318,23 @@ func (node *cbsNode) NodeGetCapabilities(context.Context, *csi.NodeGetCapabiliti
 }
 
 func (node *cbsNode) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "")
+	nodeId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	maxVolumes := DefaultMaxDataDisksPerInstance
+	if limit := node.config.Get().MaxVolumesPerNode; limit > 0 && limit < maxVolumes {
+		maxVolumes = limit
+	}
+
+	zone, err := node.metadataClient.Zone()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.NodeGetInfoResponse{
+		NodeId:             nodeId,
+		MaxVolumesPerNode:  maxVolumes,
+		AccessibleTopology: zoneTopology(zone)[0],
+	}, nil
 }
@@ -0,0 +1,30 @@
+//go:build !linux
+// +build !linux
+
+package cbs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// windows nodes need csi-proxy to format and mount disks from a container, its client requires a
+// newer grpc and csi spec than the driver is built with, so staging is only supported on linux.
+
+func (node *cbsNode) formatAndMount(device, target, fsType string, mountFlags []string, opts formatOptions) error {
+	return fmt.Errorf("staging disks on %s nodes is not supported", runtime.GOOS)
+}
+
+func (node *cbsNode) openLuks(diskId, device string, secrets map[string]string) (string, error) {
+	return "", fmt.Errorf("luks is not supported on %s nodes", runtime.GOOS)
+}
+
+func (node *cbsNode) closeLuks(diskId string) error {
+	return nil
+}
+
+func registerVolumeStats(node *cbsNode) {}
+
+func volumeUtilization(path string) (float64, error) {
+	return 0, fmt.Errorf("volume utilization is not supported on %s nodes", runtime.GOOS)
+}
@@ -0,0 +1,109 @@
+package cbs
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	OperationsPath = "/debug/operations"
+
+	// operations in flight, listed at OperationsPath
+	operations = &operationTracker{operations: map[int64]*operation{}}
+)
+
+// operation is a controller or node rpc in flight.
+type operation struct {
+	RequestId string    `json:"requestId"`
+	Method    string    `json:"method"`
+	VolumeId  string    `json:"volumeId,omitempty"`
+	NodeId    string    `json:"nodeId,omitempty"`
+	Started   time.Time `json:"started"`
+	// seconds since the operation started, set when listed
+	Elapsed float64 `json:"elapsedSeconds"`
+	// disk state last returned by the cloud api while waiting for the disk
+	DiskState         string     `json:"diskState,omitempty"`
+	DiskStateObserved *time.Time `json:"diskStateObserved,omitempty"`
+}
+
+type operationTracker struct {
+	mutex      sync.Mutex
+	next       int64
+	operations map[int64]*operation
+}
+
+type operationKey struct{}
+
+// start tracks the rpc fullMethod with request req until the returned function is called, ctx
+// carries the operation so the disk state can be observed.
+func (t *operationTracker) start(ctx context.Context, fullMethod string, req interface{}) (context.Context, func()) {
+	op := &operation{
+		RequestId: requestIdFromContext(ctx),
+		Method:    path.Base(fullMethod),
+		Started:   time.Now(),
+	}
+	if r, ok := req.(interface{ GetVolumeId() string }); ok {
+		op.VolumeId = r.GetVolumeId()
+	}
+	if r, ok := req.(interface{ GetNodeId() string }); ok {
+		op.NodeId = r.GetNodeId()
+	}
+
+	t.mutex.Lock()
+	t.next++
+	id := t.next
+	t.operations[id] = op
+	t.mutex.Unlock()
+
+	return context.WithValue(ctx, operationKey{}, op), func() {
+		t.mutex.Lock()
+		delete(t.operations, id)
+		t.mutex.Unlock()
+	}
+}
+
+// observeDiskState records the state of disk diskId seen by the operation in ctx, if there is one.
+func (t *operationTracker) observeDiskState(ctx context.Context, diskId, state string) {
+	op, ok := ctx.Value(operationKey{}).(*operation)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	op.VolumeId = diskId
+	op.DiskState = state
+	op.DiskStateObserved = &now
+}
+
+// list returns copies of the operations in flight, the longest running first.
+func (t *operationTracker) list() []operation {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	list := make([]operation, 0, len(t.operations))
+	for _, op := range t.operations {
+		o := *op
+		o.Elapsed = now.Sub(o.Started).Seconds()
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// ServeHTTP writes the operations in flight as json.
+func (t *operationTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(t.list())
+}
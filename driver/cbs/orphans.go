@@ -0,0 +1,177 @@
+package cbs
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// disks younger than this are never orphans, their pv may not be created yet
+	OrphanMinAge = time.Hour
+
+	// CreateTime of disks is in china standard time
+	cloudTimeLocation = time.FixedZone("CST", 8*60*60)
+	CloudTimeFormat   = "2006-01-02 15:04:05"
+
+	DescribeDisksPageSize uint64 = 100
+)
+
+// hasTags reports whether disk carries all tags.
+func hasTags(disk *cbs.Disk, tags map[string]string) bool {
+	for key, value := range tags {
+		found := false
+		for _, tag := range disk.Tags {
+			if tag.Key != nil && tag.Value != nil && *tag.Key == key && *tag.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// listDataDisks returns all data disks of the region, page by page.
+func listDataDisks(ctx context.Context, client *cloudClient) ([]*cbs.Disk, error) {
+	filterName := "disk-usage"
+	request := cbs.NewDescribeDisksRequest()
+	request.Filters = []*cbs.Filter{{Name: &filterName, Values: []*string{&DiskUsageDataDisk}}}
+	request.Limit = &DescribeDisksPageSize
+
+	var disks []*cbs.Disk
+	for offset := uint64(0); ; offset += DescribeDisksPageSize {
+		o := offset
+		request.Offset = &o
+
+		response, err := client.DescribeDisks(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		disks = append(disks, response.Response.DiskSet...)
+
+		if len(response.Response.DiskSet) < int(DescribeDisksPageSize) {
+			return disks, nil
+		}
+	}
+}
+
+// Orphans lists the disks which carry all tags of the config, so they were created by the driver,
+// but are not the volume of any csi persistent volume of the driver, and writes them to w. With
+// remove the orphans which are not attached or retained are terminated.
+func (drv *Driver) Orphans(w io.Writer, remove bool) error {
+	config, err := newConfigStore(drv.configPath, drv.config)
+	if err != nil {
+		return err
+	}
+	cfg := config.Get()
+	if len(cfg.Tags) == 0 {
+		return fmt.Errorf("no tags configured, disks created by the driver can not be told from other disks")
+	}
+
+	kubeClient, err := kube.NewInClusterClient()
+	if err != nil {
+		return fmt.Errorf("kubernetes client not available, run the command in the cluster: %v", err)
+	}
+
+	client, err := newCloudClient(drv.region, drv.credentials)
+	if err != nil {
+		return err
+	}
+	if cfg.AuditLogFile != "" {
+		if client.audit, err = openAuditLog(cfg.AuditLogFile); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+
+	pvs := &kube.PersistentVolumeList{}
+	if err := kubeClient.Get(ctx, kube.PersistentVolumesPath(), pvs); err != nil {
+		return fmt.Errorf("list persistent volumes err: %v", err)
+	}
+	volumes := map[string]string{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName {
+			volumes[legacyVolumeId(pv.Spec.CSI.VolumeHandle)] = pv.Metadata.Name
+		}
+	}
+
+	disks, err := listDataDisks(ctx, client)
+	if err != nil {
+		return fmt.Errorf("list disks err: %v", err)
+	}
+	sort.Slice(disks, func(i, j int) bool { return *disks[i].DiskId < *disks[j].DiskId })
+
+	var tags []string
+	for key, value := range cfg.Tags {
+		tags = append(tags, key+"="+value)
+	}
+	sort.Strings(tags)
+	fmt.Fprintf(w, "disks with tags %s and no persistent volume, %d persistent volumes of %s:\n", strings.Join(tags, ","), len(volumes), DriverName)
+
+	orphans := 0
+	for _, disk := range disks {
+		if disk.DiskId == nil || !hasTags(disk, cfg.Tags) {
+			continue
+		}
+		if _, ok := volumes[*disk.DiskId]; ok {
+			continue
+		}
+
+		created := ""
+		if disk.CreateTime != nil {
+			created = *disk.CreateTime
+			if t, err := time.ParseInLocation(CloudTimeFormat, created, cloudTimeLocation); err == nil && time.Since(t) < OrphanMinAge {
+				continue
+			}
+		}
+		orphans++
+
+		state := ""
+		if disk.DiskState != nil {
+			state = *disk.DiskState
+		}
+		size := uint64(0)
+		if disk.DiskSize != nil {
+			size = *disk.DiskSize
+		}
+		action := ""
+		switch {
+		case !remove:
+		case disk.Attached != nil && *disk.Attached:
+			action = "kept, attached"
+		case isRetained(disk):
+			action = fmt.Sprintf("kept, tagged %s=%s", RetainTagKey, RetainTagValue)
+		default:
+			action = "deleted"
+			if err := terminateDisk(ctx, client, *disk.DiskId); err != nil {
+				action = fmt.Sprintf("delete failed: %v", err)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%dGB\t%s\tcreated %s\t%s\n", *disk.DiskId, size, state, created, action)
+	}
+
+	if orphans == 0 {
+		fmt.Fprintln(w, "no orphaned disks found")
+	} else if !remove {
+		fmt.Fprintf(w, "%d orphaned disks found, run orphans delete to delete the ones not attached\n", orphans)
+	}
+	return nil
+}
+
+func terminateDisk(ctx context.Context, client *cloudClient, diskId string) error {
+	request := cbs.NewTerminateDisksRequest()
+	request.DiskIds = []*string{&diskId}
+	_, err := client.TerminateDisks(ctx, request)
+	return err
+}
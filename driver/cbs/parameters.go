@@ -0,0 +1,267 @@
+package cbs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// disk size limits in GB of each disk type
+	DiskSizeLimits = map[string][2]int64{
+		DiskTypeCloudBasic:   {10, 16000},
+		DiskTypeCloudPremium: {50, 16000},
+		DiskTypeCloudSsd:     {100, 16000},
+	}
+
+	// days after which cbs deletes a snapshot, a volume snapshot class parameter
+	SnapshotExpireDaysAttr = "expireDays"
+
+	// parameters of volume snapshot classes
+	SnapshotParameterNames = []string{SnapshotTypeParameter, FsFreezeParameter, TagsAttr, SnapshotExpireDaysAttr}
+)
+
+// createParameters are the disk options parsed from storage class parameters.
+type createParameters struct {
+	diskType         string
+	chargeType       string
+	prepaidPeriod    int
+	prepaidRenewFlag string
+	encrypt          string
+	tags             map[string]string
+	fsType           string
+	mkfsOptions      string
+	reservedBlocks   string
+	luksEncrypt      bool
+	discard          string
+	// block device queue settings, keyed by storage class parameter
+	tuning map[string]string
+}
+
+// parseCreateParameters parses and validates storage class parameters, falling back to cfg for omitted ones.
+func parseCreateParameters(parameters map[string]string, cfg *Config) (*createParameters, error) {
+	p := &createParameters{}
+
+	parameters = convertLegacyParameters(parameters)
+
+	var ok bool
+
+	p.diskType, ok = parameters[DiskTypeAttr]
+	if !ok {
+		p.diskType = cfg.DiskType
+	}
+
+	if !isValidDiskType(p.diskType) {
+		return nil, fmt.Errorf("cbs type not supported")
+	}
+
+	p.chargeType, ok = parameters[DiskChargeTypeAttr]
+	if !ok {
+		p.chargeType = cfg.DiskChargeType
+	}
+
+	if p.chargeType != DiskChargeTypePrePaid && p.chargeType != DiskChargeTypePostPaidByHour {
+		return nil, fmt.Errorf("cbs charge type not supported")
+	}
+
+	if p.chargeType == DiskChargeTypePrePaid {
+		periodStr, ok := parameters[DiskChargePrepaidPeriodAttr]
+		if !ok {
+			periodStr = strconv.Itoa(DiskChargePrepaidPeriodDefault)
+		}
+
+		period, err := strconv.Atoi(periodStr)
+		if err != nil {
+			return nil, fmt.Errorf("prepaid period not valid")
+		}
+
+		found := false
+
+		for _, v := range DiskChargePrepaidPeriodValidValues {
+			if v == period {
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("can not found valid prepaid period")
+		}
+
+		p.prepaidPeriod = period
+
+		p.prepaidRenewFlag, ok = parameters[DiskChargePrepaidRenewFlagAttr]
+		if !ok {
+			p.prepaidRenewFlag = DiskChargePrepaidRenewFlagDefault
+		}
+		if p.prepaidRenewFlag != DiskChargePrepaidRenewFlagDisableNotifyAndManualRenew && p.prepaidRenewFlag != DiskChargePrepaidRenewFlagNotifyAndAutoRenew && p.prepaidRenewFlag != DiskChargePrepaidRenewFlagNotifyAndManualRenewd {
+			return nil, fmt.Errorf("invalid renew flag")
+		}
+	}
+
+	p.encrypt = parameters[EncryptAttr]
+
+	if p.encrypt != "" && p.encrypt != EncryptEnable {
+		return nil, fmt.Errorf("volume encrypt not valid")
+	}
+
+	p.fsType = parameters[FsTypeAttr]
+	if fsType, ok := parameters[FsTypeCSIAttr]; ok {
+		p.fsType = fsType
+	}
+
+	if p.fsType != "" && !isValidFsType(p.fsType) {
+		return nil, fmt.Errorf("fsType %s not supported, must be %s or %s", p.fsType, FsTypeExt4, FsTypeXfs)
+	}
+
+	p.mkfsOptions = parameters[MkfsOptionsAttr]
+	if _, err := parseMkfsOptions(p.mkfsOptions); err != nil {
+		return nil, err
+	}
+
+	p.reservedBlocks = parameters[ReservedBlocksPercentageAttr]
+	if err := validateReservedBlocksPercentage(p.reservedBlocks); err != nil {
+		return nil, err
+	}
+	if p.reservedBlocks != "" && p.fsType == FsTypeXfs {
+		return nil, fmt.Errorf("reservedBlocksPercentage is only supported by %s", FsTypeExt4)
+	}
+
+	if luks, ok := parameters[LuksEncryptAttr]; ok {
+		if luks != LuksEncryptTrue && luks != "false" {
+			return nil, fmt.Errorf("luksEncrypt must be true or false")
+		}
+		p.luksEncrypt = luks == LuksEncryptTrue
+	}
+
+	p.discard = parameters[DiscardAttr]
+	if p.discard != "" && p.discard != DiscardMount && p.discard != DiscardFstrim {
+		return nil, fmt.Errorf("discard must be %s or %s", DiscardMount, DiscardFstrim)
+	}
+
+	if err := validateBlockDeviceTuning(parameters); err != nil {
+		return nil, err
+	}
+	p.tuning = map[string]string{}
+	for attr := range QueueAttrFiles {
+		if value, ok := parameters[attr]; ok {
+			p.tuning[attr] = value
+		}
+	}
+
+	p.tags = make(map[string]string, len(cfg.Tags))
+	for k, v := range cfg.Tags {
+		p.tags[k] = v
+	}
+	if tagsStr, ok := parameters[TagsAttr]; ok {
+		volumeTags, err := parseTags(tagsStr)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range volumeTags {
+			p.tags[k] = v
+		}
+	}
+
+	return p, nil
+}
+
+// snapshotParameters are the snapshot options parsed from volume snapshot class parameters.
+type snapshotParameters struct {
+	typ      string
+	fsFreeze bool
+	tags     map[string]string
+	// days after which cbs deletes the snapshot, zero keeps it until it is deleted
+	expireDays int
+}
+
+// parseSnapshotParameters parses and validates volume snapshot class parameters, the tags of the
+// class are merged over the tags of cfg. Names with a prefix, e.g. the secret parameters of the
+// snapshotter, are ignored.
+func parseSnapshotParameters(parameters map[string]string, cfg *Config) (*snapshotParameters, error) {
+	for name := range parameters {
+		if !strings.Contains(name, "/") && !isSnapshotParameter(name) {
+			return nil, fmt.Errorf("unknown parameter %s, supported are %s", name, strings.Join(SnapshotParameterNames, ", "))
+		}
+	}
+
+	p := &snapshotParameters{}
+	var err error
+	if p.typ, err = snapshotType(parameters); err != nil {
+		return nil, err
+	}
+	if p.fsFreeze, err = fsFreezeRequested(parameters); err != nil {
+		return nil, err
+	}
+
+	p.tags = make(map[string]string, len(cfg.Tags))
+	for k, v := range cfg.Tags {
+		p.tags[k] = v
+	}
+	tagsStr, hasTags := parameters[TagsAttr]
+	if hasTags {
+		snapshotTags, err := parseTags(tagsStr)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range snapshotTags {
+			p.tags[k] = v
+		}
+	}
+
+	days, hasExpireDays := parameters[SnapshotExpireDaysAttr]
+	if hasExpireDays {
+		p.expireDays, err = strconv.Atoi(days)
+		if err != nil || p.expireDays <= 0 {
+			return nil, fmt.Errorf("%s must be a positive number of days", SnapshotExpireDaysAttr)
+		}
+	}
+
+	if p.typ == SnapshotTypeBackup && (hasTags || hasExpireDays) {
+		return nil, fmt.Errorf("disk backups support neither %s nor %s", TagsAttr, SnapshotExpireDaysAttr)
+	}
+	return p, nil
+}
+
+func isSnapshotParameter(name string) bool {
+	for _, n := range SnapshotParameterNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDiskSize checks that a disk of sizeGB can be created with diskType.
+func validateDiskSize(diskType string, sizeGB int64) error {
+	limits, ok := DiskSizeLimits[diskType]
+	if !ok {
+		return nil
+	}
+	if sizeGB < limits[0] || sizeGB > limits[1] {
+		return fmt.Errorf("%s disk size must be between %dGB and %dGB, got %dGB", diskType, limits[0], limits[1], sizeGB)
+	}
+	return nil
+}
+
+// ValidateParameters validates storage class parameters, falling back to the defaults of cfg like
+// the controller does, it is used by the admission webhook.
+func ValidateParameters(parameters map[string]string, cfg *Config) error {
+	_, err := parseCreateParameters(parameters, cfg)
+	return err
+}
+
+// ValidateSnapshotParameters validates volume snapshot class parameters, it is used by the
+// admission webhook.
+func ValidateSnapshotParameters(parameters map[string]string, cfg *Config) error {
+	_, err := parseSnapshotParameters(parameters, cfg)
+	return err
+}
+
+// ValidateDiskSize validates the requested size in bytes of a volume provisioned with parameters.
+func ValidateDiskSize(parameters map[string]string, sizeBytes int64, cfg *Config) error {
+	p, err := parseCreateParameters(parameters, cfg)
+	if err != nil {
+		return err
+	}
+	return validateDiskSize(p.diskType, (sizeBytes+int64(GB)-1)/int64(GB))
+}
@@ -0,0 +1,25 @@
+package cbs
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+// servePprof serves the go profiling endpoints under /debug/pprof/ and the operations in flight at
+// OperationsPath at address until the process exits.
+func servePprof(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle(OperationsPath, operations)
+
+	logging.Infof("serving pprof at %s/debug/pprof/", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logging.Errorf("serve pprof err: %v", err)
+	}
+}
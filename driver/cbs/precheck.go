@@ -0,0 +1,46 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"golang.org/x/net/context"
+)
+
+var (
+	InquiryTypeCbsConfig = "INQUIRY_CBS_CONFIG"
+)
+
+// checkCloudAccess makes cheap read only api calls to verify that the credentials are valid
+// and the region and zone exist, so that misconfiguration is reported at startup instead of
+// when the first volume is provisioned.
+func checkCloudAccess(client *cloudClient, region, zone string) error {
+	var limit uint64 = 1
+
+	describeDisksRequest := cbs.NewDescribeDisksRequest()
+	describeDisksRequest.Limit = &limit
+
+	if _, err := client.DescribeDisks(context.Background(), describeDisksRequest); err != nil {
+		if e, ok := err.(*errors.TencentCloudSDKError); ok && strings.HasPrefix(e.Code, "AuthFailure") {
+			return fmt.Errorf("tencent cloud credentials are invalid, check secret id and secret key: %v", err)
+		}
+		return fmt.Errorf("describe disks in region %s failed, check that the region exists and the api is reachable: %v", region, err)
+	}
+
+	quotaRequest := cbs.NewDescribeDiskConfigQuotaRequest()
+	quotaRequest.InquiryType = &InquiryTypeCbsConfig
+	quotaRequest.Zones = []*string{&zone}
+
+	quotaResponse, err := client.DescribeDiskConfigQuota(context.Background(), quotaRequest)
+	if err != nil {
+		return fmt.Errorf("describe disk config of zone %s failed, check that the zone exists in region %s: %v", zone, region, err)
+	}
+
+	if len(quotaResponse.Response.DiskConfigSet) == 0 {
+		return fmt.Errorf("no cbs disk can be created in zone %s, check that the zone exists in region %s", zone, region)
+	}
+
+	return nil
+}
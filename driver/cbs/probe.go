@@ -0,0 +1,76 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// timeout of the api call made by the cloud probe
+	CloudProbeTimeout = time.Second * 10
+)
+
+// cloudProbe checks that the cloud api is reachable and accepts the credentials. The result is
+// cached for cfg.ProbeCloudInterval so that frequent Probe calls do not use up the api quota.
+type cloudProbe struct {
+	client *cloudClient
+	config *configStore
+
+	mutex   sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func newCloudProbe(client *cloudClient, config *configStore) *cloudProbe {
+	return &cloudProbe{client: client, config: config}
+}
+
+func (p *cloudProbe) check() error {
+	interval := p.config.Get().ProbeCloudInterval
+	if interval <= 0 {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.checked) < interval {
+		return p.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CloudProbeTimeout)
+	defer cancel()
+
+	var limit uint64 = 1
+	request := cbs.NewDescribeDisksRequest()
+	request.Limit = &limit
+
+	// the sdk call does not take a context, give up waiting for it after the timeout
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.client.DescribeDisks(ctx, request)
+		done <- err
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// a throttled call reached the api with valid credentials
+	if err != nil && !strings.HasPrefix(cloudAPICode(err), CloudAPIRequestLimitExceeded) {
+		p.err = fmt.Errorf("cloud api check failed: %v", err)
+	} else {
+		p.err = nil
+	}
+	p.checked = time.Now()
+
+	return p.err
+}
@@ -0,0 +1,121 @@
+package cbs
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	zoneDisks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_zone_disks",
+		Help: "Number of data disks of the account, by zone and disk type.",
+	}, []string{"zone", "disk_type"})
+
+	zoneDiskSizeGigabytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_zone_disk_size_gigabytes",
+		Help: "Total size in GB of the data disks of the account, by zone and disk type.",
+	}, []string{"zone", "disk_type"})
+
+	zoneDiskQuotaGigabytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_zone_disk_quota_gigabytes",
+		Help: "Quota in GB of data disks configured in diskQuotas, by zone and disk type.",
+	}, []string{"zone", "disk_type"})
+
+	zoneDiskTypeAvailable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_zone_disk_type_available",
+		Help: "Whether data disks of a type can be created in a zone, 0 when the type is sold out.",
+	}, []string{"zone", "disk_type", "charge_type"})
+)
+
+func init() {
+	prometheus.MustRegister(zoneDisks)
+	prometheus.MustRegister(zoneDiskSizeGigabytes)
+	prometheus.MustRegister(zoneDiskQuotaGigabytes)
+	prometheus.MustRegister(zoneDiskTypeAvailable)
+}
+
+// runQuotaMetrics updates the disk usage and quota metrics of the zones of the region every
+// interval until stopCh is closed. Only the leader updates them when leader election is enabled.
+func (ctrl *cbsController) runQuotaMetrics(interval time.Duration, stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), interval); ok {
+			if err := ctrl.updateQuotaMetrics(ctx); err != nil {
+				logging.Errorf("update disk quota metrics err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) updateQuotaMetrics(ctx context.Context) error {
+	cfg := ctrl.config.Get()
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	disks, err := listDataDisks(ctx, ctrl.cbsClient)
+	if err != nil {
+		return err
+	}
+
+	type key struct{ zone, diskType string }
+	counts := map[key]float64{}
+	sizes := map[key]float64{}
+	for _, disk := range disks {
+		if disk.Placement == nil || disk.Placement.Zone == nil || disk.DiskType == nil {
+			continue
+		}
+		k := key{*disk.Placement.Zone, *disk.DiskType}
+		counts[k]++
+		if disk.DiskSize != nil {
+			sizes[k] += float64(*disk.DiskSize)
+		}
+	}
+
+	zoneDisks.Reset()
+	zoneDiskSizeGigabytes.Reset()
+	for k, count := range counts {
+		zoneDisks.WithLabelValues(k.zone, k.diskType).Set(count)
+		zoneDiskSizeGigabytes.WithLabelValues(k.zone, k.diskType).Set(sizes[k])
+	}
+
+	zoneDiskQuotaGigabytes.Reset()
+	for zone, quotas := range cfg.DiskQuotas {
+		for diskType, quota := range quotas {
+			zoneDiskQuotaGigabytes.WithLabelValues(zone, diskType).Set(float64(quota))
+		}
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	request := cbs.NewDescribeDiskConfigQuotaRequest()
+	request.InquiryType = &InquiryTypeCbsConfig
+	response, err := ctrl.cbsClient.DescribeDiskConfigQuota(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	zoneDiskTypeAvailable.Reset()
+	for _, c := range response.Response.DiskConfigSet {
+		if c.Zone == nil || c.DiskType == nil || c.DiskChargeType == nil || c.DiskUsage == nil || *c.DiskUsage != DiskUsageDataDisk {
+			continue
+		}
+		available := 0.0
+		if c.Available != nil && *c.Available {
+			available = 1
+		}
+		zoneDiskTypeAvailable.WithLabelValues(*c.Zone, *c.DiskType, *c.DiskChargeType).Set(available)
+	}
+	return nil
+}
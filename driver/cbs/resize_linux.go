@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package cbs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	xfsInfoDataRegexp = regexp.MustCompile(`data\s+=\s+bsize=(\d+)\s+blocks=(\d+)`)
+)
+
+// deviceSize returns the size in bytes of a block device.
+func (node *cbsNode) deviceSize(device string) (int64, error) {
+	output, err := node.mounter.Exec.Run("blockdev", "--getsize64", device)
+	if err != nil {
+		return 0, fmt.Errorf("get size of disk %s err: %v, output: %s", device, err, string(output))
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+}
+
+// filesystemSize returns the size in bytes of the filesystem on device mounted at target.
+func (node *cbsNode) filesystemSize(device, target, fsType string) (int64, error) {
+	switch fsType {
+	case FsTypeExt4:
+		output, err := node.mounter.Exec.Run("dumpe2fs", "-h", device)
+		if err != nil {
+			return 0, fmt.Errorf("dumpe2fs %s err: %v, output: %s", device, err, string(output))
+		}
+		var blockCount, blockSize int64
+		for _, line := range strings.Split(string(output), "\n") {
+			fields := strings.SplitN(line, ":", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			value := strings.TrimSpace(fields[1])
+			switch strings.TrimSpace(fields[0]) {
+			case "Block count":
+				blockCount, err = strconv.ParseInt(value, 10, 64)
+			case "Block size":
+				blockSize, err = strconv.ParseInt(value, 10, 64)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("parse dumpe2fs output of %s err: %v", device, err)
+			}
+		}
+		if blockCount == 0 || blockSize == 0 {
+			return 0, fmt.Errorf("block count or block size of %s not found in dumpe2fs output", device)
+		}
+		return blockCount * blockSize, nil
+	case FsTypeXfs:
+		output, err := node.mounter.Exec.Run("xfs_info", target)
+		if err != nil {
+			return 0, fmt.Errorf("xfs_info %s err: %v, output: %s", target, err, string(output))
+		}
+		match := xfsInfoDataRegexp.FindStringSubmatch(string(output))
+		if match == nil {
+			return 0, fmt.Errorf("data section of %s not found in xfs_info output", target)
+		}
+		blockSize, _ := strconv.ParseInt(match[1], 10, 64)
+		blockCount, _ := strconv.ParseInt(match[2], 10, 64)
+		return blockCount * blockSize, nil
+	}
+	return 0, fmt.Errorf("fsType %s not supported", fsType)
+}
+
+// growFilesystem expands the filesystem on device mounted at target when the disk is larger than
+// the filesystem, e.g. the disk was resized while detached or restored from a smaller snapshot.
+func (node *cbsNode) growFilesystem(device, target, fsType string) error {
+	diskSize, err := node.deviceSize(device)
+	if err != nil {
+		return err
+	}
+	fsSize, err := node.filesystemSize(device, target, fsType)
+	if err != nil {
+		return err
+	}
+	if diskSize <= fsSize {
+		return nil
+	}
+
+	logging.Infof("disk %s is %d bytes but filesystem is %d bytes, growing filesystem", device, diskSize, fsSize)
+
+	var output []byte
+	switch fsType {
+	case FsTypeExt4:
+		output, err = node.mounter.Exec.Run("resize2fs", device)
+	case FsTypeXfs:
+		output, err = node.mounter.Exec.Run("xfs_growfs", target)
+	}
+	if err != nil {
+		return fmt.Errorf("grow %s filesystem on disk %s err: %v, output: %s", fsType, device, err, string(output))
+	}
+
+	return nil
+}
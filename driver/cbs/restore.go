@@ -0,0 +1,94 @@
+package cbs
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// snapshot a volume was restored from, passed to the node in volume attributes
+	SnapshotIdAttr = "snapshotId"
+)
+
+// describeSnapshot returns the snapshot snapshotId, a NotFound error if it does not exist.
+func (ctrl *cbsController) describeSnapshot(ctx context.Context, snapshotId string) (*cbs.Snapshot, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	request := cbs.NewDescribeSnapshotsRequest()
+	request.SnapshotIds = []*string{&snapshotId}
+	response, err := ctrl.cbsClient.DescribeSnapshots(ctx, request)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	for _, snapshot := range response.Response.SnapshotSet {
+		if snapshot.SnapshotId != nil && *snapshot.SnapshotId == snapshotId {
+			return snapshot, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "snapshot %s not found, DescribeSnapshots request id %s", snapshotId, requestIdOf(response.Response.RequestId))
+}
+
+// restoreSnapshot returns the snapshot the volume of req is restored from, nil if the volume is
+// created blank. Snapshots are regional, so a disk can be restored from them in any zone of the
+// region.
+func (ctrl *cbsController) restoreSnapshot(ctx context.Context, req *csi.CreateVolumeRequest) (*cbs.Snapshot, error) {
+	source := req.GetVolumeContentSource().GetSnapshot()
+	if source == nil {
+		return nil, nil
+	}
+	if source.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "snapshot id of volume content source is empty")
+	}
+	if isDiskBackupId(source.Id) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is a disk backup, volumes can only be restored from snapshots", source.Id)
+	}
+
+	snapshot, err := ctrl.describeSnapshot(ctx, source.Id)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.SnapshotState == nil || *snapshot.SnapshotState != SnapshotStateNormal {
+		return nil, status.Errorf(codes.Unavailable, "snapshot %s is not ready to restore, state %s", source.Id, stringValue(snapshot.SnapshotState))
+	}
+	return snapshot, nil
+}
+
+// restoreSizeGB returns the size of a disk restored from snapshot for the requested capacity in
+// bytes, at least the size of the disk the snapshot was taken of. A larger disk keeps the
+// filesystem of the snapshot, the node grows it when the volume is staged.
+func restoreSizeGB(snapshot *cbs.Snapshot, capacityRange *csi.CapacityRange) (uint64, error) {
+	gb := uint64(capacityRange.GetRequiredBytes() / int64(GB))
+	if snapshot.DiskSize == nil || gb >= *snapshot.DiskSize {
+		return gb, nil
+	}
+
+	limit := capacityRange.GetLimitBytes()
+	if limit > 0 && uint64(limit/int64(GB)) < *snapshot.DiskSize {
+		return 0, status.Errorf(codes.OutOfRange, "capacity limit %d bytes is smaller than the %dGB of snapshot %s", limit, *snapshot.DiskSize, *snapshot.SnapshotId)
+	}
+	logging.Infof("requested %dGB is smaller than the %dGB of snapshot %s, restoring to %dGB", gb, *snapshot.DiskSize, *snapshot.SnapshotId, *snapshot.DiskSize)
+	return *snapshot.DiskSize, nil
+}
+
+// checkRestoreDiskType checks that a disk of diskType and sizeGB can be restored from snapshot.
+// The disk type of the snapshot does not matter, e.g. a snapshot of a CLOUD_PREMIUM disk can be
+// restored onto CLOUD_SSD as a performance upgrade, but the size limits of diskType apply.
+func checkRestoreDiskType(snapshot *cbs.Snapshot, diskType string, sizeGB uint64) error {
+	if err := validateDiskSize(diskType, int64(sizeGB)); err != nil {
+		return status.Errorf(codes.OutOfRange, "restore snapshot %s onto %s: %v", *snapshot.SnapshotId, diskType, err)
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
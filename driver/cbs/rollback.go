@@ -0,0 +1,207 @@
+package cbs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// interval between two checks of the volume rollbacks in progress
+	VolumeRollbackCheckPeriod = time.Second * 10
+
+	// state of a disk being rolled back to a snapshot
+	StatusRollbacking = "ROLLBACKING"
+)
+
+// runVolumeRollbacks rolls the disks of the VolumeRollback resources back to their snapshots until
+// stopCh is closed. Only the leader rolls them back when leader election is enabled.
+func (ctrl *cbsController) runVolumeRollbacks(stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), VolumeRollbackCheckPeriod*6); ok {
+			if err := ctrl.checkVolumeRollbacks(ctx, time.Now()); err != nil {
+				logging.Errorf("check volume rollbacks err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(VolumeRollbackCheckPeriod):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) checkVolumeRollbacks(ctx context.Context, now time.Time) error {
+	rollbacks := &kube.VolumeRollbackList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.AllVolumeRollbacksPath(), rollbacks); err != nil {
+		return err
+	}
+
+	for i := range rollbacks.Items {
+		rollback := &rollbacks.Items[i]
+		if rollback.Status.Phase == kube.VolumeRollbackSucceeded || rollback.Status.Phase == kube.VolumeRollbackFailed {
+			continue
+		}
+
+		name := rollback.Metadata.Namespace + "/" + rollback.Metadata.Name
+		next := ctrl.rollBack(ctx, rollback, now)
+		if next == rollback.Status {
+			continue
+		}
+		if next.Phase != rollback.Status.Phase {
+			logging.Infof("volume rollback %s: %s %s", name, next.Phase, next.Message)
+		}
+		rollback.Status = next
+		if err := ctrl.kubeClient.Update(ctx, kube.VolumeRollbackPath(rollback.Metadata.Namespace, rollback.Metadata.Name), rollback, nil); err != nil {
+			logging.Errorf("update volume rollback %s err: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// rollBack takes the next step of rollback and returns its new status. A disk is only rolled back
+// once no node uses it, the pods using the claim have to be stopped first; the disk is attached
+// again when they are started. A disk left attached without a volume attachment is detached.
+func (ctrl *cbsController) rollBack(ctx context.Context, rollback *kube.VolumeRollback, now time.Time) kube.VolumeRollbackStatus {
+	s := rollback.Status
+	pending := func(phase, format string, args ...interface{}) kube.VolumeRollbackStatus {
+		s.Phase, s.Message = phase, fmt.Sprintf(format, args...)
+		return s
+	}
+	failed := func(format string, args ...interface{}) kube.VolumeRollbackStatus {
+		s.CompletionTime = now.UTC().Format(time.RFC3339)
+		return pending(kube.VolumeRollbackFailed, format, args...)
+	}
+
+	if s.Phase == "" {
+		diskId, err := ctrl.claimDisk(ctx, rollback.Metadata.Namespace, rollback.Spec.PersistentVolumeClaim)
+		if err != nil {
+			return failed("%v", err)
+		}
+		s.Phase, s.VolumeId = kube.VolumeRollbackPending, diskId
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return pending(s.Phase, "%v", err)
+	}
+	disk, err := describeDisk(ctx, ctrl.cbsClient, s.VolumeId)
+	if err != nil {
+		return pending(s.Phase, "%v", err)
+	}
+
+	if s.Phase == kube.VolumeRollbackRollingBack {
+		if stringValue(disk.DiskState) == StatusRollbacking {
+			return s
+		}
+		s.CompletionTime = now.UTC().Format(time.RFC3339)
+		return pending(kube.VolumeRollbackSucceeded, "rolled back to %s", rollback.Spec.SnapshotId)
+	}
+
+	snapshot, err := ctrl.describeSnapshot(ctx, rollback.Spec.SnapshotId)
+	if status.Code(err) == codes.NotFound {
+		return failed("snapshot %s not found", rollback.Spec.SnapshotId)
+	}
+	if err != nil {
+		return pending(kube.VolumeRollbackPending, "%v", err)
+	}
+	if stringValue(snapshot.DiskId) != s.VolumeId {
+		return failed("snapshot %s is a snapshot of %s, not of %s", rollback.Spec.SnapshotId, stringValue(snapshot.DiskId), s.VolumeId)
+	}
+	if stringValue(snapshot.SnapshotState) != SnapshotStateNormal {
+		return pending(kube.VolumeRollbackPending, "waiting for snapshot %s to be ready, state %s", rollback.Spec.SnapshotId, stringValue(snapshot.SnapshotState))
+	}
+
+	nodes, err := ctrl.attachedNodes(ctx, s.VolumeId)
+	if err != nil {
+		return pending(kube.VolumeRollbackPending, "%v", err)
+	}
+	if len(nodes) > 0 {
+		return pending(kube.VolumeRollbackPending, "waiting for the pods using the claim to stop, the volume is attached to %v", nodes)
+	}
+
+	if state := stringValue(disk.DiskState); state != StatusUnattached {
+		if state == StatusAttached {
+			if err := ctrl.detachDisk(ctx, s.VolumeId); err != nil {
+				return pending(kube.VolumeRollbackDetaching, "detach %s from %s err: %v", s.VolumeId, stringValue(disk.InstanceId), err)
+			}
+		}
+		return pending(kube.VolumeRollbackDetaching, "waiting for %s to be detached, state %s", s.VolumeId, state)
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return pending(kube.VolumeRollbackPending, "%v", err)
+	}
+	request := cbs.NewApplySnapshotRequest()
+	request.DiskId = &s.VolumeId
+	request.SnapshotId = &rollback.Spec.SnapshotId
+	if _, err := ctrl.cbsClient.ApplySnapshot(ctx, request); err != nil {
+		return pending(kube.VolumeRollbackPending, "roll %s back err: %v", s.VolumeId, explainCloudError(err))
+	}
+	s.StartTime = now.UTC().Format(time.RFC3339)
+	return pending(kube.VolumeRollbackRollingBack, "rolling %s back to %s", s.VolumeId, rollback.Spec.SnapshotId)
+}
+
+// claimDisk returns the disk of the persistent volume bound to the claim.
+func (ctrl *cbsController) claimDisk(ctx context.Context, namespace, name string) (string, error) {
+	claim := &kube.PersistentVolumeClaim{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumeClaimPath(namespace, name), claim); err != nil {
+		return "", fmt.Errorf("get claim %s err: %v", name, err)
+	}
+	if claim.Spec.VolumeName == "" {
+		return "", fmt.Errorf("claim %s is not bound", name)
+	}
+
+	pv := &kube.PersistentVolume{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumePath(claim.Spec.VolumeName), pv); err != nil {
+		return "", fmt.Errorf("get pv %s err: %v", claim.Spec.VolumeName, err)
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName {
+		return "", fmt.Errorf("pv %s is not a volume of %s", claim.Spec.VolumeName, DriverName)
+	}
+	return legacyVolumeId(pv.Spec.CSI.VolumeHandle), nil
+}
+
+// attachedNodes returns the nodes with a volume attachment of the persistent volume of diskId.
+func (ctrl *cbsController) attachedNodes(ctx context.Context, diskId string) ([]string, error) {
+	pvs := &kube.PersistentVolumeList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumesPath(), pvs); err != nil {
+		return nil, fmt.Errorf("list pvs err: %v", err)
+	}
+	names := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == DriverName && legacyVolumeId(pv.Spec.CSI.VolumeHandle) == diskId {
+			names[pv.Metadata.Name] = true
+		}
+	}
+
+	attachments := &kube.VolumeAttachmentList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.VolumeAttachmentsPath(), attachments); err != nil {
+		return nil, fmt.Errorf("list volume attachments err: %v", err)
+	}
+	var nodes []string
+	for _, attachment := range attachments.Items {
+		source := attachment.Spec.Source.PersistentVolumeName
+		if attachment.Spec.Attacher == DriverName && source != nil && names[*source] {
+			nodes = append(nodes, attachment.Spec.NodeName)
+		}
+	}
+	return nodes, nil
+}
+
+func (ctrl *cbsController) detachDisk(ctx context.Context, diskId string) error {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	request := cbs.NewDetachDisksRequest()
+	request.DiskIds = []*string{&diskId}
+	_, err := ctrl.cbsClient.DetachDisks(ctx, request)
+	return err
+}
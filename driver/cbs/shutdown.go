@@ -0,0 +1,37 @@
+package cbs
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"google.golang.org/grpc"
+)
+
+// stopOnSignal stops srv when the process receives SIGTERM or SIGINT. New rpcs are refused at once,
+// rpcs in flight, e.g. a CreateVolume waiting for its disk to become available, get up to timeout to
+// finish before the remaining connections are closed. Serve returns once srv is stopped.
+func stopOnSignal(srv *grpc.Server, timeout time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	sig := <-signals
+	logging.Infof("received %s, waiting up to %s for rpcs in flight", sig, timeout)
+	serverHealth.setServing(false)
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		logging.Info("all rpcs finished, exiting")
+	case <-time.After(timeout):
+		logging.Warningf("rpcs still in flight after %s, exiting anyway", timeout)
+		srv.Stop()
+	}
+}
@@ -0,0 +1,61 @@
+package cbs
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+	"golang.org/x/net/context"
+)
+
+// logPrefix returns the request id prefix of the log lines of the csi rpc handled with ctx.
+func logPrefix(ctx context.Context) string {
+	if requestId := requestIdFromContext(ctx); requestId != "" {
+		return "[" + requestId + "] "
+	}
+	return ""
+}
+
+// warnSlowCall logs a warning if the call of request which started at start took longer than
+// threshold, zero disables the warning.
+func warnSlowCall(ctx context.Context, threshold time.Duration, request tchttp.Request, start time.Time, err error) {
+	elapsed := time.Since(start)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+
+	var fields auditedFields
+	if data, err := json.Marshal(request); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	volumes := appendIds(nil, fields.DiskId, fields.DiskIds)
+	instances := appendIds(nil, fields.InstanceId, fields.InstanceIds)
+
+	logging.Warningf("%sslow cloud api call: action=%s duration=%v threshold=%v code=%s volumes=%v instances=%v",
+		logPrefix(ctx), request.GetAction(), elapsed, threshold, cloudAPICode(err), volumes, instances)
+}
+
+// slowWait warns once when waiting for a disk to reach a state takes longer than a threshold.
+type slowWait struct {
+	operation string
+	diskId    string
+	start     time.Time
+	warned    bool
+}
+
+func newSlowWait(operation, diskId string) *slowWait {
+	return &slowWait{operation: operation, diskId: diskId, start: time.Now()}
+}
+
+// observe is called with the current state of the disk on every poll.
+func (w *slowWait) observe(ctx context.Context, threshold time.Duration, state string) {
+	elapsed := time.Since(w.start)
+	if w.warned || threshold <= 0 || elapsed < threshold {
+		return
+	}
+	w.warned = true
+
+	logging.Warningf("%sslow wait for disk: operation=%s volume=%s state=%s duration=%v threshold=%v",
+		logPrefix(ctx), w.operation, w.diskId, state, elapsed, threshold)
+}
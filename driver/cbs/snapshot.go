@@ -0,0 +1,435 @@
+package cbs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cbsext"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// cbs snapshot states
+	SnapshotStateNormal            = "NORMAL"
+	SnapshotStateCreating          = "CREATING"
+	SnapshotStateRollbacking       = "ROLLBACKING"
+	SnapshotStateCopyingFromRemote = "COPYING_FROM_REMOTE"
+
+	// maximum number of snapshots returned by one ListSnapshots call
+	ListSnapshotsMaxEntries = 100
+
+	// error code prefix of calls rejected because a quota is exhausted
+	CloudAPILimitExceeded = "LimitExceeded"
+
+	// a disk with this fraction of snapshotsPerDisk snapshots is logged as approaching the limit
+	SnapshotLimitWarningFraction = 0.9
+
+	// format of the time cbs deletes a snapshot at
+	SnapshotDeadlineFormat = "2006-01-02T15:04:05+00:00"
+
+	snapshotQuotaHint = "delete old snapshots, e.g. lower the retention of the snapshot schedules of the disk, or raise the quota in the console and snapshotsPerDisk or snapshotQuota in the config file"
+)
+
+// csiSnapshot returns the csi snapshot of a cbs snapshot, its size is the size of the disk it was
+// taken of, the smallest volume it can be restored to. A snapshot being created is returned as
+// uploading with its progress in the details, the point in time of the snapshot is already taken,
+// so the application may resume writing, but a volume can not be restored from it before it is
+// ready.
+func csiSnapshot(s *cbs.Snapshot) *csi.Snapshot {
+	snapshot := &csi.Snapshot{
+		Id:             stringValue(s.SnapshotId),
+		SourceVolumeId: stringValue(s.DiskId),
+		Status:         &csi.SnapshotStatus{Type: csi.SnapshotStatus_UNKNOWN},
+	}
+	if s.DiskSize != nil {
+		snapshot.SizeBytes = int64(*s.DiskSize) * int64(GB)
+	}
+	if s.CreateTime != nil {
+		if created, err := time.ParseInLocation(CloudTimeFormat, *s.CreateTime, cloudTimeLocation); err == nil {
+			snapshot.CreatedAt = created.UnixNano()
+		}
+	}
+
+	switch state := stringValue(s.SnapshotState); state {
+	case SnapshotStateNormal, SnapshotStateRollbacking:
+		snapshot.Status.Type = csi.SnapshotStatus_READY
+	case SnapshotStateCreating, SnapshotStateCopyingFromRemote:
+		snapshot.Status.Type = csi.SnapshotStatus_UPLOADING
+		if s.Percent != nil {
+			snapshot.Status.Details = fmt.Sprintf("%d%% done", *s.Percent)
+		}
+	default:
+		snapshot.Status.Details = "snapshot state " + state
+	}
+	return snapshot
+}
+
+// countSnapshots returns the number of snapshots of the region matching all filters.
+func (ctrl *cbsController) countSnapshots(ctx context.Context, filters ...*cbs.Filter) (uint64, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return 0, err
+	}
+
+	var limit uint64 = 1
+	request := cbs.NewDescribeSnapshotsRequest()
+	request.Filters = filters
+	request.Limit = &limit
+	response, err := ctrl.cbsClient.DescribeSnapshots(ctx, request)
+	if err != nil {
+		return 0, cloudError(codes.Internal, err)
+	}
+	if response.Response.TotalCount == nil {
+		return 0, status.Errorf(codes.Internal, "no snapshot count in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	return *response.Response.TotalCount, nil
+}
+
+// checkSnapshotQuota returns a ResourceExhausted error if diskId or the account has as many
+// snapshots as allowed by cfg, so a snapshot which cbs would reject is reported with a hint how to
+// resolve it. With rotateSnapshots the oldest snapshots of the disk taken by schedules are deleted
+// instead to make room.
+func (ctrl *cbsController) checkSnapshotQuota(ctx context.Context, diskId string, cfg *Config) error {
+	if limit := cfg.SnapshotsPerDisk; limit > 0 {
+		filterName := "disk-id"
+		count, err := ctrl.countSnapshots(ctx, &cbs.Filter{Name: &filterName, Values: []*string{&diskId}})
+		if err != nil {
+			return err
+		}
+		if count >= uint64(limit) {
+			if !cfg.RotateSnapshots {
+				return status.Errorf(codes.ResourceExhausted, "disk %s has %d snapshots, the limit is %d: %s", diskId, count, limit, snapshotQuotaHint)
+			}
+			if err := ctrl.rotateSnapshots(ctx, diskId, count-uint64(limit)+1, limit); err != nil {
+				return err
+			}
+		} else if float64(count+1) >= float64(limit)*SnapshotLimitWarningFraction {
+			logging.Warningf("disk %s has %d snapshots, approaching the limit of %d", diskId, count, limit)
+		}
+	}
+
+	if quota := cfg.SnapshotQuota; quota > 0 {
+		count, err := ctrl.countSnapshots(ctx)
+		if err != nil {
+			return err
+		}
+		if count >= uint64(quota) {
+			return status.Errorf(codes.ResourceExhausted, "the account has %d snapshots in the region, the quota is %d: %s", count, quota, snapshotQuotaHint)
+		}
+	}
+	return nil
+}
+
+// rotateSnapshots deletes the n oldest ready snapshots of diskId taken by schedules to make room for
+// a new snapshot, or returns a ResourceExhausted error if the disk has fewer of them. Snapshots of
+// VolumeSnapshots are never rotated, their VolumeSnapshotContents would be left behind.
+func (ctrl *cbsController) rotateSnapshots(ctx context.Context, diskId string, n uint64, limit int) error {
+	filterName := "disk-id"
+	diskFilter := &cbs.Filter{Name: &filterName, Values: []*string{&diskId}}
+	snapshots, err := ctrl.listSnapshots(ctx, diskFilter)
+	if err != nil {
+		return cloudError(codes.Internal, err)
+	}
+	// only snapshots tagged by the schedules of this cluster are rotated
+	scheduled, err := ctrl.listSnapshots(ctx, append(scheduledSnapshotFilters(ctrl.config.Get().Tags, ""), diskFilter)...)
+	if err != nil {
+		return cloudError(codes.Internal, err)
+	}
+
+	var ids []*string
+	for i := len(scheduled) - 1; i >= 0 && uint64(len(ids)) < n; i-- {
+		snapshot := scheduled[i]
+		if snapshot.SnapshotId == nil || stringValue(snapshot.SnapshotState) != SnapshotStateNormal || !strings.HasPrefix(stringValue(snapshot.SnapshotName), ScheduledSnapshotNamePrefix) {
+			continue
+		}
+		ids = append(ids, snapshot.SnapshotId)
+	}
+	if uint64(len(ids)) < n {
+		return status.Errorf(codes.ResourceExhausted, "disk %s has %d snapshots, the limit is %d, and only %d of them can be rotated, the others were not taken by schedules or are not ready: %s", diskId, len(snapshots), limit, len(ids), snapshotQuotaHint)
+	}
+
+	logging.Infof("rotating the oldest scheduled snapshots %v of %s to stay within the limit of %d snapshots", derefIds(ids), diskId, limit)
+	if err := ctrl.deleteSnapshots(ctx, ids); err != nil {
+		return cloudError(codes.Internal, err)
+	}
+	return nil
+}
+
+// createSnapshot snapshots diskId as name with the tags and expiry of p after checking the snapshot
+// quota and returns the id of the snapshot. With fsFreeze the filesystem of the disk is frozen on
+// its node until cbs took the point in time of the snapshot.
+func (ctrl *cbsController) createSnapshot(ctx context.Context, diskId, name string, p *snapshotParameters) (string, error) {
+	if err := ctrl.checkSnapshotQuota(ctx, diskId, ctrl.config.Get()); err != nil {
+		return "", err
+	}
+
+	if p.fsFreeze {
+		thaw, err := ctrl.freezeVolume(ctx, diskId)
+		if err != nil {
+			return "", err
+		}
+		defer thaw()
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+
+	request := cbsext.NewCreateSnapshotRequest()
+	request.DiskId = &diskId
+	request.SnapshotName = &name
+	for _, tag := range diskTags(p.tags) {
+		request.Tags = append(request.Tags, &cbsext.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	if p.expireDays > 0 {
+		deadline := time.Now().UTC().AddDate(0, 0, p.expireDays).Format(SnapshotDeadlineFormat)
+		request.Deadline = &deadline
+	}
+	response, err := ctrl.cbsClient.CreateSnapshot(ctx, request)
+	if err != nil {
+		if e, ok := err.(*errors.TencentCloudSDKError); ok && strings.HasPrefix(e.Code, CloudAPILimitExceeded) {
+			p := status.Convert(cloudError(codes.ResourceExhausted, err)).Proto()
+			p.Message += ": " + snapshotQuotaHint
+			return "", status.ErrorProto(p)
+		}
+		return "", err
+	}
+	if response.Response.SnapshotId == nil {
+		return "", fmt.Errorf("no snapshot id in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	return *response.Response.SnapshotId, nil
+}
+
+// diskSizeBytes returns the size of diskId in bytes, zero if it can not be described. The
+// snapshotter keeps the size of the first CreateSnapshot response as the restore size, so a new
+// snapshot which can not be described yet is reported with the size of its disk.
+func (ctrl *cbsController) diskSizeBytes(ctx context.Context, diskId string) int64 {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return 0
+	}
+	disk, err := describeDisk(ctx, ctrl.cbsClient, diskId)
+	if err != nil || disk.DiskSize == nil {
+		logging.Warningf("%sdescribe %s for the snapshot size err: %v", logPrefix(ctx), diskId, err)
+		return 0
+	}
+	return int64(*disk.DiskSize) * int64(GB)
+}
+
+// snapshotByName returns the snapshot named name, nil if there is none.
+func (ctrl *cbsController) snapshotByName(ctx context.Context, name string) (*cbs.Snapshot, error) {
+	filterName := "snapshot-name"
+	snapshots, err := ctrl.listSnapshots(ctx, &cbs.Filter{Name: &filterName, Values: []*string{&name}})
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotName != nil && *snapshot.SnapshotName == name {
+			return snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateSnapshot starts a snapshot of the source volume and returns without waiting for it to be
+// ready. The snapshotter calls it again until the snapshot is ready, the name of the snapshot
+// makes these calls return the same snapshot with its current status.
+func (ctrl *cbsController) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "snapshot name is empty")
+	}
+	if req.SourceVolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "source volume id is empty")
+	}
+	diskId := legacyVolumeId(req.SourceVolumeId)
+
+	p, err := parseSnapshotParameters(req.Parameters, ctrl.config.Get())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx, cancelTerm, err := ctrl.leaderContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelTerm()
+
+	if p.typ == SnapshotTypeBackup {
+		return ctrl.createDiskBackupSnapshot(ctx, diskId, req.Name, p.fsFreeze)
+	}
+
+	existing, err := ctrl.snapshotByName(ctx, req.Name)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	if existing != nil {
+		if stringValue(existing.DiskId) != diskId {
+			return nil, status.Errorf(codes.AlreadyExists, "snapshot %s named %s is a snapshot of %s, not of %s", stringValue(existing.SnapshotId), req.Name, stringValue(existing.DiskId), diskId)
+		}
+		return &csi.CreateSnapshotResponse{Snapshot: csiSnapshot(existing)}, nil
+	}
+
+	snapshotId, err := ctrl.createSnapshot(ctx, diskId, req.Name, p)
+	ctrl.observeSnapshotCreated(diskId, snapshotId, SnapshotTypeSnapshot, SnapshotTriggerVolumeSnapshot, nil, err)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	logging.Infof("%screated snapshot %s of %s", logPrefix(ctx), snapshotId, diskId)
+
+	snapshot, err := ctrl.describeSnapshot(ctx, snapshotId)
+	if err != nil {
+		logging.Warningf("%sdescribe snapshot %s err: %v", logPrefix(ctx), snapshotId, err)
+		return &csi.CreateSnapshotResponse{Snapshot: &csi.Snapshot{
+			Id:             snapshotId,
+			SourceVolumeId: diskId,
+			SizeBytes:      ctrl.diskSizeBytes(ctx, diskId),
+			CreatedAt:      time.Now().UnixNano(),
+			Status:         &csi.SnapshotStatus{Type: csi.SnapshotStatus_UPLOADING},
+		}}, nil
+	}
+	return &csi.CreateSnapshotResponse{Snapshot: csiSnapshot(snapshot)}, nil
+}
+
+func (ctrl *cbsController) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	if req.SnapshotId == "" {
+		return nil, status.Error(codes.InvalidArgument, "snapshot id is empty")
+	}
+
+	ctx, cancelTerm, err := ctrl.leaderContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancelTerm()
+
+	if isDiskBackupId(req.SnapshotId) {
+		if err := ctrl.deleteDiskBackup(ctx, req.SnapshotId); err != nil {
+			return nil, err
+		}
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	snapshot, err := ctrl.describeSnapshot(ctx, req.SnapshotId)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			logging.Infof("%ssnapshot %s not found, assuming it is deleted", logPrefix(ctx), req.SnapshotId)
+			return &csi.DeleteSnapshotResponse{}, nil
+		}
+		return nil, err
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	request := cbs.NewDeleteSnapshotsRequest()
+	request.SnapshotIds = []*string{&req.SnapshotId}
+	_, err = ctrl.cbsClient.DeleteSnapshots(ctx, request)
+	ctrl.observeSnapshotDeleted(stringValue(snapshot.DiskId), req.SnapshotId, SnapshotTypeSnapshot, SnapshotTriggerVolumeSnapshot, err)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	logging.Infof("%sdeleted snapshot %s", logPrefix(ctx), req.SnapshotId)
+
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// ListSnapshots lists the snapshots of the region, the newest first, followed by the disk backups.
+// The starting token is the offset of the first snapshot or backup returned, a full page has a
+// next token, so the last page may be empty.
+func (ctrl *cbsController) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	diskId := ""
+	if req.SourceVolumeId != "" {
+		diskId = legacyVolumeId(req.SourceVolumeId)
+	}
+
+	if isDiskBackupId(req.SnapshotId) {
+		backup, err := ctrl.describeDiskBackup(ctx, req.SnapshotId)
+		if status.Code(err) == codes.NotFound {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if diskId != "" && stringValue(backup.DiskId) != diskId {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		return &csi.ListSnapshotsResponse{Entries: []*csi.ListSnapshotsResponse_Entry{{Snapshot: csiDiskBackup(backup)}}}, nil
+	}
+	if req.SnapshotId != "" {
+		snapshot, err := ctrl.describeSnapshot(ctx, req.SnapshotId)
+		if status.Code(err) == codes.NotFound {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if diskId != "" && stringValue(snapshot.DiskId) != diskId {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		return &csi.ListSnapshotsResponse{Entries: []*csi.ListSnapshotsResponse_Entry{{Snapshot: csiSnapshot(snapshot)}}}, nil
+	}
+
+	var offset uint64
+	if req.StartingToken != "" {
+		var err error
+		if offset, err = strconv.ParseUint(req.StartingToken, 10, 64); err != nil {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %q", req.StartingToken)
+		}
+	}
+	limit := uint64(ListSnapshotsMaxEntries)
+	if req.MaxEntries > 0 && uint64(req.MaxEntries) < limit {
+		limit = uint64(req.MaxEntries)
+	}
+
+	order, orderField := "DESC", "CREATE_TIME"
+	request := cbs.NewDescribeSnapshotsRequest()
+	request.Order = &order
+	request.OrderField = &orderField
+	request.Offset = &offset
+	request.Limit = &limit
+	if diskId != "" {
+		filterName := "disk-id"
+		request.Filters = []*cbs.Filter{{Name: &filterName, Values: []*string{&diskId}}}
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	response, err := ctrl.cbsClient.DescribeSnapshots(ctx, request)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+
+	resp := &csi.ListSnapshotsResponse{}
+	for _, snapshot := range response.Response.SnapshotSet {
+		resp.Entries = append(resp.Entries, &csi.ListSnapshotsResponse_Entry{Snapshot: csiSnapshot(snapshot)})
+	}
+
+	if count := uint64(len(resp.Entries)); count < limit {
+		var total uint64
+		if response.Response.TotalCount != nil {
+			total = *response.Response.TotalCount
+		}
+		var backupOffset uint64
+		if offset > total {
+			backupOffset = offset - total
+		}
+		backups, err := ctrl.listDiskBackups(ctx, diskId, backupOffset, limit-count)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range backups {
+			resp.Entries = append(resp.Entries, &csi.ListSnapshotsResponse_Entry{Snapshot: csiDiskBackup(backup)})
+		}
+	}
+
+	if uint64(len(resp.Entries)) == limit {
+		resp.NextToken = strconv.FormatUint(offset+limit, 10)
+	}
+	return resp, nil
+}
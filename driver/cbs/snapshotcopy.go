@@ -0,0 +1,213 @@
+package cbs
+
+import (
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cbsext"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// Code of a successful copy in the results of CopySnapshotCrossRegions
+	SnapshotCopyCodeSuccess = "Success"
+)
+
+// copyScheduledSnapshots copies the last snapshots of schedule which are ready to the regions of
+// copyToRegions they have no copy in yet, failed copies are retried. It reports whether the status
+// of schedule changed.
+func (ctrl *cbsController) copyScheduledSnapshots(ctx context.Context, schedule *kube.VolumeSnapshotSchedule) bool {
+	if len(schedule.Spec.CopyToRegions) == 0 {
+		return false
+	}
+
+	// regions without a copy by snapshot id
+	pending := map[string][]string{}
+	var ids []*string
+	for _, snapshot := range schedule.Status.LastSnapshots {
+		if snapshot.SnapshotId == "" {
+			continue
+		}
+		if regions := missingCopies(snapshot, schedule.Spec.CopyToRegions); len(regions) > 0 {
+			id := snapshot.SnapshotId
+			pending[id] = regions
+			ids = append(ids, &id)
+		}
+	}
+	if len(ids) == 0 {
+		return false
+	}
+
+	filterName := "snapshot-id"
+	snapshots, err := ctrl.listSnapshots(ctx, &cbs.Filter{Name: &filterName, Values: ids})
+	if err != nil {
+		logging.Errorf("describe snapshots %v err: %v", derefIds(ids), err)
+		return false
+	}
+
+	changed := false
+	for _, snapshot := range snapshots {
+		// only snapshots which finished can be copied
+		if snapshot.SnapshotId == nil || snapshot.SnapshotState == nil || *snapshot.SnapshotState != SnapshotStateNormal {
+			continue
+		}
+		regions := pending[*snapshot.SnapshotId]
+		if len(regions) == 0 {
+			continue
+		}
+
+		copies := ctrl.copySnapshot(ctx, snapshot, regions)
+		for i := range schedule.Status.LastSnapshots {
+			last := &schedule.Status.LastSnapshots[i]
+			if last.SnapshotId == *snapshot.SnapshotId {
+				last.Copies = mergeCopies(last.Copies, copies)
+			}
+		}
+		// the copies outlive the last snapshots in the status, they are deleted with their snapshot
+		for _, c := range copies {
+			if c.SnapshotId != "" {
+				schedule.Status.CopiedSnapshots = append(schedule.Status.CopiedSnapshots, kube.CopiedSnapshot{SourceSnapshotId: *snapshot.SnapshotId, Region: c.Region, SnapshotId: c.SnapshotId})
+			}
+		}
+		changed = true
+	}
+	return changed
+}
+
+// missingCopies returns the regions of copyToRegions snapshot has no copy in.
+func missingCopies(snapshot kube.ScheduledSnapshot, copyToRegions []string) []string {
+	var regions []string
+	for _, region := range copyToRegions {
+		found := false
+		for _, c := range snapshot.Copies {
+			if c.Region == region && c.SnapshotId != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// mergeCopies replaces the copies of copies by the copies to the same region of updates.
+func mergeCopies(copies, updates []kube.SnapshotCopy) []kube.SnapshotCopy {
+	for _, update := range updates {
+		replaced := false
+		for i := range copies {
+			if copies[i].Region == update.Region {
+				copies[i] = update
+				replaced = true
+			}
+		}
+		if !replaced {
+			copies = append(copies, update)
+		}
+	}
+	return copies
+}
+
+// copySnapshot copies snapshot to regions under the same name and returns the copies.
+func (ctrl *cbsController) copySnapshot(ctx context.Context, snapshot *cbs.Snapshot, regions []string) []kube.SnapshotCopy {
+	failed := func(err error) []kube.SnapshotCopy {
+		logging.Errorf("copy snapshot %s to %v err: %v", *snapshot.SnapshotId, regions, err)
+		copies := make([]kube.SnapshotCopy, 0, len(regions))
+		for _, region := range regions {
+			copies = append(copies, kube.SnapshotCopy{Region: region, Error: err.Error()})
+		}
+		return copies
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return failed(err)
+	}
+	request := cbsext.NewCopySnapshotCrossRegionsRequest()
+	request.SnapshotId = snapshot.SnapshotId
+	request.SnapshotName = snapshot.SnapshotName
+	for i := range regions {
+		request.DestinationRegions = append(request.DestinationRegions, &regions[i])
+	}
+	response, err := ctrl.cbsClient.CopySnapshotCrossRegions(ctx, request)
+	if err != nil {
+		return failed(err)
+	}
+
+	var copies []kube.SnapshotCopy
+	for _, result := range response.Response.SnapshotCopyResultSet {
+		if result.DestinationRegion == nil {
+			continue
+		}
+		c := kube.SnapshotCopy{Region: *result.DestinationRegion}
+		if result.Code != nil && *result.Code != "" && *result.Code != SnapshotCopyCodeSuccess {
+			c.Error = *result.Code
+			if result.Message != nil {
+				c.Error += ": " + *result.Message
+			}
+			logging.Errorf("copy snapshot %s to %s err: %s", *snapshot.SnapshotId, c.Region, c.Error)
+		} else if result.SnapshotId != nil {
+			c.SnapshotId = *result.SnapshotId
+			logging.Infof("copying snapshot %s to %s as %s", *snapshot.SnapshotId, c.Region, c.SnapshotId)
+		}
+		copies = append(copies, c)
+	}
+	return copies
+}
+
+// deleteExpiredCopies deletes the copies of schedule whose snapshot is not in existing any more, e.g.
+// because it expired, and reports whether the status of schedule changed. Copies which could not be
+// deleted are retried by the next call.
+func (ctrl *cbsController) deleteExpiredCopies(ctx context.Context, schedule *kube.VolumeSnapshotSchedule, existing map[string]bool) bool {
+	var kept []kube.CopiedSnapshot
+	changed := false
+	for _, c := range schedule.Status.CopiedSnapshots {
+		if existing[c.SourceSnapshotId] {
+			kept = append(kept, c)
+			continue
+		}
+		if err := ctrl.deleteSnapshotCopy(ctx, c); err != nil {
+			logging.Errorf("delete copy %s in %s of snapshot %s err: %v", c.SnapshotId, c.Region, c.SourceSnapshotId, err)
+			kept = append(kept, c)
+			continue
+		}
+		changed = true
+	}
+	schedule.Status.CopiedSnapshots = kept
+	return changed
+}
+
+// deleteSnapshotCopy deletes the copy c in its region, a copy which does not exist any more counts as
+// deleted.
+func (ctrl *cbsController) deleteSnapshotCopy(ctx context.Context, c kube.CopiedSnapshot) error {
+	client, err := ctrl.cbsClient.inRegion(c.Region)
+	if err != nil {
+		return err
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	filterName := "snapshot-id"
+	describeRequest := cbs.NewDescribeSnapshotsRequest()
+	describeRequest.Filters = []*cbs.Filter{{Name: &filterName, Values: []*string{&c.SnapshotId}}}
+	response, err := client.DescribeSnapshots(ctx, describeRequest)
+	if err != nil {
+		return err
+	}
+	if len(response.Response.SnapshotSet) == 0 {
+		logging.Infof("copy %s in %s of snapshot %s not found, assuming it is deleted", c.SnapshotId, c.Region, c.SourceSnapshotId)
+		return nil
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	request := cbs.NewDeleteSnapshotsRequest()
+	request.SnapshotIds = []*string{&c.SnapshotId}
+	if _, err := client.DeleteSnapshots(ctx, request); err != nil {
+		return err
+	}
+	logging.Infof("deleted copy %s in %s of snapshot %s", c.SnapshotId, c.Region, c.SourceSnapshotId)
+	return nil
+}
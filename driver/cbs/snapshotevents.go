@@ -0,0 +1,285 @@
+package cbs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	snapshotOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbs_snapshot_operations_total",
+		Help: "Number of snapshots and disk backups created, completed and deleted, by type, trigger, result and failure reason.",
+	}, []string{"operation", "type", "trigger", "result", "reason"})
+
+	snapshotReadySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cbs_snapshot_ready_seconds",
+		Help:    "Seconds from creating a snapshot or disk backup until it was ready to restore, by type and trigger.",
+		Buckets: []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400},
+	}, []string{"type", "trigger"})
+
+	snapshotsPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cbs_snapshots_pending",
+		Help: "Number of snapshots and disk backups created by the controller which are not ready yet.",
+	})
+
+	// operations on snapshots
+	SnapshotOperationCreate   = "create"
+	SnapshotOperationComplete = "complete"
+	SnapshotOperationDelete   = "delete"
+
+	// what a snapshot was taken for
+	SnapshotTriggerVolumeSnapshot = "volumesnapshot"
+	SnapshotTriggerSchedule       = "schedule"
+
+	SnapshotResultSuccess = "success"
+	SnapshotResultFailure = "failure"
+
+	// reasons of the events of snapshots, recorded on the claim of the disk
+	EventReasonSnapshotCreated = "SnapshotCreated"
+	EventReasonSnapshotReady   = "SnapshotReady"
+	EventReasonSnapshotFailed  = "SnapshotFailed"
+	EventReasonSnapshotDeleted = "SnapshotDeleted"
+
+	// interval between two checks whether the snapshots created by the controller are ready
+	SnapshotTrackPeriod = time.Second * 15
+
+	// snapshots not ready this long after they were created are reported as failed
+	SnapshotReadyTimeout = time.Hour * 24
+)
+
+func init() {
+	prometheus.MustRegister(snapshotOperationsTotal)
+	prometheus.MustRegister(snapshotReadySeconds)
+	prometheus.MustRegister(snapshotsPending)
+}
+
+// trackedSnapshot is a snapshot or disk backup created by the controller which is not ready yet.
+type trackedSnapshot struct {
+	diskId  string
+	typ     string
+	trigger string
+	created time.Time
+	// objects besides the claim of the disk its events are recorded on
+	involved []kube.ObjectReference
+}
+
+// snapshotTracker keeps the snapshots created by the controller until they are ready, to report
+// how long they took.
+type snapshotTracker struct {
+	mutex   sync.Mutex
+	pending map[string]trackedSnapshot
+}
+
+func newSnapshotTracker() *snapshotTracker {
+	return &snapshotTracker{pending: map[string]trackedSnapshot{}}
+}
+
+func (t *snapshotTracker) add(id string, s trackedSnapshot) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pending[id] = s
+	snapshotsPending.Set(float64(len(t.pending)))
+}
+
+func (t *snapshotTracker) remove(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.pending, id)
+	snapshotsPending.Set(float64(len(t.pending)))
+}
+
+func (t *snapshotTracker) list() map[string]trackedSnapshot {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	pending := make(map[string]trackedSnapshot, len(t.pending))
+	for id, s := range t.pending {
+		pending[id] = s
+	}
+	return pending
+}
+
+// snapshotFailureReason returns the cloud api error code of err, else its grpc code.
+func snapshotFailureReason(err error) string {
+	if e, ok := err.(*errors.TencentCloudSDKError); ok {
+		return e.Code
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return codes.Unknown.String()
+	}
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.RequestInfo); ok && info.ServingData != "" {
+			return info.ServingData
+		}
+	}
+	return s.Code().String()
+}
+
+// observeSnapshotCreated records the creation of snapshotId of diskId, or its failure with err,
+// and tracks the snapshot until it is ready.
+func (ctrl *cbsController) observeSnapshotCreated(diskId, snapshotId, typ, trigger string, involved []kube.ObjectReference, err error) {
+	if err != nil {
+		reason := snapshotFailureReason(err)
+		snapshotOperationsTotal.WithLabelValues(SnapshotOperationCreate, typ, trigger, SnapshotResultFailure, reason).Inc()
+		ctrl.recordSnapshotEvent(diskId, involved, kube.EventTypeWarning, EventReasonSnapshotFailed, fmt.Sprintf("create %s of %s failed, %s", typ, diskId, explainCloudError(err)))
+		return
+	}
+
+	snapshotOperationsTotal.WithLabelValues(SnapshotOperationCreate, typ, trigger, SnapshotResultSuccess, "").Inc()
+	ctrl.snapshots.add(snapshotId, trackedSnapshot{diskId: diskId, typ: typ, trigger: trigger, created: time.Now(), involved: involved})
+	ctrl.recordSnapshotEvent(diskId, involved, kube.EventTypeNormal, EventReasonSnapshotCreated, fmt.Sprintf("created %s %s of %s", typ, snapshotId, diskId))
+}
+
+// observeSnapshotDeleted records the deletion of snapshotId of diskId, or its failure with err.
+// Only deletions requested by DeleteSnapshot are recorded as events, not those of expired scheduled
+// snapshots.
+func (ctrl *cbsController) observeSnapshotDeleted(diskId, snapshotId, typ, trigger string, err error) {
+	if err != nil {
+		snapshotOperationsTotal.WithLabelValues(SnapshotOperationDelete, typ, trigger, SnapshotResultFailure, snapshotFailureReason(err)).Inc()
+		return
+	}
+	snapshotOperationsTotal.WithLabelValues(SnapshotOperationDelete, typ, trigger, SnapshotResultSuccess, "").Inc()
+	if trigger == SnapshotTriggerVolumeSnapshot && diskId != "" {
+		ctrl.recordSnapshotEvent(diskId, nil, kube.EventTypeNormal, EventReasonSnapshotDeleted, fmt.Sprintf("deleted %s %s of %s", typ, snapshotId, diskId))
+	}
+}
+
+// recordSnapshotEvent records an event on involved and, unless it includes a claim, on the claim of
+// diskId.
+func (ctrl *cbsController) recordSnapshotEvent(diskId string, involved []kube.ObjectReference, eventType, reason, message string) {
+	if ctrl.kubeClient == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		objects := append([]kube.ObjectReference{}, involved...)
+		for _, object := range involved {
+			if object.Kind == "PersistentVolumeClaim" {
+				recordEvents(ctx, ctrl.kubeClient, ControllerEventComponent, objects, eventType, reason, message)
+				return
+			}
+		}
+
+		pvs := &kube.PersistentVolumeList{}
+		if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumesPath(), pvs); err != nil {
+			logging.Warningf("list pvs err: %v", err)
+		}
+		for _, pv := range pvs.Items {
+			claim := pv.Spec.ClaimRef
+			if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName || legacyVolumeId(pv.Spec.CSI.VolumeHandle) != diskId || claim == nil {
+				continue
+			}
+			objects = append(objects, kube.ObjectReference{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: claim.Namespace, Name: claim.Name, UID: claim.UID})
+			break
+		}
+		recordEvents(ctx, ctrl.kubeClient, ControllerEventComponent, objects, eventType, reason, message)
+	}()
+}
+
+// runSnapshotTracking reports the snapshots created by the controller once they are ready until
+// stopCh is closed.
+func (ctrl *cbsController) runSnapshotTracking(stopCh <-chan struct{}) {
+	for {
+		if pending := ctrl.snapshots.list(); len(pending) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), SnapshotTrackPeriod*4)
+			ctrl.checkPendingSnapshots(ctx, pending, time.Now())
+			cancel()
+		}
+
+		select {
+		case <-time.After(SnapshotTrackPeriod):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) checkPendingSnapshots(ctx context.Context, pending map[string]trackedSnapshot, now time.Time) {
+	var ids []*string
+	for id, s := range pending {
+		if s.typ == SnapshotTypeBackup {
+			backup, err := ctrl.describeDiskBackup(ctx, id)
+			if err != nil && status.Code(err) != codes.NotFound {
+				logging.V(4).Infof("describe disk backup %s err: %v", id, err)
+				continue
+			}
+			state := ""
+			if backup != nil {
+				state = stringValue(backup.DiskBackupState)
+			}
+			ctrl.completeSnapshot(id, s, state, now)
+			continue
+		}
+		snapshotId := id
+		ids = append(ids, &snapshotId)
+	}
+
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > int(DescribeDisksPageSize) {
+			batch = batch[:DescribeDisksPageSize]
+		}
+		ids = ids[len(batch):]
+
+		if err := ctrl.waitRateLimit(ctx); err != nil {
+			return
+		}
+		request := cbs.NewDescribeSnapshotsRequest()
+		request.SnapshotIds = batch
+		request.Limit = &DescribeDisksPageSize
+		response, err := ctrl.cbsClient.DescribeSnapshots(ctx, request)
+		if err != nil {
+			logging.V(4).Infof("describe pending snapshots err: %v", err)
+			continue
+		}
+		states := map[string]string{}
+		for _, snapshot := range response.Response.SnapshotSet {
+			states[stringValue(snapshot.SnapshotId)] = stringValue(snapshot.SnapshotState)
+		}
+		for _, id := range batch {
+			ctrl.completeSnapshot(*id, pending[*id], states[*id], now)
+		}
+	}
+}
+
+// completeSnapshot reports a pending snapshot in state, an empty state if it does not exist, as
+// ready or failed. Snapshots still being created are kept until SnapshotReadyTimeout.
+func (ctrl *cbsController) completeSnapshot(id string, s trackedSnapshot, state string, now time.Time) {
+	elapsed := now.Sub(s.created)
+	var failure string
+	switch state {
+	case SnapshotStateNormal:
+		ctrl.snapshots.remove(id)
+		snapshotReadySeconds.WithLabelValues(s.typ, s.trigger).Observe(elapsed.Seconds())
+		snapshotOperationsTotal.WithLabelValues(SnapshotOperationComplete, s.typ, s.trigger, SnapshotResultSuccess, "").Inc()
+		ctrl.recordSnapshotEvent(s.diskId, s.involved, kube.EventTypeNormal, EventReasonSnapshotReady, fmt.Sprintf("%s %s of %s is ready after %v", s.typ, id, s.diskId, elapsed.Round(time.Second)))
+		return
+	case SnapshotStateCreating, SnapshotStateCopyingFromRemote:
+		if elapsed < SnapshotReadyTimeout {
+			return
+		}
+		failure = "Timeout"
+	case "":
+		failure = "NotFound"
+	default:
+		failure = state
+	}
+
+	ctrl.snapshots.remove(id)
+	snapshotOperationsTotal.WithLabelValues(SnapshotOperationComplete, s.typ, s.trigger, SnapshotResultFailure, failure).Inc()
+	ctrl.recordSnapshotEvent(s.diskId, s.involved, kube.EventTypeWarning, EventReasonSnapshotFailed, fmt.Sprintf("%s %s of %s did not become ready after %v: %s", s.typ, id, s.diskId, elapsed.Round(time.Second), failure))
+}
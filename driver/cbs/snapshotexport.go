@@ -0,0 +1,291 @@
+package cbs
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cos"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cvm"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// states of the images snapshots are exported through
+	ImageStateNormal       = "NORMAL"
+	ImageStateCreateFailed = "CREATEFAILED"
+
+	ImageTagResourceType = "image"
+
+	// exports whose objects are not all in the bucket after this failed, their image is deleted
+	SnapshotExportTimeout = time.Hour * 24
+)
+
+// exportScheduledSnapshots exports the last snapshots of schedule to the cos bucket of exportToCos,
+// through an image of each snapshot, taking one step of each export per call, and continues the
+// exports pending from earlier runs. Failed steps are retried. It reports whether the status of
+// schedule changed.
+func (ctrl *cbsController) exportScheduledSnapshots(ctx context.Context, schedule *kube.VolumeSnapshotSchedule, now time.Time) bool {
+	spec := schedule.Spec.ExportToCos
+	if spec == nil || spec.Bucket == "" {
+		return false
+	}
+
+	changed := false
+	exportAll := func(snapshots []kube.ScheduledSnapshot) {
+		for i := range snapshots {
+			last := &snapshots[i]
+			if last.SnapshotId == "" || (last.Export != nil && last.Export.Phase != "") {
+				continue
+			}
+
+			export := kube.SnapshotExport{}
+			if last.Export != nil {
+				export = *last.Export
+			}
+			object := spec.Prefix + schedule.Metadata.Namespace + "/" + schedule.Metadata.Name + "/" + last.SnapshotId
+			next := ctrl.exportSnapshot(ctx, last.SnapshotId, export, spec, object, now)
+			if last.Export == nil || !reflect.DeepEqual(next, *last.Export) {
+				last.Export = &next
+				changed = true
+			}
+		}
+	}
+	exportAll(schedule.Status.LastSnapshots)
+	exportAll(schedule.Status.PendingExports)
+
+	var pending []kube.ScheduledSnapshot
+	for _, snapshot := range schedule.Status.PendingExports {
+		if snapshot.Export.Phase == "" {
+			pending = append(pending, snapshot)
+		}
+	}
+	if len(pending) != len(schedule.Status.PendingExports) {
+		schedule.Status.PendingExports = pending
+		changed = true
+	}
+	return changed
+}
+
+// exportsInProgress returns the snapshots whose export started and did not end yet, they are
+// continued after the next run replaced them.
+func exportsInProgress(snapshots []kube.ScheduledSnapshot) []kube.ScheduledSnapshot {
+	var exports []kube.ScheduledSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Export != nil && snapshot.Export.Phase == "" && snapshot.Export.ImageId != "" {
+			exports = append(exports, snapshot)
+		}
+	}
+	return exports
+}
+
+// exportSnapshot takes the next step of export of snapshotId: it creates an image of the snapshot
+// once the snapshot is ready, exports the image as object once the image is ready, and once the
+// objects of the export task are in the bucket tags them and deletes the image.
+func (ctrl *cbsController) exportSnapshot(ctx context.Context, snapshotId string, export kube.SnapshotExport, spec *kube.SnapshotExportSpec, object string, now time.Time) kube.SnapshotExport {
+	if export.ImageId == "" {
+		systemSnapshotId := ctrl.config.Get().ExportSystemDiskSnapshotId
+		if systemSnapshotId == "" {
+			export.Error = "exportSystemDiskSnapshotId is not set in the config file"
+			return export
+		}
+		snapshot, err := ctrl.describeSnapshot(ctx, snapshotId)
+		if err != nil {
+			export.Error = err.Error()
+			return export
+		}
+		if stringValue(snapshot.SnapshotState) != SnapshotStateNormal {
+			return export
+		}
+
+		imageId, err := ctrl.createSnapshotImage(ctx, snapshot, systemSnapshotId)
+		if err != nil {
+			logging.Errorf("create image of snapshot %s err: %v", snapshotId, err)
+			export.Error = err.Error()
+			return export
+		}
+		logging.Infof("creating image %s of snapshot %s to export it", imageId, snapshotId)
+		return kube.SnapshotExport{ImageId: imageId}
+	}
+
+	if export.TaskId == "" {
+		state, err := ctrl.imageState(ctx, export.ImageId)
+		if err != nil {
+			export.Error = err.Error()
+			return export
+		}
+		switch state {
+		case ImageStateNormal:
+		case ImageStateCreateFailed:
+			logging.Errorf("image %s of snapshot %s failed", export.ImageId, snapshotId)
+			ctrl.deleteImages(ctx, []string{export.ImageId})
+			return kube.SnapshotExport{Error: fmt.Sprintf("image %s of the snapshot failed", export.ImageId)}
+		default:
+			return export
+		}
+
+		taskId, objects, err := ctrl.exportImage(ctx, export.ImageId, spec, object)
+		if err != nil {
+			logging.Errorf("export image %s of snapshot %s to %s err: %v", export.ImageId, snapshotId, spec.Bucket, err)
+			export.Error = err.Error()
+			return export
+		}
+		logging.Infof("exporting snapshot %s to %s %v, task %s", snapshotId, spec.Bucket, objects, taskId)
+		return kube.SnapshotExport{ImageId: export.ImageId, TaskId: taskId, StartTime: now.UTC().Format(time.RFC3339), Objects: objects}
+	}
+
+	bucket := ctrl.cbsClient.cosClient(spec.Bucket)
+	exported := true
+	for _, object := range export.Objects {
+		exists, err := bucket.ObjectExists(ctx, cos.ObjectKey(object))
+		if err != nil {
+			export.Error = fmt.Sprintf("check exported object %s err: %v", object, err)
+			return export
+		}
+		exported = exported && exists
+	}
+	if !exported {
+		start, err := time.Parse(time.RFC3339, export.StartTime)
+		if err == nil && now.Sub(start) < SnapshotExportTimeout {
+			return export
+		}
+		logging.Errorf("export task %s of snapshot %s did not finish within %v", export.TaskId, snapshotId, SnapshotExportTimeout)
+		if err := ctrl.deleteImages(ctx, []string{export.ImageId}); err != nil {
+			export.Error = err.Error()
+			return export
+		}
+		return kube.SnapshotExport{
+			Phase:     kube.SnapshotExportFailed,
+			TaskId:    export.TaskId,
+			StartTime: export.StartTime,
+			Objects:   export.Objects,
+			Error:     fmt.Sprintf("export task did not finish within %v", SnapshotExportTimeout),
+		}
+	}
+
+	tags := exportTags(spec, ctrl.config.Get().Tags)
+	for _, object := range export.Objects {
+		if err := bucket.PutObjectTagging(ctx, cos.ObjectKey(object), tags); err != nil {
+			logging.Errorf("tag exported object %s err: %v", object, err)
+			export.Error = fmt.Sprintf("tag exported object %s err: %v", object, err)
+			return export
+		}
+	}
+	if err := ctrl.deleteImages(ctx, []string{export.ImageId}); err != nil {
+		export.Error = err.Error()
+		return export
+	}
+	logging.Infof("exported snapshot %s to %s %v", snapshotId, spec.Bucket, export.Objects)
+	return kube.SnapshotExport{Phase: kube.SnapshotExportExported, TaskId: export.TaskId, StartTime: export.StartTime, Objects: export.Objects}
+}
+
+// exportTags returns the tags of the exported objects, the tags of spec and those of the config.
+func exportTags(spec *kube.SnapshotExportSpec, configTags map[string]string) map[string]string {
+	tags := map[string]string{}
+	for key, value := range configTags {
+		tags[key] = value
+	}
+	for key, value := range spec.Tags {
+		tags[key] = value
+	}
+	return tags
+}
+
+// createSnapshotImage creates an image of the system disk snapshot systemSnapshotId with the data
+// disk snapshot snapshot, named after it with the tags of the config, and returns its id.
+func (ctrl *cbsController) createSnapshotImage(ctx context.Context, snapshot *cbs.Snapshot, systemSnapshotId string) (string, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+
+	request := cvm.NewCreateImageRequest()
+	request.ImageName = snapshot.SnapshotName
+	request.SnapshotIds = []*string{&systemSnapshotId, snapshot.SnapshotId}
+	if tags := ctrl.config.Get().Tags; len(tags) > 0 {
+		spec := &cvm.TagSpecification{ResourceType: &ImageTagResourceType}
+		for key, value := range tags {
+			k, v := key, value
+			spec.Tags = append(spec.Tags, &cvm.Tag{Key: &k, Value: &v})
+		}
+		request.TagSpecification = []*cvm.TagSpecification{spec}
+	}
+	response, err := ctrl.cbsClient.CreateImage(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if response.Response.ImageId == nil {
+		return "", fmt.Errorf("no image id in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	return *response.Response.ImageId, nil
+}
+
+func (ctrl *cbsController) imageState(ctx context.Context, imageId string) (string, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+
+	request := cvm.NewDescribeImagesRequest()
+	request.ImageIds = []*string{&imageId}
+	response, err := ctrl.cbsClient.DescribeImages(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	for _, image := range response.Response.ImageSet {
+		if image.ImageId != nil && *image.ImageId == imageId {
+			return stringValue(image.ImageState), nil
+		}
+	}
+	return "", fmt.Errorf("image %s not found, request id %s", imageId, requestIdOf(response.Response.RequestId))
+}
+
+// exportImage exports the disks of imageId to the bucket of spec as objects prefixed with object and
+// returns the id of the task and the objects.
+func (ctrl *cbsController) exportImage(ctx context.Context, imageId string, spec *kube.SnapshotExportSpec, object string) (string, []string, error) {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", nil, err
+	}
+
+	request := cvm.NewExportImagesRequest()
+	request.BucketName = &spec.Bucket
+	request.ImageIds = []*string{&imageId}
+	request.FileNamePrefixList = []*string{&object}
+	if spec.Format != "" {
+		request.ExportFormat = &spec.Format
+	}
+	response, err := ctrl.cbsClient.ExportImages(ctx, request)
+	if err != nil {
+		return "", nil, err
+	}
+	if response.Response.TaskId == nil || len(response.Response.CosPaths) == 0 {
+		return "", nil, fmt.Errorf("no task id or cos paths in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	var objects []string
+	for _, path := range response.Response.CosPaths {
+		if path != nil {
+			objects = append(objects, *path)
+		}
+	}
+	return strconv.FormatUint(*response.Response.TaskId, 10), objects, nil
+}
+
+func (ctrl *cbsController) deleteImages(ctx context.Context, ids []string) error {
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		logging.Errorf("delete images %v err: %v", ids, err)
+		return err
+	}
+
+	request := cvm.NewDeleteImagesRequest()
+	for i := range ids {
+		request.ImageIds = append(request.ImageIds, &ids[i])
+	}
+	if _, err := ctrl.cbsClient.DeleteImages(ctx, request); err != nil {
+		logging.Errorf("delete images %v err: %v", ids, err)
+		return err
+	}
+	logging.Infof("deleted images %v", ids)
+	return nil
+}
@@ -0,0 +1,179 @@
+package cbs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cbsext"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	snapshotSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_snapshot_size_bytes",
+		Help: "Size in bytes of the disk a snapshot or disk backup was taken of, the smallest volume it restores to, by the object it was taken for.",
+	}, []string{"snapshot_id", "disk_id", "type", "namespace", "owner_kind", "owner_name"})
+
+	snapshotMonthlyCost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cbs_snapshot_monthly_cost",
+		Help: "Estimated monthly cost of a snapshot at snapshotPricePerGB, the billed size of the region shared by its snapshots in proportion to their size.",
+	}, []string{"snapshot_id", "disk_id", "type", "namespace", "owner_kind", "owner_name"})
+
+	snapshotsStoredGigabytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cbs_snapshots_stored_gigabytes",
+		Help: "GB stored by the snapshots of the region, unchanged blocks are shared by the snapshots of a disk.",
+	})
+
+	snapshotsBilledGigabytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cbs_snapshots_billed_gigabytes",
+		Help: "GB of snapshots of the region billed, the stored size less the free quota.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(snapshotSizeBytes)
+	prometheus.MustRegister(snapshotMonthlyCost)
+	prometheus.MustRegister(snapshotsStoredGigabytes)
+	prometheus.MustRegister(snapshotsBilledGigabytes)
+}
+
+// snapshotOwner is the kubernetes object a snapshot was taken for.
+type snapshotOwner struct {
+	namespace, kind, name string
+}
+
+// runSnapshotMetrics updates the size and cost metrics of the snapshots of the region every interval
+// until stopCh is closed. Only the leader updates them when leader election is enabled.
+func (ctrl *cbsController) runSnapshotMetrics(interval time.Duration, stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), interval); ok {
+			if err := ctrl.updateSnapshotMetrics(ctx); err != nil {
+				logging.Errorf("update snapshot metrics err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) updateSnapshotMetrics(ctx context.Context) error {
+	cfg := ctrl.config.Get()
+
+	snapshots, err := ctrl.listSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	var backups []*cbsext.DiskBackup
+	for offset := uint64(0); ; offset += DescribeDisksPageSize {
+		page, err := ctrl.listDiskBackups(ctx, "", offset, DescribeDisksPageSize)
+		if err != nil {
+			return err
+		}
+		backups = append(backups, page...)
+		if len(page) < int(DescribeDisksPageSize) {
+			break
+		}
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	overview, err := ctrl.cbsClient.DescribeSnapshotOverview(ctx, cbsext.NewDescribeSnapshotOverviewRequest())
+	if err != nil {
+		return err
+	}
+	billed := 0.0
+	if overview.Response.RealTradeSize != nil {
+		billed = *overview.Response.RealTradeSize
+	}
+	snapshotsBilledGigabytes.Set(billed)
+	if overview.Response.TotalSize != nil {
+		snapshotsStoredGigabytes.Set(*overview.Response.TotalSize)
+	}
+
+	owners := ctrl.snapshotOwners(ctx, snapshots)
+
+	var totalSize float64
+	for _, snapshot := range snapshots {
+		if snapshot.DiskSize != nil {
+			totalSize += float64(*snapshot.DiskSize)
+		}
+	}
+
+	snapshotSizeBytes.Reset()
+	snapshotMonthlyCost.Reset()
+	for _, snapshot := range snapshots {
+		id := stringValue(snapshot.SnapshotId)
+		owner := owners[id]
+		labels := []string{id, stringValue(snapshot.DiskId), SnapshotTypeSnapshot, owner.namespace, owner.kind, owner.name}
+		size := 0.0
+		if snapshot.DiskSize != nil {
+			size = float64(*snapshot.DiskSize)
+		}
+		snapshotSizeBytes.WithLabelValues(labels...).Set(size * float64(GB))
+		if cfg.SnapshotPricePerGB > 0 && totalSize > 0 {
+			snapshotMonthlyCost.WithLabelValues(labels...).Set(billed * size / totalSize * cfg.SnapshotPricePerGB)
+		}
+	}
+	// disk backups are billed by the backup quota of their disks, not by size
+	for _, backup := range backups {
+		id := stringValue(backup.DiskBackupId)
+		owner := owners[id]
+		size := 0.0
+		if backup.DiskSize != nil {
+			size = float64(*backup.DiskSize)
+		}
+		snapshotSizeBytes.WithLabelValues(id, stringValue(backup.DiskId), SnapshotTypeBackup, owner.namespace, owner.kind, owner.name).Set(size * float64(GB))
+	}
+	return nil
+}
+
+// snapshotOwners returns the owners of snapshots and disk backups by id: the VolumeSnapshot of
+// their volume snapshot content, or the VolumeSnapshotSchedule whose prefix names them. Owners which
+// can not be listed are left out.
+func (ctrl *cbsController) snapshotOwners(ctx context.Context, snapshots []*cbs.Snapshot) map[string]snapshotOwner {
+	owners := map[string]snapshotOwner{}
+	if ctrl.kubeClient == nil {
+		return owners
+	}
+
+	contents := &kube.VolumeSnapshotContentList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.VolumeSnapshotContentsPath(), contents); err != nil {
+		logging.V(4).Infof("list volume snapshot contents err: %v", err)
+	}
+	for _, content := range contents.Items {
+		source, ref := content.Spec.CSI, content.Spec.VolumeSnapshotRef
+		if source == nil || source.Driver != DriverName || ref == nil {
+			continue
+		}
+		owners[source.SnapshotHandle] = snapshotOwner{namespace: ref.Namespace, kind: "VolumeSnapshot", name: ref.Name}
+	}
+
+	schedules := &kube.VolumeSnapshotScheduleList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.AllVolumeSnapshotSchedulesPath(), schedules); err != nil {
+		logging.V(4).Infof("list snapshot schedules err: %v", err)
+	}
+	for _, snapshot := range snapshots {
+		name := stringValue(snapshot.SnapshotName)
+		if !strings.HasPrefix(name, ScheduledSnapshotNamePrefix) {
+			continue
+		}
+		for i := range schedules.Items {
+			schedule := &schedules.Items[i]
+			if strings.HasPrefix(name, scheduledSnapshotPrefix(schedule)) {
+				owners[stringValue(snapshot.SnapshotId)] = snapshotOwner{namespace: schedule.Metadata.Namespace, kind: "VolumeSnapshotSchedule", name: schedule.Metadata.Name}
+				break
+			}
+		}
+	}
+	return owners
+}
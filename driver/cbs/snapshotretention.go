@@ -0,0 +1,231 @@
+package cbs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// interval between two runs of the reaper deleting expired scheduled snapshots
+	SnapshotReapPeriod = time.Hour
+
+	// snapshots of a claim kept by a schedule which sets neither retention nor maxAge
+	DefaultSnapshotRetention = 7
+)
+
+// snapshotRetention decides which snapshots of a disk taken by a schedule are deleted.
+type snapshotRetention struct {
+	// newest snapshots kept, zero keeps all
+	maxCount int
+	// snapshots older than this are deleted, zero keeps them regardless of age
+	maxAge time.Duration
+}
+
+// scheduleRetention returns the retention of the snapshots taken by schedule. Without retention
+// and maxAge the schedule keeps DefaultSnapshotRetention snapshots and deletes those older than
+// snapshotMaxAge of the config.
+func scheduleRetention(schedule *kube.VolumeSnapshotSchedule, cfg *Config) (snapshotRetention, error) {
+	retention := snapshotRetention{maxCount: schedule.Spec.Retention, maxAge: cfg.SnapshotMaxAge}
+	if schedule.Spec.MaxAge != "" {
+		maxAge, err := time.ParseDuration(schedule.Spec.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return retention, fmt.Errorf("invalid maxAge %q, must be a positive duration, e.g. 720h", schedule.Spec.MaxAge)
+		}
+		retention.maxAge = maxAge
+	} else if retention.maxCount <= 0 {
+		retention.maxCount = DefaultSnapshotRetention
+	}
+	return retention, nil
+}
+
+// expired returns the ids of snapshots, the newest first, which are beyond maxCount or older than
+// maxAge. Snapshots not in state NORMAL, e.g. being created or rolled back, count but are never
+// expired.
+func (r snapshotRetention) expired(snapshots []*cbs.Snapshot, now time.Time) []*string {
+	var ids []*string
+	for i, snapshot := range snapshots {
+		if snapshot.SnapshotId == nil || snapshot.SnapshotState == nil || *snapshot.SnapshotState != SnapshotStateNormal {
+			continue
+		}
+
+		expired := r.maxCount > 0 && i >= r.maxCount
+		if r.maxAge > 0 && snapshot.CreateTime != nil {
+			created, err := time.ParseInLocation(CloudTimeFormat, *snapshot.CreateTime, cloudTimeLocation)
+			if err == nil && now.Sub(created) > r.maxAge {
+				expired = true
+			}
+		}
+		if expired {
+			ids = append(ids, snapshot.SnapshotId)
+		}
+	}
+	return ids
+}
+
+func (ctrl *cbsController) deleteSnapshots(ctx context.Context, ids []*string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return err
+	}
+	request := cbs.NewDeleteSnapshotsRequest()
+	request.SnapshotIds = ids
+	if _, err := ctrl.cbsClient.DeleteSnapshots(ctx, request); err != nil {
+		return err
+	}
+	logging.Infof("deleted expired snapshots %v", derefIds(ids))
+	return nil
+}
+
+func derefIds(ids []*string) []string {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, *id)
+	}
+	return values
+}
+
+// runSnapshotReaper deletes the expired snapshots of all schedules every SnapshotReapPeriod until
+// stopCh is closed, including those of claims no longer selected and of deleted schedules, which
+// the schedules do not prune themselves. Only the leader deletes them when leader election is
+// enabled.
+func (ctrl *cbsController) runSnapshotReaper(stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), SnapshotReapPeriod); ok {
+			if err := ctrl.reapSnapshots(ctx, time.Now()); err != nil {
+				logging.Errorf("reap snapshots err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(SnapshotReapPeriod):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) reapSnapshots(ctx context.Context, now time.Time) error {
+	cfg := ctrl.config.Get()
+
+	schedules := &kube.VolumeSnapshotScheduleList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.AllVolumeSnapshotSchedulesPath(), schedules); err != nil {
+		return err
+	}
+	retentions := map[string]snapshotRetention{}
+	for i := range schedules.Items {
+		schedule := &schedules.Items[i]
+		retention, err := scheduleRetention(schedule, cfg)
+		if err != nil {
+			// keep the snapshots of a schedule with an invalid retention
+			retention = snapshotRetention{}
+		}
+		retentions[scheduledSnapshotPrefix(schedule)] = retention
+	}
+
+	// only snapshots tagged by the schedules of this cluster, never those of other clusters or taken
+	// by hand which merely share the name prefix
+	snapshots, err := ctrl.listSnapshots(ctx, scheduledSnapshotFilters(cfg.Tags, "")...)
+	if err != nil {
+		return err
+	}
+
+	// snapshots by schedule prefix and disk, the newest first
+	groups := map[string]map[string][]*cbs.Snapshot{}
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotName == nil || snapshot.DiskId == nil {
+			continue
+		}
+		prefix := scheduledSnapshotPrefixOf(*snapshot.SnapshotName)
+		if prefix == "" {
+			continue
+		}
+		if groups[prefix] == nil {
+			groups[prefix] = map[string][]*cbs.Snapshot{}
+		}
+		groups[prefix][*snapshot.DiskId] = append(groups[prefix][*snapshot.DiskId], snapshot)
+	}
+
+	for prefix, disks := range groups {
+		retention := reapRetention(retentions, prefix, cfg)
+		for diskId, diskSnapshots := range disks {
+			if err := ctrl.deleteSnapshots(ctx, retention.expired(diskSnapshots, now)); err != nil {
+				logging.Errorf("delete expired snapshots of %s err: %v", diskId, err)
+			}
+		}
+	}
+
+	return ctrl.reapSnapshotCopies(ctx, schedules)
+}
+
+// reapSnapshotCopies deletes the copies in other regions of the snapshots of schedules which were
+// deleted, by retention or by hand.
+func (ctrl *cbsController) reapSnapshotCopies(ctx context.Context, schedules *kube.VolumeSnapshotScheduleList) error {
+	copied := false
+	for i := range schedules.Items {
+		if len(schedules.Items[i].Status.CopiedSnapshots) > 0 {
+			copied = true
+		}
+	}
+	if !copied {
+		return nil
+	}
+
+	// all snapshots of the region, a snapshot missing from the list is deleted for sure
+	snapshots, err := ctrl.listSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotId != nil {
+			existing[*snapshot.SnapshotId] = true
+		}
+	}
+
+	for i := range schedules.Items {
+		schedule := &schedules.Items[i]
+		if !ctrl.deleteExpiredCopies(ctx, schedule, existing) {
+			continue
+		}
+		if err := ctrl.kubeClient.Update(ctx, kube.VolumeSnapshotSchedulePath(schedule.Metadata.Namespace, schedule.Metadata.Name), schedule, nil); err != nil {
+			logging.Errorf("update snapshot schedule %s/%s err: %v", schedule.Metadata.Namespace, schedule.Metadata.Name, err)
+		}
+	}
+	return nil
+}
+
+// reapRetention returns the retention of the snapshots of the schedule with prefix. The snapshots of
+// deleted schedules expire after snapshotMaxAge, but only if the config has tags: without them the
+// snapshots of the schedules of other clusters in the account look like those of deleted schedules.
+func reapRetention(retentions map[string]snapshotRetention, prefix string, cfg *Config) snapshotRetention {
+	if retention, ok := retentions[prefix]; ok {
+		return retention
+	}
+	if len(cfg.Tags) == 0 {
+		return snapshotRetention{}
+	}
+	return snapshotRetention{maxAge: cfg.SnapshotMaxAge}
+}
+
+// scheduledSnapshotPrefixOf returns the prefix of the schedule which took the snapshot named name,
+// empty if no schedule took it.
+func scheduledSnapshotPrefixOf(name string) string {
+	if !strings.HasPrefix(name, ScheduledSnapshotNamePrefix) {
+		return ""
+	}
+	i := strings.Index(name[len(ScheduledSnapshotNamePrefix):], "-")
+	if i < 0 {
+		return ""
+	}
+	return name[:len(ScheduledSnapshotNamePrefix)+i+1]
+}
@@ -0,0 +1,158 @@
+package cbs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+)
+
+func TestScheduledSnapshotPrefixOf(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"csi-schedule-1a2b3c4d-20240310-0300", "csi-schedule-1a2b3c4d-"},
+		{"csi-schedule-1a2b-20240310-0300", "csi-schedule-1a2b-"},
+		{"csi-schedule-1a2b3c4d", ""},
+		{"csi-schedule-", ""},
+		{"snapshot-1a2b3c4d-20240310-0300", ""},
+		{"my-csi-schedule-1a2b3c4d-20240310-0300", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := scheduledSnapshotPrefixOf(test.name); got != test.want {
+			t.Errorf("scheduledSnapshotPrefixOf(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSnapshotRetentionExpired(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, cloudTimeLocation)
+	snapshot := func(id, state string, age time.Duration) *cbs.Snapshot {
+		created := now.Add(-age).Format(CloudTimeFormat)
+		return &cbs.Snapshot{SnapshotId: &id, SnapshotState: &state, CreateTime: &created}
+	}
+	day := 24 * time.Hour
+	// the newest first, as listed
+	snapshots := []*cbs.Snapshot{
+		snapshot("snap-1", SnapshotStateNormal, 1*day),
+		snapshot("snap-2", SnapshotStateCreating, 2*day),
+		snapshot("snap-3", SnapshotStateNormal, 3*day),
+		snapshot("snap-4", SnapshotStateNormal, 10*day),
+		snapshot("snap-5", SnapshotStateNormal, 40*day),
+	}
+
+	tests := []struct {
+		name      string
+		retention snapshotRetention
+		want      []string
+	}{
+		{"keep all", snapshotRetention{}, nil},
+		{"count", snapshotRetention{maxCount: 3}, []string{"snap-4", "snap-5"}},
+		{"count of all", snapshotRetention{maxCount: 5}, nil},
+		{"not ready counts but is kept", snapshotRetention{maxCount: 1}, []string{"snap-3", "snap-4", "snap-5"}},
+		{"age", snapshotRetention{maxAge: 7 * day}, []string{"snap-4", "snap-5"}},
+		{"count or age", snapshotRetention{maxCount: 4, maxAge: 30 * day}, []string{"snap-5"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, id := range test.retention.expired(snapshots, now) {
+				got = append(got, *id)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expired %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotRetentionExpiredWithoutTime(t *testing.T) {
+	id, state, invalid := "snap-1", SnapshotStateNormal, "yesterday"
+	snapshots := []*cbs.Snapshot{
+		{SnapshotId: &id, SnapshotState: &state},
+		{SnapshotId: &id, SnapshotState: &state, CreateTime: &invalid},
+		{SnapshotState: &state},
+	}
+
+	if got := (snapshotRetention{maxAge: time.Hour}).expired(snapshots, time.Now()); len(got) != 0 {
+		t.Errorf("expired %v, snapshots of unknown age must be kept", got)
+	}
+}
+
+// matchesFilters reports whether a snapshot carrying tags is listed by DescribeSnapshots with filters.
+func matchesFilters(filters []*cbs.Filter, tags map[string]string) bool {
+	for _, filter := range filters {
+		switch {
+		case *filter.Name == "tag-key":
+			if _, ok := tags[*filter.Values[0]]; !ok {
+				return false
+			}
+		case strings.HasPrefix(*filter.Name, "tag:"):
+			if value, ok := tags[strings.TrimPrefix(*filter.Name, "tag:")]; !ok || value != *filter.Values[0] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestScheduledSnapshotFilters(t *testing.T) {
+	clusterTags := map[string]string{"cluster": "a"}
+
+	tests := []struct {
+		name         string
+		snapshotTags map[string]string
+		uid          string
+		want         bool
+	}{
+		{"taken by the schedule", map[string]string{"cluster": "a", ScheduleUIDTagKey: "uid-1"}, "uid-1", true},
+		{"taken by any schedule", map[string]string{"cluster": "a", ScheduleUIDTagKey: "uid-1"}, "", true},
+		{"untagged", nil, "uid-1", false},
+		{"untagged of any schedule", nil, "", false},
+		{"without cluster tags", map[string]string{ScheduleUIDTagKey: "uid-1"}, "uid-1", false},
+		{"of another cluster", map[string]string{"cluster": "b", ScheduleUIDTagKey: "uid-1"}, "uid-1", false},
+		{"of another cluster of any schedule", map[string]string{"cluster": "b", ScheduleUIDTagKey: "uid-1"}, "", false},
+		{"of another schedule", map[string]string{"cluster": "a", ScheduleUIDTagKey: "uid-2"}, "uid-1", false},
+		{"taken by hand", map[string]string{"cluster": "a"}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchesFilters(scheduledSnapshotFilters(clusterTags, test.uid), test.snapshotTags); got != test.want {
+				t.Errorf("snapshot with tags %v selected %v, want %v", test.snapshotTags, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReapRetention(t *testing.T) {
+	day := 24 * time.Hour
+	retentions := map[string]snapshotRetention{"csi-schedule-1a2b3c4d-": {maxCount: 7}}
+
+	tests := []struct {
+		name   string
+		prefix string
+		tags   map[string]string
+		want   snapshotRetention
+	}{
+		{"schedule", "csi-schedule-1a2b3c4d-", nil, snapshotRetention{maxCount: 7}},
+		{"deleted schedule", "csi-schedule-5e6f7a8b-", map[string]string{"cluster": "a"}, snapshotRetention{maxAge: 30 * day}},
+		// without tags the schedule may be of another cluster
+		{"deleted schedule without tags", "csi-schedule-5e6f7a8b-", nil, snapshotRetention{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &Config{Tags: test.tags, SnapshotMaxAge: 30 * day}
+			if got := reapRetention(retentions, test.prefix, cfg); got != test.want {
+				t.Errorf("retention %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package cbs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cron"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// interval between two checks whether a snapshot schedule is due
+	SnapshotScheduleCheckPeriod = time.Minute
+
+	// names of the snapshots taken by a schedule start with the prefix and the first characters of
+	// the uid of the schedule, followed by the time they were taken
+	ScheduledSnapshotNamePrefix = "csi-schedule-"
+	ScheduledSnapshotTimeFormat = "20060102-1504"
+
+	// tag holding the uid of the schedule which took a snapshot, expired snapshots are only deleted
+	// if they carry it and the tags of the config, so those of other clusters are never touched
+	ScheduleUIDTagKey = "com.tencent.cloud.csi.cbs/schedule-uid"
+)
+
+// scheduledSnapshotPrefix returns the prefix of the names of the snapshots taken by schedule.
+func scheduledSnapshotPrefix(schedule *kube.VolumeSnapshotSchedule) string {
+	uid := schedule.Metadata.UID
+	if len(uid) > 8 {
+		uid = uid[:8]
+	}
+	return ScheduledSnapshotNamePrefix + uid + "-"
+}
+
+// runSnapshotSchedules takes the snapshots of the VolumeSnapshotSchedule resources when they are due
+// until stopCh is closed. Only the leader takes them when leader election is enabled.
+func (ctrl *cbsController) runSnapshotSchedules(stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), SnapshotScheduleCheckPeriod*10); ok {
+			if err := ctrl.checkSnapshotSchedules(ctx, time.Now()); err != nil {
+				logging.Errorf("check snapshot schedules err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(SnapshotScheduleCheckPeriod):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (ctrl *cbsController) checkSnapshotSchedules(ctx context.Context, now time.Time) error {
+	schedules := &kube.VolumeSnapshotScheduleList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.AllVolumeSnapshotSchedulesPath(), schedules); err != nil {
+		return err
+	}
+
+	for i := range schedules.Items {
+		schedule := &schedules.Items[i]
+		name := schedule.Metadata.Namespace + "/" + schedule.Metadata.Name
+		if schedule.Spec.Suspend {
+			continue
+		}
+
+		s, err := cron.Parse(schedule.Spec.Schedule)
+		if err != nil {
+			logging.Errorf("snapshot schedule %s: %v", name, err)
+			continue
+		}
+		retention, err := scheduleRetention(schedule, ctrl.config.Get())
+		if err != nil {
+			logging.Errorf("snapshot schedule %s: %v", name, err)
+			continue
+		}
+		windows, stagger, err := scheduleTiming(schedule, ctrl.config.Get())
+		if err != nil {
+			logging.Errorf("snapshot schedule %s: %v", name, err)
+			continue
+		}
+
+		last := schedule.Status.LastScheduleTime
+		if last == "" {
+			last = schedule.Metadata.CreationTimestamp
+		}
+		lastTime, err := time.Parse(time.RFC3339, last)
+		if err != nil {
+			lastTime = now
+		}
+		// the copies and exports of the last snapshots are made before they are replaced by the next
+		// ones
+		changed := ctrl.copyScheduledSnapshots(ctx, schedule)
+		if ctrl.exportScheduledSnapshots(ctx, schedule, now) {
+			changed = true
+		}
+
+		if until := schedule.Status.StaggeredUntil; until != "" {
+			// a staggered run is in progress, the claims left are taken once it ends
+			end := now
+			if untilTime, err := time.Parse(time.RFC3339, until); err != nil || !now.Before(untilTime) {
+				end, schedule.Status.StaggeredUntil = lastTime.Add(stagger), ""
+				changed = true
+			}
+			taken := ctrl.takeScheduledSnapshots(ctx, schedule, schedule.Status.LastSnapshots, retention, lastTime, end, stagger)
+			if len(taken) > 0 {
+				schedule.Status.LastSnapshots = append(schedule.Status.LastSnapshots, taken...)
+				changed = true
+			}
+		} else if next := s.Next(lastTime.UTC()); !next.IsZero() && !now.Before(next) {
+			// missed runs, e.g. while the controller was down or outside the windows, are taken once
+			if inSnapshotWindows(windows, now) {
+				logging.Infof("taking snapshots of schedule %s", name)
+				// exports in progress are continued, those not started yet had a whole run to
+				schedule.Status.PendingExports = append(schedule.Status.PendingExports, exportsInProgress(schedule.Status.LastSnapshots)...)
+				// the run starts without snapshots of its own
+				schedule.Status.LastSnapshots = ctrl.takeScheduledSnapshots(ctx, schedule, nil, retention, now, now, stagger)
+				schedule.Status.LastScheduleTime = now.UTC().Format(time.RFC3339)
+				if stagger > 0 {
+					schedule.Status.StaggeredUntil = now.Add(stagger).UTC().Format(time.RFC3339)
+				}
+				changed = true
+			} else {
+				logging.V(4).Infof("snapshot schedule %s is due outside its snapshot windows", name)
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := ctrl.kubeClient.Update(ctx, kube.VolumeSnapshotSchedulePath(schedule.Metadata.Namespace, schedule.Metadata.Name), schedule, nil); err != nil {
+			logging.Errorf("update snapshot schedule %s err: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// takeScheduledSnapshots snapshots the claims selected by schedule for the run started at runTime
+// and deletes their snapshots expired by retention. With stagger a claim is only snapshotted once
+// its offset after runTime has passed by now; claims with a snapshot in runSnapshots, those already
+// taken in the run, are skipped.
+func (ctrl *cbsController) takeScheduledSnapshots(ctx context.Context, schedule *kube.VolumeSnapshotSchedule, runSnapshots []kube.ScheduledSnapshot, retention snapshotRetention, runTime, now time.Time, stagger time.Duration) []kube.ScheduledSnapshot {
+	namespace := schedule.Metadata.Namespace
+	taken := map[string]bool{}
+	for _, last := range runSnapshots {
+		taken[last.PersistentVolumeClaim] = true
+	}
+
+	claims := &kube.PersistentVolumeClaimList{}
+	if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumeClaimsPath(namespace), claims); err != nil {
+		return []kube.ScheduledSnapshot{{Error: fmt.Sprintf("list claims err: %v", err)}}
+	}
+
+	prefix := scheduledSnapshotPrefix(schedule)
+	p := &snapshotParameters{fsFreeze: schedule.Spec.FsFreeze, tags: map[string]string{ScheduleUIDTagKey: schedule.Metadata.UID}}
+	for key, value := range ctrl.config.Get().Tags {
+		p.tags[key] = value
+	}
+
+	var results []kube.ScheduledSnapshot
+	for _, claim := range claims.Items {
+		if claim.Spec.VolumeName == "" || !hasLabels(claim.Metadata.Labels, schedule.Spec.Selector) || taken[claim.Metadata.Name] {
+			continue
+		}
+		if now.Before(runTime.Add(staggerOffset(namespace+"/"+claim.Metadata.Name, stagger))) {
+			continue
+		}
+
+		pv := &kube.PersistentVolume{}
+		if err := ctrl.kubeClient.Get(ctx, kube.PersistentVolumePath(claim.Spec.VolumeName), pv); err != nil {
+			results = append(results, kube.ScheduledSnapshot{PersistentVolumeClaim: claim.Metadata.Name, Error: fmt.Sprintf("get pv err: %v", err)})
+			continue
+		}
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != DriverName {
+			continue
+		}
+		diskId := legacyVolumeId(pv.Spec.CSI.VolumeHandle)
+
+		result := kube.ScheduledSnapshot{PersistentVolumeClaim: claim.Metadata.Name, VolumeId: diskId}
+		snapshotId, err := ctrl.createSnapshot(ctx, diskId, prefix+runTime.UTC().Format(ScheduledSnapshotTimeFormat), p)
+		involved := []kube.ObjectReference{
+			{APIVersion: kube.CustomResourceAPIVersion, Kind: "VolumeSnapshotSchedule", Namespace: namespace, Name: schedule.Metadata.Name, UID: schedule.Metadata.UID},
+			{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: namespace, Name: claim.Metadata.Name, UID: claim.Metadata.UID},
+		}
+		ctrl.observeSnapshotCreated(diskId, snapshotId, SnapshotTypeSnapshot, SnapshotTriggerSchedule, involved, err)
+		if err != nil {
+			logging.Errorf("snapshot %s of claim %s/%s err: %v", diskId, namespace, claim.Metadata.Name, err)
+			result.Error = err.Error()
+		} else {
+			logging.Infof("took snapshot %s of %s of claim %s/%s", snapshotId, diskId, namespace, claim.Metadata.Name)
+			result.SnapshotId = snapshotId
+		}
+		results = append(results, result)
+
+		if err := ctrl.pruneSnapshots(ctx, diskId, schedule, retention, now); err != nil {
+			logging.Errorf("delete old snapshots of %s err: %v", diskId, err)
+		}
+	}
+	return results
+}
+
+func hasLabels(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// listSnapshots returns the snapshots of the region matching all filters, the newest first.
+func (ctrl *cbsController) listSnapshots(ctx context.Context, filters ...*cbs.Filter) ([]*cbs.Snapshot, error) {
+	order, orderField := "DESC", "CREATE_TIME"
+	request := cbs.NewDescribeSnapshotsRequest()
+	request.Filters = filters
+	request.Order = &order
+	request.OrderField = &orderField
+	request.Limit = &DescribeDisksPageSize
+
+	var snapshots []*cbs.Snapshot
+	for offset := uint64(0); ; offset += DescribeDisksPageSize {
+		o := offset
+		request.Offset = &o
+
+		if err := ctrl.waitRateLimit(ctx); err != nil {
+			return nil, err
+		}
+		response, err := ctrl.cbsClient.DescribeSnapshots(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, response.Response.SnapshotSet...)
+
+		if len(response.Response.SnapshotSet) < int(DescribeDisksPageSize) {
+			return snapshots, nil
+		}
+	}
+}
+
+// scheduledSnapshotFilters returns the filters of the snapshots taken by the schedule with uid, which
+// carry the tags of the config too, or by any schedule if uid is empty.
+func scheduledSnapshotFilters(tags map[string]string, uid string) []*cbs.Filter {
+	filters := tagFilters(tags)
+	if uid != "" {
+		name := "tag:" + ScheduleUIDTagKey
+		filters = append(filters, &cbs.Filter{Name: &name, Values: []*string{&uid}})
+	} else {
+		name, key := "tag-key", ScheduleUIDTagKey
+		filters = append(filters, &cbs.Filter{Name: &name, Values: []*string{&key}})
+	}
+	return filters
+}
+
+// tagFilters returns the filters of snapshots carrying tags.
+func tagFilters(tags map[string]string) []*cbs.Filter {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var filters []*cbs.Filter
+	for _, key := range keys {
+		name, value := "tag:"+key, tags[key]
+		filters = append(filters, &cbs.Filter{Name: &name, Values: []*string{&value}})
+	}
+	return filters
+}
+
+// pruneSnapshots deletes the snapshots of diskId taken by schedule which are expired by retention.
+func (ctrl *cbsController) pruneSnapshots(ctx context.Context, diskId string, schedule *kube.VolumeSnapshotSchedule, retention snapshotRetention, now time.Time) error {
+	filterName := "disk-id"
+	filters := append(scheduledSnapshotFilters(ctrl.config.Get().Tags, schedule.Metadata.UID), &cbs.Filter{Name: &filterName, Values: []*string{&diskId}})
+	snapshots, err := ctrl.listSnapshots(ctx, filters...)
+	if err != nil {
+		return err
+	}
+
+	prefix := scheduledSnapshotPrefix(schedule)
+
+	var named []*cbs.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotName != nil && strings.HasPrefix(*snapshot.SnapshotName, prefix) {
+			named = append(named, snapshot)
+		}
+	}
+	expired := retention.expired(named, now)
+	err = ctrl.deleteSnapshots(ctx, expired)
+	for _, id := range expired {
+		ctrl.observeSnapshotDeleted(diskId, *id, SnapshotTypeSnapshot, SnapshotTriggerSchedule, err)
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package cbs
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+)
+
+var (
+	// a disk created from a snapshot only shows that cbs restores it, not that the filesystem on it
+	// is intact, so the metrics do not claim the snapshots are verified
+	snapshotRestoreTestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cbs_snapshot_restore_tests_total",
+		Help: "Number of sampled snapshots of the driver a disk was test-created from, by result.",
+	}, []string{"result"})
+
+	snapshotRestoreTestLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cbs_snapshot_restore_test_last_success_timestamp_seconds",
+		Help: "Unix time of the last test creating a disk from a snapshot which became available.",
+	})
+
+	snapshotRestoreTestSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cbs_snapshot_restore_test_seconds",
+		Help: "Seconds the disk of the last successful restore test took to become available.",
+	})
+
+	// results of snapshot verifications
+	VerificationResultSuccess = "success"
+	VerificationResultFailure = "failure"
+
+	// snapshots taken within this long are sampled for verification
+	SnapshotVerifyMaxAge = time.Hour * 24 * 7
+
+	// names of the disks snapshots are test-restored onto start with the prefix
+	VerifyDiskNamePrefix = "csi-verify-"
+)
+
+func init() {
+	prometheus.MustRegister(snapshotRestoreTestsTotal)
+	prometheus.MustRegister(snapshotRestoreTestLastSuccess)
+	prometheus.MustRegister(snapshotRestoreTestSeconds)
+}
+
+// runSnapshotVerification restores a sampled recent snapshot onto a new disk, and deletes the disk,
+// every interval until stopCh is closed. Only the leader verifies snapshots when leader election
+// is enabled.
+func (ctrl *cbsController) runSnapshotVerification(interval time.Duration, stopCh <-chan struct{}) {
+	for {
+		if ctx, cancel, ok := ctrl.leader.termContext(context.Background(), ctrl.config.Get().CreateTimeout+time.Minute); ok {
+			if err := ctrl.verifySnapshot(ctx, time.Now()); err != nil {
+				logging.Errorf("verify snapshot err: %v", err)
+			}
+			cancel()
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// verifySnapshot restores a snapshot of the driver taken within SnapshotVerifyMaxAge, chosen at
+// random, onto a disk of the default disk type in the zone of the controller and reports whether
+// the disk became available. The snapshots of the driver are told apart by the tags of the config.
+func (ctrl *cbsController) verifySnapshot(ctx context.Context, now time.Time) error {
+	cfg := ctrl.config.Get()
+	if len(cfg.Tags) == 0 {
+		return fmt.Errorf("the snapshots of the driver can not be told apart without the tags of the config")
+	}
+
+	filterName := "snapshot-state"
+	filters := append(tagFilters(cfg.Tags), &cbs.Filter{Name: &filterName, Values: []*string{&SnapshotStateNormal}})
+	snapshots, err := ctrl.listSnapshots(ctx, filters...)
+	if err != nil {
+		return err
+	}
+	var recent []*cbs.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.CreateTime == nil || snapshot.SnapshotId == nil {
+			continue
+		}
+		created, err := time.ParseInLocation(CloudTimeFormat, *snapshot.CreateTime, cloudTimeLocation)
+		if err == nil && now.Sub(created) <= SnapshotVerifyMaxAge {
+			recent = append(recent, snapshot)
+		}
+	}
+	if len(recent) == 0 {
+		logging.V(4).Infof("no snapshot taken in the last %v to verify", SnapshotVerifyMaxAge)
+		return nil
+	}
+	snapshot := recent[rand.Intn(len(recent))]
+
+	start := time.Now()
+	diskId, err := ctrl.restoreVerifyDisk(ctx, snapshot, cfg, now)
+	if diskId != "" {
+		defer ctrl.terminateVerifyDisk(diskId)
+	}
+	if err != nil {
+		snapshotRestoreTestsTotal.WithLabelValues(VerificationResultFailure).Inc()
+		return fmt.Errorf("restore snapshot %s of %s err: %v", *snapshot.SnapshotId, stringValue(snapshot.DiskId), err)
+	}
+
+	elapsed := time.Since(start)
+	snapshotRestoreTestsTotal.WithLabelValues(VerificationResultSuccess).Inc()
+	snapshotRestoreTestLastSuccess.Set(float64(time.Now().Unix()))
+	snapshotRestoreTestSeconds.Set(elapsed.Seconds())
+	logging.Infof("restored snapshot %s of %s onto %s in %v", *snapshot.SnapshotId, stringValue(snapshot.DiskId), diskId, elapsed)
+	return nil
+}
+
+// restoreVerifyDisk creates a disk from snapshot and waits until it is usable. It returns the id of
+// the disk, if one was created, also with an error.
+func (ctrl *cbsController) restoreVerifyDisk(ctx context.Context, snapshot *cbs.Snapshot, cfg *Config, now time.Time) (string, error) {
+	diskType := cfg.DiskType
+	sizeGB := uint64(0)
+	if snapshot.DiskSize != nil {
+		sizeGB = *snapshot.DiskSize
+	}
+	if limits, ok := DiskSizeLimits[diskType]; ok && sizeGB < uint64(limits[0]) {
+		sizeGB = uint64(limits[0])
+	}
+	if err := checkRestoreDiskType(snapshot, diskType, sizeGB); err != nil {
+		return "", err
+	}
+
+	name := VerifyDiskNamePrefix + *snapshot.SnapshotId
+	token := fmt.Sprintf("%s-%d", name, now.Unix())
+	request := cbs.NewCreateDisksRequest()
+	request.ClientToken = &token
+	request.DiskName = &name
+	request.DiskType = &diskType
+	request.DiskChargeType = &DiskChargeTypePostPaidByHour
+	request.DiskSize = &sizeGB
+	request.SnapshotId = snapshot.SnapshotId
+	request.Placement = &cbs.Placement{Zone: &ctrl.zone}
+	request.Tags = diskTags(cfg.Tags)
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+	response, err := ctrl.cbsClient.CreateDisks(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("%s", explainCloudError(err))
+	}
+	if len(response.Response.DiskIdSet) == 0 {
+		return "", fmt.Errorf("no disk id in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	diskId := *response.Response.DiskIdSet[0]
+
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ctrl.waitRateLimit(ctx); err != nil {
+				continue
+			}
+			disk, err := describeDisk(ctx, ctrl.cbsClient, diskId)
+			if err != nil {
+				logging.V(4).Infof("describe verify disk %s err: %v", diskId, err)
+				continue
+			}
+			if stringValue(disk.DiskState) == StatusUnattached {
+				return diskId, nil
+			}
+		case <-ctx.Done():
+			return diskId, fmt.Errorf("%s is not usable after %v", diskId, cfg.CreateTimeout)
+		}
+	}
+}
+
+// terminateVerifyDisk terminates a disk a snapshot was restored onto. A disk which could not be
+// terminated is left for the orphans command.
+func (ctrl *cbsController) terminateVerifyDisk(diskId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		logging.Errorf("terminate verify disk %s err: %v", diskId, err)
+		return
+	}
+	request := cbs.NewTerminateDisksRequest()
+	request.DiskIds = []*string{&diskId}
+	if _, err := ctrl.cbsClient.TerminateDisks(ctx, request); err != nil {
+		logging.Errorf("terminate verify disk %s err: %v, delete it by hand or with the orphans command", diskId, err)
+		return
+	}
+	logging.V(4).Infof("terminated verify disk %s", diskId)
+}
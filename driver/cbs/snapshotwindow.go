@@ -0,0 +1,92 @@
+package cbs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+)
+
+// snapshotWindow is a daily time range in UTC scheduled snapshots may be taken in, given as
+// offsets from midnight. It spans midnight when end is before start.
+type snapshotWindow struct {
+	start, end time.Duration
+}
+
+// parseSnapshotWindows parses windows in the form "HH:MM-HH:MM", e.g. "22:00-04:00".
+func parseSnapshotWindows(windows []string) ([]snapshotWindow, error) {
+	var parsed []snapshotWindow
+	for _, w := range windows {
+		parts := strings.Split(w, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid snapshot window %q, must be HH:MM-HH:MM in UTC", w)
+		}
+		start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot window %q, must be HH:MM-HH:MM in UTC", w)
+		}
+		end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+		if err != nil || end.Equal(start) {
+			return nil, fmt.Errorf("invalid snapshot window %q, must be HH:MM-HH:MM in UTC", w)
+		}
+		parsed = append(parsed, snapshotWindow{
+			start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+			end:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		})
+	}
+	return parsed, nil
+}
+
+// inSnapshotWindows reports whether now is in one of windows, always true without windows.
+func inSnapshotWindows(windows []snapshotWindow, now time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	t := now.UTC()
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	for _, w := range windows {
+		if w.start < w.end && offset >= w.start && offset < w.end {
+			return true
+		}
+		if w.start > w.end && (offset >= w.start || offset < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleTiming returns the snapshot windows and the stagger of schedule, those of the config
+// unless the schedule sets its own.
+func scheduleTiming(schedule *kube.VolumeSnapshotSchedule, cfg *Config) ([]snapshotWindow, time.Duration, error) {
+	windows := cfg.SnapshotWindows
+	if len(schedule.Spec.Windows) > 0 {
+		windows = schedule.Spec.Windows
+	}
+	parsed, err := parseSnapshotWindows(windows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stagger := cfg.SnapshotStagger
+	if schedule.Spec.Stagger != "" {
+		stagger, err = time.ParseDuration(schedule.Spec.Stagger)
+		if err != nil || stagger < 0 {
+			return nil, 0, fmt.Errorf("invalid stagger %q, must be a duration, e.g. 30m", schedule.Spec.Stagger)
+		}
+	}
+	return parsed, stagger, nil
+}
+
+// staggerOffset returns how long after the start of a run the claim key is snapshotted, spread
+// over stagger by a hash of the key so a claim keeps its offset from run to run.
+func staggerOffset(key string, stagger time.Duration) time.Duration {
+	seconds := uint64(stagger / time.Second)
+	if seconds == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return time.Duration(uint64(h.Sum32())%seconds) * time.Second
+}
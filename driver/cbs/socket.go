@@ -0,0 +1,111 @@
+package cbs
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+// parseSocketMode parses an octal file mode such as 0660, an empty mode means the umask default.
+func parseSocketMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %s", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// parseSocketOwner parses uid:gid, either may be empty to keep it unchanged. It returns -1 for ids
+// which are not changed, as expected by os.Chown.
+func parseSocketOwner(owner string) (int, int, error) {
+	if owner == "" {
+		return -1, -1, nil
+	}
+
+	parts := strings.Split(owner, ":")
+	if len(parts) != 2 {
+		return -1, -1, fmt.Errorf("invalid socket owner %s, expected uid:gid", owner)
+	}
+
+	ids := []int{-1, -1}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil || id < 0 {
+			return -1, -1, fmt.Errorf("invalid socket owner %s, expected numeric uid:gid", owner)
+		}
+		ids[i] = id
+	}
+	return ids[0], ids[1], nil
+}
+
+// removeStaleSocket removes the socket left at sockPath by a driver which crashed or was killed.
+// A socket another process still accepts connections on is not removed.
+func removeStaleSocket(sockPath string) error {
+	info, err := os.Lstat(sockPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("endpoint %s exists and is not a socket", sockPath)
+	}
+
+	if conn, err := net.DialTimeout("unix", sockPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("endpoint %s is in use by another process", sockPath)
+	}
+
+	logging.Infof("removing stale socket %s", sockPath)
+	return os.Remove(sockPath)
+}
+
+// listenUnix listens on the unix socket sockPath and applies the configured mode and ownership,
+// so that only the intended users, e.g. kubelet or the csi sidecars, can connect.
+func listenUnix(sockPath string, cfg *Config) (net.Listener, error) {
+	mode, err := parseSocketMode(cfg.SocketMode)
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, err := parseSocketOwner(cfg.SocketOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeStaleSocket(sockPath); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(sockPath, uid, gid); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	if mode != 0 {
+		if err := os.Chmod(sockPath, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
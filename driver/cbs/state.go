@@ -0,0 +1,111 @@
+package cbs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+// volumeState is a staged volume as stored in the state file.
+type volumeState struct {
+	StagingPath string   `json:"stagingPath"`
+	ReadOnly    bool     `json:"readOnly,omitempty"`
+	Fstrim      bool     `json:"fstrim,omitempty"`
+	Targets     []string `json:"targets,omitempty"`
+}
+
+// saveLocked writes the tracked volumes to the state file, t.mutex must be held.
+func (t *volumeTracker) saveLocked() {
+	if t.stateFile == "" {
+		return
+	}
+
+	state := map[string]volumeState{}
+	for volumeId, v := range t.volumes {
+		s := volumeState{StagingPath: v.stagingPath, ReadOnly: v.readOnly, Fstrim: v.fstrim}
+		for target := range v.targets {
+			s.Targets = append(s.Targets, target)
+		}
+		state[volumeId] = s
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		logging.Errorf("marshal volume state err: %v", err)
+		return
+	}
+
+	// write to a temporary file first so a crash never leaves a truncated state file
+	tmp := t.stateFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(t.stateFile), 0750); err != nil {
+		logging.Errorf("create directory of state file %s err: %v", t.stateFile, err)
+		return
+	}
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		logging.Errorf("write state file %s err: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, t.stateFile); err != nil {
+		logging.Errorf("rename state file %s err: %v", tmp, err)
+	}
+}
+
+func loadVolumeState(path string) (map[string]volumeState, error) {
+	state := map[string]volumeState{}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// restoreVolumes rebuilds the tracked volumes after the node plugin restarted. Volumes are taken
+// from the state file if their staging path is still mounted, volumes staged by an older version
+// of the driver without a state file are reconstructed from the mount table.
+func (node *cbsNode) restoreVolumes() error {
+	state, err := loadVolumeState(node.volumes.stateFile)
+	if err != nil {
+		logging.Errorf("load state file %s err: %v", node.volumes.stateFile, err)
+		state = map[string]volumeState{}
+	}
+
+	mountPoints, err := node.mounter.List()
+	if err != nil {
+		return err
+	}
+	mounted := map[string]bool{}
+	for _, mp := range mountPoints {
+		mounted[mp.Path] = true
+	}
+
+	for volumeId, s := range state {
+		if !mounted[s.StagingPath] {
+			logging.Infof("volume %s is no longer staged at %s, forgetting it", volumeId, s.StagingPath)
+			continue
+		}
+		v := &stagedVolume{stagingPath: s.StagingPath, readOnly: s.ReadOnly, fstrim: s.Fstrim, targets: map[string]bool{}}
+		for _, target := range s.Targets {
+			if mounted[target] {
+				v.targets[target] = true
+			}
+		}
+		logging.Infof("restored staged volume %s at %s", volumeId, s.StagingPath)
+		node.volumes.add(volumeId, v)
+	}
+
+	return node.recoverStagedVolumes()
+}
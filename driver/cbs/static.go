@@ -0,0 +1,73 @@
+package cbs
+
+import (
+	"fmt"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cvm"
+	cbs "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cbs/v20170312"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// a disk with this tag set to true is never terminated by DeleteVolume, e.g. a disk created by
+	// hand and adopted through a statically provisioned pv
+	RetainTagKey   = "com.tencent.cloud.csi.cbs/retain"
+	RetainTagValue = "true"
+)
+
+func isRetained(disk *cbs.Disk) bool {
+	for _, tag := range disk.Tags {
+		if tag.Key != nil && tag.Value != nil && *tag.Key == RetainTagKey && *tag.Value == RetainTagValue {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceZone returns the zone of instanceId, zones are cached since instances never move.
+func (ctrl *cbsController) instanceZone(ctx context.Context, instanceId string) (string, error) {
+	if zone, ok := ctrl.instances.zone(instanceId); ok {
+		return zone, nil
+	}
+
+	if err := ctrl.waitRateLimit(ctx); err != nil {
+		return "", err
+	}
+
+	request := cvm.NewDescribeInstancesRequest()
+	request.InstanceIds = []*string{&instanceId}
+
+	response, err := ctrl.cbsClient.DescribeInstances(ctx, request)
+	if err != nil {
+		return "", cloudError(codes.Internal, err)
+	}
+
+	for _, instance := range response.Response.InstanceSet {
+		if instance.InstanceId != nil && *instance.InstanceId == instanceId && instance.Placement != nil && instance.Placement.Zone != nil {
+			ctrl.instances.setZone(instanceId, *instance.Placement.Zone)
+			return *instance.Placement.Zone, nil
+		}
+	}
+
+	return "", status.Error(codes.NotFound, fmt.Sprintf("instance %s not found", instanceId))
+}
+
+// checkZone returns a grpc error if disk can not be attached to instanceId because they are in
+// different zones, which happens with statically provisioned pvs without node affinity.
+func (ctrl *cbsController) checkZone(ctx context.Context, disk *cbs.Disk, instanceId string) error {
+	if disk.Placement == nil || disk.Placement.Zone == nil {
+		return nil
+	}
+
+	zone, err := ctrl.instanceZone(ctx, instanceId)
+	if err != nil {
+		return err
+	}
+
+	if zone != *disk.Placement.Zone {
+		return status.Errorf(codes.FailedPrecondition, "disk %s in zone %s can not be attached to instance %s in zone %s", *disk.DiskId, *disk.Placement.Zone, instanceId, zone)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cbs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// serverTLSCredentials returns the credentials of a tcp endpoint listening on address. Clients must
+// present a certificate signed by the client ca when TLSClientCAFile is set, which is required unless
+// the endpoint only listens on loopback, since the csi services change disks without further checks.
+func serverTLSCredentials(cfg *Config, address string) (credentials.TransportCredentials, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, fmt.Errorf("tcp endpoints require a tls certificate and key")
+	}
+	if cfg.TLSClientCAFile == "" && !isLoopbackAddress(address) {
+		return nil, fmt.Errorf("tcp endpoint %s does not listen on loopback, it requires a tls client ca", address)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate %s err: %v", cfg.TLSCertFile, err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		data, err := ioutil.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in tls client ca file %s", cfg.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// isLoopbackAddress reports whether address, a host:port, only listens on a loopback interface.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,31 @@
+package cbs
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+)
+
+var (
+	// topology segment of the availability zone of nodes and disks, kubelet labels the nodes with it
+	TopologyZoneKey = "topology." + DriverName + "/zone"
+)
+
+// volumeZone returns the zone a volume with requirements is created in: the zone of the first
+// preferred topology, e.g. the zone of the node a pod waiting for the volume is scheduled to, else
+// the zone of the first requisite topology, else defaultZone.
+func volumeZone(requirements *csi.TopologyRequirement, defaultZone string) string {
+	if requirements == nil {
+		return defaultZone
+	}
+	for _, topologies := range [][]*csi.Topology{requirements.Preferred, requirements.Requisite} {
+		for _, topology := range topologies {
+			if zone := topology.GetSegments()[TopologyZoneKey]; zone != "" {
+				return zone
+			}
+		}
+	}
+	return defaultZone
+}
+
+func zoneTopology(zone string) []*csi.Topology {
+	return []*csi.Topology{{Segments: map[string]string{TopologyZoneKey: zone}}}
+}
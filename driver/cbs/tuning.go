@@ -0,0 +1,84 @@
+package cbs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	// block device queue settings applied when the volume is staged, passed to the node in volume attributes
+	ReadAheadKBAttr = "readAheadKB"
+	NrRequestsAttr  = "nrRequests"
+	IOSchedulerAttr = "ioScheduler"
+
+	MaxReadAheadKB = 65536
+	MaxNrRequests  = 65536
+
+	// schedulers of single and multi queue kernels
+	IOSchedulers = []string{"none", "mq-deadline", "kyber", "bfq", "noop", "deadline", "cfq"}
+
+	// files under /sys/block/<device>/queue
+	QueueAttrFiles = map[string]string{
+		ReadAheadKBAttr: "read_ahead_kb",
+		NrRequestsAttr:  "nr_requests",
+		IOSchedulerAttr: "scheduler",
+	}
+)
+
+func validateQueueSetting(attr, value string, max int) error {
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > max {
+		return fmt.Errorf("%s must be a number between 0 and %d", attr, max)
+	}
+	return nil
+}
+
+// validateBlockDeviceTuning checks the block device settings of storage class parameters.
+func validateBlockDeviceTuning(parameters map[string]string) error {
+	if err := validateQueueSetting(ReadAheadKBAttr, parameters[ReadAheadKBAttr], MaxReadAheadKB); err != nil {
+		return err
+	}
+	if err := validateQueueSetting(NrRequestsAttr, parameters[NrRequestsAttr], MaxNrRequests); err != nil {
+		return err
+	}
+	if scheduler, ok := parameters[IOSchedulerAttr]; ok {
+		for _, s := range IOSchedulers {
+			if scheduler == s {
+				return nil
+			}
+		}
+		return fmt.Errorf("ioScheduler %s not supported", scheduler)
+	}
+	return nil
+}
+
+// tuneBlockDevice writes the block device settings in attributes to the queue of device. The
+// settings do not survive a detach, so they are applied every time the volume is staged.
+func tuneBlockDevice(device string, attributes map[string]string) error {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	queuePath := path.Join(SysBlockPath, filepath.Base(device), "queue")
+
+	// the scheduler goes first, it resets nr_requests
+	for _, attr := range []string{IOSchedulerAttr, ReadAheadKBAttr, NrRequestsAttr} {
+		value, ok := attributes[attr]
+		if !ok {
+			continue
+		}
+		file := path.Join(queuePath, QueueAttrFiles[attr])
+		logging.Infof("setting %s of %s to %s", QueueAttrFiles[attr], device, value)
+		if err := ioutil.WriteFile(file, []byte(value), 0644); err != nil {
+			return fmt.Errorf("set %s of %s to %s err: %v", QueueAttrFiles[attr], device, value, err)
+		}
+	}
+	return nil
+}
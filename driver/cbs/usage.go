@@ -0,0 +1,51 @@
+package cbs
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+// checkVolumeUsage records a VolumeNearlyFull event on the claim of a staged volume when its
+// utilization reaches cfg.VolumeFullThreshold.
+func (node *cbsNode) checkVolumeUsage() {
+	threshold := node.config.Get().VolumeFullThreshold
+	if node.kubeClient == nil || threshold <= 0 {
+		return
+	}
+
+	type usage struct {
+		stagingPath string
+		nearlyFull  bool
+	}
+	node.volumes.mutex.Lock()
+	volumes := map[string]usage{}
+	for volumeId, v := range node.volumes.volumes {
+		volumes[volumeId] = usage{v.stagingPath, v.nearlyFull}
+	}
+	node.volumes.mutex.Unlock()
+
+	for volumeId, u := range volumes {
+		ratio, err := volumeUtilization(u.stagingPath)
+		if err != nil {
+			logging.V(4).Infof("utilization of volume %s at %s err: %v", volumeId, u.stagingPath, err)
+			continue
+		}
+
+		percent := int(math.Floor(ratio * 100))
+		nearlyFull := ratio >= threshold
+		if nearlyFull && !u.nearlyFull {
+			logging.Warningf("volume %s staged at %s is %d%% full", volumeId, u.stagingPath, percent)
+			node.recordVolumeEvent(u.stagingPath, nil, EventReasonVolumeNearlyFull,
+				fmt.Errorf("volume %s is %d%% full, at or above the threshold of %d%%, expand the volume or free space", volumeId, percent, int(threshold*100)))
+		}
+		u.nearlyFull = nearlyFull
+
+		node.volumes.mutex.Lock()
+		if v, ok := node.volumes.volumes[volumeId]; ok && v.stagingPath == u.stagingPath {
+			v.nearlyFull = u.nearlyFull
+		}
+		node.volumes.mutex.Unlock()
+	}
+}
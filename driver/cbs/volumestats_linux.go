@@ -0,0 +1,205 @@
+//go:build linux
+// +build linux
+
+package cbs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+)
+
+var (
+	ProcDiskStatsPath = "/proc/diskstats"
+
+	volumeStatsLabels = []string{"volume_id", "persistentvolume", "persistentvolumeclaim", "namespace"}
+
+	volumeCapacityBytesDesc  = prometheus.NewDesc("cbs_volume_capacity_bytes", "Capacity in bytes of the filesystem of a staged volume.", volumeStatsLabels, nil)
+	volumeAvailableBytesDesc = prometheus.NewDesc("cbs_volume_available_bytes", "Available bytes of the filesystem of a staged volume.", volumeStatsLabels, nil)
+	volumeUsedBytesDesc      = prometheus.NewDesc("cbs_volume_used_bytes", "Used bytes of the filesystem of a staged volume.", volumeStatsLabels, nil)
+	volumeInodesDesc         = prometheus.NewDesc("cbs_volume_inodes", "Number of inodes of the filesystem of a staged volume.", volumeStatsLabels, nil)
+	volumeInodesUsedDesc     = prometheus.NewDesc("cbs_volume_inodes_used", "Used inodes of the filesystem of a staged volume.", volumeStatsLabels, nil)
+	volumeUtilizationDesc    = prometheus.NewDesc("cbs_volume_utilization_ratio", "Fraction of the bytes or inodes in use, whichever is higher, of the filesystem of a staged volume.", volumeStatsLabels, nil)
+	volumeReadBytesDesc      = prometheus.NewDesc("cbs_volume_read_bytes_total", "Bytes read from the disk of a staged volume.", volumeStatsLabels, nil)
+	volumeWrittenBytesDesc   = prometheus.NewDesc("cbs_volume_written_bytes_total", "Bytes written to the disk of a staged volume.", volumeStatsLabels, nil)
+	volumeIOTimeDesc         = prometheus.NewDesc("cbs_volume_io_time_seconds_total", "Seconds the disk of a staged volume spent doing io.", volumeStatsLabels, nil)
+)
+
+// diskStats are the counters of one block device in /proc/diskstats.
+type diskStats struct {
+	sectorsRead    float64
+	sectorsWritten float64
+	ioTimeMs       float64
+}
+
+func readDiskStats() (map[string]diskStats, error) {
+	data, err := ioutil.ReadFile(ProcDiskStatsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]diskStats{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 13 {
+			continue
+		}
+		var s diskStats
+		s.sectorsRead, _ = strconv.ParseFloat(fields[5], 64)
+		s.sectorsWritten, _ = strconv.ParseFloat(fields[9], 64)
+		s.ioTimeMs, _ = strconv.ParseFloat(fields[12], 64)
+		stats[fields[2]] = s
+	}
+	return stats, nil
+}
+
+// volumeStatsCollector exports usage and io metrics of the volumes staged on this node.
+type volumeStatsCollector struct {
+	node *cbsNode
+}
+
+func registerVolumeStats(node *cbsNode) {
+	prometheus.MustRegister(&volumeStatsCollector{node: node})
+}
+
+func (c *volumeStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- volumeCapacityBytesDesc
+	ch <- volumeAvailableBytesDesc
+	ch <- volumeUsedBytesDesc
+	ch <- volumeInodesDesc
+	ch <- volumeInodesUsedDesc
+	ch <- volumeUtilizationDesc
+	ch <- volumeReadBytesDesc
+	ch <- volumeWrittenBytesDesc
+	ch <- volumeIOTimeDesc
+}
+
+// lookupClaim returns the claim of the pv, nil if it has none, and whether the lookup succeeded.
+func (c *volumeStatsCollector) lookupClaim(pvName string) (*kube.ObjectReference, bool) {
+	if pvName == "" || c.node.kubeClient == nil {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	pv := &kube.PersistentVolume{}
+	if err := c.node.kubeClient.Get(ctx, kube.PersistentVolumePath(pvName), pv); err != nil {
+		logging.V(4).Infof("get pv %s err: %v", pvName, err)
+		return nil, false
+	}
+	return pv.Spec.ClaimRef, true
+}
+
+func (c *volumeStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	type volume struct {
+		stagingPath string
+		claim       *kube.ObjectReference
+		claimKnown  bool
+	}
+	c.node.volumes.mutex.Lock()
+	volumes := map[string]*volume{}
+	for volumeId, v := range c.node.volumes.volumes {
+		volumes[volumeId] = &volume{v.stagingPath, v.claim, v.claimKnown}
+	}
+	c.node.volumes.mutex.Unlock()
+
+	// the claim of a volume is looked up once while it is staged, without holding the lock of the
+	// staged volumes, and forgotten with the volume on unstage
+	for volumeId, v := range volumes {
+		if v.claimKnown {
+			continue
+		}
+		if v.claim, v.claimKnown = c.lookupClaim(pvNameOfPath(v.stagingPath)); !v.claimKnown {
+			continue
+		}
+		c.node.volumes.mutex.Lock()
+		if staged, ok := c.node.volumes.volumes[volumeId]; ok && staged.stagingPath == v.stagingPath {
+			staged.claim, staged.claimKnown = v.claim, true
+		}
+		c.node.volumes.mutex.Unlock()
+	}
+
+	mountPoints, err := c.node.mounter.List()
+	if err != nil {
+		logging.Errorf("list mount points err: %v", err)
+		return
+	}
+	devices := map[string]string{}
+	for _, mp := range mountPoints {
+		devices[mp.Path] = mp.Device
+	}
+
+	stats, err := readDiskStats()
+	if err != nil {
+		logging.Errorf("read disk stats err: %v", err)
+	}
+
+	for volumeId, v := range volumes {
+		stagingPath := v.stagingPath
+		pvName := pvNameOfPath(stagingPath)
+		labels := []string{volumeId, pvName, "", ""}
+		if v.claim != nil {
+			labels[2] = v.claim.Name
+			labels[3] = v.claim.Namespace
+		}
+
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(stagingPath, &fs); err == nil {
+			blockSize := float64(fs.Bsize)
+			ch <- prometheus.MustNewConstMetric(volumeCapacityBytesDesc, prometheus.GaugeValue, float64(fs.Blocks)*blockSize, labels...)
+			ch <- prometheus.MustNewConstMetric(volumeAvailableBytesDesc, prometheus.GaugeValue, float64(fs.Bavail)*blockSize, labels...)
+			ch <- prometheus.MustNewConstMetric(volumeUsedBytesDesc, prometheus.GaugeValue, float64(fs.Blocks-fs.Bfree)*blockSize, labels...)
+			ch <- prometheus.MustNewConstMetric(volumeInodesDesc, prometheus.GaugeValue, float64(fs.Files), labels...)
+			ch <- prometheus.MustNewConstMetric(volumeInodesUsedDesc, prometheus.GaugeValue, float64(fs.Files-fs.Ffree), labels...)
+		} else {
+			logging.V(4).Infof("statfs %s err: %v", stagingPath, err)
+		}
+		if ratio, err := volumeUtilization(stagingPath); err == nil {
+			ch <- prometheus.MustNewConstMetric(volumeUtilizationDesc, prometheus.GaugeValue, ratio, labels...)
+		}
+
+		device, ok := devices[stagingPath]
+		if !ok {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(device); err == nil {
+			device = resolved
+		}
+		if s, ok := stats[filepath.Base(device)]; ok {
+			// diskstats counts 512 byte sectors regardless of the device sector size
+			ch <- prometheus.MustNewConstMetric(volumeReadBytesDesc, prometheus.CounterValue, s.sectorsRead*512, labels...)
+			ch <- prometheus.MustNewConstMetric(volumeWrittenBytesDesc, prometheus.CounterValue, s.sectorsWritten*512, labels...)
+			ch <- prometheus.MustNewConstMetric(volumeIOTimeDesc, prometheus.CounterValue, s.ioTimeMs/1000, labels...)
+		}
+	}
+}
+
+// volumeUtilization returns the fraction of the bytes or inodes in use of the filesystem at path,
+// whichever is higher.
+func volumeUtilization(path string) (float64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+
+	ratio := 0.0
+	// blocks reserved for root are not available to pods, they count as used
+	if usable := fs.Blocks - fs.Bfree + fs.Bavail; usable > 0 {
+		ratio = float64(fs.Blocks-fs.Bfree) / float64(usable)
+	}
+	if fs.Files > 0 {
+		if inodes := float64(fs.Files-fs.Ffree) / float64(fs.Files); inodes > ratio {
+			ratio = inodes
+		}
+	}
+	return ratio, nil
+}
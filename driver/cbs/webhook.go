@@ -0,0 +1,142 @@
+package cbs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/kube"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// webhook validates cbs storage classes and the pvcs provisioned from them at admission time.
+type webhook struct {
+	kubeClient *kube.Client
+	// defaults and pvc annotation overrides of the controller, parameters are validated the way
+	// the controller parses them
+	config *Config
+}
+
+// NewWebhookHandler returns the http handler of the validating admission webhook. kubeClient is
+// used to look up the storage class of a pvc, pvcs are not validated when it is nil.
+func NewWebhookHandler(kubeClient *kube.Client, config *Config) http.Handler {
+	return &webhook{kubeClient: kubeClient, config: config}
+}
+
+func (wh *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &kube.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("invalid admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &kube.AdmissionResponse{
+		UID:     review.Request.UID,
+		Allowed: true,
+	}
+
+	if err := wh.validate(r.Context(), review.Request); err != nil {
+		logging.Infof("reject %s %s: %v", review.Request.Operation, review.Request.Kind.Kind, err)
+		response.Allowed = false
+		response.Result = &kube.Status{
+			Message: err.Error(),
+			Reason:  "Invalid",
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+
+	review.Request = nil
+	review.Response = response
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		logging.Errorf("write admission response err: %v", err)
+	}
+}
+
+func (wh *webhook) validate(ctx context.Context, req *kube.AdmissionRequest) error {
+	switch req.Kind.Kind {
+	case "StorageClass":
+		sc := &kube.StorageClass{}
+		if err := json.Unmarshal(req.Object, sc); err != nil {
+			return err
+		}
+		if sc.Provisioner != DriverName {
+			return nil
+		}
+		if err := ValidateParameters(sc.Parameters, wh.config); err != nil {
+			return fmt.Errorf("invalid parameters of storage class %s: %v", sc.Metadata.Name, err)
+		}
+	case "VolumeSnapshotClass":
+		class := &kube.VolumeSnapshotClass{}
+		if err := json.Unmarshal(req.Object, class); err != nil {
+			return err
+		}
+		if class.Snapshotter != DriverName {
+			return nil
+		}
+		if err := ValidateSnapshotParameters(class.Parameters, wh.config); err != nil {
+			return fmt.Errorf("invalid parameters of volume snapshot class %s: %v", class.Metadata.Name, err)
+		}
+	case "PersistentVolumeClaim":
+		pvc := &kube.PersistentVolumeClaim{}
+		if err := json.Unmarshal(req.Object, pvc); err != nil {
+			return err
+		}
+		return wh.validatePVC(ctx, pvc)
+	}
+	return nil
+}
+
+func (wh *webhook) validatePVC(ctx context.Context, pvc *kube.PersistentVolumeClaim) error {
+	if wh.kubeClient == nil || pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" || pvc.Spec.VolumeName != "" {
+		return nil
+	}
+
+	sc := &kube.StorageClass{}
+	if err := wh.kubeClient.Get(ctx, kube.StorageClassPath(*pvc.Spec.StorageClassName), sc); err != nil {
+		if kube.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if sc.Provisioner != DriverName {
+		return nil
+	}
+
+	parameters := make(map[string]string, len(sc.Parameters))
+	for k, v := range sc.Parameters {
+		parameters[k] = v
+	}
+	if wh.config.PVCAnnotationOverrides {
+		for _, name := range PVCOverridableParameterNames {
+			if v, ok := pvc.Metadata.Annotations[PVCAnnotationPrefix+name]; ok {
+				parameters[name] = v
+			}
+		}
+	}
+
+	if err := ValidateParameters(parameters, wh.config); err != nil {
+		return fmt.Errorf("invalid parameters for pvc %s: %v", pvc.Metadata.Name, err)
+	}
+
+	storage, ok := pvc.Spec.Resources.Requests["storage"]
+	if !ok {
+		return nil
+	}
+	size, err := resource.ParseQuantity(storage)
+	if err != nil {
+		return fmt.Errorf("invalid storage request %q of pvc %s: %v", storage, pvc.Metadata.Name, err)
+	}
+
+	return ValidateDiskSize(parameters, size.Value(), wh.config)
+}
@@ -0,0 +1,234 @@
+package cfs
+
+import (
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/vpc"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// error code of calls on file systems which do not exist
+	CloudAPIFileSystemNotFound = "ResourceNotFound.FileSystemNotFound"
+)
+
+// Credential is a tencent cloud api secret id and key pair.
+type Credential struct {
+	SecretId  string
+	SecretKey string
+}
+
+// cloudClient sends cfs api requests.
+type cloudClient struct {
+	client *common.Client
+}
+
+func newCloudClient(region string, credential Credential) (*cloudClient, error) {
+	client := &common.Client{}
+	client.Init(region).WithSecretId(credential.SecretId, credential.SecretKey).WithProfile(profile.NewClientProfile())
+	return &cloudClient{client: client}, nil
+}
+
+func (c *cloudClient) send(ctx context.Context, request tchttp.Request, response tchttp.Response) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.client.Send(request, response)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return status.Errorf(codes.DeadlineExceeded, "%s: %v", request.GetAction(), ctx.Err())
+	}
+}
+
+func (c *cloudClient) CreateCfsFileSystem(ctx context.Context, request *cfs.CreateCfsFileSystemRequest) (*cfs.CreateCfsFileSystemResponse, error) {
+	response := cfs.NewCreateCfsFileSystemResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteCfsFileSystem(ctx context.Context, request *cfs.DeleteCfsFileSystemRequest) (*cfs.DeleteCfsFileSystemResponse, error) {
+	response := cfs.NewDeleteCfsFileSystemResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeCfsFileSystems(ctx context.Context, request *cfs.DescribeCfsFileSystemsRequest) (*cfs.DescribeCfsFileSystemsResponse, error) {
+	response := cfs.NewDescribeCfsFileSystemsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeMountTargets(ctx context.Context, request *cfs.DescribeMountTargetsRequest) (*cfs.DescribeMountTargetsResponse, error) {
+	response := cfs.NewDescribeMountTargetsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteMountTarget(ctx context.Context, request *cfs.DeleteMountTargetRequest) (*cfs.DeleteMountTargetResponse, error) {
+	response := cfs.NewDeleteMountTargetResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) CreateCfsPGroup(ctx context.Context, request *cfs.CreateCfsPGroupRequest) (*cfs.CreateCfsPGroupResponse, error) {
+	response := cfs.NewCreateCfsPGroupResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeCfsPGroups(ctx context.Context, request *cfs.DescribeCfsPGroupsRequest) (*cfs.DescribeCfsPGroupsResponse, error) {
+	response := cfs.NewDescribeCfsPGroupsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteCfsPGroup(ctx context.Context, request *cfs.DeleteCfsPGroupRequest) (*cfs.DeleteCfsPGroupResponse, error) {
+	response := cfs.NewDeleteCfsPGroupResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) CreateCfsRule(ctx context.Context, request *cfs.CreateCfsRuleRequest) (*cfs.CreateCfsRuleResponse, error) {
+	response := cfs.NewCreateCfsRuleResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeCfsRules(ctx context.Context, request *cfs.DescribeCfsRulesRequest) (*cfs.DescribeCfsRulesResponse, error) {
+	response := cfs.NewDescribeCfsRulesResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) SetUserQuota(ctx context.Context, request *cfs.SetUserQuotaRequest) (*cfs.SetUserQuotaResponse, error) {
+	response := cfs.NewSetUserQuotaResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DeleteUserQuota(ctx context.Context, request *cfs.DeleteUserQuotaRequest) (*cfs.DeleteUserQuotaResponse, error) {
+	response := cfs.NewDeleteUserQuotaResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeUserQuota(ctx context.Context, request *cfs.DescribeUserQuotaRequest) (*cfs.DescribeUserQuotaResponse, error) {
+	response := cfs.NewDescribeUserQuotaResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *cloudClient) DescribeVpcs(ctx context.Context, request *vpc.DescribeVpcsRequest) (*vpc.DescribeVpcsResponse, error) {
+	response := vpc.NewDescribeVpcsResponse()
+	if err := c.send(ctx, request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// describeFileSystem returns the file system fsId, a NotFound error if it does not exist.
+func (c *cloudClient) describeFileSystem(ctx context.Context, fsId string) (*cfs.FileSystemInfo, error) {
+	request := cfs.NewDescribeCfsFileSystemsRequest()
+	request.FileSystemId = &fsId
+	response, err := c.DescribeCfsFileSystems(ctx, request)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "file system %s not found", fsId)
+		}
+		return nil, cloudError(codes.Internal, err)
+	}
+	for _, fs := range response.Response.FileSystems {
+		if stringValue(fs.FileSystemId) == fsId {
+			return fs, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "file system %s not found, request id %s", fsId, requestIdOf(response.Response.RequestId))
+}
+
+// mountTarget returns the mount target nodes mount the file system fsId through.
+func (c *cloudClient) mountTarget(ctx context.Context, fsId string) (*cfs.MountInfo, error) {
+	request := cfs.NewDescribeMountTargetsRequest()
+	request.FileSystemId = &fsId
+	response, err := c.DescribeMountTargets(ctx, request)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	for _, target := range response.Response.MountTargets {
+		if target.IpAddress != nil && *target.IpAddress != "" {
+			return target, nil
+		}
+	}
+	return nil, status.Errorf(codes.Internal, "file system %s has no mount target, request id %s", fsId, requestIdOf(response.Response.RequestId))
+}
+
+// cloudError returns a status error with code for err of a cloud api call, errors which already are
+// status errors are returned unchanged.
+func cloudError(code codes.Code, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(code, err.Error())
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*errors.TencentCloudSDKError)
+	return ok && e.Code == CloudAPIFileSystemNotFound
+}
+
+// requestIdOf returns the request id of a cloud api response, or unknown if the response has none.
+func requestIdOf(requestId *string) string {
+	if requestId == nil || *requestId == "" {
+		return "unknown"
+	}
+	return *requestId
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// fileSystemTags returns tags as the resource tags of a new file system.
+func fileSystemTags(tags map[string]string) []*cfs.TagInfo {
+	var infos []*cfs.TagInfo
+	for key, value := range tags {
+		k, v := key, value
+		infos = append(infos, &cfs.TagInfo{TagKey: &k, TagValue: &v})
+	}
+	return infos
+}
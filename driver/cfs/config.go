@@ -0,0 +1,79 @@
+package cfs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config holds the driver settings, set by flags at startup.
+type Config struct {
+	// vpc and subnet the mount targets of new file systems are created in, unless the storage class
+	// sets them
+	VpcId    string
+	SubnetId string
+
+	// permission group of new file systems, which decides the clients allowed to mount them, empty
+	// to create one for every file system
+	PGroupId string
+
+	// what deleting a volume does to its file system or subdirectory, unless the storage class sets
+	// it
+	Reclaim       string
+	SubdirReclaim string
+
+	// range of the groups whose quotas limit subdirectories, it must not overlap with the groups
+	// pods run as
+	QuotaGidMin int
+	QuotaGidMax int
+
+	// address to serve prometheus metrics at, disabled if empty
+	MetricsAddress string
+
+	// directory the controller mounts the file systems volumes are subdirectories of in
+	WorkDir string
+
+	// tags attached to every file system created by the driver
+	Tags map[string]string
+
+	// how long to wait for a new file system to become available, and the interval between two
+	// checks while waiting
+	CreateTimeout time.Duration
+	PollInterval  time.Duration
+}
+
+// DefaultConfig returns the config used when flags do not override it.
+func DefaultConfig() *Config {
+	return &Config{
+		Reclaim:       ReclaimDelete,
+		SubdirReclaim: ReclaimArchive,
+		QuotaGidMin:   50000,
+		QuotaGidMax:   59999,
+		WorkDir:       "/var/lib/csi-cfs",
+		Tags:          map[string]string{},
+		CreateTimeout: time.Minute * 5,
+		PollInterval:  time.Second * 3,
+	}
+}
+
+func (cfg *Config) validate() error {
+	if cfg.CreateTimeout <= 0 {
+		return fmt.Errorf("create timeout must be positive")
+	}
+	if cfg.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive")
+	}
+	if !isValidReclaim(cfg.Reclaim, FileSystemReclaims) {
+		return fmt.Errorf("reclaim of file systems must be one of %s", strings.Join(FileSystemReclaims, ", "))
+	}
+	if !isValidReclaim(cfg.SubdirReclaim, SubdirReclaims) {
+		return fmt.Errorf("reclaim of subdirectories must be one of %s", strings.Join(SubdirReclaims, ", "))
+	}
+	if cfg.QuotaGidMin <= 0 || cfg.QuotaGidMax < cfg.QuotaGidMin {
+		return fmt.Errorf("quota gid range %d-%d not valid", cfg.QuotaGidMin, cfg.QuotaGidMax)
+	}
+	if cfg.WorkDir == "" {
+		return fmt.Errorf("work dir must be set")
+	}
+	return nil
+}
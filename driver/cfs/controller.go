@@ -0,0 +1,334 @@
+package cfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// attributes of a volume passed to the node, where to mount it from
+	HostAttr = "host"
+	FSIDAttr = "fsid"
+	PathAttr = "path"
+	// protocol nodes mount the volume with, TURBO or an nfs version, empty for nfs 4.0
+	ProtocolVolumeAttr = "protocol"
+
+	NetInterfaceVPC = "VPC"
+	NetInterfaceCCN = "CCN"
+
+	ProtocolNFS   = "NFS"
+	ProtocolTurbo = "TURBO"
+
+	// standard and high performance storage, and their turbo variants
+	StorageTypeSD = "SD"
+	StorageTypeHP = "HP"
+	StorageTypeTB = "TB"
+	StorageTypeTP = "TP"
+
+	GiB int64 = 1 << 30
+
+	// cfs file system states
+	LifeCycleStateCreating     = "creating"
+	LifeCycleStateCreateFailed = "create_failed"
+	LifeCycleStateAvailable    = "available"
+)
+
+type cfsController struct {
+	cloud  *cloudClient
+	zone   string
+	config *Config
+	// roots of the file systems volumes are subdirectories of
+	shared *sharedMounts
+	// serializes allocating the quota groups of subdirectories
+	gidMutex sync.Mutex
+}
+
+func newCfsController(cloud *cloudClient, zone string, config *Config) (*cfsController, error) {
+	return &cfsController{cloud: cloud, zone: zone, config: config, shared: newSharedMounts(config.WorkDir)}, nil
+}
+
+// CreateVolume creates a cfs file system named after the volume and waits until it and its mount
+// target are available. The name is the client token of the call, so retries return the same file
+// system. Without a permission group the volume gets one of its own, allowing the vpc by default.
+// With a fileSystemId parameter the volume is a subdirectory of that file system instead.
+func (ctrl *cfsController) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume name is empty")
+	}
+	if len(req.VolumeCapabilities) <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume has no capabilities")
+	}
+	for _, c := range req.VolumeCapabilities {
+		if c.GetBlock() != nil {
+			return nil, status.Error(codes.InvalidArgument, "block volume is not supported")
+		}
+	}
+
+	p, err := parseCreateParameters(req.Parameters, ctrl.config)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if p.fileSystemId != "" {
+		return ctrl.createSubdirVolume(ctx, req, p)
+	}
+
+	cfg := ctrl.config
+	if p.protocol == ProtocolNFS && (p.vpcId == "" || p.subnetId == "") {
+		return nil, status.Errorf(codes.FailedPrecondition, "vpc and subnet of new file systems are unknown, set %s and %s or start the controller with --vpc_id and --subnet_id", VpcIdAttr, SubnetIdAttr)
+	}
+
+	var capacity int64
+	if req.CapacityRange != nil {
+		capacity = req.CapacityRange.RequiredBytes
+	}
+
+	pgroupId := p.pgroupId
+	if pgroupId == "" {
+		pgroupId, err = ctrl.ensureVolumePGroup(ctx, req.Name, p.vpcId, p.rule)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	request := cfs.NewCreateCfsFileSystemRequest()
+	request.ClientToken = &req.Name
+	request.FsName = &req.Name
+	request.Zone = &ctrl.zone
+	request.Protocol = &p.protocol
+	request.StorageType = &p.storageType
+	request.PGroupId = &pgroupId
+	tags := provisionedTags(cfg.Tags)
+	tags[ReclaimTagKey] = p.reclaim
+	request.ResourceTags = fileSystemTags(tags)
+	if p.protocol == ProtocolTurbo {
+		// turbo file systems are sized up front, in GiB
+		if capacity <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s file systems need a capacity", ProtocolTurbo)
+		}
+		gib := uint64((capacity + GiB - 1) / GiB)
+		capacity = int64(gib) * GiB
+		request.NetInterface = &NetInterfaceCCN
+		request.CcnId = &p.ccnId
+		request.CidrBlock = &p.cidrBlock
+		request.Capacity = &gib
+	} else {
+		request.NetInterface = &NetInterfaceVPC
+		request.VpcId = &p.vpcId
+		request.SubnetId = &p.subnetId
+	}
+
+	response, err := ctrl.cloud.CreateCfsFileSystem(ctx, request)
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	if response.Response.FileSystemId == nil {
+		return nil, status.Errorf(codes.Internal, "no file system id in response, request id %s", requestIdOf(response.Response.RequestId))
+	}
+	fsId := *response.Response.FileSystemId
+	logging.Infof("created %s %s file system %s for volume %s", p.protocol, p.storageType, fsId, req.Name)
+
+	if err := ctrl.waitFileSystem(ctx, fsId); err != nil {
+		return nil, err
+	}
+
+	target, err := ctrl.cloud.mountTarget(ctx, fsId)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{
+		HostAttr: stringValue(target.IpAddress),
+		FSIDAttr: stringValue(target.FSID),
+		PathAttr: "/",
+	}
+	if p.mountProtocol != "" {
+		attributes[ProtocolVolumeAttr] = p.mountProtocol
+	} else if p.protocol != ProtocolNFS {
+		attributes[ProtocolVolumeAttr] = p.protocol
+	}
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			Id:            fsId,
+			CapacityBytes: capacity,
+			Attributes:    attributes,
+		},
+	}, nil
+}
+
+// waitFileSystem waits until the file system fsId is available.
+func (ctrl *cfsController) waitFileSystem(ctx context.Context, fsId string) error {
+	ticker := time.NewTicker(ctrl.config.PollInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithTimeout(ctx, ctrl.config.CreateTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ticker.C:
+			fs, err := ctrl.cloud.describeFileSystem(ctx, fsId)
+			if err != nil {
+				logging.V(4).Infof("describe file system %s err: %v", fsId, err)
+				continue
+			}
+			switch state := stringValue(fs.LifeCycleState); state {
+			case LifeCycleStateAvailable:
+				return nil
+			case LifeCycleStateCreateFailed:
+				return status.Errorf(codes.Internal, "file system %s failed to create", fsId)
+			}
+		case <-ctx.Done():
+			return status.Errorf(codes.DeadlineExceeded, "file system %s is not available after %v", fsId, ctrl.config.CreateTimeout)
+		}
+	}
+}
+
+// DeleteVolume deletes the mount targets of the file system, which older file systems can not be
+// deleted with, the file system and the permission group created for it. A file system which does
+// not exist is deleted, one not created by the driver, e.g. of a statically provisioned volume, or
+// with the retain reclaim is kept. The subdirectory of a volume provisioned on a shared file system
+// is archived, deleted or kept by the reclaim in its volume id instead.
+func (ctrl *cfsController) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
+	}
+	if fsId, _, ok := parseStaticVolumeId(req.VolumeId); ok {
+		logging.Infof("volume %s is statically provisioned, keeping file system %s", req.VolumeId, fsId)
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+	fsId, subdir, reclaim := parseVolumeId(req.VolumeId)
+	if subdir == "" && reclaim != "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid volume id %s", req.VolumeId)
+	}
+	if subdir != "" {
+		if err := ctrl.deleteSubdirVolume(ctx, fsId, subdir, reclaim); err != nil {
+			return nil, err
+		}
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	fs, err := ctrl.cloud.describeFileSystem(ctx, fsId)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			logging.Infof("file system %s not found, assuming it is deleted", fsId)
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+		return nil, err
+	}
+	if !isProvisioned(fs) {
+		logging.Infof("file system %s was not created by %s, keeping it", fsId, DriverName)
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+	if fileSystemReclaim(fs) == ReclaimRetain {
+		logging.Infof("file system %s has tag %s=%s, keeping it", fsId, ReclaimTagKey, ReclaimRetain)
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
+	if err := ctrl.deleteMountTargets(ctx, fsId); err != nil {
+		return nil, err
+	}
+
+	request := cfs.NewDeleteCfsFileSystemRequest()
+	request.FileSystemId = &fsId
+	if _, err := ctrl.cloud.DeleteCfsFileSystem(ctx, request); err != nil && !isNotFound(err) {
+		return nil, cloudError(codes.Internal, err)
+	}
+	logging.Infof("deleted file system %s", fsId)
+
+	ctrl.deleteVolumePGroup(ctx, fs)
+
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+func (ctrl *cfsController) deleteMountTargets(ctx context.Context, fsId string) error {
+	request := cfs.NewDescribeMountTargetsRequest()
+	request.FileSystemId = &fsId
+	response, err := ctrl.cloud.DescribeMountTargets(ctx, request)
+	if err != nil {
+		return cloudError(codes.Internal, err)
+	}
+	for _, target := range response.Response.MountTargets {
+		if target.MountTargetId == nil {
+			continue
+		}
+		deleteRequest := cfs.NewDeleteMountTargetRequest()
+		deleteRequest.FileSystemId = &fsId
+		deleteRequest.MountTargetId = target.MountTargetId
+		if _, err := ctrl.cloud.DeleteMountTarget(ctx, deleteRequest); err != nil {
+			return cloudError(codes.Internal, err)
+		}
+		logging.Infof("deleted mount target %s of file system %s", *target.MountTargetId, fsId)
+	}
+	return nil
+}
+
+func (ctrl *cfsController) ControllerPublishVolume(context.Context, *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (ctrl *cfsController) ControllerUnpublishVolume(context.Context, *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (ctrl *cfsController) ControllerGetCapabilities(context.Context, *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
+	return &csi.ControllerGetCapabilitiesResponse{
+		Capabilities: []*csi.ControllerServiceCapability{
+			{
+				Type: &csi.ControllerServiceCapability_Rpc{
+					Rpc: &csi.ControllerServiceCapability_RPC{
+						Type: csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// ValidateVolumeCapabilities supports every access mode of mounted volumes, nfs is shared by nodes.
+func (ctrl *cfsController) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
+	}
+	if len(req.VolumeCapabilities) <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume has no capabilities")
+	}
+
+	fsId := volumeFileSystemId(req.VolumeId)
+	if _, err := ctrl.cloud.describeFileSystem(ctx, fsId); err != nil {
+		return nil, err
+	}
+
+	for _, c := range req.VolumeCapabilities {
+		if c.GetBlock() != nil {
+			return &csi.ValidateVolumeCapabilitiesResponse{Supported: false, Message: "block volume is not supported"}, nil
+		}
+	}
+	return &csi.ValidateVolumeCapabilitiesResponse{Supported: true}, nil
+}
+
+func (ctrl *cfsController) ListVolumes(context.Context, *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (ctrl *cfsController) GetCapacity(context.Context, *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (ctrl *cfsController) CreateSnapshot(context.Context, *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (ctrl *cfsController) DeleteSnapshot(context.Context, *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (ctrl *cfsController) ListSnapshots(context.Context, *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
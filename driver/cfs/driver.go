@@ -0,0 +1,112 @@
+package cfs
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/redact"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var (
+	DriverName     = "com.tencent.cloud.csi.cfs"
+	DriverVerision = "0.1.0"
+)
+
+type Driver struct {
+	region     string
+	zone       string
+	credential Credential
+	config     *Config
+}
+
+// NewDriver creates the cfs driver, config holds the defaults of the file systems it creates.
+func NewDriver(region string, zone string, credential Credential, config *Config) (*Driver, error) {
+	if credential.SecretId == "" || credential.SecretKey == "" {
+		return nil, fmt.Errorf("no tencent cloud credential specified")
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	driver := Driver{
+		zone:       zone,
+		region:     region,
+		credential: credential,
+		config:     config,
+	}
+
+	return &driver, nil
+}
+
+func (drv *Driver) Run(endpoint *url.URL) error {
+	logging.Infof("starting %s %s", DriverName, DriverVerision)
+
+	redact.AddSecret(drv.credential.SecretId)
+	redact.AddSecret(drv.credential.SecretKey)
+
+	// tencent cloud sdk dumps every http request and response to the standard logger
+	log.SetFlags(0)
+	log.SetOutput(redact.LogWriter{V: 5})
+
+	cloud, err := newCloudClient(drv.region, drv.credential)
+	if err != nil {
+		return err
+	}
+
+	controller, err := newCfsController(cloud, drv.zone, drv.config)
+	if err != nil {
+		return err
+	}
+
+	if address := drv.config.MetricsAddress; address != "" {
+		registerSubdirQuotaMetrics(controller)
+		go serveMetrics(address)
+	}
+
+	identity, err := newCfsIdentity()
+	if err != nil {
+		return err
+	}
+
+	node, err := newCfsNode(cloud, drv.config)
+	if err != nil {
+		return err
+	}
+
+	logGRPC := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		logging.V(4).Infof("GRPC call: %s, request: %+v", info.FullMethod, req)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			logging.Errorf("GRPC call: %s, error: %v", info.FullMethod, err)
+		} else {
+			logging.V(4).Infof("GRPC call: %s, response: %+v", info.FullMethod, resp)
+		}
+		return resp, err
+	}
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(logGRPC))
+
+	csi.RegisterControllerServer(srv, controller)
+	csi.RegisterIdentityServer(srv, identity)
+	csi.RegisterNodeServer(srv, node)
+
+	sockPath := path.Join(endpoint.Host, endpoint.Path)
+	if err := os.Remove(sockPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(listener)
+}
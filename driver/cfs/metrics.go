@@ -0,0 +1,23 @@
+package cfs
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+var (
+	MetricsPath = "/metrics"
+)
+
+// serveMetrics serves the prometheus metrics of the driver at address until the process exits.
+func serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, prometheus.UninstrumentedHandler())
+
+	logging.Infof("serving metrics at %s%s", address, MetricsPath)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logging.Errorf("serve metrics err: %v", err)
+	}
+}
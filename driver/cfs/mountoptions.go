@@ -0,0 +1,98 @@
+package cfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// values of the protocol parameter mounting nfs file systems with another nfs version than 4.0
+	ProtocolNFSv3  = "NFSv3"
+	ProtocolNFSv41 = "NFSv4.1"
+
+	// options of the nfs mounts of each protocol, noresvport lets the client reconnect from a new
+	// port after the mount target failed over, nfsv3 locks are not supported by cfs
+	NFSMountOptions = map[string][]string{
+		ProtocolNFS:    {"vers=4.0", "noresvport"},
+		ProtocolNFSv3:  {"vers=3", "nolock", "proto=tcp", "noresvport"},
+		ProtocolNFSv41: {"vers=4.1", "noresvport"},
+	}
+
+	// nfs mount options which contradict each other, one of a group set by the volume replaces the
+	// others of the defaults
+	ConflictingMountOptions = [][]string{
+		{"ro", "rw"},
+		{"hard", "soft"},
+		{"sync", "async"},
+		{"lock", "nolock"},
+		{"resvport", "noresvport"},
+		{"ac", "noac"},
+	}
+
+	// names of the same nfs mount option
+	MountOptionAliases = map[string]string{
+		"nfsvers": "vers",
+	}
+)
+
+// mountOptionKey returns what an nfs mount option sets, options setting the same thing replace
+// each other.
+func mountOptionKey(option string) string {
+	key := strings.SplitN(option, "=", 2)[0]
+	if alias, ok := MountOptionAliases[key]; ok {
+		key = alias
+	}
+	for _, group := range ConflictingMountOptions {
+		for _, o := range group {
+			if o == key {
+				return group[0]
+			}
+		}
+	}
+	return key
+}
+
+// mergeMountOptions returns defaults with options from the volume, e.g. the mount options of its
+// storage class such as rsize, wsize, hard or timeo, appended. An option of the volume replaces
+// the defaults setting the same thing, so vers=3 overrides the default version.
+func mergeMountOptions(defaults, options []string) ([]string, error) {
+	set := map[string]string{}
+	var volumeOptions []string
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		if strings.ContainsAny(option, " \t\n") {
+			return nil, fmt.Errorf("mount option %q not valid", option)
+		}
+		key := mountOptionKey(option)
+		if previous, ok := set[key]; ok {
+			if previous == option {
+				continue
+			}
+			return nil, fmt.Errorf("mount options %s and %s conflict with each other", previous, option)
+		}
+		set[key] = option
+		volumeOptions = append(volumeOptions, option)
+	}
+
+	var result []string
+	for _, option := range defaults {
+		if _, ok := set[mountOptionKey(option)]; !ok {
+			result = append(result, option)
+		}
+	}
+	return append(result, volumeOptions...), nil
+}
+
+// mountOptionValue returns the value of the option setting key, empty if none does.
+func mountOptionValue(options []string, key string) string {
+	for _, option := range options {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) == 2 && mountOptionKey(kv[0]) == key {
+			return kv[1]
+		}
+	}
+	return ""
+}
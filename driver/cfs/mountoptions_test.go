@@ -0,0 +1,40 @@
+package cfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMountOptions(t *testing.T) {
+	defaults := NFSMountOptions[ProtocolNFSv3]
+
+	tests := []struct {
+		name     string
+		defaults []string
+		options  []string
+		want     []string
+		wantErr  bool
+	}{
+		{"defaults only", defaults, nil, []string{"vers=3", "nolock", "proto=tcp", "noresvport"}, false},
+		{"appended", defaults, []string{"rsize=1048576", "hard"}, []string{"vers=3", "nolock", "proto=tcp", "noresvport", "rsize=1048576", "hard"}, false},
+		{"replaces the same option", defaults, []string{"proto=udp"}, []string{"vers=3", "nolock", "noresvport", "proto=udp"}, false},
+		{"replaces the contradicting option", defaults, []string{"lock", "resvport"}, []string{"vers=3", "proto=tcp", "lock", "resvport"}, false},
+		{"replaces aliases", NFSMountOptions[ProtocolNFS], []string{"nfsvers=4.1"}, []string{"noresvport", "nfsvers=4.1"}, false},
+		{"blank and duplicate options", defaults, []string{" ", "hard", " hard "}, []string{"vers=3", "nolock", "proto=tcp", "noresvport", "hard"}, false},
+		{"conflicting options", defaults, []string{"hard", "soft"}, nil, true},
+		{"conflicting values", defaults, []string{"vers=3", "nfsvers=4.0"}, nil, true},
+		{"whitespace in option", defaults, []string{"rsize=1 wsize=2"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := mergeMountOptions(test.defaults, test.options)
+			if gotErr := err != nil; gotErr != test.wantErr {
+				t.Fatalf("err %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("options %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package cfs
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/dbdd4us/qcloudapi-sdk-go/metadata"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+var (
+	// turbo file systems are mounted with the lustre client
+	TurboFsType = "lustre"
+)
+
+type cfsNode struct {
+	// resolves where to mount statically provisioned volumes from
+	cloud          *cloudClient
+	metadataClient *metadata.MetaData
+	mounter        mount.Interface
+	config         *Config
+}
+
+func newCfsNode(cloud *cloudClient, config *Config) (*cfsNode, error) {
+	return &cfsNode{
+		cloud:          cloud,
+		metadataClient: metadata.NewMetaData(http.DefaultClient),
+		mounter:        mount.New(""),
+		config:         config,
+	}, nil
+}
+
+func (node *cfsNode) NodeStageVolume(context.Context, *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (node *cfsNode) NodeUnstageVolume(context.Context, *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// NodePublishVolume mounts the file system at the target path of the pod over nfs, or with the
+// lustre client for turbo file systems, every pod has a mount of its own. Volumes without a host,
+// provisioned statically, are looked up by their file system.
+func (node *cfsNode) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
+	}
+	if req.TargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume target path is empty")
+	}
+	if req.VolumeCapability == nil || req.VolumeCapability.GetMount() == nil {
+		return nil, status.Error(codes.InvalidArgument, "volume access type is not mount")
+	}
+
+	attributes := req.VolumeAttributes
+	if attributes[HostAttr] == "" {
+		var err error
+		if attributes, err = node.staticVolumeAttributes(ctx, req.VolumeId, attributes); err != nil {
+			return nil, cloudError(codes.Internal, err)
+		}
+	}
+	host := attributes[HostAttr]
+	path := attributes[PathAttr]
+	if path == "" {
+		path = "/"
+	}
+	fsid := attributes[FSIDAttr]
+
+	protocol := attributes[ProtocolVolumeAttr]
+	if protocol == "" {
+		protocol = ProtocolNFS
+	}
+	var defaults []string
+	if protocol != ProtocolTurbo {
+		var ok bool
+		if defaults, ok = NFSMountOptions[protocol]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "volume protocol %s not supported", protocol)
+		}
+	}
+
+	volumeOptions := req.VolumeCapability.GetMount().MountFlags
+	if req.Readonly {
+		volumeOptions = append(append([]string{}, volumeOptions...), "ro")
+	}
+	options, err := mergeMountOptions(defaults, volumeOptions)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	source, fsType := fmt.Sprintf("%s:%s", host, path), "nfs"
+	switch {
+	case protocol == ProtocolTurbo:
+		if fsid == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "volume attribute %s of %s volume is empty", FSIDAttr, protocol)
+		}
+		source = fmt.Sprintf("%s@tcp0:/%s/cfs%s", host, fsid, strings.TrimSuffix(path, "/"))
+		fsType = TurboFsType
+	case strings.HasPrefix(mountOptionValue(options, "vers"), "3"):
+		// nfsv3 exports the file system under its fsid rather than at the root
+		if fsid == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "volume attribute %s is empty, the volume can not be mounted with nfsv3", FSIDAttr)
+		}
+		source = fmt.Sprintf("%s:/%s%s", host, fsid, strings.TrimSuffix(path, "/"))
+	}
+	target := req.TargetPath
+
+	notMounted, err := node.mounter.IsLikelyNotMountPoint(target)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if err := os.MkdirAll(target, 0750); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		notMounted = true
+	}
+	if !notMounted {
+		logging.Infof("volume %s is already mounted at %s", req.VolumeId, target)
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if err := node.mounter.Mount(source, target, fsType, options); err != nil {
+		return nil, status.Errorf(codes.Internal, "mount %s at %s err: %v", source, target, err)
+	}
+	logging.Infof("mounted volume %s from %s at %s", req.VolumeId, source, target)
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+func (node *cfsNode) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	if req.TargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume target path is empty")
+	}
+
+	// unpublish may be retried after the unmount succeeded, only unmount actual mount points
+	notMounted, err := node.mounter.IsLikelyNotMountPoint(req.TargetPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err == nil && !notMounted {
+		if err := node.mounter.Unmount(req.TargetPath); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if err := os.Remove(req.TargetPath); err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+func (node *cfsNode) NodeGetId(context.Context, *csi.NodeGetIdRequest) (*csi.NodeGetIdResponse, error) {
+	nodeId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &csi.NodeGetIdResponse{
+		NodeId: nodeId,
+	}, nil
+}
+
+func (node *cfsNode) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{}, nil
+}
+
+func (node *cfsNode) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	nodeId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &csi.NodeGetInfoResponse{
+		NodeId: nodeId,
+	}, nil
+}
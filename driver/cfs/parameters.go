@@ -0,0 +1,235 @@
+package cfs
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// storage class parameters deciding the clients allowed to mount new file systems, either an
+	// existing permission group or the rule of a permission group created for the volume
+	PGroupIdAttr       = "pgroupId"
+	AllowedCidrAttr    = "allowedCidr"
+	RWPermissionAttr   = "rwPermission"
+	UserPermissionAttr = "userPermission"
+
+	RWPermissionRW = "RW"
+	RWPermissionRO = "RO"
+
+	UserPermissionAllSquash    = "all_squash"
+	UserPermissionNoAllSquash  = "no_all_squash"
+	UserPermissionRootSquash   = "root_squash"
+	UserPermissionNoRootSquash = "no_root_squash"
+
+	// client ip of a rule allowing every client
+	AllowedCidrAll = "*"
+
+	// access rule parameters
+	AccessRuleAttrs = []string{AllowedCidrAttr, RWPermissionAttr, UserPermissionAttr}
+
+	// storage class parameters of the kind of new file systems, turbo file systems are attached to a
+	// cidr block of a ccn
+	StorageTypeAttr = "storageType"
+	ProtocolAttr    = "protocol"
+	CcnIdAttr       = "ccnId"
+	CidrBlockAttr   = "cidrBlock"
+
+	// storage types of each protocol, the first is the default
+	ProtocolStorageTypes = map[string][]string{
+		ProtocolNFS:   {StorageTypeSD, StorageTypeHP},
+		ProtocolTurbo: {StorageTypeTB, StorageTypeTP},
+	}
+
+	// storage class parameters of the vpc and subnet the mount target of a new file system is
+	// created in, overriding those of the controller
+	VpcIdAttr    = "vpcId"
+	SubnetIdAttr = "subnetId"
+
+	// parameters of new file systems, which do not apply to subdirectory volumes
+	FileSystemAttrs = append([]string{PGroupIdAttr, StorageTypeAttr, CcnIdAttr, CidrBlockAttr, VpcIdAttr, SubnetIdAttr}, AccessRuleAttrs...)
+)
+
+// accessRule is the rule of the permission group created for a volume.
+type accessRule struct {
+	// an ip, cidr or * for every client, empty for the cidr of the vpc of the file system
+	allowedCidr    string
+	rwPermission   string
+	userPermission string
+}
+
+// createParameters are the file system options parsed from storage class parameters.
+type createParameters struct {
+	// file system the volume is a subdirectory of, empty to create a file system for the volume
+	fileSystemId string
+	protocol     string
+	storageType  string
+	// nfs version nodes mount the volume with, empty for the default of protocol
+	mountProtocol string
+	// ccn and cidr block of turbo file systems
+	ccnId     string
+	cidrBlock string
+	// vpc and subnet of the mount target, the vpc also is the default range of access rules
+	vpcId    string
+	subnetId string
+	// what deleting the volume does, one of FileSystemReclaims or SubdirReclaims
+	reclaim string
+	// existing permission group of the file system, empty to create one with rule
+	pgroupId string
+	rule     *accessRule
+}
+
+// parseCreateParameters parses and validates storage class parameters, falling back to cfg for
+// omitted ones. Access rule parameters create a permission group for the volume even if cfg has a
+// permission group, and without either the group allows the vpc of the file system.
+func parseCreateParameters(parameters map[string]string, cfg *Config) (*createParameters, error) {
+	p := &createParameters{fileSystemId: parameters[FileSystemIdAttr]}
+
+	if p.fileSystemId != "" {
+		for _, attr := range FileSystemAttrs {
+			if _, ok := parameters[attr]; ok {
+				return nil, fmt.Errorf("%s does not apply to volumes on the existing file system %s", attr, p.fileSystemId)
+			}
+		}
+		p.reclaim = cfg.SubdirReclaim
+		if reclaim, ok := parameters[ReclaimAttr]; ok {
+			p.reclaim = reclaim
+		}
+		if !isValidReclaim(p.reclaim, SubdirReclaims) {
+			return nil, fmt.Errorf("%s of volumes on the existing file system %s must be one of %s", ReclaimAttr, p.fileSystemId, strings.Join(SubdirReclaims, ", "))
+		}
+		if protocol, ok := parameters[ProtocolAttr]; ok {
+			if _, ok := NFSMountOptions[protocol]; !ok {
+				return nil, fmt.Errorf("%s of volumes on the existing file system %s must be %s, %s or %s", ProtocolAttr, p.fileSystemId, ProtocolNFS, ProtocolNFSv3, ProtocolNFSv41)
+			}
+			if protocol != ProtocolNFS {
+				p.mountProtocol = protocol
+			}
+		}
+		return p, nil
+	}
+
+	if err := p.parseFileSystemKind(parameters); err != nil {
+		return nil, err
+	}
+
+	p.reclaim = cfg.Reclaim
+	if reclaim, ok := parameters[ReclaimAttr]; ok {
+		p.reclaim = reclaim
+	}
+	if !isValidReclaim(p.reclaim, FileSystemReclaims) {
+		return nil, fmt.Errorf("%s of file systems must be one of %s", ReclaimAttr, strings.Join(FileSystemReclaims, ", "))
+	}
+
+	// a subnet is in one vpc, so the two are set together
+	_, hasVpc := parameters[VpcIdAttr]
+	_, hasSubnet := parameters[SubnetIdAttr]
+	if hasVpc != hasSubnet {
+		return nil, fmt.Errorf("%s and %s must be set together", VpcIdAttr, SubnetIdAttr)
+	}
+	p.vpcId, p.subnetId = cfg.VpcId, cfg.SubnetId
+	if hasVpc {
+		p.vpcId, p.subnetId = parameters[VpcIdAttr], parameters[SubnetIdAttr]
+		if p.vpcId == "" || p.subnetId == "" {
+			return nil, fmt.Errorf("%s or %s is empty", VpcIdAttr, SubnetIdAttr)
+		}
+	}
+
+	hasRule := false
+	for _, attr := range AccessRuleAttrs {
+		if _, ok := parameters[attr]; ok {
+			hasRule = true
+		}
+	}
+	_, hasPGroup := parameters[PGroupIdAttr]
+
+	if hasPGroup {
+		if hasRule {
+			return nil, fmt.Errorf("%s can not be set together with access rules", PGroupIdAttr)
+		}
+		p.pgroupId = parameters[PGroupIdAttr]
+		if p.pgroupId == "" {
+			return nil, fmt.Errorf("%s is empty", PGroupIdAttr)
+		}
+		return p, nil
+	}
+	if !hasRule && cfg.PGroupId != "" {
+		p.pgroupId = cfg.PGroupId
+		return p, nil
+	}
+
+	rule := &accessRule{
+		allowedCidr:    parameters[AllowedCidrAttr],
+		rwPermission:   RWPermissionRW,
+		userPermission: UserPermissionNoRootSquash,
+	}
+	if rule.allowedCidr != "" && rule.allowedCidr != AllowedCidrAll {
+		if _, _, err := net.ParseCIDR(rule.allowedCidr); err != nil && net.ParseIP(rule.allowedCidr) == nil {
+			return nil, fmt.Errorf("%s %s is neither an ip nor a cidr", AllowedCidrAttr, rule.allowedCidr)
+		}
+	}
+	if rw, ok := parameters[RWPermissionAttr]; ok {
+		if rw != RWPermissionRW && rw != RWPermissionRO {
+			return nil, fmt.Errorf("%s must be %s or %s", RWPermissionAttr, RWPermissionRW, RWPermissionRO)
+		}
+		rule.rwPermission = rw
+	}
+	if user, ok := parameters[UserPermissionAttr]; ok {
+		switch user {
+		case UserPermissionAllSquash, UserPermissionNoAllSquash, UserPermissionRootSquash, UserPermissionNoRootSquash:
+		default:
+			return nil, fmt.Errorf("%s must be one of %s, %s, %s or %s", UserPermissionAttr,
+				UserPermissionAllSquash, UserPermissionNoAllSquash, UserPermissionRootSquash, UserPermissionNoRootSquash)
+		}
+		rule.userPermission = user
+	}
+	p.rule = rule
+
+	return p, nil
+}
+
+// parseFileSystemKind parses the protocol and storage type of a new file system, and the ccn a
+// turbo file system is attached to.
+func (p *createParameters) parseFileSystemKind(parameters map[string]string) error {
+	p.protocol = ProtocolNFS
+	if protocol, ok := parameters[ProtocolAttr]; ok {
+		p.protocol = protocol
+	}
+	// nfs file systems mounted with another nfs version
+	if p.protocol == ProtocolNFSv3 || p.protocol == ProtocolNFSv41 {
+		p.protocol, p.mountProtocol = ProtocolNFS, p.protocol
+	}
+	storageTypes, ok := ProtocolStorageTypes[p.protocol]
+	if !ok {
+		return fmt.Errorf("%s must be %s, %s, %s or %s", ProtocolAttr, ProtocolNFS, ProtocolNFSv3, ProtocolNFSv41, ProtocolTurbo)
+	}
+
+	p.storageType = storageTypes[0]
+	if storageType, ok := parameters[StorageTypeAttr]; ok {
+		p.storageType = storageType
+	}
+	valid := false
+	for _, t := range storageTypes {
+		if t == p.storageType {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%s of %s file systems must be %s", StorageTypeAttr, p.protocol, strings.Join(storageTypes, " or "))
+	}
+
+	p.ccnId, p.cidrBlock = parameters[CcnIdAttr], parameters[CidrBlockAttr]
+	if p.protocol != ProtocolTurbo {
+		if p.ccnId != "" || p.cidrBlock != "" {
+			return fmt.Errorf("%s and %s only apply to %s file systems", CcnIdAttr, CidrBlockAttr, ProtocolTurbo)
+		}
+		return nil
+	}
+	if p.ccnId == "" || p.cidrBlock == "" {
+		return fmt.Errorf("%s file systems need %s and %s", ProtocolTurbo, CcnIdAttr, CidrBlockAttr)
+	}
+	if _, _, err := net.ParseCIDR(p.cidrBlock); err != nil {
+		return fmt.Errorf("%s %s is not a cidr", CidrBlockAttr, p.cidrBlock)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package cfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/vpc"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// priority of the only rule of a permission group created for a volume
+	AccessRulePriority int64 = 1
+)
+
+// volumePGroupDescription is the description of the permission group created for the volume name,
+// which tells it apart from groups of the same name created by users.
+func volumePGroupDescription(name string) string {
+	return fmt.Sprintf("created by %s for volume %s", DriverName, name)
+}
+
+// ensureVolumePGroup returns the permission group created for the volume name, creating it with
+// rule if it does not exist. The group is named after the volume, so retries find the same group.
+// A rule without a range allows the vpc vpcId.
+func (ctrl *cfsController) ensureVolumePGroup(ctx context.Context, name, vpcId string, rule *accessRule) (string, error) {
+	group, err := ctrl.findVolumePGroup(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	var pgroupId string
+	if group != nil {
+		pgroupId = stringValue(group.PGroupId)
+	} else {
+		description := volumePGroupDescription(name)
+		request := cfs.NewCreateCfsPGroupRequest()
+		request.Name = &name
+		request.DescInfo = &description
+		response, err := ctrl.cloud.CreateCfsPGroup(ctx, request)
+		if err != nil {
+			return "", cloudError(codes.Internal, err)
+		}
+		if response.Response.PGroupId == nil {
+			return "", status.Errorf(codes.Internal, "no permission group id in response, request id %s", requestIdOf(response.Response.RequestId))
+		}
+		pgroupId = *response.Response.PGroupId
+		logging.Infof("created permission group %s for volume %s", pgroupId, name)
+	}
+
+	rulesRequest := cfs.NewDescribeCfsRulesRequest()
+	rulesRequest.PGroupId = &pgroupId
+	rulesResponse, err := ctrl.cloud.DescribeCfsRules(ctx, rulesRequest)
+	if err != nil {
+		return "", cloudError(codes.Internal, err)
+	}
+	if len(rulesResponse.Response.RuleList) > 0 {
+		return pgroupId, nil
+	}
+
+	allowedCidr := rule.allowedCidr
+	if allowedCidr == "" {
+		if vpcId == "" {
+			return "", status.Errorf(codes.FailedPrecondition, "vpc is unknown, set %s or %s, or start the controller with --vpc_id", VpcIdAttr, AllowedCidrAttr)
+		}
+		allowedCidr, err = ctrl.vpcCidr(ctx, vpcId)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	request := cfs.NewCreateCfsRuleRequest()
+	request.PGroupId = &pgroupId
+	request.AuthClientIp = &allowedCidr
+	request.Priority = &AccessRulePriority
+	request.RWPermission = &rule.rwPermission
+	request.UserPermission = &rule.userPermission
+	if _, err := ctrl.cloud.CreateCfsRule(ctx, request); err != nil {
+		return "", cloudError(codes.Internal, err)
+	}
+	logging.Infof("permission group %s of volume %s allows %s %s %s", pgroupId, name, allowedCidr, rule.rwPermission, rule.userPermission)
+
+	return pgroupId, nil
+}
+
+// findVolumePGroup returns the permission group created for the volume name, nil if there is none.
+func (ctrl *cfsController) findVolumePGroup(ctx context.Context, name string) (*cfs.PGroupInfo, error) {
+	response, err := ctrl.cloud.DescribeCfsPGroups(ctx, cfs.NewDescribeCfsPGroupsRequest())
+	if err != nil {
+		return nil, cloudError(codes.Internal, err)
+	}
+	description := volumePGroupDescription(name)
+	for _, group := range response.Response.PGroupList {
+		if stringValue(group.Name) == name && stringValue(group.DescInfo) == description {
+			return group, nil
+		}
+	}
+	return nil, nil
+}
+
+// vpcCidr returns the cidr block of the vpc vpcId, the range new file systems are locked down to
+// when the storage class does not set one.
+func (ctrl *cfsController) vpcCidr(ctx context.Context, vpcId string) (string, error) {
+	request := vpc.NewDescribeVpcsRequest()
+	request.VpcIds = []*string{&vpcId}
+	response, err := ctrl.cloud.DescribeVpcs(ctx, request)
+	if err != nil {
+		return "", cloudError(codes.Internal, err)
+	}
+	for _, v := range response.Response.VpcSet {
+		if stringValue(v.VpcId) == vpcId && stringValue(v.CidrBlock) != "" {
+			return *v.CidrBlock, nil
+		}
+	}
+	return "", status.Errorf(codes.Internal, "cidr of vpc %s not found, request id %s", vpcId, requestIdOf(response.Response.RequestId))
+}
+
+// deleteVolumePGroup deletes the permission group created for the deleted file system fs, once the
+// file system is gone since groups in use can not be deleted. Groups not created for the volume are
+// kept. Failures are logged only, the file system is deleted and a retry would not find the group.
+func (ctrl *cfsController) deleteVolumePGroup(ctx context.Context, fs *cfs.FileSystemInfo) {
+	if fs.PGroup == nil || fs.PGroup.PGroupId == nil {
+		return
+	}
+	pgroupId, name := *fs.PGroup.PGroupId, stringValue(fs.FsName)
+	group, err := ctrl.findVolumePGroup(ctx, name)
+	if err != nil {
+		logging.Warningf("find permission group of volume %s err: %v, delete %s manually if it was created for the volume", name, err, pgroupId)
+		return
+	}
+	if group == nil || stringValue(group.PGroupId) != pgroupId {
+		return
+	}
+
+	if err := ctrl.waitFileSystemDeleted(ctx, stringValue(fs.FileSystemId)); err != nil {
+		logging.Warningf("%v, delete permission group %s of volume %s manually", err, pgroupId, name)
+		return
+	}
+
+	request := cfs.NewDeleteCfsPGroupRequest()
+	request.PGroupId = &pgroupId
+	if _, err := ctrl.cloud.DeleteCfsPGroup(ctx, request); err != nil {
+		logging.Warningf("delete permission group %s of volume %s err: %v, delete it manually", pgroupId, name, err)
+		return
+	}
+	logging.Infof("deleted permission group %s of volume %s", pgroupId, name)
+}
+
+// waitFileSystemDeleted waits until the file system fsId does not exist.
+func (ctrl *cfsController) waitFileSystemDeleted(ctx context.Context, fsId string) error {
+	ticker := time.NewTicker(ctrl.config.PollInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithTimeout(ctx, ctrl.config.CreateTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := ctrl.cloud.describeFileSystem(ctx, fsId)
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			if err != nil {
+				logging.V(4).Infof("describe file system %s err: %v", fsId, err)
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("file system %s still exists after %v", fsId, ctrl.config.CreateTimeout)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package cfs
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// subdirectories are limited by a quota of a group of their own, new files inherit the group of
+	// the subdirectory through its setgid bit
+	QuotaUserTypeGid = "Gid"
+
+	SubdirQuotaMode = SubdirMode | os.ModeSetgid
+
+	// prefix of the error codes of quota calls on file systems which do not support quotas
+	CloudAPIUnsupportedOperation = "UnsupportedOperation"
+
+	// page size of quota listings
+	QuotaPageSize uint64 = 100
+
+	subdirQuotaLabels = []string{"file_system_id", "persistentvolume"}
+
+	subdirQuotaBytesDesc = prometheus.NewDesc("cfs_subdir_volume_quota_bytes", "Quota in bytes of the subdirectory of a volume on a shared file system.", subdirQuotaLabels, nil)
+	subdirUsedBytesDesc  = prometheus.NewDesc("cfs_subdir_volume_used_bytes", "Used bytes of the subdirectory of a volume on a shared file system.", subdirQuotaLabels, nil)
+	subdirUsedFilesDesc  = prometheus.NewDesc("cfs_subdir_volume_used_files", "Number of files in the subdirectory of a volume on a shared file system.", subdirQuotaLabels, nil)
+)
+
+func isQuotaUnsupported(err error) bool {
+	e, ok := err.(*errors.TencentCloudSDKError)
+	return ok && strings.HasPrefix(e.Code, CloudAPIUnsupportedOperation)
+}
+
+// subdirGids returns the groups in the quota gid range of the subdirectories in root, by group.
+func (ctrl *cfsController) subdirGids(root string) (map[int]string, error) {
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	gids := map[int]string{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if gid, ok := fileGid(info); ok && gid >= ctrl.config.QuotaGidMin && gid <= ctrl.config.QuotaGidMax {
+			gids[gid] = info.Name()
+		}
+	}
+	return gids, nil
+}
+
+// allocateGid returns the group of the subdirectory name in root, the group it already has if it
+// is in the quota gid range, or else an unused one, starting at a hash of the name.
+func (ctrl *cfsController) allocateGid(root, name string) (int, error) {
+	gids, err := ctrl.subdirGids(root)
+	if err != nil {
+		return 0, err
+	}
+	for gid, subdir := range gids {
+		if subdir == name {
+			return gid, nil
+		}
+	}
+
+	min, max := ctrl.config.QuotaGidMin, ctrl.config.QuotaGidMax
+	size := max - min + 1
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	start := int(h.Sum32() % uint32(size))
+	for i := 0; i < size; i++ {
+		gid := min + (start+i)%size
+		if _, ok := gids[gid]; !ok {
+			return gid, nil
+		}
+	}
+	return 0, fmt.Errorf("all gids from %d to %d are in use", min, max)
+}
+
+// setSubdirQuota limits the subdirectory name in root of the file system fsId to capacity bytes,
+// rounded up to GiB, if the file system supports quotas. It returns whether the quota is enforced.
+func (ctrl *cfsController) setSubdirQuota(ctx context.Context, fsId, root, name string, capacity int64) (bool, error) {
+	if capacity <= 0 {
+		return false, nil
+	}
+	dir := filepath.Join(root, name)
+
+	// subdirectories created at the same time must get different groups
+	ctrl.gidMutex.Lock()
+	gid, err := ctrl.allocateGid(root, name)
+	if err == nil {
+		if err = os.Chown(dir, -1, gid); err == nil {
+			err = os.Chmod(dir, SubdirQuotaMode)
+		}
+	}
+	ctrl.gidMutex.Unlock()
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "set group of subdirectory %s of file system %s err: %v", name, fsId, err)
+	}
+
+	limit := uint64((capacity + GiB - 1) / GiB)
+	userId := strconv.Itoa(gid)
+	request := cfs.NewSetUserQuotaRequest()
+	request.FileSystemId = &fsId
+	request.UserType = &QuotaUserTypeGid
+	request.UserId = &userId
+	request.CapacityHardLimit = &limit
+	if _, err := ctrl.cloud.SetUserQuota(ctx, request); err != nil {
+		if isQuotaUnsupported(err) {
+			logging.Infof("file system %s does not support quotas, subdirectory %s is not limited: %v", fsId, name, err)
+			return false, nil
+		}
+		return false, cloudError(codes.Internal, err)
+	}
+	logging.Infof("limited subdirectory %s of file system %s to %d GiB with the quota of gid %d", name, fsId, limit, gid)
+	return true, nil
+}
+
+// deleteSubdirQuota deletes the quota of the subdirectory dir of the file system fsId, if it has one.
+// Failures are logged only, a quota left behind limits a group no other subdirectory gets.
+func (ctrl *cfsController) deleteSubdirQuota(ctx context.Context, fsId, dir string) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+	gid, ok := fileGid(info)
+	if !ok || gid < ctrl.config.QuotaGidMin || gid > ctrl.config.QuotaGidMax {
+		return
+	}
+
+	userId := strconv.Itoa(gid)
+	request := cfs.NewDeleteUserQuotaRequest()
+	request.FileSystemId = &fsId
+	request.UserType = &QuotaUserTypeGid
+	request.UserId = &userId
+	if _, err := ctrl.cloud.DeleteUserQuota(ctx, request); err != nil {
+		if !isQuotaUnsupported(err) {
+			logging.Warningf("delete quota of gid %d of file system %s err: %v", gid, fsId, err)
+		}
+		return
+	}
+	logging.Infof("deleted quota of gid %d of file system %s", gid, fsId)
+}
+
+// subdirQuotaCollector exports the quota and usage of the subdirectory volumes on the file systems
+// mounted by the controller. The csi spec the driver implements has no NodeGetVolumeStats, so the
+// usage of subdirectories, which statfs on nodes reports for the whole file system, is exported
+// here instead.
+type subdirQuotaCollector struct {
+	ctrl *cfsController
+}
+
+func registerSubdirQuotaMetrics(ctrl *cfsController) {
+	prometheus.MustRegister(&subdirQuotaCollector{ctrl: ctrl})
+}
+
+func (c *subdirQuotaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- subdirQuotaBytesDesc
+	ch <- subdirUsedBytesDesc
+	ch <- subdirUsedFilesDesc
+}
+
+func (c *subdirQuotaCollector) Collect(ch chan<- prometheus.Metric) {
+	c.ctrl.shared.mutex.Lock()
+	roots := map[string]string{}
+	for fsId, root := range c.ctrl.shared.roots {
+		roots[fsId] = root
+	}
+	c.ctrl.shared.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	for fsId, root := range roots {
+		gids, err := c.ctrl.subdirGids(root)
+		if err != nil {
+			logging.V(4).Infof("list subdirectories of file system %s err: %v", fsId, err)
+			continue
+		}
+		quotas, err := c.ctrl.userQuotas(ctx, fsId)
+		if err != nil {
+			logging.V(4).Infof("list quotas of file system %s err: %v", fsId, err)
+			continue
+		}
+		for _, quota := range quotas {
+			if stringValue(quota.UserType) != QuotaUserTypeGid {
+				continue
+			}
+			gid, err := strconv.Atoi(stringValue(quota.UserId))
+			if err != nil {
+				continue
+			}
+			subdir, ok := gids[gid]
+			if !ok || strings.HasPrefix(subdir, ArchivedSubdirPrefix) {
+				continue
+			}
+			labels := []string{fsId, subdir}
+			if quota.CapacityHardLimit != nil {
+				ch <- prometheus.MustNewConstMetric(subdirQuotaBytesDesc, prometheus.GaugeValue, float64(*quota.CapacityHardLimit)*float64(GiB), labels...)
+			}
+			if quota.CapacityUsed != nil {
+				ch <- prometheus.MustNewConstMetric(subdirUsedBytesDesc, prometheus.GaugeValue, float64(*quota.CapacityUsed)*float64(GiB), labels...)
+			}
+			if quota.FileUsed != nil {
+				ch <- prometheus.MustNewConstMetric(subdirUsedFilesDesc, prometheus.GaugeValue, float64(*quota.FileUsed), labels...)
+			}
+		}
+	}
+}
+
+// userQuotas returns all quotas of the file system fsId.
+func (ctrl *cfsController) userQuotas(ctx context.Context, fsId string) ([]*cfs.UserQuota, error) {
+	var quotas []*cfs.UserQuota
+	for offset := uint64(0); ; offset += QuotaPageSize {
+		o := offset
+		request := cfs.NewDescribeUserQuotaRequest()
+		request.FileSystemId = &fsId
+		request.Offset = &o
+		request.Limit = &QuotaPageSize
+		response, err := ctrl.cloud.DescribeUserQuota(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, response.Response.UserQuotaInfo...)
+		if uint64(len(response.Response.UserQuotaInfo)) < QuotaPageSize {
+			return quotas, nil
+		}
+	}
+}
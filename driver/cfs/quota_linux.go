@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package cfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileGid returns the group of the file info is of.
+func fileGid(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Gid), true
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package cfs
+
+import (
+	"os"
+)
+
+// the controller mounts shared file systems on linux only, groups of files are not needed elsewhere.
+
+func fileGid(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,42 @@
+package cfs
+
+import (
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+)
+
+var (
+	// storage class parameter deciding what deleting a volume does to its data
+	ReclaimAttr = "reclaim"
+
+	// delete the file system or subdirectory, keep it, or rename the subdirectory aside
+	ReclaimDelete  = "delete"
+	ReclaimRetain  = "retain"
+	ReclaimArchive = "archive"
+
+	// reclaims of each kind of volume, a file system has nothing to archive it in
+	FileSystemReclaims = []string{ReclaimDelete, ReclaimRetain}
+	SubdirReclaims     = []string{ReclaimArchive, ReclaimDelete, ReclaimRetain}
+
+	// tag of the reclaim of a file system created by the driver, which may be changed to retain to
+	// keep the file system once its volume is deleted
+	ReclaimTagKey = DriverName + "/reclaim"
+)
+
+func isValidReclaim(reclaim string, reclaims []string) bool {
+	for _, r := range reclaims {
+		if r == reclaim {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSystemReclaim returns the reclaim of the file system fs, delete if it has no reclaim tag.
+func fileSystemReclaim(fs *cfs.FileSystemInfo) string {
+	for _, tag := range fs.Tags {
+		if stringValue(tag.TagKey) == ReclaimTagKey && stringValue(tag.TagValue) != "" {
+			return *tag.TagValue
+		}
+	}
+	return ReclaimDelete
+}
@@ -0,0 +1,93 @@
+package cfs
+
+import (
+	"path"
+	"strings"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+	"golang.org/x/net/context"
+)
+
+var (
+	// separates the file system of a statically provisioned volume from the path mounted, e.g.
+	// cfs-xxxxxxxx:/data
+	StaticVolumeSeparator = ":"
+
+	// tag of the file systems created by the driver, file systems without it are owned by someone
+	// else and never deleted
+	ProvisionedTagKey   = DriverName + "/provisioned"
+	ProvisionedTagValue = "true"
+)
+
+// parseStaticVolumeId returns the file system and path of a statically provisioned volume, ok is
+// false if the id is not one.
+func parseStaticVolumeId(volumeId string) (fsId, p string, ok bool) {
+	parts := strings.SplitN(volumeId, StaticVolumeSeparator, 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], path.Clean("/" + parts[1]), true
+}
+
+// volumeFileSystemId returns the file system of a volume of any kind.
+func volumeFileSystemId(volumeId string) string {
+	if fsId, _, ok := parseStaticVolumeId(volumeId); ok {
+		return fsId
+	}
+	fsId, _, _ := parseVolumeId(volumeId)
+	return fsId
+}
+
+// provisionedTags returns tags with the tag marking file systems created by the driver.
+func provisionedTags(tags map[string]string) map[string]string {
+	provisioned := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		provisioned[k] = v
+	}
+	provisioned[ProvisionedTagKey] = ProvisionedTagValue
+	return provisioned
+}
+
+// isProvisioned returns whether the file system fs was created by the driver.
+func isProvisioned(fs *cfs.FileSystemInfo) bool {
+	for _, tag := range fs.Tags {
+		if stringValue(tag.TagKey) == ProvisionedTagKey && stringValue(tag.TagValue) == ProvisionedTagValue {
+			return true
+		}
+	}
+	return false
+}
+
+// staticVolumeAttributes returns the attributes of a statically provisioned volume, whose
+// persistent volume names the file system only, completed with where to mount it from. The path
+// attribute takes precedence over the path of the volume id.
+func (node *cfsNode) staticVolumeAttributes(ctx context.Context, volumeId string, attributes map[string]string) (map[string]string, error) {
+	fsId, p, ok := parseStaticVolumeId(volumeId)
+	if !ok {
+		fsId, p = volumeFileSystemId(volumeId), "/"
+	}
+	if attributes[PathAttr] != "" {
+		p = attributes[PathAttr]
+	}
+
+	fs, err := node.cloud.describeFileSystem(ctx, fsId)
+	if err != nil {
+		return nil, err
+	}
+	target, err := node.cloud.mountTarget(ctx, fsId)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]string, len(attributes)+4)
+	for k, v := range attributes {
+		resolved[k] = v
+	}
+	resolved[HostAttr] = stringValue(target.IpAddress)
+	resolved[FSIDAttr] = stringValue(target.FSID)
+	resolved[PathAttr] = p
+	if protocol := stringValue(fs.Protocol); protocol != "" && protocol != ProtocolNFS {
+		resolved[ProtocolVolumeAttr] = protocol
+	}
+	return resolved, nil
+}
@@ -0,0 +1,27 @@
+package cfs
+
+import "testing"
+
+func TestParseStaticVolumeId(t *testing.T) {
+	tests := []struct {
+		volumeId string
+		wantFsId string
+		wantPath string
+		wantOk   bool
+	}{
+		{"cfs-1a2b3c4d:/data", "cfs-1a2b3c4d", "/data", true},
+		{"cfs-1a2b3c4d:data/app/", "cfs-1a2b3c4d", "/data/app", true},
+		{"cfs-1a2b3c4d:", "cfs-1a2b3c4d", "/", true},
+		{"cfs-1a2b3c4d:/../../etc", "cfs-1a2b3c4d", "/etc", true},
+		{"cfs-1a2b3c4d:/a:b", "cfs-1a2b3c4d", "/a:b", true},
+		{"cfs-1a2b3c4d", "", "", false},
+		{"cfs-1a2b3c4d/pvc-1", "", "", false},
+	}
+
+	for _, test := range tests {
+		fsId, p, ok := parseStaticVolumeId(test.volumeId)
+		if fsId != test.wantFsId || p != test.wantPath || ok != test.wantOk {
+			t.Errorf("parseStaticVolumeId(%q) = %q, %q, %v, want %q, %q, %v", test.volumeId, fsId, p, ok, test.wantFsId, test.wantPath, test.wantOk)
+		}
+	}
+}
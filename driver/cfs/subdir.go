@@ -0,0 +1,225 @@
+package cfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/cfs"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+var (
+	// storage class parameter naming an existing file system volumes are provisioned as
+	// subdirectories of instead of file systems of their own
+	FileSystemIdAttr = "fileSystemId"
+
+	// subdirectories of deleted volumes are renamed to the prefix, their name and the deletion time
+	ArchivedSubdirPrefix = "archived-"
+
+	ArchivedSubdirTimeFormat = "20060102-150405"
+
+	// mode of new subdirectories, pods of any uid may write them like the volume of a file system
+	SubdirMode os.FileMode = 0777
+)
+
+// subdirVolumeId returns the id of the volume in subdir of the file system fsId, followed by the
+// reclaim of the volume unless it is archive, since DeleteVolume gets nothing but the id.
+func subdirVolumeId(fsId, subdir, reclaim string) string {
+	if reclaim == ReclaimArchive {
+		return fsId + "/" + subdir
+	}
+	return fsId + "/" + subdir + "/" + reclaim
+}
+
+// parseVolumeId returns the file system of a volume, its subdirectory and the reclaim of the
+// subdirectory, empty for volumes which are file systems of their own.
+func parseVolumeId(volumeId string) (fsId, subdir, reclaim string) {
+	parts := strings.SplitN(volumeId, "/", 3)
+	switch len(parts) {
+	case 1:
+		return parts[0], "", ""
+	case 2:
+		return parts[0], parts[1], ReclaimArchive
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// sharedMounts keeps the roots of the file systems volumes are subdirectories of mounted on the
+// controller, at a directory named after the file system in workDir.
+type sharedMounts struct {
+	mutex   sync.Mutex
+	mounter mount.Interface
+	workDir string
+	roots   map[string]string
+}
+
+func newSharedMounts(workDir string) *sharedMounts {
+	return &sharedMounts{mounter: mount.New(""), workDir: workDir, roots: map[string]string{}}
+}
+
+// root returns where the root of the file system fsId is mounted, mounting it from host unless it
+// already is, e.g. by the controller before a restart.
+func (m *sharedMounts) root(fsId, host string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if root, ok := m.roots[fsId]; ok {
+		return root, nil
+	}
+
+	root := filepath.Join(m.workDir, fsId)
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return "", err
+	}
+	notMounted, err := m.mounter.IsLikelyNotMountPoint(root)
+	if err != nil {
+		return "", err
+	}
+	if notMounted {
+		source := fmt.Sprintf("%s:/", host)
+		if err := m.mounter.Mount(source, root, "nfs", NFSMountOptions[ProtocolNFS]); err != nil {
+			return "", fmt.Errorf("mount %s at %s err: %v", source, root, err)
+		}
+		logging.Infof("mounted file system %s from %s at %s", fsId, source, root)
+	}
+	m.roots[fsId] = root
+	return root, nil
+}
+
+// sharedRoot returns where the root of the file system fsId is mounted on the controller, and the
+// mount target it is mounted through.
+func (ctrl *cfsController) sharedRoot(ctx context.Context, fsId string) (string, *cfs.MountInfo, error) {
+	target, err := ctrl.cloud.mountTarget(ctx, fsId)
+	if err != nil {
+		return "", nil, err
+	}
+	root, err := ctrl.shared.root(fsId, stringValue(target.IpAddress))
+	if err != nil {
+		return "", nil, status.Errorf(codes.Internal, "mount file system %s err: %v", fsId, err)
+	}
+	return root, target, nil
+}
+
+// createSubdirVolume provisions the volume as a subdirectory named after it of the file system of
+// p, mounted by nodes with the nfs version of p, and limits it to the requested capacity if the file
+// system supports quotas.
+func (ctrl *cfsController) createSubdirVolume(ctx context.Context, req *csi.CreateVolumeRequest, p *createParameters) (*csi.CreateVolumeResponse, error) {
+	fsId := p.fileSystemId
+	fs, err := ctrl.cloud.describeFileSystem(ctx, fsId)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, status.Errorf(codes.InvalidArgument, "file system %s of %s not found", fsId, FileSystemIdAttr)
+		}
+		return nil, err
+	}
+	// the controller mounts the shared file system over nfs
+	if protocol := stringValue(fs.Protocol); protocol != ProtocolNFS {
+		return nil, status.Errorf(codes.InvalidArgument, "file system %s of %s is %s, only %s file systems can be shared", fsId, FileSystemIdAttr, protocol, ProtocolNFS)
+	}
+
+	root, target, err := ctrl.sharedRoot(ctx, fsId)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(root, req.Name)
+	if err := os.Mkdir(dir, SubdirMode); err != nil && !os.IsExist(err) {
+		return nil, status.Errorf(codes.Internal, "create subdirectory %s of file system %s err: %v", req.Name, fsId, err)
+	}
+	// the mode of mkdir is masked by the umask
+	if err := os.Chmod(dir, SubdirMode); err != nil {
+		return nil, status.Errorf(codes.Internal, "chmod subdirectory %s of file system %s err: %v", req.Name, fsId, err)
+	}
+	logging.Infof("created subdirectory %s of file system %s", req.Name, fsId)
+
+	var capacity int64
+	if req.CapacityRange != nil {
+		capacity = req.CapacityRange.RequiredBytes
+	}
+	enforced, err := ctrl.setSubdirQuota(ctx, fsId, root, req.Name, capacity)
+	if err != nil {
+		return nil, err
+	}
+	if enforced {
+		// quotas are whole GiB
+		capacity = (capacity + GiB - 1) / GiB * GiB
+	}
+	attributes := map[string]string{
+		HostAttr: stringValue(target.IpAddress),
+		FSIDAttr: stringValue(target.FSID),
+		PathAttr: "/" + req.Name,
+	}
+	if p.mountProtocol != "" {
+		attributes[ProtocolVolumeAttr] = p.mountProtocol
+	}
+	return &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{
+			Id:            subdirVolumeId(fsId, req.Name, p.reclaim),
+			CapacityBytes: capacity,
+			Attributes:    attributes,
+		},
+	}, nil
+}
+
+// deleteSubdirVolume archives the subdirectory subdir of the file system fsId by renaming it, so the
+// data of a volume deleted by accident can be recovered, or deletes or keeps it by reclaim. A
+// subdirectory which does not exist is deleted.
+func (ctrl *cfsController) deleteSubdirVolume(ctx context.Context, fsId, subdir, reclaim string) error {
+	if subdir == "." || subdir == ".." {
+		return status.Errorf(codes.InvalidArgument, "invalid subdirectory %s of file system %s", subdir, fsId)
+	}
+	if !isValidReclaim(reclaim, SubdirReclaims) {
+		// e.g. the id of a volume provisioned by a newer driver, keeping its data is always safe
+		logging.Warningf("unknown reclaim %s of subdirectory %s of file system %s, keeping it", reclaim, subdir, fsId)
+		return nil
+	}
+	if reclaim == ReclaimRetain {
+		logging.Infof("subdirectory %s of file system %s is retained, keeping it", subdir, fsId)
+		return nil
+	}
+
+	if _, err := ctrl.cloud.describeFileSystem(ctx, fsId); err != nil {
+		if status.Code(err) == codes.NotFound {
+			logging.Infof("file system %s of subdirectory %s not found, assuming it is deleted", fsId, subdir)
+			return nil
+		}
+		return err
+	}
+
+	root, _, err := ctrl.sharedRoot(ctx, fsId)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(root, subdir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		logging.Infof("subdirectory %s of file system %s not found, assuming it is deleted", subdir, fsId)
+		return nil
+	}
+
+	ctrl.deleteSubdirQuota(ctx, fsId, dir)
+
+	if reclaim == ReclaimDelete {
+		if err := os.RemoveAll(dir); err != nil {
+			return status.Errorf(codes.Internal, "delete subdirectory %s of file system %s err: %v", subdir, fsId, err)
+		}
+		logging.Infof("deleted subdirectory %s of file system %s", subdir, fsId)
+		return nil
+	}
+
+	archived := ArchivedSubdirPrefix + subdir + "-" + time.Now().UTC().Format(ArchivedSubdirTimeFormat)
+	if err := os.Rename(dir, filepath.Join(root, archived)); err != nil {
+		return status.Errorf(codes.Internal, "archive subdirectory %s of file system %s err: %v", subdir, fsId, err)
+	}
+	logging.Infof("archived subdirectory %s of file system %s as %s", subdir, fsId, archived)
+	return nil
+}
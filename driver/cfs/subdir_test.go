@@ -0,0 +1,65 @@
+package cfs
+
+import "testing"
+
+func TestParseVolumeId(t *testing.T) {
+	tests := []struct {
+		volumeId    string
+		wantFsId    string
+		wantSubdir  string
+		wantReclaim string
+	}{
+		{"cfs-1a2b3c4d", "cfs-1a2b3c4d", "", ""},
+		{"cfs-1a2b3c4d/pvc-1", "cfs-1a2b3c4d", "pvc-1", ReclaimArchive},
+		{"cfs-1a2b3c4d/pvc-1/delete", "cfs-1a2b3c4d", "pvc-1", ReclaimDelete},
+		{"cfs-1a2b3c4d/pvc-1/retain", "cfs-1a2b3c4d", "pvc-1", ReclaimRetain},
+	}
+
+	for _, test := range tests {
+		fsId, subdir, reclaim := parseVolumeId(test.volumeId)
+		if fsId != test.wantFsId || subdir != test.wantSubdir || reclaim != test.wantReclaim {
+			t.Errorf("parseVolumeId(%q) = %q, %q, %q, want %q, %q, %q", test.volumeId, fsId, subdir, reclaim, test.wantFsId, test.wantSubdir, test.wantReclaim)
+		}
+	}
+}
+
+func TestSubdirVolumeIdRoundTrip(t *testing.T) {
+	for _, reclaim := range SubdirReclaims {
+		volumeId := subdirVolumeId("cfs-1a2b3c4d", "pvc-1", reclaim)
+		if fsId, subdir, got := parseVolumeId(volumeId); fsId != "cfs-1a2b3c4d" || subdir != "pvc-1" || got != reclaim {
+			t.Errorf("parseVolumeId(%q) = %q, %q, %q, want cfs-1a2b3c4d, pvc-1, %q", volumeId, fsId, subdir, got, reclaim)
+		}
+	}
+}
+
+func TestParseCreateParametersReclaim(t *testing.T) {
+	tests := []struct {
+		parameters  map[string]string
+		wantReclaim string
+		wantErr     bool
+	}{
+		{map[string]string{FileSystemIdAttr: "cfs-1a2b3c4d"}, ReclaimArchive, false},
+		{map[string]string{FileSystemIdAttr: "cfs-1a2b3c4d", ReclaimAttr: ReclaimRetain}, ReclaimRetain, false},
+		{map[string]string{FileSystemIdAttr: "cfs-1a2b3c4d", ReclaimAttr: "keep"}, "", true},
+		{map[string]string{FileSystemIdAttr: "cfs-1a2b3c4d", ReclaimAttr: "delete/retain"}, "", true},
+		{map[string]string{}, ReclaimDelete, false},
+		{map[string]string{ReclaimAttr: ReclaimArchive}, "", true},
+	}
+
+	for _, test := range tests {
+		p, err := parseCreateParameters(test.parameters, DefaultConfig())
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseCreateParameters(%v) = %+v, want error", test.parameters, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCreateParameters(%v) err: %v", test.parameters, err)
+			continue
+		}
+		if p.reclaim != test.wantReclaim {
+			t.Errorf("parseCreateParameters(%v) reclaim = %q, want %q", test.parameters, p.reclaim, test.wantReclaim)
+		}
+	}
+}
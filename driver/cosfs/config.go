@@ -0,0 +1,40 @@
+package cosfs
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config holds the driver settings, set by flags at startup.
+type Config struct {
+	// path of the cosfs binary
+	CosfsPath string
+
+	// directory the password files of mounted buckets are written to
+	WorkDir string
+
+	// how long to wait for cosfs to mount a bucket
+	MountTimeout time.Duration
+}
+
+// DefaultConfig returns the config used when flags do not override it.
+func DefaultConfig() *Config {
+	return &Config{
+		CosfsPath:    "cosfs",
+		WorkDir:      "/var/lib/csi-cosfs",
+		MountTimeout: time.Second * 30,
+	}
+}
+
+func (cfg *Config) validate() error {
+	if cfg.CosfsPath == "" {
+		return fmt.Errorf("cosfs path must be set")
+	}
+	if cfg.WorkDir == "" {
+		return fmt.Errorf("work dir must be set")
+	}
+	if cfg.MountTimeout <= 0 {
+		return fmt.Errorf("mount timeout must be positive")
+	}
+	return nil
+}
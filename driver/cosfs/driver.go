@@ -0,0 +1,80 @@
+package cosfs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/redact"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var (
+	DriverName     = "com.tencent.cloud.csi.cosfs"
+	DriverVerision = "0.1.0"
+)
+
+// Driver is a node only plugin, buckets are created outside of kubernetes and used through static
+// persistent volumes, so there is no controller.
+type Driver struct {
+	config *Config
+}
+
+// NewDriver creates the cosfs driver.
+func NewDriver(config *Config) (*Driver, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(config.WorkDir, 0700); err != nil {
+		return nil, fmt.Errorf("create work dir %s err: %v", config.WorkDir, err)
+	}
+	return &Driver{config: config}, nil
+}
+
+func (drv *Driver) Run(endpoint *url.URL) error {
+	logging.Infof("starting %s %s", DriverName, DriverVerision)
+
+	identity, err := newCosfsIdentity()
+	if err != nil {
+		return err
+	}
+
+	node, err := newCosfsNode(drv.config)
+	if err != nil {
+		return err
+	}
+
+	// requests carry the credentials of buckets in their secrets
+	logGRPC := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		logging.V(4).Infof("GRPC call: %s, request: %+v", info.FullMethod, redact.Message(req))
+		resp, err := handler(ctx, req)
+		if err != nil {
+			logging.Errorf("GRPC call: %s, error: %v", info.FullMethod, redact.String(err.Error()))
+		} else {
+			logging.V(4).Infof("GRPC call: %s, response: %+v", info.FullMethod, resp)
+		}
+		return resp, err
+	}
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(logGRPC))
+
+	csi.RegisterIdentityServer(srv, identity)
+	csi.RegisterNodeServer(srv, node)
+
+	sockPath := path.Join(endpoint.Host, endpoint.Path)
+	if err := os.Remove(sockPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(listener)
+}
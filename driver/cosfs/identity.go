@@ -0,0 +1,28 @@
+package cosfs
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"golang.org/x/net/context"
+)
+
+type cosfsIdentity struct{}
+
+func newCosfsIdentity() (*cosfsIdentity, error) {
+	return &cosfsIdentity{}, nil
+}
+
+func (identity *cosfsIdentity) GetPluginInfo(context.Context, *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{
+		Name:          DriverName,
+		VendorVersion: DriverVerision,
+	}, nil
+}
+
+// GetPluginCapabilities returns no capabilities, the plugin has no controller service.
+func (identity *cosfsIdentity) GetPluginCapabilities(context.Context, *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{}, nil
+}
+
+func (identity *cosfsIdentity) Probe(context.Context, *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{}, nil
+}
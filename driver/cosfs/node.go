@@ -0,0 +1,236 @@
+package cosfs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/dbdd4us/qcloudapi-sdk-go/metadata"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+var (
+	// attributes of a volume, the bucket, e.g. examplebucket-1250000000, its endpoint, e.g.
+	// http://cos.ap-guangzhou.myqcloud.com, and the directory of the bucket to mount
+	BucketAttr = "bucket"
+	URLAttr    = "url"
+	PathAttr   = "path"
+
+	// keys of the secret of a volume, the api credential cosfs accesses the bucket with
+	SecretIdKey  = "SecretId"
+	SecretKeyKey = "SecretKey"
+
+	// options of every mount, pods of any uid may read the bucket
+	DefaultMountOptions = []string{"allow_other"}
+
+	// mount options set by the driver, which volumes can not override
+	ReservedMountOptions = []string{"url", "passwd_file"}
+
+	// interval between two checks whether cosfs mounted a bucket
+	MountPollInterval = time.Millisecond * 500
+)
+
+type cosfsNode struct {
+	metadataClient *metadata.MetaData
+	mounter        mount.Interface
+	config         *Config
+}
+
+func newCosfsNode(config *Config) (*cosfsNode, error) {
+	return &cosfsNode{
+		metadataClient: metadata.NewMetaData(http.DefaultClient),
+		mounter:        mount.New(""),
+		config:         config,
+	}, nil
+}
+
+func (node *cosfsNode) NodeStageVolume(context.Context, *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+func (node *cosfsNode) NodeUnstageVolume(context.Context, *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// passwdFile returns the password file of the bucket mounted at target, every mount has one of its
+// own since volumes of the same bucket may have different credentials.
+func (node *cosfsNode) passwdFile(target string) string {
+	return filepath.Join(node.config.WorkDir, fmt.Sprintf("%x", sha256.Sum256([]byte(target))))
+}
+
+// NodePublishVolume mounts the bucket at the target path of the pod with cosfs, using the
+// credential in the node publish secret of the volume. The cosfs process serving the mount runs in
+// the plugin container.
+func (node *cosfsNode) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is empty")
+	}
+	if req.TargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume target path is empty")
+	}
+	if req.VolumeCapability == nil || req.VolumeCapability.GetMount() == nil {
+		return nil, status.Error(codes.InvalidArgument, "volume access type is not mount")
+	}
+
+	bucket, endpoint := req.VolumeAttributes[BucketAttr], req.VolumeAttributes[URLAttr]
+	if bucket == "" || endpoint == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "volume attributes %s and %s must be set", BucketAttr, URLAttr)
+	}
+	secretId, secretKey := req.NodePublishSecrets[SecretIdKey], req.NodePublishSecrets[SecretKeyKey]
+	if secretId == "" || secretKey == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "node publish secret must have %s and %s", SecretIdKey, SecretKeyKey)
+	}
+
+	source := bucket
+	if p := path.Clean("/" + req.VolumeAttributes[PathAttr]); p != "/" {
+		source = bucket + ":" + p
+	}
+
+	options := append([]string{}, DefaultMountOptions...)
+	flags := req.VolumeCapability.GetMount().MountFlags
+	if err := checkMountFlags(flags); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	options = append(options, flags...)
+	if req.Readonly {
+		options = append(options, "ro")
+	}
+
+	target := req.TargetPath
+	notMounted, err := node.mounter.IsLikelyNotMountPoint(target)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if err := os.MkdirAll(target, 0750); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		notMounted = true
+	}
+	if !notMounted {
+		logging.Infof("volume %s is already mounted at %s", req.VolumeId, target)
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	passwdFile := node.passwdFile(target)
+	if err := ioutil.WriteFile(passwdFile, []byte(fmt.Sprintf("%s:%s:%s\n", bucket, secretId, secretKey)), 0600); err != nil {
+		return nil, status.Errorf(codes.Internal, "write password file of volume %s err: %v", req.VolumeId, err)
+	}
+
+	args := []string{source, target, "-ourl=" + endpoint, "-opasswd_file=" + passwdFile}
+	for _, option := range options {
+		args = append(args, "-o"+option)
+	}
+	// cosfs returns once it runs in the background, the mount appears shortly after
+	if output, err := exec.Command(node.config.CosfsPath, args...).CombinedOutput(); err != nil {
+		os.Remove(passwdFile)
+		return nil, status.Errorf(codes.Internal, "mount bucket %s at %s err: %v, output: %s", source, target, err, strings.TrimSpace(string(output)))
+	}
+	if err := node.waitMounted(ctx, target); err != nil {
+		os.Remove(passwdFile)
+		return nil, err
+	}
+	logging.Infof("mounted volume %s from bucket %s at %s", req.VolumeId, source, target)
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// waitMounted waits until target is a mount point.
+func (node *cosfsNode) waitMounted(ctx context.Context, target string) error {
+	ticker := time.NewTicker(MountPollInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithTimeout(ctx, node.config.MountTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case <-ticker.C:
+			notMounted, err := node.mounter.IsLikelyNotMountPoint(target)
+			if err == nil && !notMounted {
+				return nil
+			}
+		case <-ctx.Done():
+			return status.Errorf(codes.DeadlineExceeded, "bucket is not mounted at %s after %v", target, node.config.MountTimeout)
+		}
+	}
+}
+
+func (node *cosfsNode) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	if req.TargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume target path is empty")
+	}
+
+	// unpublish may be retried after the unmount succeeded, only unmount actual mount points
+	notMounted, err := node.mounter.IsLikelyNotMountPoint(req.TargetPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err == nil && !notMounted {
+		if err := node.mounter.Unmount(req.TargetPath); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if err := os.Remove(node.passwdFile(req.TargetPath)); err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := os.Remove(req.TargetPath); err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+func (node *cosfsNode) NodeGetId(context.Context, *csi.NodeGetIdRequest) (*csi.NodeGetIdResponse, error) {
+	nodeId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &csi.NodeGetIdResponse{
+		NodeId: nodeId,
+	}, nil
+}
+
+func (node *cosfsNode) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{}, nil
+}
+
+func (node *cosfsNode) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	nodeId, err := node.metadataClient.InstanceID()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &csi.NodeGetInfoResponse{
+		NodeId: nodeId,
+	}, nil
+}
+
+// checkMountFlags rejects mount flags setting the options of ReservedMountOptions. A flag holds a
+// single option, a comma would smuggle more, e.g. noatime,url=http://other, past the check.
+func checkMountFlags(flags []string) error {
+	for _, option := range flags {
+		if strings.Contains(option, ",") {
+			return fmt.Errorf("mount option %q has a comma, set one option per mount option", option)
+		}
+		key := strings.TrimSpace(strings.SplitN(option, "=", 2)[0])
+		for _, reserved := range ReservedMountOptions {
+			if key == reserved {
+				return fmt.Errorf("mount option %s is set by the driver", key)
+			}
+		}
+	}
+	return nil
+}
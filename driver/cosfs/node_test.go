@@ -0,0 +1,26 @@
+package cosfs
+
+import "testing"
+
+func TestCheckMountFlags(t *testing.T) {
+	tests := []struct {
+		flags   []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"use_cache=/tmp/cosfs", "uid=1000", "allow_other"}, false},
+		{[]string{"url=http://cos.ap-guangzhou.myqcloud.com"}, true},
+		{[]string{"passwd_file"}, true},
+		{[]string{" passwd_file=/x"}, true},
+		{[]string{"noatime,url=http://other"}, true},
+		{[]string{"foo,url=http://evil,passwd_file=/x"}, true},
+		{[]string{"uid=1000,gid=1000"}, true},
+	}
+
+	for _, test := range tests {
+		err := checkMountFlags(test.flags)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("checkMountFlags(%q) err %v, want error %v", test.flags, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Package cbsext contains the cbs api actions used by the drivers which the vendored
+// tencentcloud-sdk-go lacks, in the layout of its generated packages. Requests are sent through
+// any sdk client, since the service and version are carried by the request.
+package cbsext
+
+import (
+	"encoding/json"
+
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+)
+
+const APIVersion = "2017-03-12"
+
+type SnapshotCopyResult struct {
+	// id of the copy in DestinationRegion
+	SnapshotId        *string `json:"SnapshotId" name:"SnapshotId"`
+	Message           *string `json:"Message" name:"Message"`
+	Code              *string `json:"Code" name:"Code"`
+	DestinationRegion *string `json:"DestinationRegion" name:"DestinationRegion"`
+}
+
+func NewCopySnapshotCrossRegionsRequest() (request *CopySnapshotCrossRegionsRequest) {
+	request = &CopySnapshotCrossRegionsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cbs", APIVersion, "CopySnapshotCrossRegions")
+	return
+}
+
+func NewCopySnapshotCrossRegionsResponse() (response *CopySnapshotCrossRegionsResponse) {
+	response = &CopySnapshotCrossRegionsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type CopySnapshotCrossRegionsRequest struct {
+	*tchttp.BaseRequest
+	DestinationRegions []*string `json:"DestinationRegions" name:"DestinationRegions"`
+	SnapshotId         *string   `json:"SnapshotId" name:"SnapshotId"`
+	// name of the copies, the name of the snapshot if empty
+	SnapshotName *string `json:"SnapshotName" name:"SnapshotName"`
+}
+
+func (r *CopySnapshotCrossRegionsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CopySnapshotCrossRegionsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CopySnapshotCrossRegionsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		// one result per destination region, a failed copy has a Code
+		SnapshotCopyResultSet []*SnapshotCopyResult `json:"SnapshotCopyResultSet" name:"SnapshotCopyResultSet"`
+		RequestId             *string               `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CopySnapshotCrossRegionsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CopySnapshotCrossRegionsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type Tag struct {
+	Key   *string `json:"Key" name:"Key"`
+	Value *string `json:"Value" name:"Value"`
+}
+
+func NewCreateSnapshotRequest() (request *CreateSnapshotRequest) {
+	request = &CreateSnapshotRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cbs", APIVersion, "CreateSnapshot")
+	return
+}
+
+func NewCreateSnapshotResponse() (response *CreateSnapshotResponse) {
+	response = &CreateSnapshotResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+// CreateSnapshotRequest is the CreateSnapshot request of the vendored sdk with the expiry time and
+// the tags of the snapshot.
+type CreateSnapshotRequest struct {
+	*tchttp.BaseRequest
+	DiskId       *string `json:"DiskId" name:"DiskId"`
+	SnapshotName *string `json:"SnapshotName" name:"SnapshotName"`
+	// utc time in ISO 8601 cbs deletes the snapshot at, the snapshot is kept until it is deleted if
+	// empty
+	Deadline *string `json:"Deadline" name:"Deadline"`
+	Tags     []*Tag  `json:"Tags" name:"Tags"`
+}
+
+func (r *CreateSnapshotRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateSnapshotRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CreateSnapshotResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		SnapshotId *string `json:"SnapshotId" name:"SnapshotId"`
+		RequestId  *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CreateSnapshotResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateSnapshotResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type Filter struct {
+	Name   *string   `json:"Name" name:"Name"`
+	Values []*string `json:"Values" name:"Values"`
+}
+
+// DiskBackup is a backup point of a disk, kept by cbs with the disk up to its backup quota.
+type DiskBackup struct {
+	DiskBackupId   *string `json:"DiskBackupId" name:"DiskBackupId"`
+	DiskId         *string `json:"DiskId" name:"DiskId"`
+	DiskSize       *uint64 `json:"DiskSize" name:"DiskSize"`
+	DiskUsage      *string `json:"DiskUsage" name:"DiskUsage"`
+	DiskBackupName *string `json:"DiskBackupName" name:"DiskBackupName"`
+	// NORMAL, CREATING or ROLLBACKING
+	DiskBackupState *string `json:"DiskBackupState" name:"DiskBackupState"`
+	// percentage of the backup done while it is being created
+	Percent    *uint64 `json:"Percent" name:"Percent"`
+	CreateTime *string `json:"CreateTime" name:"CreateTime"`
+	Encrypt    *bool   `json:"Encrypt" name:"Encrypt"`
+}
+
+func NewCreateDiskBackupRequest() (request *CreateDiskBackupRequest) {
+	request = &CreateDiskBackupRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cbs", APIVersion, "CreateDiskBackup")
+	return
+}
+
+func NewCreateDiskBackupResponse() (response *CreateDiskBackupResponse) {
+	response = &CreateDiskBackupResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type CreateDiskBackupRequest struct {
+	*tchttp.BaseRequest
+	DiskId         *string `json:"DiskId" name:"DiskId"`
+	DiskBackupName *string `json:"DiskBackupName" name:"DiskBackupName"`
+}
+
+func (r *CreateDiskBackupRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateDiskBackupRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CreateDiskBackupResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		DiskBackupId *string `json:"DiskBackupId" name:"DiskBackupId"`
+		RequestId    *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CreateDiskBackupResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateDiskBackupResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeDiskBackupsRequest() (request *DescribeDiskBackupsRequest) {
+	request = &DescribeDiskBackupsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cbs", APIVersion, "DescribeDiskBackups")
+	return
+}
+
+func NewDescribeDiskBackupsResponse() (response *DescribeDiskBackupsResponse) {
+	response = &DescribeDiskBackupsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeDiskBackupsRequest struct {
+	*tchttp.BaseRequest
+	DiskBackupIds []*string `json:"DiskBackupIds" name:"DiskBackupIds"`
+	// disk-backup-id, disk-id or disk-backup-state
+	Filters []*Filter `json:"Filters" name:"Filters"`
+	Offset  *uint64   `json:"Offset" name:"Offset"`
+	Limit   *uint64   `json:"Limit" name:"Limit"`
+}
+
+func (r *DescribeDiskBackupsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeDiskBackupsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeDiskBackupsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		TotalCount    *uint64       `json:"TotalCount" name:"TotalCount"`
+		DiskBackupSet []*DiskBackup `json:"DiskBackupSet" name:"DiskBackupSet"`
+		RequestId     *string       `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeDiskBackupsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeDiskBackupsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDeleteDiskBackupsRequest() (request *DeleteDiskBackupsRequest) {
+	request = &DeleteDiskBackupsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cbs", APIVersion, "DeleteDiskBackups")
+	return
+}
+
+func NewDeleteDiskBackupsResponse() (response *DeleteDiskBackupsResponse) {
+	response = &DeleteDiskBackupsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DeleteDiskBackupsRequest struct {
+	*tchttp.BaseRequest
+	DiskBackupIds []*string `json:"DiskBackupIds" name:"DiskBackupIds"`
+}
+
+func (r *DeleteDiskBackupsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteDiskBackupsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DeleteDiskBackupsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DeleteDiskBackupsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteDiskBackupsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeSnapshotOverviewRequest() (request *DescribeSnapshotOverviewRequest) {
+	request = &DescribeSnapshotOverviewRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cbs", APIVersion, "DescribeSnapshotOverview")
+	return
+}
+
+func NewDescribeSnapshotOverviewResponse() (response *DescribeSnapshotOverviewResponse) {
+	response = &DescribeSnapshotOverviewResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeSnapshotOverviewRequest struct {
+	*tchttp.BaseRequest
+}
+
+func (r *DescribeSnapshotOverviewRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeSnapshotOverviewRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeSnapshotOverviewResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		// GB stored by the snapshots of the region, they share unchanged blocks
+		TotalSize *float64 `json:"TotalSize" name:"TotalSize"`
+		// GB billed, the stored size less the free quota
+		RealTradeSize *float64 `json:"RealTradeSize" name:"RealTradeSize"`
+		FreeQuota     *float64 `json:"FreeQuota" name:"FreeQuota"`
+		TotalNums     *uint64  `json:"TotalNums" name:"TotalNums"`
+		RequestId     *string  `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeSnapshotOverviewResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeSnapshotOverviewResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
@@ -0,0 +1,724 @@
+// Package cfs contains the subset of the cfs api used by the drivers, in the layout of the
+// tencentcloud-sdk-go generated packages. Requests are sent through any sdk client, since the
+// service and version are carried by the request.
+package cfs
+
+import (
+	"encoding/json"
+
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+)
+
+const APIVersion = "2019-07-19"
+
+type TagInfo struct {
+	TagKey   *string `json:"TagKey" name:"TagKey"`
+	TagValue *string `json:"TagValue" name:"TagValue"`
+}
+
+type PGroup struct {
+	PGroupId *string `json:"PGroupId" name:"PGroupId"`
+	Name     *string `json:"Name" name:"Name"`
+}
+
+type FileSystemInfo struct {
+	CreationTime  *string `json:"CreationTime" name:"CreationTime"`
+	CreationToken *string `json:"CreationToken" name:"CreationToken"`
+	FileSystemId  *string `json:"FileSystemId" name:"FileSystemId"`
+	// creating, create_failed, available, unserviced or upgrading
+	LifeCycleState *string    `json:"LifeCycleState" name:"LifeCycleState"`
+	SizeByte       *uint64    `json:"SizeByte" name:"SizeByte"`
+	SizeLimit      *uint64    `json:"SizeLimit" name:"SizeLimit"`
+	ZoneId         *uint64    `json:"ZoneId" name:"ZoneId"`
+	Zone           *string    `json:"Zone" name:"Zone"`
+	Protocol       *string    `json:"Protocol" name:"Protocol"`
+	StorageType    *string    `json:"StorageType" name:"StorageType"`
+	PGroup         *PGroup    `json:"PGroup" name:"PGroup"`
+	FsName         *string    `json:"FsName" name:"FsName"`
+	Tags           []*TagInfo `json:"Tags" name:"Tags"`
+}
+
+type MountInfo struct {
+	FileSystemId  *string `json:"FileSystemId" name:"FileSystemId"`
+	MountTargetId *string `json:"MountTargetId" name:"MountTargetId"`
+	IpAddress     *string `json:"IpAddress" name:"IpAddress"`
+	// path of the root of the file system in NFSv3 mounts
+	FSID             *string `json:"FSID" name:"FSID"`
+	LifeCycleState   *string `json:"LifeCycleState" name:"LifeCycleState"`
+	NetworkInterface *string `json:"NetworkInterface" name:"NetworkInterface"`
+	VpcId            *string `json:"VpcId" name:"VpcId"`
+	SubnetId         *string `json:"SubnetId" name:"SubnetId"`
+}
+
+func NewCreateCfsFileSystemRequest() (request *CreateCfsFileSystemRequest) {
+	request = &CreateCfsFileSystemRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "CreateCfsFileSystem")
+	return
+}
+
+func NewCreateCfsFileSystemResponse() (response *CreateCfsFileSystemResponse) {
+	response = &CreateCfsFileSystemResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type CreateCfsFileSystemRequest struct {
+	*tchttp.BaseRequest
+	Zone *string `json:"Zone" name:"Zone"`
+	// VPC, BASIC or CCN, turbo file systems are only reachable over ccn
+	NetInterface *string `json:"NetInterface" name:"NetInterface"`
+	PGroupId     *string `json:"PGroupId" name:"PGroupId"`
+	// NFS, CIFS or TURBO
+	Protocol *string `json:"Protocol" name:"Protocol"`
+	// SD for standard, HP for high performance, TB and TP for their turbo variants
+	StorageType *string `json:"StorageType" name:"StorageType"`
+	VpcId       *string `json:"VpcId" name:"VpcId"`
+	SubnetId    *string `json:"SubnetId" name:"SubnetId"`
+	// ip of the mount target in the subnet, allocated if empty
+	MountIP *string `json:"MountIP" name:"MountIP"`
+	FsName  *string `json:"FsName" name:"FsName"`
+	// ccn and the cidr block in it the file system is attached to, with the CCN net interface
+	CcnId     *string `json:"CcnId" name:"CcnId"`
+	CidrBlock *string `json:"CidrBlock" name:"CidrBlock"`
+	// capacity in GiB, only and always set for turbo file systems
+	Capacity     *uint64    `json:"Capacity" name:"Capacity"`
+	ResourceTags []*TagInfo `json:"ResourceTags" name:"ResourceTags"`
+	// calls with the same token create the file system once
+	ClientToken *string `json:"ClientToken" name:"ClientToken"`
+}
+
+func (r *CreateCfsFileSystemRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateCfsFileSystemRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CreateCfsFileSystemResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		CreationTime   *string `json:"CreationTime" name:"CreationTime"`
+		CreationToken  *string `json:"CreationToken" name:"CreationToken"`
+		FileSystemId   *string `json:"FileSystemId" name:"FileSystemId"`
+		LifeCycleState *string `json:"LifeCycleState" name:"LifeCycleState"`
+		SizeByte       *uint64 `json:"SizeByte" name:"SizeByte"`
+		ZoneId         *uint64 `json:"ZoneId" name:"ZoneId"`
+		FsName         *string `json:"FsName" name:"FsName"`
+		RequestId      *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CreateCfsFileSystemResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateCfsFileSystemResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDeleteCfsFileSystemRequest() (request *DeleteCfsFileSystemRequest) {
+	request = &DeleteCfsFileSystemRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DeleteCfsFileSystem")
+	return
+}
+
+func NewDeleteCfsFileSystemResponse() (response *DeleteCfsFileSystemResponse) {
+	response = &DeleteCfsFileSystemResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DeleteCfsFileSystemRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId *string `json:"FileSystemId" name:"FileSystemId"`
+}
+
+func (r *DeleteCfsFileSystemRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteCfsFileSystemRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DeleteCfsFileSystemResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DeleteCfsFileSystemResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteCfsFileSystemResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeCfsFileSystemsRequest() (request *DescribeCfsFileSystemsRequest) {
+	request = &DescribeCfsFileSystemsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DescribeCfsFileSystems")
+	return
+}
+
+func NewDescribeCfsFileSystemsResponse() (response *DescribeCfsFileSystemsResponse) {
+	response = &DescribeCfsFileSystemsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeCfsFileSystemsRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId *string `json:"FileSystemId" name:"FileSystemId"`
+	VpcId        *string `json:"VpcId" name:"VpcId"`
+	SubnetId     *string `json:"SubnetId" name:"SubnetId"`
+}
+
+func (r *DescribeCfsFileSystemsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeCfsFileSystemsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeCfsFileSystemsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		FileSystems []*FileSystemInfo `json:"FileSystems" name:"FileSystems"`
+		TotalCount  *uint64           `json:"TotalCount" name:"TotalCount"`
+		RequestId   *string           `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeCfsFileSystemsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeCfsFileSystemsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeMountTargetsRequest() (request *DescribeMountTargetsRequest) {
+	request = &DescribeMountTargetsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DescribeMountTargets")
+	return
+}
+
+func NewDescribeMountTargetsResponse() (response *DescribeMountTargetsResponse) {
+	response = &DescribeMountTargetsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeMountTargetsRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId *string `json:"FileSystemId" name:"FileSystemId"`
+}
+
+func (r *DescribeMountTargetsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeMountTargetsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeMountTargetsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		MountTargets         []*MountInfo `json:"MountTargets" name:"MountTargets"`
+		NumberOfMountTargets *int64       `json:"NumberOfMountTargets" name:"NumberOfMountTargets"`
+		RequestId            *string      `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeMountTargetsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeMountTargetsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDeleteMountTargetRequest() (request *DeleteMountTargetRequest) {
+	request = &DeleteMountTargetRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DeleteMountTarget")
+	return
+}
+
+func NewDeleteMountTargetResponse() (response *DeleteMountTargetResponse) {
+	response = &DeleteMountTargetResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DeleteMountTargetRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId  *string `json:"FileSystemId" name:"FileSystemId"`
+	MountTargetId *string `json:"MountTargetId" name:"MountTargetId"`
+}
+
+func (r *DeleteMountTargetRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteMountTargetRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DeleteMountTargetResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DeleteMountTargetResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteMountTargetResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type PGroupInfo struct {
+	PGroupId *string `json:"PGroupId" name:"PGroupId"`
+	Name     *string `json:"Name" name:"Name"`
+	DescInfo *string `json:"DescInfo" name:"DescInfo"`
+	CDate    *string `json:"CDate" name:"CDate"`
+	// number of file systems using the permission group
+	BindCfsNum *int64 `json:"BindCfsNum" name:"BindCfsNum"`
+}
+
+type PGroupRuleInfo struct {
+	RuleId         *string `json:"RuleId" name:"RuleId"`
+	AuthClientIp   *string `json:"AuthClientIp" name:"AuthClientIp"`
+	RWPermission   *string `json:"RWPermission" name:"RWPermission"`
+	UserPermission *string `json:"UserPermission" name:"UserPermission"`
+	Priority       *int64  `json:"Priority" name:"Priority"`
+}
+
+func NewCreateCfsPGroupRequest() (request *CreateCfsPGroupRequest) {
+	request = &CreateCfsPGroupRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "CreateCfsPGroup")
+	return
+}
+
+func NewCreateCfsPGroupResponse() (response *CreateCfsPGroupResponse) {
+	response = &CreateCfsPGroupResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type CreateCfsPGroupRequest struct {
+	*tchttp.BaseRequest
+	Name     *string `json:"Name" name:"Name"`
+	DescInfo *string `json:"DescInfo" name:"DescInfo"`
+}
+
+func (r *CreateCfsPGroupRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateCfsPGroupRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CreateCfsPGroupResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		PGroupId  *string `json:"PGroupId" name:"PGroupId"`
+		Name      *string `json:"Name" name:"Name"`
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CreateCfsPGroupResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateCfsPGroupResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeCfsPGroupsRequest() (request *DescribeCfsPGroupsRequest) {
+	request = &DescribeCfsPGroupsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DescribeCfsPGroups")
+	return
+}
+
+func NewDescribeCfsPGroupsResponse() (response *DescribeCfsPGroupsResponse) {
+	response = &DescribeCfsPGroupsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeCfsPGroupsRequest struct {
+	*tchttp.BaseRequest
+}
+
+func (r *DescribeCfsPGroupsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeCfsPGroupsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeCfsPGroupsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		PGroupList []*PGroupInfo `json:"PGroupList" name:"PGroupList"`
+		RequestId  *string       `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeCfsPGroupsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeCfsPGroupsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDeleteCfsPGroupRequest() (request *DeleteCfsPGroupRequest) {
+	request = &DeleteCfsPGroupRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DeleteCfsPGroup")
+	return
+}
+
+func NewDeleteCfsPGroupResponse() (response *DeleteCfsPGroupResponse) {
+	response = &DeleteCfsPGroupResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DeleteCfsPGroupRequest struct {
+	*tchttp.BaseRequest
+	PGroupId *string `json:"PGroupId" name:"PGroupId"`
+}
+
+func (r *DeleteCfsPGroupRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteCfsPGroupRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DeleteCfsPGroupResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DeleteCfsPGroupResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteCfsPGroupResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewCreateCfsRuleRequest() (request *CreateCfsRuleRequest) {
+	request = &CreateCfsRuleRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "CreateCfsRule")
+	return
+}
+
+func NewCreateCfsRuleResponse() (response *CreateCfsRuleResponse) {
+	response = &CreateCfsRuleResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type CreateCfsRuleRequest struct {
+	*tchttp.BaseRequest
+	PGroupId *string `json:"PGroupId" name:"PGroupId"`
+	// an ip or cidr, or * for all clients
+	AuthClientIp *string `json:"AuthClientIp" name:"AuthClientIp"`
+	// 1 to 100, rules with a lower value take precedence
+	Priority *int64 `json:"Priority" name:"Priority"`
+	// RO or RW
+	RWPermission *string `json:"RWPermission" name:"RWPermission"`
+	// all_squash, no_all_squash, root_squash or no_root_squash
+	UserPermission *string `json:"UserPermission" name:"UserPermission"`
+}
+
+func (r *CreateCfsRuleRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateCfsRuleRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CreateCfsRuleResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		PGroupId  *string `json:"PGroupId" name:"PGroupId"`
+		RuleId    *string `json:"RuleId" name:"RuleId"`
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CreateCfsRuleResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateCfsRuleResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeCfsRulesRequest() (request *DescribeCfsRulesRequest) {
+	request = &DescribeCfsRulesRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DescribeCfsRules")
+	return
+}
+
+func NewDescribeCfsRulesResponse() (response *DescribeCfsRulesResponse) {
+	response = &DescribeCfsRulesResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeCfsRulesRequest struct {
+	*tchttp.BaseRequest
+	PGroupId *string `json:"PGroupId" name:"PGroupId"`
+}
+
+func (r *DescribeCfsRulesRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeCfsRulesRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeCfsRulesResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RuleList  []*PGroupRuleInfo `json:"RuleList" name:"RuleList"`
+		RequestId *string           `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeCfsRulesResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeCfsRulesResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type UserQuota struct {
+	// Uid or Gid
+	UserType *string `json:"UserType" name:"UserType"`
+	UserId   *string `json:"UserId" name:"UserId"`
+	// limits in GiB and files, zero for none
+	CapacityHardLimit *uint64 `json:"CapacityHardLimit" name:"CapacityHardLimit"`
+	FileHardLimit     *uint64 `json:"FileHardLimit" name:"FileHardLimit"`
+	FileSystemId      *string `json:"FileSystemId" name:"FileSystemId"`
+	// usage in GiB and files
+	CapacityUsed *uint64 `json:"CapacityUsed" name:"CapacityUsed"`
+	FileUsed     *uint64 `json:"FileUsed" name:"FileUsed"`
+}
+
+func NewSetUserQuotaRequest() (request *SetUserQuotaRequest) {
+	request = &SetUserQuotaRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "SetUserQuota")
+	return
+}
+
+func NewSetUserQuotaResponse() (response *SetUserQuotaResponse) {
+	response = &SetUserQuotaResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type SetUserQuotaRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId      *string `json:"FileSystemId" name:"FileSystemId"`
+	UserType          *string `json:"UserType" name:"UserType"`
+	UserId            *string `json:"UserId" name:"UserId"`
+	CapacityHardLimit *uint64 `json:"CapacityHardLimit" name:"CapacityHardLimit"`
+	FileHardLimit     *uint64 `json:"FileHardLimit" name:"FileHardLimit"`
+}
+
+func (r *SetUserQuotaRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *SetUserQuotaRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type SetUserQuotaResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *SetUserQuotaResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *SetUserQuotaResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDeleteUserQuotaRequest() (request *DeleteUserQuotaRequest) {
+	request = &DeleteUserQuotaRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DeleteUserQuota")
+	return
+}
+
+func NewDeleteUserQuotaResponse() (response *DeleteUserQuotaResponse) {
+	response = &DeleteUserQuotaResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DeleteUserQuotaRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId *string `json:"FileSystemId" name:"FileSystemId"`
+	UserType     *string `json:"UserType" name:"UserType"`
+	UserId       *string `json:"UserId" name:"UserId"`
+}
+
+func (r *DeleteUserQuotaRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteUserQuotaRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DeleteUserQuotaResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DeleteUserQuotaResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteUserQuotaResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeUserQuotaRequest() (request *DescribeUserQuotaRequest) {
+	request = &DescribeUserQuotaRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cfs", APIVersion, "DescribeUserQuota")
+	return
+}
+
+func NewDescribeUserQuotaResponse() (response *DescribeUserQuotaResponse) {
+	response = &DescribeUserQuotaResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeUserQuotaRequest struct {
+	*tchttp.BaseRequest
+	FileSystemId *string `json:"FileSystemId" name:"FileSystemId"`
+	Offset       *uint64 `json:"Offset" name:"Offset"`
+	Limit        *uint64 `json:"Limit" name:"Limit"`
+}
+
+func (r *DescribeUserQuotaRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeUserQuotaRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeUserQuotaResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		TotalCount    *uint64      `json:"TotalCount" name:"TotalCount"`
+		UserQuotaInfo []*UserQuota `json:"UserQuotaInfo" name:"UserQuotaInfo"`
+		RequestId     *string      `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeUserQuotaResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeUserQuotaResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
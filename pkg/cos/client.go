@@ -0,0 +1,204 @@
+// Package cos is a minimal client of the cos xml api used by the drivers to check and tag the
+// objects they export to buckets.
+package cos
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// requests are signed for this long
+const signatureDuration = time.Hour
+
+type Client struct {
+	// e.g. https://archive-1250000000.cos.ap-guangzhou.myqcloud.com
+	endpoint   string
+	secretId   string
+	secretKey  string
+	httpClient *http.Client
+}
+
+// NewClient creates a client of bucket, named with its appid, e.g. archive-1250000000, in region.
+func NewClient(bucket, region, secretId, secretKey string) *Client {
+	return &Client{
+		endpoint:   fmt.Sprintf("https://%s.cos.%s.myqcloud.com", bucket, region),
+		secretId:   secretId,
+		secretKey:  secretKey,
+		httpClient: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+// StatusError is returned when cos responds with a non 2xx code.
+type StatusError struct {
+	Code      int
+	ErrorCode string
+	Message   string
+	RequestId string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("cos error, code %d %s: %s, request id %s", e.Code, e.ErrorCode, e.Message, e.RequestId)
+}
+
+func IsNotFound(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// ObjectKey returns the key of an object given as its key or its url, e.g. as returned by the image
+// export api.
+func ObjectKey(path string) string {
+	if u, err := url.Parse(path); err == nil && u.Host != "" {
+		path = u.Path
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+// ObjectExists reports whether the object key is in the bucket.
+func (c *Client) ObjectExists(ctx context.Context, key string) (bool, error) {
+	err := c.do(ctx, http.MethodHead, key, nil, nil)
+	if err == nil {
+		return true, nil
+	}
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// PutObjectTagging replaces the tags of the object key with tags, lifecycle rules of the bucket can
+// filter on them.
+func (c *Client) PutObjectTagging(ctx context.Context, key string, tags map[string]string) error {
+	t := tagging{}
+	for k, v := range tags {
+		t.Tags = append(t.Tags, tag{Key: k, Value: v})
+	}
+	sort.Slice(t.Tags, func(i, j int) bool { return t.Tags[i].Key < t.Tags[j].Key })
+	body, err := xml.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, key, url.Values{"tagging": []string{""}}, body)
+}
+
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, body []byte) error {
+	u := c.endpoint + "/" + key
+	if len(query) > 0 {
+		var params []string
+		for k := range query {
+			param := url.QueryEscape(k)
+			// the sub resources of cos have no value, e.g. ?tagging
+			if v := query.Get(k); v != "" {
+				param += "=" + url.QueryEscape(v)
+			}
+			params = append(params, param)
+		}
+		sort.Strings(params)
+		u += "?" + strings.Join(params, "&")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	req.Header.Set("Authorization", c.authorization(method, "/"+key, query, time.Now()))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		e := &StatusError{Code: resp.StatusCode, RequestId: resp.Header.Get("x-cos-request-id")}
+		// responses to HEAD have no body
+		cosErr := struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}{}
+		if xml.Unmarshal(data, &cosErr) == nil {
+			e.ErrorCode, e.Message = cosErr.Code, cosErr.Message
+		}
+		return e
+	}
+	return nil
+}
+
+// authorization signs a request with the cos signature v5, without signing its headers.
+func (c *Client) authorization(method, path string, query url.Values, now time.Time) string {
+	keyTime := fmt.Sprintf("%d;%d", now.Unix(), now.Add(signatureDuration).Unix())
+
+	var params, paramList []string
+	for key, values := range query {
+		k := strings.ToLower(url.QueryEscape(key))
+		v := ""
+		if len(values) > 0 {
+			v = url.QueryEscape(values[0])
+		}
+		params = append(params, k+"="+v)
+		paramList = append(paramList, k)
+	}
+	sort.Strings(params)
+	sort.Strings(paramList)
+
+	httpString := strings.ToLower(method) + "\n" + path + "\n" + strings.Join(params, "&") + "\n\n"
+	httpStringSum := sha1.Sum([]byte(httpString))
+	stringToSign := "sha1\n" + keyTime + "\n" + hex.EncodeToString(httpStringSum[:]) + "\n"
+	signKey := hmacSHA1(c.secretKey, keyTime)
+	signature := hmacSHA1(signKey, stringToSign)
+
+	return strings.Join([]string{
+		"q-sign-algorithm=sha1",
+		"q-ak=" + c.secretId,
+		"q-sign-time=" + keyTime,
+		"q-key-time=" + keyTime,
+		"q-header-list=",
+		"q-url-param-list=" + strings.Join(paramList, ";"),
+		"q-signature=" + signature,
+	}, "&")
+}
+
+func hmacSHA1(key, message string) string {
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,103 @@
+package cos
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func newTestClient(url string) *Client {
+	return &Client{endpoint: url, secretId: "id", secretKey: "key", httpClient: http.DefaultClient}
+}
+
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"csi/default/daily/snap-1_0.qcow2", "csi/default/daily/snap-1_0.qcow2"},
+		{"/csi/default/daily/snap-1_0.qcow2", "csi/default/daily/snap-1_0.qcow2"},
+		{"https://archive-1250000000.cos.ap-guangzhou.myqcloud.com/csi/snap-1_0.qcow2", "csi/snap-1_0.qcow2"},
+	}
+
+	for _, test := range tests {
+		if got := ObjectKey(test.path); got != test.want {
+			t.Errorf("ObjectKey(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestObjectExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method %s, want HEAD", r.Method)
+		}
+		if r.URL.Path != "/csi/snap-1_0.raw" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server.URL)
+	for key, want := range map[string]bool{"csi/snap-1_0.raw": true, "csi/snap-1_1.raw": false} {
+		exists, err := client.ObjectExists(context.Background(), key)
+		if err != nil {
+			t.Fatalf("ObjectExists(%q) err: %v", key, err)
+		}
+		if exists != want {
+			t.Errorf("ObjectExists(%q) = %v, want %v", key, exists, want)
+		}
+	}
+}
+
+func TestPutObjectTagging(t *testing.T) {
+	var got tagging
+	var query, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, authorization = r.URL.RawQuery, r.Header.Get("Authorization")
+		data, _ := ioutil.ReadAll(r.Body)
+		if err := xml.Unmarshal(data, &got); err != nil {
+			t.Errorf("request body not xml: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	err := newTestClient(server.URL).PutObjectTagging(context.Background(), "csi/snap-1_0.raw", map[string]string{"team": "db", "archive": "true"})
+	if err != nil {
+		t.Fatalf("PutObjectTagging err: %v", err)
+	}
+
+	if query != "tagging" {
+		t.Errorf("query %q, want tagging", query)
+	}
+	if !strings.HasPrefix(authorization, "q-sign-algorithm=sha1&q-ak=id&") || !strings.Contains(authorization, "&q-url-param-list=tagging&") {
+		t.Errorf("authorization %q does not sign the tagging sub resource", authorization)
+	}
+	want := []tag{{Key: "archive", Value: "true"}, {Key: "team", Value: "db"}}
+	if len(got.Tags) != len(want) || got.Tags[0] != want[0] || got.Tags[1] != want[1] {
+		t.Errorf("tags %+v, want %+v", got.Tags, want)
+	}
+}
+
+func TestPutObjectTaggingError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-cos-request-id", "req-1")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>"))
+	}))
+	defer server.Close()
+
+	err := newTestClient(server.URL).PutObjectTagging(context.Background(), "csi/snap-1_0.raw", map[string]string{"a": "b"})
+	e, ok := err.(*StatusError)
+	if !ok {
+		t.Fatalf("err %v, want a StatusError", err)
+	}
+	if e.Code != http.StatusForbidden || e.ErrorCode != "AccessDenied" || e.RequestId != "req-1" {
+		t.Errorf("err %+v, want 403 AccessDenied of req-1", e)
+	}
+}
@@ -0,0 +1,106 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 1-5 * * MON,FRI", false},
+		{"0 3 * * *", false},
+		{"5/15 * ? * *", false},
+		{"0 0 1 jan 7", false},
+		{"@daily", false},
+		{" @hourly ", false},
+		{"", true},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"*/x * * * *", true},
+		{"* * * FOO *", true},
+		{"@every 5m", true},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.spec)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("Parse(%q) err %v, want error %v", test.spec, err, test.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		from string
+		want string
+	}{
+		{"every minute", "* * * * *", "2024-03-10 10:15:00", "2024-03-10 10:16:00"},
+		{"seconds are truncated", "* * * * *", "2024-03-10 10:15:42", "2024-03-10 10:16:00"},
+		{"daily later today", "0 3 * * *", "2024-03-10 01:00:00", "2024-03-10 03:00:00"},
+		{"daily tomorrow", "0 3 * * *", "2024-03-10 03:00:00", "2024-03-11 03:00:00"},
+		{"step", "*/15 * * * *", "2024-03-10 10:16:00", "2024-03-10 10:30:00"},
+		{"step from value", "5/20 * * * *", "2024-03-10 10:26:00", "2024-03-10 10:45:00"},
+		{"hour wraps to next day", "30 1-5 * * *", "2024-03-10 05:30:00", "2024-03-11 01:30:00"},
+		{"month end", "0 0 1 * *", "2024-01-31 12:00:00", "2024-02-01 00:00:00"},
+		{"year end", "@yearly", "2024-12-31 23:59:00", "2025-01-01 00:00:00"},
+		{"day of week names", "0 9 * * MON,FRI", "2024-03-09 12:00:00", "2024-03-11 09:00:00"},
+		{"sunday as 7", "0 0 * * 7", "2024-03-10 00:00:00", "2024-03-17 00:00:00"},
+		{"day of month or week", "0 0 15 * MON", "2024-03-12 00:00:00", "2024-03-15 00:00:00"},
+		{"leap day", "0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"never", "0 0 30 2 *", "2024-01-01 00:00:00", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := Parse(test.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) err: %v", test.spec, err)
+			}
+			from := at(test.from)
+			got := s.Next(from)
+			if test.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%v) = %v, want the zero time", from, got)
+				}
+				return
+			}
+			if want := at(test.want); !got.Equal(want) {
+				t.Errorf("Next(%v) = %v, want %v", from, got, want)
+			}
+		})
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	location := time.FixedZone("CST", 8*60*60)
+	s, err := Parse("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.Next(time.Date(2024, 3, 10, 1, 0, 0, 0, location))
+	if want := time.Date(2024, 3, 10, 3, 0, 0, 0, location); !got.Equal(want) || got.Location() != location {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
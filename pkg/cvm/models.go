@@ -0,0 +1,351 @@
+// Package cvm contains the subset of the cvm api used by the drivers, in the layout of the
+// tencentcloud-sdk-go generated packages. Requests are sent through any sdk client, since the
+// service and version are carried by the request.
+package cvm
+
+import (
+	"encoding/json"
+
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+)
+
+const APIVersion = "2017-03-12"
+
+type Filter struct {
+	Name   *string   `json:"Name" name:"Name"`
+	Values []*string `json:"Values" name:"Values"`
+}
+
+type Placement struct {
+	Zone *string `json:"Zone" name:"Zone"`
+}
+
+type Instance struct {
+	InstanceId         *string    `json:"InstanceId" name:"InstanceId"`
+	InstanceName       *string    `json:"InstanceName" name:"InstanceName"`
+	InstanceType       *string    `json:"InstanceType" name:"InstanceType"`
+	PrivateIpAddresses []*string  `json:"PrivateIpAddresses" name:"PrivateIpAddresses"`
+	Placement          *Placement `json:"Placement" name:"Placement"`
+}
+
+func NewDescribeInstancesRequest() (request *DescribeInstancesRequest) {
+	request = &DescribeInstancesRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cvm", APIVersion, "DescribeInstances")
+	return
+}
+
+func NewDescribeInstancesResponse() (response *DescribeInstancesResponse) {
+	response = &DescribeInstancesResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeInstancesRequest struct {
+	*tchttp.BaseRequest
+	InstanceIds []*string `json:"InstanceIds" name:"InstanceIds"`
+	// supported filters include private-ip-address and instance-name
+	Filters []*Filter `json:"Filters" name:"Filters"`
+	Offset  *int64    `json:"Offset" name:"Offset"`
+	Limit   *int64    `json:"Limit" name:"Limit"`
+}
+
+func (r *DescribeInstancesRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeInstancesRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeInstancesResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		TotalCount  *int64      `json:"TotalCount" name:"TotalCount"`
+		InstanceSet []*Instance `json:"InstanceSet" name:"InstanceSet"`
+		RequestId   *string     `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeInstancesResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeInstancesResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type Tag struct {
+	Key   *string `json:"Key" name:"Key"`
+	Value *string `json:"Value" name:"Value"`
+}
+
+type TagSpecification struct {
+	// image for the tags of an image
+	ResourceType *string `json:"ResourceType" name:"ResourceType"`
+	Tags         []*Tag  `json:"Tags" name:"Tags"`
+}
+
+type Image struct {
+	ImageId   *string `json:"ImageId" name:"ImageId"`
+	ImageName *string `json:"ImageName" name:"ImageName"`
+	// CREATING, NORMAL, CREATEFAILED, USING, SYNCING, IMPORTING or IMPORTFAILED
+	ImageState  *string `json:"ImageState" name:"ImageState"`
+	CreatedTime *string `json:"CreatedTime" name:"CreatedTime"`
+}
+
+func NewCreateImageRequest() (request *CreateImageRequest) {
+	request = &CreateImageRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cvm", APIVersion, "CreateImage")
+	return
+}
+
+func NewCreateImageResponse() (response *CreateImageResponse) {
+	response = &CreateImageResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type CreateImageRequest struct {
+	*tchttp.BaseRequest
+	ImageName        *string `json:"ImageName" name:"ImageName"`
+	ImageDescription *string `json:"ImageDescription" name:"ImageDescription"`
+	// creates the image from these snapshots instead of an instance
+	SnapshotIds      []*string           `json:"SnapshotIds" name:"SnapshotIds"`
+	TagSpecification []*TagSpecification `json:"TagSpecification" name:"TagSpecification"`
+}
+
+func (r *CreateImageRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateImageRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type CreateImageResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		ImageId   *string `json:"ImageId" name:"ImageId"`
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *CreateImageResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *CreateImageResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDescribeImagesRequest() (request *DescribeImagesRequest) {
+	request = &DescribeImagesRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cvm", APIVersion, "DescribeImages")
+	return
+}
+
+func NewDescribeImagesResponse() (response *DescribeImagesResponse) {
+	response = &DescribeImagesResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeImagesRequest struct {
+	*tchttp.BaseRequest
+	ImageIds []*string `json:"ImageIds" name:"ImageIds"`
+	Filters  []*Filter `json:"Filters" name:"Filters"`
+	Offset   *uint64   `json:"Offset" name:"Offset"`
+	Limit    *uint64   `json:"Limit" name:"Limit"`
+}
+
+func (r *DescribeImagesRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeImagesRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeImagesResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		ImageSet   []*Image `json:"ImageSet" name:"ImageSet"`
+		TotalCount *int64   `json:"TotalCount" name:"TotalCount"`
+		RequestId  *string  `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeImagesResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeImagesResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewExportImagesRequest() (request *ExportImagesRequest) {
+	request = &ExportImagesRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cvm", APIVersion, "ExportImages")
+	return
+}
+
+func NewExportImagesResponse() (response *ExportImagesResponse) {
+	response = &ExportImagesResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type ExportImagesRequest struct {
+	*tchttp.BaseRequest
+	BucketName *string   `json:"BucketName" name:"BucketName"`
+	ImageIds   []*string `json:"ImageIds" name:"ImageIds"`
+	// RAW, QCOW2, VHD or VMDK, RAW if empty
+	ExportFormat *string `json:"ExportFormat" name:"ExportFormat"`
+	// prefixes of the names of the exported objects in the bucket, one per image
+	FileNamePrefixList []*string `json:"FileNamePrefixList" name:"FileNamePrefixList"`
+}
+
+func (r *ExportImagesRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *ExportImagesRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type ExportImagesResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		TaskId    *uint64   `json:"TaskId" name:"TaskId"`
+		CosPaths  []*string `json:"CosPaths" name:"CosPaths"`
+		RequestId *string   `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *ExportImagesResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *ExportImagesResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+func NewDeleteImagesRequest() (request *DeleteImagesRequest) {
+	request = &DeleteImagesRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cvm", APIVersion, "DeleteImages")
+	return
+}
+
+func NewDeleteImagesResponse() (response *DeleteImagesResponse) {
+	response = &DeleteImagesResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DeleteImagesRequest struct {
+	*tchttp.BaseRequest
+	ImageIds []*string `json:"ImageIds" name:"ImageIds"`
+}
+
+func (r *DeleteImagesRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteImagesRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DeleteImagesResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		RequestId *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DeleteImagesResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DeleteImagesResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type ZoneInfo struct {
+	// e.g. ap-guangzhou-3
+	Zone *string `json:"Zone" name:"Zone"`
+	// e.g. 100003, nodes of tke are labeled with it
+	ZoneId    *string `json:"ZoneId" name:"ZoneId"`
+	ZoneName  *string `json:"ZoneName" name:"ZoneName"`
+	ZoneState *string `json:"ZoneState" name:"ZoneState"`
+}
+
+func NewDescribeZonesRequest() (request *DescribeZonesRequest) {
+	request = &DescribeZonesRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("cvm", APIVersion, "DescribeZones")
+	return
+}
+
+func NewDescribeZonesResponse() (response *DescribeZonesResponse) {
+	response = &DescribeZonesResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeZonesRequest struct {
+	*tchttp.BaseRequest
+}
+
+func (r *DescribeZonesRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeZonesRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeZonesResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		TotalCount *uint64     `json:"TotalCount" name:"TotalCount"`
+		ZoneSet    []*ZoneInfo `json:"ZoneSet" name:"ZoneSet"`
+		RequestId  *string     `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeZonesResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeZonesResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
@@ -0,0 +1,239 @@
+// Package kube is a minimal kubernetes api client used by the drivers to read
+// and update the few objects they care about, such as persistent volume claims and events.
+package kube
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+	PatchTypeMerge = "application/merge-patch+json"
+)
+
+type Client struct {
+	host       string
+	token      string
+	httpClient *http.Client
+}
+
+// NewInClusterClient creates a client using the service account mounted into the pod.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be defined")
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %s", serviceAccountCAFile)
+	}
+
+	return &Client{
+		host:  "https://" + net.JoinHostPort(host, port),
+		token: string(bytes.TrimSpace(token)),
+		httpClient: &http.Client{
+			Timeout: time.Second * 30,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// StatusError is returned when the api server responds with a non 2xx code.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes api error, code %d: %s", e.Code, e.Message)
+}
+
+func IsNotFound(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Code == http.StatusNotFound
+}
+
+func IsConflict(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Code == http.StatusConflict
+}
+
+func IsAlreadyExists(err error) bool {
+	return IsConflict(err)
+}
+
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+func (c *Client) Create(ctx context.Context, path string, in, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, "application/json", in, out)
+}
+
+func (c *Client) Update(ctx context.Context, path string, in, out interface{}) error {
+	return c.do(ctx, http.MethodPut, path, "application/json", in, out)
+}
+
+func (c *Client) Patch(ctx context.Context, path string, patchType string, patch, out interface{}) error {
+	return c.do(ctx, http.MethodPatch, path, patchType, patch, out)
+}
+
+func (c *Client) Delete(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodDelete, path, "", nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.host+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError(resp.StatusCode, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func statusError(code int, data []byte) error {
+	status := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(data, &status); err != nil || status.Message == "" {
+		status.Message = string(data)
+	}
+	return &StatusError{Code: code, Message: status.Message}
+}
+
+// WatchEvent is a change of an object sent by a watch, Type is ADDED, MODIFIED or DELETED.
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// IsGone is true if the resource version a watch started from is too old, the objects must be
+// listed again.
+func IsGone(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Code == http.StatusGone
+}
+
+// Watch watches the objects listed at path, which may have a query, from resourceVersion and calls
+// handle with each event until handle returns false, ctx is done or the api server ends the watch
+// after timeout.
+func (c *Client) Watch(ctx context.Context, path, resourceVersion string, timeout time.Duration, handle func(*WatchEvent) bool) error {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("resourceVersion", resourceVersion)
+	query.Set("timeoutSeconds", fmt.Sprint(int(timeout.Seconds())))
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.host+path+separator+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+
+	// the timeout of the client would end the watch
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return statusError(resp.StatusCode, data)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := &WatchEvent{}
+		if err := decoder.Decode(event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if event.Type == "ERROR" {
+			status := struct {
+				Code int `json:"code"`
+			}{}
+			json.Unmarshal(event.Object, &status)
+			return statusError(status.Code, event.Object)
+		}
+		if !handle(event) {
+			return nil
+		}
+	}
+}
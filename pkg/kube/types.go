@@ -0,0 +1,609 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ObjectMeta is the subset of kubernetes object metadata used by the drivers.
+type ObjectMeta struct {
+	Name            string            `json:"name,omitempty"`
+	GenerateName    string            `json:"generateName,omitempty"`
+	Namespace       string            `json:"namespace,omitempty"`
+	UID             string            `json:"uid,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	Finalizers      []string          `json:"finalizers,omitempty"`
+	// RFC 3339, set by the api server
+	CreationTimestamp string `json:"creationTimestamp,omitempty"`
+}
+
+// ListMeta is the subset of kubernetes list metadata used by the drivers.
+type ListMeta struct {
+	// a watch started from it sends the changes after the list
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type PersistentVolumeClaim struct {
+	Metadata ObjectMeta                `json:"metadata"`
+	Spec     PersistentVolumeClaimSpec `json:"spec"`
+}
+
+func PersistentVolumeClaimPath(namespace, name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/persistentvolumeclaims/%s", namespace, name)
+}
+
+type PersistentVolumeClaimList struct {
+	Items []PersistentVolumeClaim `json:"items"`
+}
+
+func AllPersistentVolumeClaimsPath() string {
+	return "/api/v1/persistentvolumeclaims"
+}
+
+func PersistentVolumeClaimsPath(namespace string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/persistentvolumeclaims", namespace)
+}
+
+type PersistentVolumeClaimSpec struct {
+	StorageClassName *string              `json:"storageClassName,omitempty"`
+	Resources        ResourceRequirements `json:"resources,omitempty"`
+	VolumeName       string               `json:"volumeName,omitempty"`
+}
+
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type PersistentVolume struct {
+	Metadata ObjectMeta           `json:"metadata"`
+	Spec     PersistentVolumeSpec `json:"spec"`
+}
+
+func PersistentVolumePath(name string) string {
+	return fmt.Sprintf("/api/v1/persistentvolumes/%s", name)
+}
+
+type PersistentVolumeSpec struct {
+	ClaimRef                      *ObjectReference           `json:"claimRef,omitempty"`
+	CSI                           *CSIPersistentVolumeSource `json:"csi,omitempty"`
+	PersistentVolumeReclaimPolicy string                     `json:"persistentVolumeReclaimPolicy,omitempty"`
+	// nodes the volume can be used on, only its presence is read
+	NodeAffinity *json.RawMessage `json:"nodeAffinity,omitempty"`
+}
+
+type CSIPersistentVolumeSource struct {
+	Driver           string            `json:"driver"`
+	VolumeHandle     string            `json:"volumeHandle"`
+	VolumeAttributes map[string]string `json:"volumeAttributes,omitempty"`
+}
+
+type PersistentVolumeList struct {
+	Items []PersistentVolume `json:"items"`
+}
+
+func PersistentVolumesPath() string {
+	return "/api/v1/persistentvolumes"
+}
+
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+	UID        string `json:"uid,omitempty"`
+}
+
+type Node struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     NodeSpec   `json:"spec"`
+	Status   NodeStatus `json:"status"`
+}
+
+func NodePath(name string) string {
+	return fmt.Sprintf("/api/v1/nodes/%s", name)
+}
+
+type NodeList struct {
+	Items []Node `json:"items"`
+}
+
+func NodesPath() string {
+	return "/api/v1/nodes"
+}
+
+type NodeSpec struct {
+	ProviderID    string `json:"providerID,omitempty"`
+	Unschedulable bool   `json:"unschedulable,omitempty"`
+}
+
+// Pod is the subset of a pod used by the driver.
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+	Status   PodStatus  `json:"status"`
+}
+
+type PodList struct {
+	Items []Pod `json:"items"`
+}
+
+// PendingPodsPath returns the path of the pods of all namespaces which are not running yet.
+func PendingPodsPath() string {
+	return "/api/v1/pods?fieldSelector=" + url.QueryEscape("status.phase=Pending")
+}
+
+type PodSpec struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Volumes      []PodVolume       `json:"volumes,omitempty"`
+}
+
+type PodVolume struct {
+	Name                  string                             `json:"name"`
+	PersistentVolumeClaim *PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+}
+
+type PersistentVolumeClaimVolumeSource struct {
+	ClaimName string `json:"claimName"`
+}
+
+type PodStatus struct {
+	Phase      string         `json:"phase,omitempty"`
+	Conditions []PodCondition `json:"conditions,omitempty"`
+}
+
+const (
+	PodScheduled           = "PodScheduled"
+	PodReasonUnschedulable = "Unschedulable"
+	ConditionStatusFalse   = "False"
+)
+
+type PodCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type NodeStatus struct {
+	Addresses []NodeAddress `json:"addresses,omitempty"`
+}
+
+type NodeAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
+
+type Event struct {
+	Metadata       ObjectMeta      `json:"metadata"`
+	InvolvedObject ObjectReference `json:"involvedObject"`
+	Reason         string          `json:"reason,omitempty"`
+	Message        string          `json:"message,omitempty"`
+	Type           string          `json:"type,omitempty"`
+	Source         EventSource     `json:"source,omitempty"`
+	FirstTimestamp string          `json:"firstTimestamp,omitempty"`
+	LastTimestamp  string          `json:"lastTimestamp,omitempty"`
+	Count          int32           `json:"count,omitempty"`
+}
+
+func EventsPath(namespace string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/events", namespace)
+}
+
+type EventSource struct {
+	Component string `json:"component,omitempty"`
+	Host      string `json:"host,omitempty"`
+}
+
+// MicroTime is a timestamp with microsecond precision as used by leases.
+type MicroTime struct {
+	time.Time
+}
+
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+func NewMicroTime(t time.Time) MicroTime {
+	return MicroTime{t.UTC()}
+}
+
+func (t MicroTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(microTimeFormat))
+}
+
+func (t *MicroTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(microTimeFormat, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+type Lease struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     LeaseSpec  `json:"spec"`
+}
+
+func LeasesPath(namespace string) string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", namespace)
+}
+
+func LeasePath(namespace, name string) string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", namespace, name)
+}
+
+type LeaseSpec struct {
+	HolderIdentity       *string    `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32     `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *MicroTime `json:"renewTime,omitempty"`
+}
+
+type VolumeAttachment struct {
+	Metadata ObjectMeta           `json:"metadata"`
+	Spec     VolumeAttachmentSpec `json:"spec"`
+}
+
+type VolumeAttachmentList struct {
+	Items []VolumeAttachment `json:"items"`
+}
+
+func VolumeAttachmentsPath() string {
+	return "/apis/storage.k8s.io/v1/volumeattachments"
+}
+
+func VolumeAttachmentPath(name string) string {
+	return fmt.Sprintf("/apis/storage.k8s.io/v1/volumeattachments/%s", name)
+}
+
+type VolumeAttachmentSpec struct {
+	Attacher string                 `json:"attacher"`
+	NodeName string                 `json:"nodeName"`
+	Source   VolumeAttachmentSource `json:"source"`
+}
+
+type VolumeAttachmentSource struct {
+	PersistentVolumeName *string `json:"persistentVolumeName,omitempty"`
+}
+
+// api version of the custom resources of the cbs driver
+const CustomResourceAPIVersion = "cbs.csi.cloud.tencent.com/v1alpha1"
+
+// DiskInfo is the custom resource holding the cloud state of the disk of a persistent volume, it is
+// named after the persistent volume and lives in the namespace of its claim.
+type DiskInfo struct {
+	APIVersion string         `json:"apiVersion,omitempty"`
+	Kind       string         `json:"kind,omitempty"`
+	Metadata   ObjectMeta     `json:"metadata"`
+	Status     DiskInfoStatus `json:"status"`
+}
+
+type DiskInfoList struct {
+	Items []DiskInfo `json:"items"`
+}
+
+// AllDiskInfosPath lists the disk infos of all namespaces.
+func AllDiskInfosPath() string {
+	return "/apis/" + CustomResourceAPIVersion + "/diskinfos"
+}
+
+func DiskInfosPath(namespace string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/diskinfos", CustomResourceAPIVersion, namespace)
+}
+
+func DiskInfoPath(namespace, name string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/diskinfos/%s", CustomResourceAPIVersion, namespace, name)
+}
+
+type DiskInfoStatus struct {
+	VolumeId              string            `json:"volumeId"`
+	PersistentVolumeClaim string            `json:"persistentVolumeClaim,omitempty"`
+	DiskName              string            `json:"diskName,omitempty"`
+	DiskType              string            `json:"diskType,omitempty"`
+	DiskSizeGB            uint64            `json:"diskSizeGB,omitempty"`
+	Zone                  string            `json:"zone,omitempty"`
+	ChargeType            string            `json:"chargeType,omitempty"`
+	ExpireTime            string            `json:"expireTime,omitempty"`
+	RenewFlag             string            `json:"renewFlag,omitempty"`
+	State                 string            `json:"state,omitempty"`
+	Attached              bool              `json:"attached"`
+	InstanceId            string            `json:"instanceId,omitempty"`
+	Encrypted             bool              `json:"encrypted,omitempty"`
+	Tags                  map[string]string `json:"tags,omitempty"`
+	Error                 string            `json:"error,omitempty"`
+}
+
+// VolumeSnapshotSchedule is the custom resource selecting persistent volume claims of its namespace
+// which are snapshotted on a cron schedule.
+type VolumeSnapshotSchedule struct {
+	APIVersion string                       `json:"apiVersion,omitempty"`
+	Kind       string                       `json:"kind,omitempty"`
+	Metadata   ObjectMeta                   `json:"metadata"`
+	Spec       VolumeSnapshotScheduleSpec   `json:"spec"`
+	Status     VolumeSnapshotScheduleStatus `json:"status,omitempty"`
+}
+
+type VolumeSnapshotScheduleList struct {
+	Items []VolumeSnapshotSchedule `json:"items"`
+}
+
+// AllVolumeSnapshotSchedulesPath lists the snapshot schedules of all namespaces.
+func AllVolumeSnapshotSchedulesPath() string {
+	return "/apis/" + CustomResourceAPIVersion + "/volumesnapshotschedules"
+}
+
+func VolumeSnapshotSchedulePath(namespace, name string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/volumesnapshotschedules/%s", CustomResourceAPIVersion, namespace, name)
+}
+
+type VolumeSnapshotScheduleSpec struct {
+	// cron expression, e.g. "0 3 * * *"
+	Schedule string `json:"schedule"`
+	// claims with all these labels are snapshotted, all claims of the driver if empty
+	Selector map[string]string `json:"selector,omitempty"`
+	// snapshots of a claim kept by the schedule, older ones are deleted
+	Retention int `json:"retention,omitempty"`
+	// snapshots older than this duration, e.g. "720h", are deleted
+	MaxAge string `json:"maxAge,omitempty"`
+	// regions the snapshots are copied to once they are ready, e.g. for disaster recovery
+	CopyToRegions []string `json:"copyToRegions,omitempty"`
+	// export the snapshots to a cos bucket once they are ready, for long term archives
+	ExportToCos *SnapshotExportSpec `json:"exportToCos,omitempty"`
+	// freeze the filesystems of the claims on their nodes while they are snapshotted
+	FsFreeze bool `json:"fsFreeze,omitempty"`
+	// daily time ranges in UTC, e.g. "22:00-04:00", runs due outside them wait for the next one
+	Windows []string `json:"windows,omitempty"`
+	// duration, e.g. "30m", the snapshots of a run are spread over by claim
+	Stagger string `json:"stagger,omitempty"`
+	Suspend bool   `json:"suspend,omitempty"`
+}
+
+type VolumeSnapshotScheduleStatus struct {
+	// RFC 3339
+	LastScheduleTime string              `json:"lastScheduleTime,omitempty"`
+	LastSnapshots    []ScheduledSnapshot `json:"lastSnapshots,omitempty"`
+	// copies of the snapshots of all runs in other regions, deleted once their snapshot is deleted
+	CopiedSnapshots []CopiedSnapshot `json:"copiedSnapshots,omitempty"`
+	// snapshots of earlier runs whose export was still in progress when the next run started
+	PendingExports []ScheduledSnapshot `json:"pendingExports,omitempty"`
+	// RFC 3339, end of the staggered run in progress
+	StaggeredUntil string `json:"staggeredUntil,omitempty"`
+}
+
+type ScheduledSnapshot struct {
+	PersistentVolumeClaim string `json:"persistentVolumeClaim"`
+	VolumeId              string `json:"volumeId,omitempty"`
+	SnapshotId            string `json:"snapshotId,omitempty"`
+	Error                 string `json:"error,omitempty"`
+	// copies in the regions of copyToRegions
+	Copies []SnapshotCopy  `json:"copies,omitempty"`
+	Export *SnapshotExport `json:"export,omitempty"`
+}
+
+type SnapshotExportSpec struct {
+	// name of the bucket with its appid, e.g. archive-1250000000
+	Bucket string `json:"bucket"`
+	// the objects are named prefix<namespace>/<schedule>/<snapshot>, lifecycle rules of the bucket
+	// can filter on it
+	Prefix string `json:"prefix,omitempty"`
+	// RAW, QCOW2, VHD or VMDK, RAW if empty
+	Format string `json:"format,omitempty"`
+	// set on the exported objects, lifecycle rules of the bucket can filter on them
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// phases of a SnapshotExport, it is in progress while empty
+const (
+	SnapshotExportExported = "Exported"
+	SnapshotExportFailed   = "Failed"
+)
+
+type SnapshotExport struct {
+	Phase string `json:"phase,omitempty"`
+	// image the snapshot is exported through, deleted once the export ended
+	ImageId string `json:"imageId,omitempty"`
+	// export task of the image
+	TaskId string `json:"taskId,omitempty"`
+	// RFC 3339, when the export task was started
+	StartTime string `json:"startTime,omitempty"`
+	// objects the disks of the image are exported to
+	Objects []string `json:"objects,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type SnapshotCopy struct {
+	Region     string `json:"region"`
+	SnapshotId string `json:"snapshotId,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type CopiedSnapshot struct {
+	// snapshot in the region of the controller the copy was made of
+	SourceSnapshotId string `json:"sourceSnapshotId"`
+	Region           string `json:"region"`
+	SnapshotId       string `json:"snapshotId"`
+}
+
+// VolumeFreeze is the custom resource asking the node plugin of the instance a disk is attached
+// to to freeze the filesystem of the disk, it is thawed when the resource is deleted.
+type VolumeFreeze struct {
+	APIVersion string             `json:"apiVersion,omitempty"`
+	Kind       string             `json:"kind,omitempty"`
+	Metadata   ObjectMeta         `json:"metadata"`
+	Spec       VolumeFreezeSpec   `json:"spec"`
+	Status     VolumeFreezeStatus `json:"status,omitempty"`
+}
+
+type VolumeFreezeList struct {
+	Metadata ListMeta       `json:"metadata"`
+	Items    []VolumeFreeze `json:"items"`
+}
+
+// label with the instance id of a VolumeFreeze, so each node lists only its own
+const VolumeFreezeInstanceLabel = "cbs.csi.cloud.tencent.com/instance-id"
+
+func VolumeFreezesPath(namespace string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/volumefreezes", CustomResourceAPIVersion, namespace)
+}
+
+// InstanceVolumeFreezesPath lists the volume freezes of instanceId.
+func InstanceVolumeFreezesPath(namespace, instanceId string) string {
+	return VolumeFreezesPath(namespace) + "?labelSelector=" + url.QueryEscape(VolumeFreezeInstanceLabel+"="+instanceId)
+}
+
+func VolumeFreezePath(namespace, name string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/volumefreezes/%s", CustomResourceAPIVersion, namespace, name)
+}
+
+type VolumeFreezeSpec struct {
+	VolumeId   string `json:"volumeId"`
+	InstanceId string `json:"instanceId"`
+}
+
+// phases of a VolumeFreeze set by the node
+const (
+	VolumeFreezeFrozen = "Frozen"
+	VolumeFreezeThawed = "Thawed"
+	VolumeFreezeFailed = "Failed"
+)
+
+type VolumeFreezeStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+	// RFC 3339
+	FrozenTime string `json:"frozenTime,omitempty"`
+}
+
+// VolumeRollback is the custom resource rolling the disk of a persistent volume claim of its
+// namespace back to a snapshot of the disk in place.
+type VolumeRollback struct {
+	APIVersion string               `json:"apiVersion,omitempty"`
+	Kind       string               `json:"kind,omitempty"`
+	Metadata   ObjectMeta           `json:"metadata"`
+	Spec       VolumeRollbackSpec   `json:"spec"`
+	Status     VolumeRollbackStatus `json:"status,omitempty"`
+}
+
+type VolumeRollbackList struct {
+	Items []VolumeRollback `json:"items"`
+}
+
+// AllVolumeRollbacksPath lists the volume rollbacks of all namespaces.
+func AllVolumeRollbacksPath() string {
+	return "/apis/" + CustomResourceAPIVersion + "/volumerollbacks"
+}
+
+func VolumeRollbackPath(namespace, name string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/volumerollbacks/%s", CustomResourceAPIVersion, namespace, name)
+}
+
+type VolumeRollbackSpec struct {
+	PersistentVolumeClaim string `json:"persistentVolumeClaim"`
+	SnapshotId            string `json:"snapshotId"`
+}
+
+// phases of a VolumeRollback
+const (
+	VolumeRollbackPending     = "Pending"
+	VolumeRollbackDetaching   = "Detaching"
+	VolumeRollbackRollingBack = "RollingBack"
+	VolumeRollbackSucceeded   = "Succeeded"
+	VolumeRollbackFailed      = "Failed"
+)
+
+type VolumeRollbackStatus struct {
+	Phase    string `json:"phase,omitempty"`
+	Message  string `json:"message,omitempty"`
+	VolumeId string `json:"volumeId,omitempty"`
+	// RFC 3339
+	StartTime      string `json:"startTime,omitempty"`
+	CompletionTime string `json:"completionTime,omitempty"`
+}
+
+// VolumeSnapshotContent is the subset of a snapshot.storage.k8s.io/v1alpha1 volume snapshot content
+// used by the driver.
+type VolumeSnapshotContent struct {
+	Metadata ObjectMeta                `json:"metadata"`
+	Spec     VolumeSnapshotContentSpec `json:"spec"`
+}
+
+type VolumeSnapshotContentList struct {
+	Items []VolumeSnapshotContent `json:"items"`
+}
+
+func VolumeSnapshotContentsPath() string {
+	return "/apis/snapshot.storage.k8s.io/v1alpha1/volumesnapshotcontents"
+}
+
+type VolumeSnapshotContentSpec struct {
+	CSI               *CSIVolumeSnapshotSource `json:"csiVolumeSnapshotSource,omitempty"`
+	VolumeSnapshotRef *ObjectReference         `json:"volumeSnapshotRef,omitempty"`
+}
+
+type CSIVolumeSnapshotSource struct {
+	Driver         string `json:"driver"`
+	SnapshotHandle string `json:"snapshotHandle"`
+}
+
+type StorageClass struct {
+	Metadata    ObjectMeta        `json:"metadata"`
+	Provisioner string            `json:"provisioner"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+}
+
+func StorageClassPath(name string) string {
+	return fmt.Sprintf("/apis/storage.k8s.io/v1/storageclasses/%s", name)
+}
+
+// VolumeSnapshotClass is the subset of a snapshot.storage.k8s.io/v1alpha1 volume snapshot class
+// used by the driver.
+type VolumeSnapshotClass struct {
+	Metadata    ObjectMeta        `json:"metadata"`
+	Snapshotter string            `json:"snapshotter"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+}
+
+// AdmissionReview is the admission.k8s.io/v1 request and response sent to admission webhooks.
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+type AdmissionRequest struct {
+	UID       string           `json:"uid"`
+	Kind      GroupVersionKind `json:"kind"`
+	Operation string           `json:"operation"`
+	Object    json.RawMessage  `json:"object,omitempty"`
+}
+
+type GroupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+type AdmissionResponse struct {
+	UID     string  `json:"uid"`
+	Allowed bool    `json:"allowed"`
+	Result  *Status `json:"status,omitempty"`
+}
+
+type Status struct {
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int32  `json:"code,omitempty"`
+}
@@ -0,0 +1,168 @@
+// Package logging logs through github.com/golang/glog, whose flags and verbosity it uses, or writes the
+// entries to stderr as json lines, so logs can be ingested by log services such as CLS or ELK. Every
+// json entry has the time, level, caller and message, plus the csi request id and the cbs disk id
+// when the message contains them.
+//
+// The drivers log through this package instead of glog, so an entry is encoded as a whole when it
+// is logged. Vendored packages which log through glog directly keep its text format.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	// request id logged by the csi rpc interceptor, e.g. [2f6b0c1d9e8a7b6c]
+	requestIdPattern = regexp.MustCompile(`^\[([0-9a-zA-Z-]+)\] `)
+
+	volumeIdPattern = regexp.MustCompile(`\bdisk-[0-9a-z]{8}\b`)
+
+	mutex sync.Mutex
+	// json entries are written to output, nil while logging through glog
+	output io.Writer
+)
+
+// Level is the verbosity of V, set with the -v flag of glog.
+type Level = glog.Level
+
+type entry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Caller    string `json:"caller,omitempty"`
+	Message   string `json:"msg"`
+	RequestId string `json:"request_id,omitempty"`
+	VolumeId  string `json:"volume_id,omitempty"`
+	Stack     string `json:"stack,omitempty"`
+}
+
+// SetFormat makes the following entries be logged in format, text or json.
+func SetFormat(format string) error {
+	switch format {
+	case FormatText:
+		setOutput(nil)
+	case FormatJSON:
+		setOutput(os.Stderr)
+	default:
+		return fmt.Errorf("log format %s not supported, use %s or %s", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+func setOutput(w io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	output = w
+}
+
+// logJSON writes message as a json entry if json output is enabled, it returns false otherwise.
+// depth is the number of frames between the caller of the package and logJSON.
+func logJSON(depth int, level, message string, stack []byte) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if output == nil {
+		return false
+	}
+
+	e := &entry{Time: time.Now().Format(time.RFC3339Nano), Level: level, Message: message, Stack: string(stack)}
+	if _, file, line, ok := runtime.Caller(depth + 1); ok {
+		e.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	if m := requestIdPattern.FindStringSubmatch(message); m != nil {
+		e.RequestId = m[1]
+	}
+	e.VolumeId = volumeIdPattern.FindString(message)
+
+	json.NewEncoder(output).Encode(e)
+	return true
+}
+
+// Verbose is true if the verbosity passed to V is enabled.
+type Verbose bool
+
+// V reports whether verbosity level is enabled, e.g. logging.V(4).Infof(...) only logs with -v=4 or higher.
+func V(level Level) Verbose {
+	return Verbose(glog.V(level))
+}
+
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v {
+		info(2, fmt.Sprintf(format, args...))
+	}
+}
+
+func Info(args ...interface{}) {
+	info(2, fmt.Sprint(args...))
+}
+
+func Infof(format string, args ...interface{}) {
+	info(2, fmt.Sprintf(format, args...))
+}
+
+func info(depth int, message string) {
+	if !logJSON(depth, "info", message, nil) {
+		glog.InfoDepth(depth, message)
+	}
+}
+
+func Warningf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if !logJSON(1, "warning", message, nil) {
+		glog.WarningDepth(1, message)
+	}
+}
+
+func Error(args ...interface{}) {
+	message := fmt.Sprint(args...)
+	if !logJSON(1, "error", message, nil) {
+		glog.ErrorDepth(1, message)
+	}
+}
+
+func Errorf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if !logJSON(1, "error", message, nil) {
+		glog.ErrorDepth(1, message)
+	}
+}
+
+// Fatal logs args and the stack of the calling goroutine, then exits with status 255 like glog.
+func Fatal(args ...interface{}) {
+	fatal(fmt.Sprint(args...))
+}
+
+func Fatalf(format string, args ...interface{}) {
+	fatal(fmt.Sprintf(format, args...))
+}
+
+func fatal(message string) {
+	stack := make([]byte, 64*1024)
+	stack = stack[:runtime.Stack(stack, false)]
+	if !logJSON(2, "fatal", strings.TrimRight(message, "\n"), stack) {
+		glog.FatalDepth(2, message)
+	}
+	glog.Flush()
+	os.Exit(255)
+}
+
+// Flush flushes the entries glog buffers for its log files, json entries are not buffered.
+func Flush() {
+	glog.Flush()
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSetFormat(t *testing.T) {
+	defer setOutput(nil)
+
+	for _, format := range []string{FormatText, FormatJSON} {
+		if err := SetFormat(format); err != nil {
+			t.Errorf("SetFormat(%q) err: %v", format, err)
+		}
+	}
+	if err := SetFormat("xml"); err == nil {
+		t.Error("SetFormat accepted xml")
+	}
+}
+
+func TestJSONEntry(t *testing.T) {
+	tests := []struct {
+		name          string
+		log           func()
+		wantLevel     string
+		wantMessage   string
+		wantRequestId string
+		wantVolumeId  string
+	}{
+		{
+			name:          "request",
+			log:           func() { Infof("[%s] attach %s to %s", "2f6b0c1d9e8a7b6c", "disk-1a2b3c4d", "ins-1") },
+			wantLevel:     "info",
+			wantMessage:   "[2f6b0c1d9e8a7b6c] attach disk-1a2b3c4d to ins-1",
+			wantRequestId: "2f6b0c1d9e8a7b6c",
+			wantVolumeId:  "disk-1a2b3c4d",
+		},
+		{
+			name:        "multi line",
+			log:         func() { Warningf("mount failed, output:\n%s", "line 1\nline 2") },
+			wantLevel:   "warning",
+			wantMessage: "mount failed, output:\nline 1\nline 2",
+		},
+		{
+			name:        "error",
+			log:         func() { Error("quota ", 10, " exceeded") },
+			wantLevel:   "error",
+			wantMessage: "quota 10 exceeded",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			setOutput(&buf)
+			defer setOutput(nil)
+
+			test.log()
+
+			lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("logged %d lines, want one json entry: %q", len(lines), buf.String())
+			}
+			var got entry
+			if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+				t.Fatalf("entry %q not json: %v", lines[0], err)
+			}
+			if got.Level != test.wantLevel || got.Message != test.wantMessage {
+				t.Errorf("level %q msg %q, want %q %q", got.Level, got.Message, test.wantLevel, test.wantMessage)
+			}
+			if got.RequestId != test.wantRequestId || got.VolumeId != test.wantVolumeId {
+				t.Errorf("request id %q volume id %q, want %q %q", got.RequestId, got.VolumeId, test.wantRequestId, test.wantVolumeId)
+			}
+			if !strings.HasPrefix(got.Caller, "logging_test.go:") {
+				t.Errorf("caller %q, want the test file", got.Caller)
+			}
+			if got.Time == "" {
+				t.Error("entry without time")
+			}
+		})
+	}
+}
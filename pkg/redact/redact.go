@@ -0,0 +1,111 @@
+// Package redact masks credentials in log lines and error messages so that verbose
+// logging can be enabled safely.
+package redact
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+)
+
+const mask = "***"
+
+var (
+	// credentials which appear in tencent cloud sdk request dumps and errors
+	patterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)((?:secret_?id|secret_?key|token|signature)["']?\s*[=:]\s*["']?)[^&"',\s]+`),
+		regexp.MustCompile(`AKID[0-9A-Za-z]{16,}`),
+	}
+
+	secretsMutex sync.RWMutex
+	secrets      []string
+)
+
+// AddSecret registers a literal value, e.g. the configured secret key, which is masked wherever it appears.
+func AddSecret(secret string) {
+	if len(secret) < 4 {
+		return
+	}
+
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	secrets = append(secrets, secret)
+}
+
+// String masks all known secrets and credential looking values in s.
+func String(s string) string {
+	secretsMutex.RLock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, mask, -1)
+	}
+	secretsMutex.RUnlock()
+
+	for _, p := range patterns {
+		if p.NumSubexp() > 0 {
+			s = p.ReplaceAllString(s, "${1}"+mask)
+		} else {
+			s = p.ReplaceAllString(s, mask)
+		}
+	}
+	return s
+}
+
+// Message returns a copy of a csi request or response with all secrets fields masked,
+// other values are returned as is.
+func Message(msg interface{}) interface{} {
+	pb, ok := msg.(proto.Message)
+	if !ok || pb == nil || reflect.ValueOf(pb).IsNil() {
+		return msg
+	}
+
+	clone := proto.Clone(pb)
+	stripSecrets(reflect.ValueOf(clone))
+	return clone
+}
+
+func stripSecrets(v reflect.Value) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		name := t.Field(i).Name
+		switch {
+		case strings.HasSuffix(name, "Secrets") && field.Kind() == reflect.Map:
+			for _, k := range field.MapKeys() {
+				field.SetMapIndex(k, reflect.ValueOf(mask))
+			}
+		case field.Kind() == reflect.Ptr:
+			stripSecrets(field)
+		}
+	}
+}
+
+// LogWriter is an io.Writer which masks secrets and writes to glog at verbosity v, it is
+// used as the output of the standard logger which the tencent cloud sdk writes request dumps to.
+type LogWriter struct {
+	V logging.Level
+}
+
+func (w LogWriter) Write(p []byte) (int, error) {
+	if logging.V(w.V) {
+		logging.Info(String(strings.TrimRight(string(p), "\n")))
+	}
+	return len(p), nil
+}
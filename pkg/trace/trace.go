@@ -0,0 +1,258 @@
+// Package trace records spans of csi rpcs and cloud api calls and exports them to an
+// OpenTelemetry collector with OTLP over http in json encoding. It is disabled until Init is
+// called, spans started before are nil and all their methods are no-ops.
+package trace
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tencentcloud/kubernetes-csi-tencentcloud/pkg/logging"
+	"golang.org/x/net/context"
+)
+
+// Kind is the otlp span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+
+	statusCodeOk    = 1
+	statusCodeError = 2
+
+	tracesPath = "/v1/traces"
+
+	batchSize     = 256
+	queueSize     = 4096
+	flushInterval = time.Second * 5
+)
+
+type spanKey struct{}
+
+// Span is a timed operation, it belongs to the trace of its parent span.
+type Span struct {
+	traceId      string
+	spanId       string
+	parentSpanId string
+	name         string
+	kind         Kind
+	start        time.Time
+
+	mutex      sync.Mutex
+	attributes map[string]string
+}
+
+// exporter is only written by Init, which must be called before spans are started by other
+// goroutines, so it needs no lock.
+var exporter *otlpExporter
+
+// Init starts exporting spans to the otlp http endpoint, e.g. http://otel-collector:4318. It must
+// be called once, before any goroutine which starts spans.
+func Init(endpoint, serviceName string) {
+	exporter = newExporter(endpoint, serviceName)
+	go exporter.run()
+}
+
+func newExporter(endpoint, serviceName string) *otlpExporter {
+	return &otlpExporter{
+		url:         strings.TrimSuffix(endpoint, "/") + tracesPath,
+		serviceName: serviceName,
+		spans:       make(chan *otlpSpan, queueSize),
+		client:      &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func randomId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Start starts a span named name, a child of the span in ctx if there is one.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		spanId:     randomId(8),
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: map[string]string{},
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceId = parent.traceId
+		span.parentSpanId = parent.spanId
+	} else {
+		span.traceId = randomId(16)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx holding span, spans started with it become children of span.
+// It carries a span over to a context with another deadline.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attributes[key] = value
+}
+
+// End finishes the span, err marks it failed.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	span := &otlpSpan{
+		TraceId:           s.traceId,
+		SpanId:            s.spanId,
+		ParentSpanId:      s.parentSpanId,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Status:            otlpStatus{Code: statusCodeOk},
+	}
+	for k, v := range s.attributes {
+		span.Attributes = append(span.Attributes, newAttribute(k, v))
+	}
+	if err != nil {
+		span.Status = otlpStatus{Code: statusCodeError, Message: err.Error()}
+	}
+
+	select {
+	case exporter.spans <- span:
+	default:
+		logging.V(4).Infof("trace queue full, dropping span %s", s.name)
+	}
+}
+
+// otlp json encoding, see opentelemetry-proto/opentelemetry/proto/trace/v1/trace.proto
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func newAttribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpExporter struct {
+	url         string
+	serviceName string
+	spans       chan *otlpSpan
+	client      *http.Client
+}
+
+func (e *otlpExporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*otlpSpan
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := e.export(batch); err != nil {
+			logging.Warningf("export %d spans err: %v", len(batch), err)
+		}
+		batch = nil
+	}
+}
+
+func (e *otlpExporter) export(spans []*otlpSpan) error {
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{newAttribute("service.name", e.serviceName)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/tencentcloud/kubernetes-csi-tencentcloud"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector %s returned %s", e.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// withExporter sets the exporter and returns a func restoring the previous one.
+func withExporter(e *otlpExporter) func() {
+	old := exporter
+	exporter = e
+	return func() { exporter = old }
+}
+
+func TestStartDisabled(t *testing.T) {
+	defer withExporter(nil)()
+
+	ctx, span := Start(context.Background(), "op", KindServer)
+	if span != nil {
+		t.Fatalf("Start without Init returned span %+v", span)
+	}
+	if FromContext(ctx) != nil {
+		t.Fatal("Start without Init put a span into the context")
+	}
+	// methods of nil spans are no-ops
+	span.SetAttribute("k", "v")
+	span.End(errors.New("failed"))
+}
+
+func TestStartChild(t *testing.T) {
+	defer withExporter(newExporter("http://collector:4318", "test"))()
+
+	ctx, parent := Start(context.Background(), "parent", KindServer)
+	_, child := Start(ctx, "child", KindClient)
+
+	if len(parent.traceId) != 32 || len(parent.spanId) != 16 {
+		t.Errorf("parent ids %q %q, want 32 and 16 hex digits", parent.traceId, parent.spanId)
+	}
+	if parent.parentSpanId != "" {
+		t.Errorf("root span has parent %q", parent.parentSpanId)
+	}
+	if child.traceId != parent.traceId {
+		t.Errorf("child trace %q, want the parent trace %q", child.traceId, parent.traceId)
+	}
+	if child.parentSpanId != parent.spanId {
+		t.Errorf("child parent %q, want %q", child.parentSpanId, parent.spanId)
+	}
+	if child.spanId == parent.spanId {
+		t.Error("child has the span id of its parent")
+	}
+}
+
+func TestContextWithSpan(t *testing.T) {
+	defer withExporter(newExporter("http://collector:4318", "test"))()
+
+	_, span := Start(context.Background(), "op", KindServer)
+	ctx := ContextWithSpan(context.Background(), span)
+	if FromContext(ctx) != span {
+		t.Error("span not carried over to the new context")
+	}
+	if ctx := ContextWithSpan(context.Background(), nil); FromContext(ctx) != nil {
+		t.Error("nil span put into the context")
+	}
+}
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   int
+		wantStatus string
+	}{
+		{"ok", nil, statusCodeOk, ""},
+		{"error", errors.New("disk not found"), statusCodeError, "disk not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newExporter("http://collector:4318/", "test")
+			defer withExporter(e)()
+
+			_, span := Start(context.Background(), "op", KindClient)
+			span.SetAttribute("disk_id", "disk-1")
+			span.End(test.err)
+
+			var got *otlpSpan
+			select {
+			case got = <-e.spans:
+			default:
+				t.Fatal("End did not queue the span")
+			}
+			if got.Name != "op" || got.Kind != KindClient || got.TraceId != span.traceId || got.SpanId != span.spanId {
+				t.Errorf("span %+v does not match %+v", got, span)
+			}
+			if got.Status.Code != test.wantCode || got.Status.Message != test.wantStatus {
+				t.Errorf("status %+v, want code %d message %q", got.Status, test.wantCode, test.wantStatus)
+			}
+			if len(got.Attributes) != 1 || got.Attributes[0].Key != "disk_id" || got.Attributes[0].Value.StringValue != "disk-1" {
+				t.Errorf("attributes %+v, want disk_id=disk-1", got.Attributes)
+			}
+		})
+	}
+}
+
+func TestEndQueueFull(t *testing.T) {
+	e := newExporter("http://collector:4318", "test")
+	e.spans = make(chan *otlpSpan)
+	defer withExporter(e)()
+
+	_, span := Start(context.Background(), "op", KindInternal)
+	// must not block when the queue is full
+	span.End(nil)
+}
+
+func TestExport(t *testing.T) {
+	var body map[string]interface{}
+	var path, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		data, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("request body not json: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	e := newExporter(server.URL+"/", "csi-test")
+	span := &otlpSpan{TraceId: "t", SpanId: "s", Name: "op", Kind: KindServer, Status: otlpStatus{Code: statusCodeOk}}
+	if err := e.export([]*otlpSpan{span}); err != nil {
+		t.Fatalf("export err: %v", err)
+	}
+
+	if path != tracesPath {
+		t.Errorf("posted to %q, want %q", path, tracesPath)
+	}
+	if contentType != "application/json" {
+		t.Errorf("content type %q, want application/json", contentType)
+	}
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	attribute := resourceSpans["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if attribute["key"] != "service.name" || attribute["value"].(map[string]interface{})["stringValue"] != "csi-test" {
+		t.Errorf("resource attribute %v, want service.name=csi-test", attribute)
+	}
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 1 || spans[0].(map[string]interface{})["name"] != "op" {
+		t.Errorf("spans %v, want the span op", spans)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if err := newExporter(server.URL, "test").export(nil); err == nil {
+		t.Error("export succeeded although the collector failed")
+	}
+}
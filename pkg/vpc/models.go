@@ -0,0 +1,65 @@
+// Package vpc contains the subset of the vpc api used by the drivers, in the layout of the
+// tencentcloud-sdk-go generated packages. Requests are sent through any sdk client, since the
+// service and version are carried by the request.
+package vpc
+
+import (
+	"encoding/json"
+
+	tchttp "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/http"
+)
+
+const APIVersion = "2017-03-12"
+
+type Vpc struct {
+	VpcId     *string `json:"VpcId" name:"VpcId"`
+	VpcName   *string `json:"VpcName" name:"VpcName"`
+	CidrBlock *string `json:"CidrBlock" name:"CidrBlock"`
+}
+
+func NewDescribeVpcsRequest() (request *DescribeVpcsRequest) {
+	request = &DescribeVpcsRequest{
+		BaseRequest: &tchttp.BaseRequest{},
+	}
+	request.Init().WithApiInfo("vpc", APIVersion, "DescribeVpcs")
+	return
+}
+
+func NewDescribeVpcsResponse() (response *DescribeVpcsResponse) {
+	response = &DescribeVpcsResponse{
+		BaseResponse: &tchttp.BaseResponse{},
+	}
+	return
+}
+
+type DescribeVpcsRequest struct {
+	*tchttp.BaseRequest
+	VpcIds []*string `json:"VpcIds" name:"VpcIds"`
+}
+
+func (r *DescribeVpcsRequest) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeVpcsRequest) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}
+
+type DescribeVpcsResponse struct {
+	*tchttp.BaseResponse
+	Response *struct {
+		TotalCount *uint64 `json:"TotalCount" name:"TotalCount"`
+		VpcSet     []*Vpc  `json:"VpcSet" name:"VpcSet"`
+		RequestId  *string `json:"RequestId" name:"RequestId"`
+	} `json:"Response"`
+}
+
+func (r *DescribeVpcsResponse) ToJsonString() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func (r *DescribeVpcsResponse) FromJsonString(s string) error {
+	return json.Unmarshal([]byte(s), &r)
+}